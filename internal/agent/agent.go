@@ -5,10 +5,15 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/erg0nix/kontekst/internal/conversation"
 	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/hook"
+	"github.com/erg0nix/kontekst/internal/provider"
 	"github.com/erg0nix/kontekst/internal/tool"
 )
 
@@ -18,6 +23,14 @@ type Agent struct {
 	tools    tool.ToolExecutor
 	context  ConversationWindow
 	config   RunConfig
+	hooks    *hook.Runner
+	plans    PlanStore
+	meta     SessionMetaStore
+	title    bool
+	loops    *loopDetector
+	started  time.Time
+	turns    int
+	usage    provider.Usage
 }
 
 // New creates an Agent with the given LLM provider, tool executor, context window, and run configuration.
@@ -48,6 +61,7 @@ func (a *Agent) Run(prompt string) (chan<- Command, <-chan Event) {
 func (a *Agent) loop(prompt string, commandChannel <-chan Command, eventChannel chan<- Event) {
 	runID := core.NewRunID()
 	eventChannel <- Event{Type: EvtRunStarted, RunID: runID}
+	a.loops = newLoopDetector(a.config.LoopDetection, a.config.WorkingDir)
 
 	systemContent := a.context.SystemContent()
 	systemTokens, err := a.provider.CountTokens(systemContent)
@@ -55,6 +69,15 @@ func (a *Agent) loop(prompt string, commandChannel <-chan Command, eventChannel
 		slog.Warn("failed to count system tokens", "error", err)
 	}
 
+	var memoryTokens int
+	if index := a.context.ProjectMemory(); index != "" {
+		memoryTokens, err = a.provider.CountTokens(index)
+		if err != nil {
+			slog.Warn("failed to count project memory tokens", "error", err)
+		}
+		systemTokens = max(systemTokens-memoryTokens, 0)
+	}
+
 	toolJSON, _ := json.Marshal(a.tools.ToolDefinitions())
 	toolTokens, err := a.provider.CountTokens(string(toolJSON))
 	if err != nil {
@@ -62,6 +85,17 @@ func (a *Agent) loop(prompt string, commandChannel <-chan Command, eventChannel
 	}
 
 	userMessage := prompt
+	if userMessage != "" && a.hooks.Has(hook.UserPromptSubmit) {
+		input := a.hookInput(hook.UserPromptSubmit, runID)
+		input.Prompt = userMessage
+		result := a.hooks.Run(context.Background(), input)
+		a.emitHookMessages(runID, result, eventChannel)
+
+		if result.AdditionalContext != "" {
+			userMessage = fmt.Sprintf("%s\n\n<hook-context>\n%s\n</hook-context>", userMessage, result.AdditionalContext)
+		}
+	}
+
 	var userPromptTokens int
 	if userMessage != "" {
 		userPromptTokens, err = a.provider.CountTokens(userMessage)
@@ -71,16 +105,32 @@ func (a *Agent) loop(prompt string, commandChannel <-chan Command, eventChannel
 	}
 
 	if err := a.context.StartRun(conversation.BudgetParams{
-		ContextSize:      a.config.ContextSize,
-		SystemContent:    systemContent,
-		SystemTokens:     systemTokens,
-		ToolTokens:       toolTokens,
-		UserPromptTokens: userPromptTokens,
+		ContextSize:         a.config.ContextSize,
+		SystemContent:       systemContent,
+		SystemTokens:        systemTokens,
+		ProjectMemoryTokens: memoryTokens,
+		ToolTokens:          toolTokens,
+		UserPromptTokens:    userPromptTokens,
+		ReplyTokens:         replyTokens(a.config.Sampling),
 	}); err != nil {
 		slog.Warn("failed to start context run", "error", err)
 	}
 	defer a.context.CompleteRun()
 
+	a.started = time.Now()
+	a.turns = 0
+	a.usage = provider.Usage{}
+	if recorder, ok := a.context.(RunRecorder); ok {
+		if err := recorder.RecordRunStart(conversation.RunStart{
+			RunID:     runID,
+			AgentName: a.config.AgentName,
+			Model:     a.config.ProviderModel,
+			Sampling:  a.config.Sampling,
+		}); err != nil {
+			slog.Warn("failed to record run start", "error", err)
+		}
+	}
+
 	if userMessage != "" {
 		if err := a.context.AddMessage(core.Message{Role: core.RoleUser, Content: userMessage, Tokens: userPromptTokens}); err != nil {
 			slog.Warn("failed to add user message", "error", err)
@@ -90,11 +140,12 @@ func (a *Agent) loop(prompt string, commandChannel <-chan Command, eventChannel
 	for {
 		contextMessages, err := a.context.BuildContext()
 		if err != nil {
-			eventChannel <- Event{Type: EvtRunFailed, RunID: runID, Error: err.Error()}
+			a.endRun(Event{Type: EvtRunFailed, RunID: runID, Error: err.Error()}, eventChannel)
 			return
 		}
 
 		chatResponse, err := a.provider.GenerateChat(
+			context.Background(),
 			contextMessages,
 			a.tools.ToolDefinitions(),
 			a.config.Sampling,
@@ -103,19 +154,23 @@ func (a *Agent) loop(prompt string, commandChannel <-chan Command, eventChannel
 		)
 
 		if err != nil {
-			eventChannel <- Event{Type: EvtRunFailed, RunID: runID, Error: err.Error()}
+			a.endRun(Event{Type: EvtRunFailed, RunID: runID, Error: err.Error()}, eventChannel)
 			return
 		}
+		a.turns++
 
 		completionTokens := 0
 		if chatResponse.Usage != nil {
 			completionTokens = chatResponse.Usage.CompletionTokens
+			a.usage.PromptTokens += chatResponse.Usage.PromptTokens
+			a.usage.CompletionTokens += chatResponse.Usage.CompletionTokens
 		}
 
 		if len(chatResponse.ToolCalls) == 0 {
 			if err := a.context.AddMessage(core.Message{
 				Role:      core.RoleAssistant,
 				Content:   chatResponse.Content,
+				Reasoning: chatResponse.Reasoning,
 				AgentName: a.config.AgentName,
 				Tokens:    completionTokens,
 			}); err != nil {
@@ -123,15 +178,19 @@ func (a *Agent) loop(prompt string, commandChannel <-chan Command, eventChannel
 			}
 			snapshot := a.context.Snapshot()
 			eventChannel <- Event{Type: EvtTurnCompleted, RunID: runID, Response: chatResponse, Snapshot: &snapshot}
-			eventChannel <- Event{Type: EvtRunCompleted, RunID: runID, Response: chatResponse}
+			a.titleRun(commandChannel, chatResponse.Content)
+			a.endRun(Event{Type: EvtRunCompleted, RunID: runID, Response: chatResponse}, eventChannel)
 			return
 		}
 
 		pendingToolCalls := buildPending(chatResponse.ToolCalls)
+		a.validateCalls(pendingToolCalls)
+		a.applyPreToolHooks(runID, pendingToolCalls, eventChannel)
 
 		assistantMessage := core.Message{
 			Role:      core.RoleAssistant,
 			Content:   chatResponse.Content,
+			Reasoning: chatResponse.Reasoning,
 			ToolCalls: pendingToolCalls.asToolCalls(),
 			AgentName: a.config.AgentName,
 			Tokens:    completionTokens,
@@ -145,21 +204,179 @@ func (a *Agent) loop(prompt string, commandChannel <-chan Command, eventChannel
 		previewCtx := tool.WithWorkingDir(context.Background(), a.config.WorkingDir)
 		proposedCalls := pendingToolCalls.asProposed(a.tools.Preview, previewCtx)
 
-		eventChannel <- Event{Type: EvtToolsProposed, RunID: runID, Calls: proposedCalls}
-		toolDecisions, err := collectApprovals(commandChannel, pendingToolCalls)
+		if len(proposedCalls) > 0 {
+			eventChannel <- Event{Type: EvtToolsProposed, RunID: runID, Calls: proposedCalls}
+		}
+		toolDecisions, err := collectApprovals(commandChannel, pendingToolCalls, a.editCall(runID, eventChannel))
 		if err != nil {
-			eventChannel <- Event{Type: EvtRunCancelled, RunID: runID}
+			a.endRun(Event{Type: EvtRunCancelled, RunID: runID}, eventChannel)
 			return
 		}
 
 		if err := a.executeTools(runID, toolDecisions, eventChannel); err != nil {
-			eventChannel <- Event{Type: EvtRunFailed, RunID: runID, Error: err.Error()}
+			a.endRun(Event{Type: EvtRunFailed, RunID: runID, Error: err.Error()}, eventChannel)
 			return
 		}
 
 		if anyWasDenied(toolDecisions) {
-			eventChannel <- Event{Type: EvtRunCompleted, RunID: runID}
+			a.endRun(Event{Type: EvtRunCompleted, RunID: runID}, eventChannel)
 			return
 		}
+
+		if finding := a.loops.check(); finding != "" {
+			if !a.loops.warn() {
+				a.endRun(Event{Type: EvtRunStopped, RunID: runID, Error: "loop detected: " + finding}, eventChannel)
+				return
+			}
+			a.injectLoopNote(runID, finding, eventChannel)
+		}
+	}
+}
+
+// replyTokens returns the max_tokens a completion request asks for.
+func replyTokens(sampling *core.SamplingConfig) int {
+	if sampling != nil && sampling.MaxTokens != nil {
+		return *sampling.MaxTokens
+	}
+	return provider.DefaultMaxTokens
+}
+
+// injectLoopNote adds a corrective note to the conversation the first time repetition is detected.
+func (a *Agent) injectLoopNote(runID core.RunID, finding string, eventChannel chan<- Event) {
+	note := loopNote(finding)
+	tokens, _ := a.provider.CountTokens(note)
+	if err := a.context.AddMessage(core.Message{Role: core.RoleUser, Content: note, Tokens: tokens}); err != nil {
+		slog.Warn("failed to add loop detection note", "error", err)
+	}
+	eventChannel <- Event{Type: EvtLoopDetected, RunID: runID, Output: finding}
+}
+
+// editCall returns an editFunc that validates user-edited arguments against the tool's schema and re-previews them.
+// Invalid arguments leave the call pending and re-propose it with the validation error.
+func (a *Agent) editCall(runID core.RunID, eventChannel chan<- Event) editFunc {
+	return func(call *pendingCall, args map[string]any) bool {
+		previewCtx := tool.WithWorkingDir(context.Background(), a.config.WorkingDir)
+
+		validated, err := a.tools.ValidateArguments(call.Name, args)
+		if err != nil {
+			proposed := call.asProposed(a.tools.Preview, previewCtx)
+			proposed.Error = err.Error()
+			eventChannel <- Event{Type: EvtToolsProposed, RunID: runID, Calls: []ProposedToolCall{proposed}}
+			return false
+		}
+
+		call.Args = validated
+		call.Edited = true
+		eventChannel <- Event{Type: EvtToolEdited, RunID: runID, Calls: []ProposedToolCall{call.asProposed(a.tools.Preview, previewCtx)}}
+		return true
+	}
+}
+
+// validateCalls coerces and validates each call's arguments against its tool schema.
+// Invalid calls are marked so they are returned to the model as errors instead of being proposed.
+func (a *Agent) validateCalls(batch *pendingBatch) {
+	for _, call := range batch.calls {
+		validated, err := a.tools.ValidateArguments(call.Name, call.Args)
+		if err != nil {
+			call.Approval = ApprovalInvalid
+			call.Reason = err.Error()
+			continue
+		}
+		call.Args = validated
+	}
+}
+
+// endRun records the end of the run, runs the run_end hooks and then emits the terminal event.
+func (a *Agent) endRun(event Event, eventChannel chan<- Event) {
+	if recorder, ok := a.context.(RunRecorder); ok {
+		if err := recorder.RecordRunEnd(conversation.RunEnd{
+			RunID:      event.RunID,
+			Outcome:    strings.TrimPrefix(string(event.Type), "run_"),
+			Turns:      a.turns,
+			DurationMS: time.Since(a.started).Milliseconds(),
+			Error:      event.Error,
+		}); err != nil {
+			slog.Warn("failed to record run end", "error", err)
+		}
+	}
+
+	if a.meta != nil {
+		if err := a.meta.AddUsage(a.config.SessionID, a.usage.PromptTokens, a.usage.CompletionTokens); err != nil {
+			slog.Warn("failed to record session token usage", "session_id", a.config.SessionID, "error", err)
+		}
+		if a.config.WorkingDir != "" {
+			if err := a.meta.SetWorkingDir(a.config.SessionID, a.config.WorkingDir); err != nil {
+				slog.Warn("failed to record session working directory", "session_id", a.config.SessionID, "error", err)
+			}
+		}
+	}
+
+	if a.hooks.Has(hook.RunEnd) {
+		input := a.hookInput(hook.RunEnd, event.RunID)
+		input.StopReason = string(event.Type)
+		result := a.hooks.Run(context.Background(), input)
+		a.emitHookMessages(event.RunID, result, eventChannel)
+	}
+
+	eventChannel <- event
+}
+
+// applyPreToolHooks runs the pre_tool_use hooks on each valid call. Arguments a hook rewrites are validated
+// again, and a call whose rewritten arguments no longer fit the tool's schema is returned to the model as
+// invalid.
+func (a *Agent) applyPreToolHooks(runID core.RunID, batch *pendingBatch, eventChannel chan<- Event) {
+	if !a.hooks.Has(hook.PreToolUse) {
+		return
+	}
+
+	for _, call := range batch.calls {
+		if call.Approval == ApprovalInvalid {
+			continue
+		}
+
+		input := a.hookInput(hook.PreToolUse, runID)
+		input.ToolName = call.Name
+		input.ToolCallID = call.ID
+		input.ToolArgs = call.Args
+
+		result := a.hooks.Run(context.Background(), input)
+		a.emitHookMessages(runID, result, eventChannel)
+
+		if result.Decision == hook.DecisionDeny {
+			call.Approval = ApprovalBlocked
+			call.Reason = result.Reason
+			continue
+		}
+
+		if result.Arguments != nil {
+			validated, err := a.tools.ValidateArguments(call.Name, result.Arguments)
+			if err != nil {
+				call.Args = result.Arguments
+				call.Approval = ApprovalInvalid
+				call.Reason = fmt.Sprintf("the arguments from a pre_tool_use hook are invalid: %v", err)
+				continue
+			}
+			call.Args = validated
+		}
+
+		if result.Decision == hook.DecisionAllow {
+			call.Approval = ApprovalGranted
+		}
+	}
+}
+
+func (a *Agent) hookInput(event hook.Event, runID core.RunID) hook.Input {
+	return hook.Input{
+		Event:      event,
+		SessionID:  string(a.config.SessionID),
+		RunID:      string(runID),
+		AgentName:  a.config.AgentName,
+		WorkingDir: a.config.WorkingDir,
+	}
+}
+
+func (a *Agent) emitHookMessages(runID core.RunID, result hook.Result, eventChannel chan<- Event) {
+	for _, msg := range result.Messages {
+		eventChannel <- Event{Type: EvtHookOutput, RunID: runID, HookEvent: string(msg.Event), Output: msg.Text}
 	}
 }
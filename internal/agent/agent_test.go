@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/conversation"
+)
+
+type recordingContext struct {
+	mockContext
+	starts []conversation.RunStart
+	ends   []conversation.RunEnd
+}
+
+func (c *recordingContext) RecordRunStart(start conversation.RunStart) error {
+	c.starts = append(c.starts, start)
+	return nil
+}
+
+func (c *recordingContext) RecordRunEnd(end conversation.RunEnd) error {
+	c.ends = append(c.ends, end)
+	return nil
+}
+
+func TestAgentLoop_RecordsRunBoundaries(t *testing.T) {
+	ctx := &recordingContext{}
+	ag := New(&mockProvider{}, &mockToolExecutor{}, ctx, RunConfig{AgentName: "coder", ProviderModel: "qwen"})
+
+	_, eventCh := ag.Run("hello")
+
+	var runID string
+	for evt := range eventCh {
+		if evt.Type == EvtRunStarted {
+			runID = string(evt.RunID)
+		}
+		if evt.Type == EvtRunCompleted || evt.Type == EvtRunFailed {
+			break
+		}
+	}
+
+	if len(ctx.starts) != 1 || len(ctx.ends) != 1 {
+		t.Fatalf("expected one run_start and one run_end, got %d and %d", len(ctx.starts), len(ctx.ends))
+	}
+
+	start, end := ctx.starts[0], ctx.ends[0]
+	if string(start.RunID) != runID || start.AgentName != "coder" || start.Model != "qwen" {
+		t.Errorf("unexpected run start: %+v", start)
+	}
+	if end.RunID != start.RunID || end.Outcome != "completed" || end.Turns != 1 {
+		t.Errorf("unexpected run end: %+v", end)
+	}
+}
@@ -15,6 +15,9 @@ const (
 	ApprovalPending ApprovalState = iota
 	ApprovalGranted
 	ApprovalDenied
+	ApprovalBlocked
+	ApprovalRejected
+	ApprovalInvalid
 )
 
 type pendingCall struct {
@@ -23,6 +26,8 @@ type pendingCall struct {
 	Args     map[string]any
 	Approval ApprovalState
 	Reason   string
+	Edited   bool
+	Diff     string
 }
 
 type pendingBatch struct {
@@ -51,21 +56,34 @@ func (b *pendingBatch) asProposed(preview previewFunc, ctx context.Context) []Pr
 	var out []ProposedToolCall
 
 	for _, call := range b.calls {
-		argsJSON, _ := jsonMarshal(call.Args)
-		proposed := ProposedToolCall{CallID: call.ID, Name: call.Name, ArgumentsJSON: argsJSON}
-
-		if preview != nil {
-			if previewText, err := preview(call.Name, call.Args, ctx); err == nil {
-				proposed.Preview = previewText
-			}
+		if call.Approval == ApprovalBlocked || call.Approval == ApprovalInvalid {
+			continue
 		}
 
-		out = append(out, proposed)
+		out = append(out, call.asProposed(preview, ctx))
 	}
 
 	return out
 }
 
+func (call *pendingCall) asProposed(preview previewFunc, ctx context.Context) ProposedToolCall {
+	argsJSON, _ := jsonMarshal(call.Args)
+	proposed := ProposedToolCall{
+		CallID:        call.ID,
+		Name:          call.Name,
+		ArgumentsJSON: argsJSON,
+		Approved:      call.Approval == ApprovalGranted,
+	}
+
+	if preview != nil {
+		if previewText, err := preview(call.Name, call.Args, ctx); err == nil {
+			proposed.Preview = previewText
+		}
+	}
+
+	return proposed
+}
+
 func (b *pendingBatch) asToolCalls() []core.ToolCall {
 	var out []core.ToolCall
 
@@ -76,7 +94,10 @@ func (b *pendingBatch) asToolCalls() []core.ToolCall {
 	return out
 }
 
-func collectApprovals(commandChannel <-chan Command, batch *pendingBatch) ([]*pendingCall, error) {
+// editFunc applies user-edited arguments to a pending call, reporting whether they were accepted.
+type editFunc func(call *pendingCall, args map[string]any) bool
+
+func collectApprovals(commandChannel <-chan Command, batch *pendingBatch, applyEdit editFunc) ([]*pendingCall, error) {
 	for {
 		if areAllDecided(batch) {
 			return collectDecisions(batch), nil
@@ -91,14 +112,24 @@ func collectApprovals(commandChannel <-chan Command, batch *pendingBatch) ([]*pe
 		case CmdCancel:
 			return nil, errors.New("cancelled")
 		case CmdApproveTool:
-			if call, ok := batch.calls[command.CallID]; ok && call.Approval == ApprovalPending {
-				call.Approval = ApprovalGranted
+			call, ok := batch.calls[command.CallID]
+			if !ok || call.Approval != ApprovalPending {
+				continue
 			}
+			if command.Arguments != nil && (applyEdit == nil || !applyEdit(call, command.Arguments)) {
+				continue
+			}
+			call.Approval = ApprovalGranted
 		case CmdDenyTool:
 			if call, ok := batch.calls[command.CallID]; ok && call.Approval == ApprovalPending {
 				call.Approval = ApprovalDenied
 				call.Reason = command.Reason
 			}
+		case CmdRejectTool:
+			if call, ok := batch.calls[command.CallID]; ok && call.Approval == ApprovalPending {
+				call.Approval = ApprovalRejected
+				call.Reason = command.Feedback
+			}
 		}
 	}
 }
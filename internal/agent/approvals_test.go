@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/tool"
+)
+
+type schemaToolExecutor struct {
+	mockToolExecutor
+}
+
+func (m *schemaToolExecutor) ToolDefinitions() []core.ToolDef {
+	return []core.ToolDef{{
+		Name: "write_file",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{"type": "string"},
+			},
+			"required": []string{"path"},
+		},
+	}}
+}
+
+func (m *schemaToolExecutor) ValidateArguments(name string, args map[string]any) (map[string]any, error) {
+	schema, err := tool.CompileSchema(m.ToolDefinitions()[0].Parameters)
+	if err != nil {
+		return nil, err
+	}
+	return schema.Validate(args)
+}
+
+func (m *schemaToolExecutor) Preview(name string, args map[string]any, ctx context.Context) (string, error) {
+	path, _ := args["path"].(string)
+	return "preview:" + path, nil
+}
+
+func newEditTestBatch() *pendingBatch {
+	return buildPending([]core.ToolCall{
+		{ID: "call1", Name: "write_file", Arguments: map[string]any{"path": "vendor/x.go"}},
+	})
+}
+
+func TestCollectApprovals_ApproveWithEditedArguments(t *testing.T) {
+	ag := &Agent{tools: &schemaToolExecutor{}}
+	eventCh := make(chan Event, 8)
+	commandCh := make(chan Command, 8)
+	batch := newEditTestBatch()
+
+	commandCh <- Command{Type: CmdApproveTool, CallID: "call1", Arguments: map[string]any{"path": "internal/x.go"}}
+
+	calls, err := collectApprovals(commandCh, batch, ag.editCall("run1", eventCh))
+	if err != nil {
+		t.Fatalf("collectApprovals failed: %v", err)
+	}
+
+	call := calls[0]
+	if call.Approval != ApprovalGranted || !call.Edited {
+		t.Fatalf("expected granted edited call, got %+v", call)
+	}
+	if call.Args["path"] != "internal/x.go" {
+		t.Fatalf("args = %v, want edited path", call.Args)
+	}
+
+	evt := <-eventCh
+	if evt.Type != EvtToolEdited || len(evt.Calls) != 1 || evt.Calls[0].Preview != "preview:internal/x.go" {
+		t.Fatalf("expected re-previewed edit event, got %+v", evt)
+	}
+}
+
+func TestCollectApprovals_InvalidEditIsReproposed(t *testing.T) {
+	ag := &Agent{tools: &schemaToolExecutor{}}
+	eventCh := make(chan Event, 8)
+	commandCh := make(chan Command, 8)
+	batch := newEditTestBatch()
+
+	commandCh <- Command{Type: CmdApproveTool, CallID: "call1", Arguments: map[string]any{"path": 42}}
+	commandCh <- Command{Type: CmdApproveTool, CallID: "call1"}
+
+	calls, err := collectApprovals(commandCh, batch, ag.editCall("run1", eventCh))
+	if err != nil {
+		t.Fatalf("collectApprovals failed: %v", err)
+	}
+
+	evt := <-eventCh
+	if evt.Type != EvtToolsProposed || len(evt.Calls) != 1 {
+		t.Fatalf("expected re-proposal, got %+v", evt)
+	}
+	if !strings.Contains(evt.Calls[0].Error, "/path") {
+		t.Fatalf("expected validation error for path, got %q", evt.Calls[0].Error)
+	}
+
+	call := calls[0]
+	if call.Edited || call.Args["path"] != "vendor/x.go" {
+		t.Fatalf("invalid edit should not change args, got %+v", call)
+	}
+	if call.Approval != ApprovalGranted {
+		t.Fatalf("expected second plain approval to grant, got %v", call.Approval)
+	}
+}
+
+func TestExecuteTools_RejectWithFeedbackContinuesRun(t *testing.T) {
+	ctx := &mockContext{}
+	eventCh := make(chan Event, 8)
+	commandCh := make(chan Command, 8)
+	ag := &Agent{context: ctx, provider: &mockProvider{}, tools: &schemaToolExecutor{}}
+	batch := newEditTestBatch()
+
+	commandCh <- Command{Type: CmdRejectTool, CallID: "call1", Feedback: "write under internal/ instead"}
+
+	calls, err := collectApprovals(commandCh, batch, ag.editCall("run1", eventCh))
+	if err != nil {
+		t.Fatalf("collectApprovals failed: %v", err)
+	}
+	if err := ag.executeTools("run1", calls, eventCh); err != nil {
+		t.Fatalf("executeTools failed: %v", err)
+	}
+
+	result := ctx.messages[0].ToolResult
+	if !result.IsError || result.Output != "rejected by user with feedback: write under internal/ instead" {
+		t.Fatalf("unexpected tool result: %+v", result)
+	}
+	if anyWasDenied(calls) {
+		t.Fatal("reject with feedback should not end the run")
+	}
+}
+
+func TestExecuteTools_EditedCallNotesArguments(t *testing.T) {
+	ctx := &mockContext{}
+	eventCh := make(chan Event, 8)
+	ag := &Agent{context: ctx, provider: &mockProvider{}, tools: &mockToolExecutor{}}
+
+	calls := []*pendingCall{
+		{ID: "call1", Name: "write_file", Args: map[string]any{"path": "internal/x.go"}, Approval: ApprovalGranted, Edited: true},
+	}
+
+	if err := ag.executeTools("run1", calls, eventCh); err != nil {
+		t.Fatalf("executeTools failed: %v", err)
+	}
+
+	output := ctx.messages[0].ToolResult.Output
+	if !strings.Contains(output, `{"path":"internal/x.go"}`) || !strings.HasSuffix(output, "mock output") {
+		t.Fatalf("expected edit note before output, got %q", output)
+	}
+}
+
+func TestValidateCalls_InvalidCallReturnedToModel(t *testing.T) {
+	ctx := &mockContext{}
+	eventCh := make(chan Event, 8)
+	ag := &Agent{context: ctx, provider: &mockProvider{}, tools: &schemaToolExecutor{}}
+
+	batch := buildPending([]core.ToolCall{
+		{ID: "call1", Name: "write_file", Arguments: map[string]any{"path": 7}},
+	})
+	ag.validateCalls(batch)
+
+	if proposed := batch.asProposed(nil, context.Background()); len(proposed) != 0 {
+		t.Fatalf("invalid call must not be proposed, got %+v", proposed)
+	}
+
+	calls, err := collectApprovals(make(chan Command), batch, nil)
+	if err != nil {
+		t.Fatalf("collectApprovals failed: %v", err)
+	}
+	if err := ag.executeTools("run1", calls, eventCh); err != nil {
+		t.Fatalf("executeTools failed: %v", err)
+	}
+
+	result := ctx.messages[0].ToolResult
+	if !result.IsError || !strings.Contains(result.Output, "at '/path': got number, want string") {
+		t.Fatalf("expected precise validation error, got %+v", result)
+	}
+	if anyWasDenied(calls) {
+		t.Fatal("invalid arguments should not end the run")
+	}
+}
@@ -1,8 +1,11 @@
 package agent
 
 import (
+	"context"
+
 	"github.com/erg0nix/kontekst/internal/conversation"
 	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/memory"
 	"github.com/erg0nix/kontekst/internal/provider"
 )
 
@@ -19,14 +22,20 @@ type ConversationWindow interface {
 	AddMessage(msg core.Message) error
 	BuildContext() ([]core.Message, error)
 	SetAgentSystemPrompt(prompt string)
+	SetProjectMemory(index string)
+	ProjectMemory() string
 	SetActiveSkill(skill *core.SkillMetadata)
 	ActiveSkill() *core.SkillMetadata
+	SetPlan(entries []core.PlanEntry)
+	SetPlanNote(note core.Message)
+	Plan() []core.PlanEntry
 	Snapshot() conversation.Snapshot
 }
 
-// LLM generates chat completions and counts tokens.
+// LLM generates chat completions and counts tokens. Cancelling ctx abandons a completion request.
 type LLM interface {
 	GenerateChat(
+		ctx context.Context,
 		messages []core.Message,
 		tools []core.ToolDef,
 		sampling *core.SamplingConfig,
@@ -41,3 +50,33 @@ type SessionStore interface {
 	Create() (core.SessionID, string, error)
 	Ensure(sessionID core.SessionID) (string, error)
 }
+
+// Rewinder supersedes the last turns of a conversation so a run can continue from an earlier user message.
+type Rewinder interface {
+	Rewind(turns int) (int, error)
+}
+
+// RunRecorder records run boundaries in a conversation's persistent history.
+type RunRecorder interface {
+	RecordRunStart(start conversation.RunStart) error
+	RecordRunEnd(end conversation.RunEnd) error
+}
+
+// SessionMetaStore keeps the session metadata that runs maintain: the title, working directory and token usage.
+type SessionMetaStore interface {
+	GetTitle(sessionID core.SessionID) (string, error)
+	SetTitle(sessionID core.SessionID, title string) error
+	SetWorkingDir(sessionID core.SessionID, dir string) error
+	AddUsage(sessionID core.SessionID, promptTokens, completionTokens int) error
+}
+
+// MemoryStore lists the facts remembered about the project in a working directory.
+type MemoryStore interface {
+	List(workingDir string) ([]memory.Entry, error)
+}
+
+// PlanStore persists a session's todo list between runs.
+type PlanStore interface {
+	GetPlan(sessionID core.SessionID) ([]core.PlanEntry, error)
+	SetPlan(sessionID core.SessionID, entries []core.PlanEntry) error
+}
@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/erg0nix/kontekst/internal/config"
+)
+
+const (
+	defaultRepeatedCalls  = 3
+	defaultRepeatedErrors = 3
+	defaultOscillations   = 2
+)
+
+// loopDetector tracks tool activity within a run and reports when the model keeps repeating itself:
+// identical calls, identical errors, or edits that flip a file back to a state it already had.
+type loopDetector struct {
+	repeatedCalls  int
+	repeatedErrors int
+	oscillations   int
+	workingDir     string
+
+	calls      map[string]int
+	errors     map[string]int
+	fileStates map[string][]string
+	flips      map[string]int
+	findings   []string
+	warned     bool
+}
+
+func newLoopDetector(cfg config.LoopDetectionConfig, workingDir string) *loopDetector {
+	if cfg.Disabled {
+		return nil
+	}
+
+	return &loopDetector{
+		repeatedCalls:  positiveOr(cfg.RepeatedCalls, defaultRepeatedCalls),
+		repeatedErrors: positiveOr(cfg.RepeatedErrors, defaultRepeatedErrors),
+		oscillations:   positiveOr(cfg.Oscillations, defaultOscillations),
+		workingDir:     workingDir,
+		calls:          make(map[string]int),
+		errors:         make(map[string]int),
+		fileStates:     make(map[string][]string),
+		flips:          make(map[string]int),
+	}
+}
+
+// beforeCall records the state of a file the call is about to modify, if it has not been seen yet.
+func (d *loopDetector) beforeCall(call *pendingCall) {
+	if d == nil || call.Approval != ApprovalGranted {
+		return
+	}
+
+	path := d.editedPath(call)
+	if path == "" || len(d.fileStates[path]) > 0 {
+		return
+	}
+
+	d.fileStates[path] = []string{d.hashFile(path)}
+}
+
+// observe records the outcome of a call. Calls the user denied or rejected are not counted.
+func (d *loopDetector) observe(call *pendingCall, err error) {
+	if d == nil || call.Approval == ApprovalDenied || call.Approval == ApprovalRejected {
+		return
+	}
+
+	argsJSON, _ := jsonMarshal(call.Args)
+	callKey := call.Name + " " + argsJSON
+	d.calls[callKey]++
+	if d.calls[callKey] == d.repeatedCalls || (d.warned && d.calls[callKey] > d.repeatedCalls) {
+		d.findings = append(d.findings, fmt.Sprintf("%s was called %d times with the same arguments", call.Name, d.calls[callKey]))
+	}
+
+	if err != nil {
+		errKey := call.Name + " " + err.Error()
+		d.errors[errKey]++
+		if d.errors[errKey] == d.repeatedErrors || (d.warned && d.errors[errKey] > d.repeatedErrors) {
+			d.findings = append(d.findings, fmt.Sprintf("%s failed %d times with the same error: %s", call.Name, d.errors[errKey], firstLine(err.Error())))
+		}
+		return
+	}
+
+	path := d.editedPath(call)
+	if path == "" {
+		return
+	}
+
+	states := d.fileStates[path]
+	current := d.hashFile(path)
+	if len(states) > 0 && states[len(states)-1] == current {
+		return
+	}
+
+	for _, earlier := range states {
+		if earlier == current {
+			d.flips[path]++
+			if d.flips[path] == d.oscillations || (d.warned && d.flips[path] > d.oscillations) {
+				d.findings = append(d.findings, fmt.Sprintf("edits to %s keep reverting it to an earlier state (%d times)", path, d.flips[path]))
+			}
+			break
+		}
+	}
+	d.fileStates[path] = append(states, current)
+}
+
+// check returns the repetition found since the last check, or an empty string.
+func (d *loopDetector) check() string {
+	if d == nil || len(d.findings) == 0 {
+		return ""
+	}
+
+	finding := strings.Join(d.findings, "; ")
+	d.findings = nil
+	return finding
+}
+
+// warn marks the run as warned; findings after this point stop the run.
+func (d *loopDetector) warn() bool {
+	if d.warned {
+		return false
+	}
+	d.warned = true
+	return true
+}
+
+func (d *loopDetector) editedPath(call *pendingCall) string {
+	if call.Name != "edit_file" && call.Name != "write_file" {
+		return ""
+	}
+	path, _ := call.Args["path"].(string)
+	return path
+}
+
+func (d *loopDetector) hashFile(path string) string {
+	if !filepath.IsAbs(path) && d.workingDir != "" {
+		path = filepath.Join(d.workingDir, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func loopNote(finding string) string {
+	return fmt.Sprintf("<system-note>\nYou appear to be stuck in a loop: %s. Repeating the same action will not produce a different result. Re-read the latest tool output, change your approach, or stop and explain what is blocking you.\n</system-note>", finding)
+}
+
+func positiveOr(value int, fallback int) int {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/config"
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/provider"
+)
+
+func TestLoopDetector_Findings(t *testing.T) {
+	readCall := func() *pendingCall {
+		return &pendingCall{Name: "read_file", Args: map[string]any{"path": "a.go"}, Approval: ApprovalGranted}
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.LoopDetectionConfig
+		run     func(d *loopDetector)
+		wantHit string
+	}{
+		{
+			name: "repeated calls",
+			run: func(d *loopDetector) {
+				for range 3 {
+					d.observe(readCall(), nil)
+				}
+			},
+			wantHit: "read_file was called 3 times with the same arguments",
+		},
+		{
+			name: "below threshold",
+			run: func(d *loopDetector) {
+				for range 2 {
+					d.observe(readCall(), nil)
+				}
+			},
+		},
+		{
+			name: "custom threshold",
+			cfg:  config.LoopDetectionConfig{RepeatedCalls: 2},
+			run: func(d *loopDetector) {
+				for range 2 {
+					d.observe(readCall(), nil)
+				}
+			},
+			wantHit: "called 2 times",
+		},
+		{
+			name: "repeated errors with different arguments",
+			run: func(d *loopDetector) {
+				for i := range 3 {
+					call := &pendingCall{Name: "edit_file", Args: map[string]any{"n": i}, Approval: ApprovalGranted}
+					d.observe(call, errors.New("old text not found\ndetails"))
+				}
+			},
+			wantHit: "edit_file failed 3 times with the same error: old text not found",
+		},
+		{
+			name: "denied calls are ignored",
+			run: func(d *loopDetector) {
+				for range 3 {
+					call := readCall()
+					call.Approval = ApprovalDenied
+					d.observe(call, errors.New("denied"))
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newLoopDetector(tt.cfg, t.TempDir())
+			tt.run(d)
+
+			got := d.check()
+			if tt.wantHit == "" {
+				if got != "" {
+					t.Fatalf("unexpected finding: %q", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.wantHit) {
+				t.Fatalf("finding = %q, want containing %q", got, tt.wantHit)
+			}
+			if d.check() != "" {
+				t.Fatal("check should clear findings once reported")
+			}
+		})
+	}
+}
+
+func TestLoopDetector_Oscillation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := newLoopDetector(config.LoopDetectionConfig{}, dir)
+	for i, content := range []string{"b", "a", "b", "a"} {
+		call := &pendingCall{Name: "write_file", Args: map[string]any{"path": "main.go", "content": content, "n": i}, Approval: ApprovalGranted}
+		d.beforeCall(call)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		d.observe(call, nil)
+
+		got := d.check()
+		if i < 2 && got != "" {
+			t.Fatalf("step %d: unexpected finding %q", i, got)
+		}
+		if i == 2 && !strings.Contains(got, "edits to main.go keep reverting it to an earlier state (2 times)") {
+			t.Fatalf("step %d: finding = %q", i, got)
+		}
+	}
+}
+
+func TestLoopDetector_Disabled(t *testing.T) {
+	d := newLoopDetector(config.LoopDetectionConfig{Disabled: true}, "")
+	d.observe(&pendingCall{Name: "read_file"}, nil)
+	if d.check() != "" {
+		t.Fatal("disabled detector should never report")
+	}
+}
+
+type repeatingProvider struct {
+	mockProvider
+}
+
+func (m *repeatingProvider) GenerateChat(_ context.Context, messages []core.Message, tools []core.ToolDef, sampling *core.SamplingConfig, model string, useToolRole bool) (provider.Response, error) {
+	return provider.Response{ToolCalls: []core.ToolCall{
+		{ID: string(core.NewToolCallID()), Name: "read_file", Arguments: map[string]any{"path": "a.go"}},
+	}}, nil
+}
+
+func TestAgentLoop_WarnsThenStopsOnRepetition(t *testing.T) {
+	ctx := &mockContext{}
+	ag := New(&repeatingProvider{}, &mockToolExecutor{}, ctx, RunConfig{})
+
+	commandCh, eventCh := ag.Run("read a.go")
+
+	var warnings int
+	var last Event
+	for evt := range eventCh {
+		switch evt.Type {
+		case EvtToolsProposed:
+			for _, call := range evt.Calls {
+				commandCh <- Command{Type: CmdApproveTool, CallID: call.CallID}
+			}
+		case EvtLoopDetected:
+			warnings++
+		}
+		last = evt
+		if evt.Type == EvtRunStopped || evt.Type == EvtRunCompleted || evt.Type == EvtRunFailed {
+			break
+		}
+	}
+
+	if warnings != 1 {
+		t.Fatalf("expected one loop warning, got %d", warnings)
+	}
+	if last.Type != EvtRunStopped || !strings.Contains(last.Error, "read_file was called 4 times") {
+		t.Fatalf("expected run stopped on repetition, got %+v", last)
+	}
+
+	var noted bool
+	for _, msg := range ctx.messages {
+		if msg.Role == core.RoleUser && strings.Contains(msg.Content, "<system-note>") {
+			noted = true
+		}
+	}
+	if !noted {
+		t.Fatal("expected corrective note in conversation")
+	}
+}
@@ -153,6 +153,8 @@ func (r *Registry) Load(name string) (*agentConfig.AgentConfig, error) {
 			cfg.ContextSize = tomlCfg.ContextSize
 			cfg.Sampling = tomlCfg.Sampling
 			cfg.ToolRole = tomlCfg.ToolRole
+			cfg.Hooks = tomlCfg.Hooks
+			cfg.LoopDetection = tomlCfg.LoopDetection
 		}
 	}
 
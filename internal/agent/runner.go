@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"cmp"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/erg0nix/kontekst/internal/config"
 	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/hook"
+	"github.com/erg0nix/kontekst/internal/memory"
 	"github.com/erg0nix/kontekst/internal/provider"
 	"github.com/erg0nix/kontekst/internal/skill"
 	"github.com/erg0nix/kontekst/internal/tool"
@@ -31,6 +34,9 @@ type RunConfig struct {
 	SkillContent        string
 	ToolRole            bool
 	Tools               tool.ToolExecutor
+	Hooks               config.HooksConfig
+	LoopDetection       config.LoopDetectionConfig
+	Rewind              int
 }
 
 // Runner starts agent runs and returns channels for bidirectional communication.
@@ -44,10 +50,21 @@ type DefaultRunner struct {
 	Context     ConversationFactory
 	Sessions    SessionStore
 	DebugConfig config.DebugConfig
+	Hooks       config.HooksConfig
+	AutoTitle   bool
+	// Memory, when set, supplies the project memory index added to the system prompt, limited to
+	// MemoryTokens tokens (zero means memory.DefaultIndexTokens).
+	Memory       MemoryStore
+	MemoryTokens int
 }
 
 // StartRun initializes a session and context window, then starts the agent loop in a background goroutine.
 func (r *DefaultRunner) StartRun(cfg RunConfig) (chan<- Command, <-chan Event, error) {
+	hooks, err := hook.NewRunner(r.Hooks, cfg.Hooks)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	sessionID := cfg.SessionID
 	if sessionID == "" {
 		newSessionID, _, err := r.Sessions.Create()
@@ -56,6 +73,7 @@ func (r *DefaultRunner) StartRun(cfg RunConfig) (chan<- Command, <-chan Event, e
 		}
 
 		sessionID = newSessionID
+		cfg.SessionID = sessionID
 	} else {
 		if _, err := r.Sessions.Ensure(sessionID); err != nil {
 			return nil, nil, err
@@ -71,13 +89,37 @@ func (r *DefaultRunner) StartRun(cfg RunConfig) (chan<- Command, <-chan Event, e
 		ctxWindow.SetAgentSystemPrompt(cfg.AgentSystemPrompt)
 	}
 
+	if cfg.Rewind > 0 {
+		if cfg.Prompt != "" || cfg.Skill != nil {
+			return nil, nil, fmt.Errorf("rewind re-runs the previous user message and cannot take a new prompt")
+		}
+		rewinder, ok := ctxWindow.(Rewinder)
+		if !ok {
+			return nil, nil, fmt.Errorf("rewind not supported by conversation window")
+		}
+		superseded, err := rewinder.Rewind(cfg.Rewind)
+		if err != nil {
+			return nil, nil, err
+		}
+		slog.Info("rewound session", "session_id", sessionID, "turns", cfg.Rewind, "superseded", superseded)
+	}
+
+	plans, _ := r.Sessions.(PlanStore)
+	if plans != nil {
+		plan, err := plans.GetPlan(sessionID)
+		if err != nil {
+			slog.Warn("failed to load session plan", "session_id", sessionID, "error", err)
+		}
+		ctxWindow.SetPlan(plan)
+	}
+
 	prompt := cfg.Prompt
 	if cfg.Skill != nil && cfg.SkillContent != "" {
 		ctxWindow.SetActiveSkill(&core.SkillMetadata{Name: cfg.Skill.Name, Path: cfg.Skill.Path})
 		prompt = fmt.Sprintf("%s\n\n---\n\n%s", cfg.Skill.FormatContent(cfg.SkillContent), prompt)
 	}
 
-	if cfg.WorkingDir != "" {
+	if cfg.WorkingDir != "" && prompt != "" {
 		agentsMDPath := filepath.Join(cfg.WorkingDir, "AGENTS.md")
 		content, err := os.ReadFile(agentsMDPath)
 		if err == nil {
@@ -96,12 +138,29 @@ func (r *DefaultRunner) StartRun(cfg RunConfig) (chan<- Command, <-chan Event, e
 		r.DebugConfig,
 	)
 
+	if r.Memory != nil && cfg.WorkingDir != "" {
+		entries, err := r.Memory.List(cfg.WorkingDir)
+		if err != nil {
+			slog.Warn("failed to load project memory", "working_dir", cfg.WorkingDir, "error", err)
+		}
+		budget := cmp.Or(r.MemoryTokens, memory.DefaultIndexTokens)
+		index, omitted := memory.Index(entries, budget, provider.CountTokens)
+		if omitted > 0 {
+			slog.Info("project memory index truncated", "working_dir", cfg.WorkingDir, "shown", len(entries)-omitted, "omitted", omitted)
+		}
+		ctxWindow.SetProjectMemory(index)
+	}
+
 	toolExecutor := cfg.Tools
 	if toolExecutor == nil {
 		toolExecutor = r.Tools
 	}
 
 	agentEngine := New(provider, toolExecutor, ctxWindow, cfg)
+	agentEngine.hooks = hooks
+	agentEngine.plans = plans
+	agentEngine.meta, _ = r.Sessions.(SessionMetaStore)
+	agentEngine.title = r.AutoTitle
 	commandChannel, eventChannel := agentEngine.Run(prompt)
 
 	outputChannel := make(chan Event, 32)
@@ -137,11 +196,13 @@ func (r *DefaultRunner) StartRun(cfg RunConfig) (chan<- Command, <-chan Event, e
 				slog.Info("run cancelled", "run_id", event.RunID)
 			case EvtRunFailed:
 				slog.Info("run failed", "run_id", event.RunID)
+			case EvtRunStopped:
+				slog.Info("run stopped", "run_id", event.RunID, "reason", event.Error)
 			}
 
 			outputChannel <- event
 
-			if event.Type == EvtRunCompleted || event.Type == EvtRunCancelled || event.Type == EvtRunFailed {
+			if event.Type == EvtRunCompleted || event.Type == EvtRunCancelled || event.Type == EvtRunFailed || event.Type == EvtRunStopped {
 				close(outputChannel)
 				return
 			}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/memory"
 	"github.com/erg0nix/kontekst/internal/session"
 	"github.com/erg0nix/kontekst/internal/skill"
 )
@@ -23,6 +24,17 @@ func (c *capturingContext) AddMessage(msg core.Message) error {
 	return c.mockContext.AddMessage(msg)
 }
 
+type memoryContext struct {
+	mockContext
+	index string
+}
+
+func (c *memoryContext) SetProjectMemory(index string) { c.index = index }
+
+type staticMemory []memory.Entry
+
+func (m staticMemory) List(_ string) ([]memory.Entry, error) { return m, nil }
+
 type mockContextService struct {
 	window ConversationWindow
 }
@@ -96,6 +108,45 @@ func TestStartRun_WithAgentsMD(t *testing.T) {
 	}
 }
 
+func TestStartRun_ProjectMemory(t *testing.T) {
+	tests := []struct {
+		name       string
+		workingDir string
+		want       string
+	}{
+		{name: "indexed", workingDir: t.TempDir(), want: "- [1] tests run with make test\n"},
+		{name: "no working dir", workingDir: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := &memoryContext{}
+			runner := &DefaultRunner{
+				Tools:    &mockToolExecutor{},
+				Context:  &mockContextService{window: window},
+				Sessions: &mockSessionService{},
+				Memory:   staticMemory{{ID: 1, Content: "tests run with make test"}},
+			}
+
+			_, events, err := runner.StartRun(RunConfig{Prompt: "hello", WorkingDir: tt.workingDir})
+			if err != nil {
+				t.Fatalf("StartRun failed: %v", err)
+			}
+			drainEvents(events)
+
+			if tt.want == "" {
+				if window.index != "" {
+					t.Errorf("expected no project memory, got %q", window.index)
+				}
+				return
+			}
+			if !strings.HasPrefix(window.index, "<project-memory>") || !strings.Contains(window.index, tt.want) {
+				t.Errorf("project memory = %q", window.index)
+			}
+		})
+	}
+}
+
 func TestStartRun_WithoutAgentsMD(t *testing.T) {
 	dir := t.TempDir()
 
@@ -166,3 +217,53 @@ func TestStartRun_AgentsMDBeforeSkillContent(t *testing.T) {
 		t.Fatal("expected skill content to appear before user prompt")
 	}
 }
+
+type rewindingContext struct {
+	capturingContext
+	rewound int
+}
+
+func (c *rewindingContext) Rewind(turns int) (int, error) {
+	c.rewound = turns
+	return 2, nil
+}
+
+func TestStartRun_Rewind(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "AGENTS.md"), []byte("Project rules here."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	window := &rewindingContext{}
+	runner := &DefaultRunner{
+		Tools:    &mockToolExecutor{},
+		Context:  &mockContextService{window: window},
+		Sessions: &mockSessionService{},
+	}
+
+	_, events, err := runner.StartRun(RunConfig{Rewind: 2, WorkingDir: dir})
+	if err != nil {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+	drainEvents(events)
+
+	if window.rewound != 2 {
+		t.Fatalf("rewound = %d, want 2", window.rewound)
+	}
+	if window.capturedPrompt != "" {
+		t.Fatalf("rewind must not add a new user message, got %q", window.capturedPrompt)
+	}
+
+	if _, _, err := runner.StartRun(RunConfig{Rewind: 1, Prompt: "hello"}); err == nil {
+		t.Fatal("expected error when combining rewind with a prompt")
+	}
+
+	plain := &DefaultRunner{
+		Tools:    &mockToolExecutor{},
+		Context:  &mockContextService{window: &capturingContext{}},
+		Sessions: &mockSessionService{},
+	}
+	if _, _, err := plain.StartRun(RunConfig{Rewind: 1}); err == nil {
+		t.Fatal("expected error when the window cannot rewind")
+	}
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+const titleInstructions = "You name conversations. Reply with a title of at most six words that says what the user " +
+	"asked for. Reply with the title only: no quotes, no prefix, no trailing punctuation."
+
+// titleExcerptRunes bounds how much of the prompt and reply are sent when asking for a title.
+const titleExcerptRunes = 2000
+
+const maxTitleRunes = 80
+
+// titleRun titles the session before the run reports its end, so the request neither outlives the run nor
+// competes with the next one for the model. A cancel command sent meanwhile abandons the request.
+func (a *Agent) titleRun(commandChannel <-chan Command, reply string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		for {
+			select {
+			case cmd, ok := <-commandChannel:
+				if !ok || cmd.Type == CmdCancel {
+					cancel()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	a.titleSession(ctx, reply)
+}
+
+// titleSession asks the model for a short title after a completed run if the session does not have one yet,
+// which in practice means after its first exchange. The title is based on what the user typed, without
+// project instructions or skill content. Failures are logged and leave the session untitled.
+func (a *Agent) titleSession(ctx context.Context, reply string) {
+	prompt := a.config.Prompt
+	if strings.TrimSpace(prompt) == "" && a.config.Skill != nil {
+		prompt = "/" + a.config.Skill.Name
+	}
+	if a.meta == nil || !a.title || strings.TrimSpace(prompt) == "" {
+		return
+	}
+
+	title, err := a.meta.GetTitle(a.config.SessionID)
+	if err != nil || title != "" {
+		return
+	}
+
+	temperature := 0.2
+	maxTokens := 32
+	response, err := a.provider.GenerateChat(
+		ctx,
+		[]core.Message{
+			{Role: core.RoleSystem, Content: titleInstructions},
+			{Role: core.RoleUser, Content: "User: " + excerpt(prompt, titleExcerptRunes) + "\n\nAssistant: " + excerpt(reply, titleExcerptRunes)},
+		},
+		nil,
+		&core.SamplingConfig{Temperature: &temperature, MaxTokens: &maxTokens},
+		a.config.ProviderModel,
+		a.config.ToolRole,
+	)
+	if err != nil {
+		slog.Warn("failed to generate session title", "session_id", a.config.SessionID, "error", err)
+		return
+	}
+
+	if response.Usage != nil {
+		if err := a.meta.AddUsage(a.config.SessionID, response.Usage.PromptTokens, response.Usage.CompletionTokens); err != nil {
+			slog.Warn("failed to record session token usage", "session_id", a.config.SessionID, "error", err)
+		}
+	}
+
+	title = cleanTitle(response.Content)
+	if title == "" {
+		return
+	}
+	if err := a.meta.SetTitle(a.config.SessionID, title); err != nil {
+		slog.Warn("failed to save session title", "session_id", a.config.SessionID, "error", err)
+	}
+}
+
+// cleanTitle reduces a model reply to a single-line title, dropping quotes, a "Title:" prefix and trailing punctuation.
+func cleanTitle(reply string) string {
+	var line string
+	for candidate := range strings.Lines(reply) {
+		if line = strings.TrimSpace(candidate); line != "" {
+			break
+		}
+	}
+
+	line = strings.TrimLeft(line, "#* ")
+	if rest, ok := cutPrefixFold(line, "title:"); ok {
+		line = rest
+	}
+	line = strings.Join(strings.Fields(line), " ")
+	line = strings.Trim(line, "\"'`*_ ")
+	line = strings.TrimRight(line, ".!:;, ")
+
+	return excerpt(line, maxTitleRunes)
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return strings.TrimSpace(s[len(prefix):]), true
+	}
+	return s, false
+}
+
+// excerpt cuts s to at most n runes, marking the cut with an ellipsis.
+func excerpt(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
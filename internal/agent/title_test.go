@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/provider"
+)
+
+type titlingProvider struct {
+	mu       sync.Mutex
+	requests [][]core.Message
+}
+
+func (p *titlingProvider) GenerateChat(_ context.Context, messages []core.Message, tools []core.ToolDef, sampling *core.SamplingConfig, model string, useToolRole bool) (provider.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, messages)
+
+	if sampling != nil && sampling.MaxTokens != nil {
+		return provider.Response{Content: "\"Fix Websocket Reconnect.\"", Usage: &provider.Usage{PromptTokens: 30, CompletionTokens: 5}}, nil
+	}
+	return provider.Response{Content: "done", Usage: &provider.Usage{PromptTokens: 100, CompletionTokens: 20}}, nil
+}
+
+func (p *titlingProvider) CountTokens(text string) (int, error) {
+	return len(text) / 4, nil
+}
+
+type memoryMetaStore struct {
+	mu     sync.Mutex
+	title  string
+	dir    string
+	prompt int
+	compl  int
+	titled chan struct{}
+}
+
+func (s *memoryMetaStore) GetTitle(_ core.SessionID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.title, nil
+}
+
+func (s *memoryMetaStore) SetTitle(_ core.SessionID, title string) error {
+	s.mu.Lock()
+	s.title = title
+	s.mu.Unlock()
+	close(s.titled)
+	return nil
+}
+
+func (s *memoryMetaStore) SetWorkingDir(_ core.SessionID, dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = dir
+	return nil
+}
+
+func (s *memoryMetaStore) AddUsage(_ core.SessionID, promptTokens, completionTokens int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prompt += promptTokens
+	s.compl += completionTokens
+	return nil
+}
+
+func waitForRunEnd(events <-chan Event) {
+	for evt := range events {
+		if evt.Type == EvtRunCompleted || evt.Type == EvtRunFailed {
+			return
+		}
+	}
+}
+
+func TestAgentLoop_TitlesFirstExchange(t *testing.T) {
+	llm := &titlingProvider{}
+	store := &memoryMetaStore{titled: make(chan struct{})}
+
+	ag := New(llm, &mockToolExecutor{}, &mockContext{}, RunConfig{
+		SessionID:  "sess_1",
+		Prompt:     "the websocket reconnect loop hangs",
+		WorkingDir: "/src/app",
+	})
+	ag.meta = store
+	ag.title = true
+
+	_, eventCh := ag.Run("<project-instructions>x</project-instructions>\n\nthe websocket reconnect loop hangs")
+	waitForRunEnd(eventCh)
+
+	select {
+	case <-store.titled:
+	default:
+		t.Fatal("session was not titled before the run ended")
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.title != "Fix Websocket Reconnect" {
+		t.Errorf("title = %q", store.title)
+	}
+	if store.dir != "/src/app" {
+		t.Errorf("working dir = %q", store.dir)
+	}
+	if store.prompt != 130 || store.compl != 25 {
+		t.Errorf("usage = %d/%d, want 130/25 including the title request", store.prompt, store.compl)
+	}
+
+	llm.mu.Lock()
+	defer llm.mu.Unlock()
+	titleRequest := llm.requests[len(llm.requests)-1]
+	if got := titleRequest[1].Content; got != "User: the websocket reconnect loop hangs\n\nAssistant: done" {
+		t.Errorf("title request = %q", got)
+	}
+}
+
+func TestAgentLoop_KeepsExistingTitle(t *testing.T) {
+	llm := &titlingProvider{}
+	store := &memoryMetaStore{title: "Named by hand", titled: make(chan struct{})}
+
+	ag := New(llm, &mockToolExecutor{}, &mockContext{}, RunConfig{SessionID: "sess_1", Prompt: "hello"})
+	ag.meta = store
+	ag.title = true
+
+	ag.titleSession(context.Background(), "hi")
+
+	if len(llm.requests) != 0 {
+		t.Errorf("expected no title request, got %d", len(llm.requests))
+	}
+	if store.title != "Named by hand" {
+		t.Errorf("title = %q", store.title)
+	}
+}
+
+// stallingTitleProvider answers the run at once and holds the title request until it is cancelled.
+type stallingTitleProvider struct {
+	titling chan struct{}
+}
+
+func (p *stallingTitleProvider) GenerateChat(ctx context.Context, messages []core.Message, tools []core.ToolDef, sampling *core.SamplingConfig, model string, useToolRole bool) (provider.Response, error) {
+	if sampling == nil || sampling.MaxTokens == nil {
+		return provider.Response{Content: "done"}, nil
+	}
+	close(p.titling)
+	<-ctx.Done()
+	return provider.Response{}, ctx.Err()
+}
+
+func (p *stallingTitleProvider) CountTokens(text string) (int, error) {
+	return len(text) / 4, nil
+}
+
+func TestAgentLoop_CancelAbandonsTitle(t *testing.T) {
+	llm := &stallingTitleProvider{titling: make(chan struct{})}
+	store := &memoryMetaStore{titled: make(chan struct{})}
+
+	ag := New(llm, &mockToolExecutor{}, &mockContext{}, RunConfig{SessionID: "sess_1", Prompt: "hello"})
+	ag.meta = store
+	ag.title = true
+
+	commandCh, eventCh := ag.Run("hello")
+	select {
+	case <-llm.titling:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the title was not requested")
+	}
+	commandCh <- Command{Type: CmdCancel}
+
+	done := make(chan struct{})
+	go func() {
+		waitForRunEnd(eventCh)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the run did not end after the title request was cancelled")
+	}
+	if store.title != "" {
+		t.Errorf("title = %q, want none", store.title)
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{reply: "Fix websocket reconnect", want: "Fix websocket reconnect"},
+		{reply: "\"Fix websocket reconnect.\"", want: "Fix websocket reconnect"},
+		{reply: "\n\nTitle: Database   migration speedup\nsecond line", want: "Database migration speedup"},
+		{reply: "## **Refactor parser**", want: "Refactor parser"},
+		{reply: "   ", want: ""},
+		{reply: "a very long title that keeps going and going and going and going and going and going and on", want: "a very long title that keeps going and going and going and going and going and…"},
+	}
+
+	for _, tt := range tests {
+		if got := cleanTitle(tt.reply); got != tt.want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.reply, got, tt.want)
+		}
+	}
+}
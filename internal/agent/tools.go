@@ -3,9 +3,12 @@ package agent
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
+	"github.com/erg0nix/kontekst/internal/conversation"
 	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/hook"
 	"github.com/erg0nix/kontekst/internal/tool"
 	"github.com/erg0nix/kontekst/internal/tool/builtin"
 )
@@ -19,9 +22,29 @@ func (a *Agent) executeTools(runID core.RunID, calls []*pendingCall, eventChanne
 			a.context.SetActiveSkill(skill)
 		},
 	}
+	todoCallbacks := &builtin.TodoCallbacks{
+		SetPlan: func(entries []core.PlanEntry) error {
+			a.context.SetPlan(entries)
+			note := conversation.PlanNote(entries)
+			tokens, _ := a.provider.CountTokens(note)
+			a.context.SetPlanNote(core.Message{Role: core.RoleUser, Content: note, Tokens: tokens})
+			if a.plans != nil {
+				if err := a.plans.SetPlan(a.config.SessionID, entries); err != nil {
+					slog.Warn("failed to persist session plan", "session_id", a.config.SessionID, "error", err)
+				}
+			}
+			eventChannel <- Event{Type: EvtPlanUpdated, RunID: runID, Plan: entries}
+			return nil
+		},
+	}
+
+	toolCtx := builtin.WithSkillCallbacks(context.Background(), skillCallbacks)
+	toolCtx = builtin.WithTodoCallbacks(toolCtx, todoCallbacks)
 
 	for _, call := range calls {
-		output, err := a.executeToolCall(runID, call, skillCallbacks, eventChannel)
+		a.loops.beforeCall(call)
+		output, err := a.executeToolCall(toolCtx, runID, call, eventChannel)
+		a.loops.observe(call, err)
 
 		var result core.ToolResult
 		if err != nil {
@@ -37,9 +60,15 @@ func (a *Agent) executeTools(runID core.RunID, calls []*pendingCall, eventChanne
 				Name:    call.Name,
 				Output:  output,
 				IsError: false,
+				Diff:    call.Diff,
 			}
 		}
 
+		if call.Edited {
+			argsJSON, _ := jsonMarshal(call.Args)
+			result.Output = fmt.Sprintf("The user edited the arguments before approving; the call ran with: %s\n\n%s", argsJSON, result.Output)
+		}
+
 		tokens, _ := a.provider.CountTokens(result.Output)
 		msg := core.Message{
 			Role:       core.RoleTool,
@@ -57,7 +86,7 @@ func (a *Agent) executeTools(runID core.RunID, calls []*pendingCall, eventChanne
 	return nil
 }
 
-func (a *Agent) executeToolCall(runID core.RunID, call *pendingCall, callbacks *builtin.SkillCallbacks, eventChannel chan<- Event) (string, error) {
+func (a *Agent) executeToolCall(parent context.Context, runID core.RunID, call *pendingCall, eventChannel chan<- Event) (string, error) {
 	if call.Approval == ApprovalDenied {
 		reason := call.Reason
 		if reason == "" {
@@ -66,16 +95,37 @@ func (a *Agent) executeToolCall(runID core.RunID, call *pendingCall, callbacks *
 		return "", fmt.Errorf("denied: %s", reason)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	if call.Approval == ApprovalRejected {
+		if call.Reason == "" {
+			return "", fmt.Errorf("rejected by user")
+		}
+		return "", fmt.Errorf("rejected by user with feedback: %s", call.Reason)
+	}
+
+	if call.Approval == ApprovalInvalid {
+		return "", fmt.Errorf("%s not executed, %s; fix the arguments and call the tool again", call.Name, call.Reason)
+	}
+
+	if call.Approval == ApprovalBlocked {
+		reason := call.Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		return "", fmt.Errorf("blocked by hook: %s", reason)
+	}
+
+	ctx, cancel := context.WithTimeout(parent, 2*time.Minute)
 	defer cancel()
 
 	if a.config.WorkingDir != "" {
 		ctx = tool.WithWorkingDir(ctx, a.config.WorkingDir)
 	}
-	ctx = builtin.WithSkillCallbacks(ctx, callbacks)
+
+	call.Diff = a.diff(call, ctx)
 
 	eventChannel <- Event{Type: EvtToolStarted, RunID: runID, CallID: call.ID}
 	output, err := a.tools.Execute(call.Name, call.Args, ctx)
+	output, err = a.applyPostToolHooks(runID, call, output, err, eventChannel)
 
 	if err != nil {
 		eventChannel <- Event{Type: EvtToolFailed, RunID: runID, CallID: call.ID, Error: err.Error()}
@@ -85,3 +135,48 @@ func (a *Agent) executeToolCall(runID core.RunID, call *pendingCall, callbacks *
 
 	return output, err
 }
+
+// diff captures the change a file-editing call is about to make so it can be kept with the tool result.
+func (a *Agent) diff(call *pendingCall, ctx context.Context) string {
+	differ, ok := a.tools.(interface {
+		Diff(name string, args map[string]any, ctx context.Context) (string, error)
+	})
+	if !ok {
+		return ""
+	}
+
+	diffText, err := differ.Diff(call.Name, call.Args, ctx)
+	if err != nil {
+		return ""
+	}
+	return diffText
+}
+
+func (a *Agent) applyPostToolHooks(runID core.RunID, call *pendingCall, output string, execErr error, eventChannel chan<- Event) (string, error) {
+	if !a.hooks.Has(hook.PostToolUse) {
+		return output, execErr
+	}
+
+	input := a.hookInput(hook.PostToolUse, runID)
+	input.ToolName = call.Name
+	input.ToolCallID = call.ID
+	input.ToolArgs = call.Args
+	input.ToolOutput = output
+	if execErr != nil {
+		input.ToolOutput = execErr.Error()
+		input.ToolError = true
+	}
+
+	result := a.hooks.Run(context.Background(), input)
+	a.emitHookMessages(runID, result, eventChannel)
+
+	if result.AdditionalContext == "" {
+		return output, execErr
+	}
+
+	if execErr != nil {
+		return output, fmt.Errorf("%w\n\n%s", execErr, result.AdditionalContext)
+	}
+
+	return output + "\n\n" + result.AdditionalContext, nil
+}
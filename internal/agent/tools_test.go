@@ -2,15 +2,24 @@ package agent
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/erg0nix/kontekst/internal/config"
 	"github.com/erg0nix/kontekst/internal/conversation"
 	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/hook"
 	"github.com/erg0nix/kontekst/internal/provider"
+	"github.com/erg0nix/kontekst/internal/tool"
+	"github.com/erg0nix/kontekst/internal/tool/builtin"
 )
 
 type mockContext struct {
 	messages []core.Message
+	plan     []core.PlanEntry
 }
 
 func (m *mockContext) SystemContent() string {
@@ -40,6 +49,22 @@ func (m *mockContext) ActiveSkill() *core.SkillMetadata {
 
 func (m *mockContext) SetAgentSystemPrompt(prompt string) {}
 
+func (m *mockContext) SetProjectMemory(index string) {}
+
+func (m *mockContext) ProjectMemory() string {
+	return ""
+}
+
+func (m *mockContext) SetPlan(entries []core.PlanEntry) {
+	m.plan = entries
+}
+
+func (m *mockContext) SetPlanNote(note core.Message) {}
+
+func (m *mockContext) Plan() []core.PlanEntry {
+	return m.plan
+}
+
 func (m *mockContext) Snapshot() conversation.Snapshot {
 	return conversation.Snapshot{}
 }
@@ -58,9 +83,13 @@ func (m *mockToolExecutor) Preview(name string, args map[string]any, ctx context
 	return "", nil
 }
 
+func (m *mockToolExecutor) ValidateArguments(name string, args map[string]any) (map[string]any, error) {
+	return args, nil
+}
+
 type mockProvider struct{}
 
-func (m *mockProvider) GenerateChat(messages []core.Message, tools []core.ToolDef, sampling *core.SamplingConfig, model string, useToolRole bool) (provider.Response, error) {
+func (m *mockProvider) GenerateChat(_ context.Context, messages []core.Message, tools []core.ToolDef, sampling *core.SamplingConfig, model string, useToolRole bool) (provider.Response, error) {
 	return provider.Response{}, nil
 }
 
@@ -197,3 +226,207 @@ func TestExecuteTools_MixedApprovedAndDenied(t *testing.T) {
 		t.Error("expected first message to not be an error")
 	}
 }
+
+func newHookRunner(t *testing.T, cfg func(script string) config.HooksConfig, body string) *hook.Runner {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := hook.NewRunner(cfg(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func TestExecuteTools_PreToolHookBlocksCall(t *testing.T) {
+	ctx := &mockContext{}
+	eventCh := make(chan Event, 32)
+	ag := &Agent{
+		context:  ctx,
+		provider: &mockProvider{},
+		tools:    &mockToolExecutor{},
+		hooks: newHookRunner(t, func(script string) config.HooksConfig {
+			return config.HooksConfig{PreToolUse: []config.HookConfig{{Command: script, Matcher: "write_file"}}}
+		}, "echo 'vendor/ is read-only' >&2\nexit 2\n"),
+	}
+
+	batch := buildPending([]core.ToolCall{
+		{ID: "call1", Name: "write_file", Arguments: map[string]any{"path": "vendor/a.go"}},
+		{ID: "call2", Name: "read_file", Arguments: map[string]any{"path": "a.go"}},
+	})
+	ag.applyPreToolHooks("run1", batch, eventCh)
+
+	proposed := batch.asProposed(nil, context.Background())
+	if len(proposed) != 1 || proposed[0].CallID != "call2" {
+		t.Fatalf("expected only call2 to be proposed, got %+v", proposed)
+	}
+
+	batch.calls["call2"].Approval = ApprovalGranted
+	decisions := collectDecisions(batch)
+	if anyWasDenied(decisions) {
+		t.Fatal("hook-blocked calls must not end the run like a user denial")
+	}
+
+	if err := ag.executeTools("run1", decisions, eventCh); err != nil {
+		t.Fatalf("executeTools failed: %v", err)
+	}
+
+	for _, msg := range ctx.messages {
+		if msg.ToolResult.CallID != "call1" {
+			continue
+		}
+		if !msg.ToolResult.IsError || !strings.Contains(msg.ToolResult.Output, "vendor/ is read-only") {
+			t.Fatalf("expected blocked result with hook reason, got %+v", msg.ToolResult)
+		}
+		return
+	}
+	t.Fatal("missing tool result for blocked call")
+}
+
+func TestApplyPreToolHooks_ValidatesRewrittenArguments(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		approval ApprovalState
+		args     map[string]any
+	}{
+		{"valid rewrite is coerced", `{"arguments":{"path":"safe.go","limit":"5"}}`, ApprovalPending, map[string]any{"path": "safe.go", "limit": 5}},
+		{"rewrite breaking the schema", `{"arguments":{"limit":"lots"}}`, ApprovalInvalid, nil},
+		{"allow with a broken rewrite", `{"decision":"allow","arguments":{"path":3}}`, ApprovalInvalid, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := tool.NewRegistry()
+			builtin.RegisterReadFile(registry, t.TempDir())
+			ag := &Agent{
+				context:  &mockContext{},
+				provider: &mockProvider{},
+				tools:    registry,
+				hooks: newHookRunner(t, func(script string) config.HooksConfig {
+					return config.HooksConfig{PreToolUse: []config.HookConfig{{Command: script}}}
+				}, "echo '"+tt.output+"'\n"),
+			}
+
+			batch := buildPending([]core.ToolCall{{ID: "call1", Name: "read_file", Arguments: map[string]any{"path": "a.go"}}})
+			ag.validateCalls(batch)
+			ag.applyPreToolHooks("run1", batch, make(chan Event, 32))
+
+			call := batch.calls["call1"]
+			if call.Approval != tt.approval {
+				t.Fatalf("approval = %v, want %v (reason %q)", call.Approval, tt.approval, call.Reason)
+			}
+			if tt.args != nil && fmt.Sprint(call.Args) != fmt.Sprint(tt.args) {
+				t.Errorf("args = %v, want %v", call.Args, tt.args)
+			}
+			if tt.approval == ApprovalInvalid && !strings.Contains(call.Reason, "pre_tool_use hook") {
+				t.Errorf("reason = %q, want it to name the hook", call.Reason)
+			}
+		})
+	}
+}
+
+func TestExecuteTools_PostToolHookAppendsContext(t *testing.T) {
+	ctx := &mockContext{}
+	eventCh := make(chan Event, 32)
+	ag := &Agent{
+		context:  ctx,
+		provider: &mockProvider{},
+		tools:    &mockToolExecutor{},
+		hooks: newHookRunner(t, func(script string) config.HooksConfig {
+			return config.HooksConfig{PostToolUse: []config.HookConfig{{Command: script}}}
+		}, `echo '{"additional_context":"gofmt: ok","message":"formatted"}'`),
+	}
+
+	calls := []*pendingCall{
+		{ID: "call1", Name: "edit_file", Args: map[string]any{}, Approval: ApprovalGranted},
+	}
+
+	if err := ag.executeTools("run1", calls, eventCh); err != nil {
+		t.Fatalf("executeTools failed: %v", err)
+	}
+
+	if got := ctx.messages[0].ToolResult.Output; got != "mock output\n\ngofmt: ok" {
+		t.Fatalf("tool output = %q", got)
+	}
+
+	close(eventCh)
+	var sawHook bool
+	for evt := range eventCh {
+		if evt.Type == EvtHookOutput && evt.Output == "formatted" && evt.HookEvent == string(hook.PostToolUse) {
+			sawHook = true
+		}
+	}
+	if !sawHook {
+		t.Fatal("expected hook output event")
+	}
+}
+
+type mockPlanStore struct {
+	saved map[core.SessionID][]core.PlanEntry
+}
+
+func (m *mockPlanStore) GetPlan(sessionID core.SessionID) ([]core.PlanEntry, error) {
+	return m.saved[sessionID], nil
+}
+
+func (m *mockPlanStore) SetPlan(sessionID core.SessionID, entries []core.PlanEntry) error {
+	m.saved[sessionID] = entries
+	return nil
+}
+
+func TestExecuteTools_TodoUpdatesPlan(t *testing.T) {
+	registry := tool.NewRegistry()
+	builtin.RegisterTodo(registry)
+
+	ctx := &mockContext{}
+	store := &mockPlanStore{saved: make(map[core.SessionID][]core.PlanEntry)}
+	eventCh := make(chan Event, 32)
+	ag := &Agent{
+		context:  ctx,
+		provider: &mockProvider{},
+		tools:    registry,
+		plans:    store,
+		config:   RunConfig{SessionID: "sess_1"},
+	}
+
+	calls := []*pendingCall{
+		{ID: "call1", Name: "todo", Approval: ApprovalGranted, Args: map[string]any{
+			"todos": []any{
+				map[string]any{"content": "Write parser", "status": "in_progress", "priority": "high"},
+				map[string]any{"content": "Add tests", "status": "pending"},
+			},
+		}},
+	}
+
+	if err := ag.executeTools("run1", calls, eventCh); err != nil {
+		t.Fatalf("executeTools failed: %v", err)
+	}
+
+	want := []core.PlanEntry{
+		{Content: "Write parser", Priority: core.PlanPriorityHigh, Status: core.PlanStatusInProgress},
+		{Content: "Add tests", Priority: core.PlanPriorityMedium, Status: core.PlanStatusPending},
+	}
+	if len(ctx.plan) != 2 || ctx.plan[0] != want[0] || ctx.plan[1] != want[1] {
+		t.Fatalf("window plan = %+v, want %+v", ctx.plan, want)
+	}
+	if len(store.saved["sess_1"]) != 2 {
+		t.Fatalf("expected plan to be persisted, got %+v", store.saved)
+	}
+	if ctx.messages[0].ToolResult.IsError {
+		t.Fatalf("todo tool failed: %s", ctx.messages[0].ToolResult.Output)
+	}
+
+	close(eventCh)
+	var sawPlan bool
+	for evt := range eventCh {
+		if evt.Type == EvtPlanUpdated && len(evt.Plan) == 2 {
+			sawPlan = true
+		}
+	}
+	if !sawPlan {
+		t.Fatal("expected plan updated event")
+	}
+}
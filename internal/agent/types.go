@@ -13,10 +13,12 @@ type CommandType string
 type EventType string
 
 const (
-	// CmdApproveTool is a command that approves a proposed tool call for execution.
+	// CmdApproveTool is a command that approves a proposed tool call for execution, optionally with edited arguments.
 	CmdApproveTool CommandType = "approve_tool"
 	// CmdDenyTool is a command that denies a proposed tool call.
 	CmdDenyTool CommandType = "deny_tool"
+	// CmdRejectTool is a command that rejects a proposed tool call with feedback for the model, continuing the run.
+	CmdRejectTool CommandType = "reject_tool"
 	// CmdCancel is a command that cancels the current agent run.
 	CmdCancel CommandType = "cancel"
 	// EvtRunStarted is emitted when a new agent run begins.
@@ -29,6 +31,8 @@ const (
 	EvtTurnCompleted EventType = "turn_completed"
 	// EvtToolsProposed is emitted when the LLM proposes one or more tool calls for approval.
 	EvtToolsProposed EventType = "tools_proposed"
+	// EvtToolEdited is emitted when a tool call is approved with user-edited arguments.
+	EvtToolEdited EventType = "tool_edited"
 	// EvtToolStarted is emitted when a tool begins executing.
 	EvtToolStarted EventType = "tool_execution_started"
 	// EvtToolCompleted is emitted when a tool finishes executing successfully.
@@ -43,13 +47,23 @@ const (
 	EvtRunCancelled EventType = "run_cancelled"
 	// EvtRunFailed is emitted when the agent run terminates due to an error.
 	EvtRunFailed EventType = "run_failed"
+	// EvtRunStopped is emitted when the agent run is ended early because it kept repeating itself.
+	EvtRunStopped EventType = "run_stopped"
+	// EvtLoopDetected is emitted when repetition is first detected and a corrective note is injected.
+	EvtLoopDetected EventType = "loop_detected"
+	// EvtHookOutput is emitted when a lifecycle hook produces output for the user.
+	EvtHookOutput EventType = "hook_output"
+	// EvtPlanUpdated is emitted when the todo tool replaces the session's plan.
+	EvtPlanUpdated EventType = "plan_updated"
 )
 
 // Command represents an instruction sent from a client to control the agent run.
 type Command struct {
-	Type   CommandType
-	CallID string
-	Reason string
+	Type      CommandType
+	CallID    string
+	Reason    string
+	Arguments map[string]any
+	Feedback  string
 }
 
 // Event represents a notification emitted by the agent during a run.
@@ -66,6 +80,8 @@ type Event struct {
 	Response  provider.Response
 	Snapshot  *conversation.Snapshot
 	Error     string
+	HookEvent string
+	Plan      []core.PlanEntry
 }
 
 // ProposedToolCall represents a tool call proposed by the LLM that awaits client approval.
@@ -74,4 +90,6 @@ type ProposedToolCall struct {
 	Name          string
 	ArgumentsJSON string
 	Preview       string
+	Approved      bool
+	Error         string
 }
@@ -0,0 +1,294 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/agent"
+	"github.com/erg0nix/kontekst/internal/command"
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/protocol"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+	"github.com/erg0nix/kontekst/internal/session"
+	"github.com/erg0nix/kontekst/internal/skill"
+)
+
+// manage serves the _kontekst methods that list and read the daemon's agents, sessions, skills and
+// commands, delete sessions and reload the registries. It reports false for any other method.
+func (d *daemon) manage(method string, params json.RawMessage) (any, bool, error) {
+	switch method {
+	case types.MethodKontekstAgentsList:
+		resp, err := listAgents(d.services.Agents)
+		return resp, true, err
+	case types.MethodKontekstAgentsGet:
+		resp, err := getAgent(d.services.Agents, params)
+		return resp, true, err
+	case types.MethodKontekstSessionsList:
+		resp, err := d.listSessions()
+		return resp, true, err
+	case types.MethodKontekstSessionsGet:
+		resp, err := d.getSession(params)
+		return resp, true, err
+	case types.MethodKontekstSessionsDelete:
+		resp, err := d.deleteSession(params)
+		return resp, true, err
+	case types.MethodKontekstSkillsList:
+		return listSkills(d.services.Skills), true, nil
+	case types.MethodKontekstSkillsGet:
+		resp, err := getSkill(d.services.Skills, params)
+		return resp, true, err
+	case types.MethodKontekstCommandsList:
+		return listCommands(d.services.Commands), true, nil
+	case types.MethodKontekstCommandsGet:
+		resp, err := getCommand(d.services.Commands, params)
+		return resp, true, err
+	case types.MethodKontekstReload:
+		resp, err := d.reload()
+		return resp, true, err
+	}
+	return nil, false, nil
+}
+
+func listAgents(registry *agent.Registry) (types.ListAgentsResponse, error) {
+	agents, err := registry.List()
+	if err != nil {
+		return types.ListAgentsResponse{}, protocol.NewRPCError(types.ErrInternalError, err.Error())
+	}
+
+	resp := types.ListAgentsResponse{Agents: make([]types.AgentSummary, 0, len(agents))}
+	for _, a := range agents {
+		resp.Agents = append(resp.Agents, types.AgentSummary{
+			Name:        a.Name,
+			DisplayName: a.DisplayName,
+			HasPrompt:   a.HasPrompt,
+			HasConfig:   a.HasConfig,
+		})
+	}
+	return resp, nil
+}
+
+func getAgent(registry *agent.Registry, params json.RawMessage) (types.AgentDetail, error) {
+	var req types.NameRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return types.AgentDetail{}, protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+	if !validName(req.Name) {
+		return types.AgentDetail{}, protocol.NewRPCError(types.ErrInvalidParams, fmt.Sprintf("invalid agent name %q", req.Name))
+	}
+
+	cfg, err := registry.Load(req.Name)
+	if notFound := (*agent.NotFoundError)(nil); errors.As(err, &notFound) {
+		return types.AgentDetail{}, protocol.NewRPCError(types.ErrNotFound, err.Error())
+	}
+	if err != nil {
+		return types.AgentDetail{}, protocol.NewRPCError(types.ErrInternalError, err.Error())
+	}
+
+	detail := types.AgentDetail{
+		Name:               cfg.Name,
+		DisplayName:        cfg.DisplayName,
+		SystemPrompt:       cfg.SystemPrompt,
+		ContextSize:        cfg.ContextSize,
+		Endpoint:           cfg.Provider.Endpoint,
+		Model:              cfg.Provider.Model,
+		HTTPTimeoutSeconds: int(cfg.Provider.HTTPTimeout / time.Second),
+		ToolRole:           cfg.ToolRole,
+	}
+	if s := cfg.Sampling; s != nil {
+		detail.Sampling = &types.SamplingOverride{
+			Temperature:   s.Temperature,
+			TopP:          s.TopP,
+			TopK:          s.TopK,
+			RepeatPenalty: s.RepeatPenalty,
+			MaxTokens:     s.MaxTokens,
+		}
+	}
+	return detail, nil
+}
+
+func (d *daemon) listSessions() (types.ListSessionsResponse, error) {
+	infos, err := d.services.Sessions.List()
+	if err != nil {
+		return types.ListSessionsResponse{}, protocol.NewRPCError(types.ErrInternalError, err.Error())
+	}
+
+	resp := types.ListSessionsResponse{Sessions: make([]types.SessionInfo, 0, len(infos))}
+	for _, info := range infos {
+		resp.Sessions = append(resp.Sessions, d.sessionInfo(info))
+	}
+	return resp, nil
+}
+
+func (d *daemon) getSession(params json.RawMessage) (types.SessionInfo, error) {
+	id, err := sessionParam(params)
+	if err != nil {
+		return types.SessionInfo{}, err
+	}
+
+	info, err := d.services.Sessions.Get(id)
+	if errors.Is(err, session.ErrNotFound) {
+		return types.SessionInfo{}, protocol.NewRPCError(types.ErrNotFound, err.Error())
+	}
+	if err != nil {
+		return types.SessionInfo{}, protocol.NewRPCError(types.ErrInternalError, err.Error())
+	}
+	return d.sessionInfo(info), nil
+}
+
+// deleteSession removes a session's files. A session with an active run cannot be deleted.
+func (d *daemon) deleteSession(params json.RawMessage) (struct{}, error) {
+	id, err := sessionParam(params)
+	if err != nil {
+		return struct{}{}, err
+	}
+	if d.sessions.Running(types.SessionID(id)) {
+		return struct{}{}, protocol.NewRPCError(types.ErrInvalidParams, "session has an active run")
+	}
+
+	err = d.services.Sessions.Delete(id)
+	if errors.Is(err, session.ErrNotFound) {
+		return struct{}{}, protocol.NewRPCError(types.ErrNotFound, err.Error())
+	}
+	if err != nil {
+		return struct{}{}, protocol.NewRPCError(types.ErrInternalError, err.Error())
+	}
+	return struct{}{}, nil
+}
+
+func (d *daemon) sessionInfo(info session.Info) types.SessionInfo {
+	children := make([]types.SessionID, 0, len(info.Children))
+	for _, child := range info.Children {
+		children = append(children, types.SessionID(child))
+	}
+	return types.SessionInfo{
+		SessionID:        types.SessionID(info.ID),
+		Title:            info.Title,
+		Tags:             info.Tags,
+		Agent:            info.DefaultAgent,
+		WorkingDir:       info.WorkingDir,
+		PromptTokens:     info.Usage.PromptTokens,
+		CompletionTokens: info.Usage.CompletionTokens,
+		ParentID:         types.SessionID(info.ParentID),
+		ForkedAt:         info.ForkedAt,
+		Children:         children,
+		Messages:         info.MessageCount,
+		FileSize:         info.FileSize,
+		CreatedAt:        info.CreatedAt.Format(time.RFC3339),
+		ModifiedAt:       info.ModifiedAt.Format(time.RFC3339),
+		Running:          d.sessions.Running(types.SessionID(info.ID)),
+	}
+}
+
+func sessionParam(params json.RawMessage) (core.SessionID, error) {
+	var req types.SessionRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return "", protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+	if !validName(string(req.SessionID)) {
+		return "", protocol.NewRPCError(types.ErrInvalidParams, fmt.Sprintf("invalid session ID %q", req.SessionID))
+	}
+	return core.SessionID(req.SessionID), nil
+}
+
+// validName reports whether name can name a file in one of the data directory's folders.
+func validName(name string) bool {
+	return name != "" && name == filepath.Base(name) && !strings.HasPrefix(name, ".")
+}
+
+func listSkills(registry *skill.Registry) types.ListSkillsResponse {
+	skills := registry.List()
+	resp := types.ListSkillsResponse{Skills: make([]types.SkillInfo, 0, len(skills))}
+	for _, s := range skills {
+		resp.Skills = append(resp.Skills, skillInfo(s))
+	}
+	return resp
+}
+
+func getSkill(registry *skill.Registry, params json.RawMessage) (types.SkillInfo, error) {
+	var req types.NameRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return types.SkillInfo{}, protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+
+	s, ok := registry.Get(req.Name)
+	if !ok {
+		return types.SkillInfo{}, protocol.NewRPCError(types.ErrNotFound, fmt.Sprintf("skill not found: %s", req.Name))
+	}
+	info := skillInfo(s)
+	info.Content = s.Content
+	return info, nil
+}
+
+func skillInfo(s *skill.Skill) types.SkillInfo {
+	return types.SkillInfo{
+		Name:           s.Name,
+		Description:    s.Description,
+		Path:           s.Path,
+		UserInvocable:  s.UserInvocable,
+		ModelInvocable: !s.DisableModelInvocation,
+	}
+}
+
+func listCommands(registry *command.Registry) types.ListCommandsResponse {
+	commands := registry.List()
+	resp := types.ListCommandsResponse{Commands: make([]types.CommandInfo, 0, len(commands))}
+	for _, cmd := range commands {
+		resp.Commands = append(resp.Commands, commandInfo(cmd))
+	}
+	return resp
+}
+
+func getCommand(registry *command.Registry, params json.RawMessage) (types.CommandInfo, error) {
+	var req types.NameRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return types.CommandInfo{}, protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+
+	cmd, ok := registry.Get(req.Name)
+	if !ok {
+		return types.CommandInfo{}, protocol.NewRPCError(types.ErrNotFound, fmt.Sprintf("command not found: %s", req.Name))
+	}
+	return commandInfo(cmd), nil
+}
+
+func commandInfo(cmd *command.Command) types.CommandInfo {
+	args := make([]types.CommandArgument, 0, len(cmd.Arguments))
+	for _, arg := range cmd.Arguments {
+		args = append(args, types.CommandArgument{
+			Name:        arg.Name,
+			Type:        arg.Type,
+			Description: arg.Description,
+			Required:    arg.Required,
+			Default:     arg.Default,
+		})
+	}
+	return types.CommandInfo{
+		Name:        cmd.Name,
+		Description: cmd.Description,
+		Runtime:     cmd.Runtime,
+		Timeout:     cmd.Timeout,
+		Arguments:   args,
+	}
+}
+
+// reload rereads skills and commands from disk the way the directory watcher does, and counts what is
+// loaded afterwards.
+func (d *daemon) reload() (types.ReloadResponse, error) {
+	if err := d.reloadRegistries(); err != nil {
+		return types.ReloadResponse{}, protocol.NewRPCError(types.ErrInternalError, fmt.Sprintf("reload: %v", err))
+	}
+
+	agents, err := d.services.Agents.List()
+	if err != nil {
+		return types.ReloadResponse{}, protocol.NewRPCError(types.ErrInternalError, fmt.Sprintf("list agents: %v", err))
+	}
+	return types.ReloadResponse{
+		Agents:   len(agents),
+		Skills:   len(d.services.Skills.List()),
+		Commands: len(d.services.Commands.List()),
+	}, nil
+}
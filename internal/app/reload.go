@@ -0,0 +1,184 @@
+package app
+
+import (
+	"io/fs"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/command"
+	"github.com/erg0nix/kontekst/internal/protocol"
+	"github.com/erg0nix/kontekst/internal/skill"
+)
+
+// watchInterval is how often the daemon checks the agents, skills and commands directories for changes.
+const watchInterval = 2 * time.Second
+
+// fileStamp is what a poll records about a file to notice that it changed.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// watch polls the agents, skills and commands directories until stop is closed and reloads the registries
+// once a change has settled, that is when a poll finds nothing new since the poll that saw the change.
+func (d *daemon) watch(interval time.Duration, stop <-chan struct{}) {
+	dirs := d.watchedDirs()
+	last := stampDirs(dirs)
+	pending := false
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := stampDirs(dirs)
+		if !maps.Equal(current, last) {
+			last = current
+			pending = true
+			continue
+		}
+		if pending {
+			pending = false
+			d.reloadRegistries()
+		}
+	}
+}
+
+func (d *daemon) watchedDirs() []string {
+	return []string{
+		d.services.Agents.AgentsDir,
+		filepath.Join(d.cfg.DataDir, "skills"),
+		filepath.Join(d.cfg.DataDir, "commands"),
+	}
+}
+
+// stampDirs records every file and directory under dirs. Directories that do not exist are skipped.
+func stampDirs(dirs []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, dir := range dirs {
+		_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+			stamps[path] = fileStamp{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+			return nil
+		})
+	}
+	return stamps
+}
+
+// reloadRegistries rereads skills and commands, checks every agent's configuration and logs what changed.
+// Each registry is swapped in whole, and a file that no longer parses keeps its previous version. When the
+// skills changed, clients with an open session are sent the new available commands.
+func (d *daemon) reloadRegistries() error {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	skillsBefore := d.services.Skills.List()
+	if err := d.services.Skills.Load(); err != nil {
+		slog.Warn("failed to reload skills", "error", err)
+		return err
+	}
+	skillsChanged := logChanges("skills", skillsByName(skillsBefore), skillsByName(d.services.Skills.List()))
+
+	commandsBefore := d.services.Commands.List()
+	if err := d.services.Commands.Load(); err != nil {
+		slog.Warn("failed to reload commands", "error", err)
+		return err
+	}
+	logChanges("commands", commandsByName(commandsBefore), commandsByName(d.services.Commands.List()))
+
+	agents, err := d.loadAgents()
+	if err != nil {
+		slog.Warn("failed to reload agents", "error", err)
+		return err
+	}
+	if d.agents != nil {
+		logChanges("agents", d.agents, agents)
+	}
+	d.agents = agents
+
+	if skillsChanged {
+		d.sessions.UpdateCommands(protocol.AvailableCommands(d.services.Skills))
+	}
+	return nil
+}
+
+// loadAgents loads every agent's configuration. Agents are read from disk each time a run starts, so this
+// only reports an agent whose configuration no longer loads; it is left out of the result.
+func (d *daemon) loadAgents() (map[string]any, error) {
+	summaries, err := d.services.Agents.List()
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make(map[string]any, len(summaries))
+	for _, summary := range summaries {
+		cfg, err := d.services.Agents.Load(summary.Name)
+		if err != nil {
+			slog.Warn("agent configuration is invalid", "agent", summary.Name, "error", err)
+			continue
+		}
+		agents[summary.Name] = *cfg
+	}
+	return agents, nil
+}
+
+func skillsByName(skills []*skill.Skill) map[string]any {
+	result := make(map[string]any, len(skills))
+	for _, s := range skills {
+		result[s.Name] = *s
+	}
+	return result
+}
+
+func commandsByName(commands []*command.Command) map[string]any {
+	result := make(map[string]any, len(commands))
+	for _, cmd := range commands {
+		result[cmd.Name] = *cmd
+	}
+	return result
+}
+
+// logChanges logs the names added, removed and updated between two versions of a registry and reports
+// whether there were any.
+func logChanges(kind string, before, after map[string]any) bool {
+	var added, removed, updated []string
+	for name, item := range after {
+		previous, ok := before[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case !reflect.DeepEqual(previous, item):
+			updated = append(updated, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	if len(added)+len(removed)+len(updated) == 0 {
+		return false
+	}
+
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(updated)
+	slog.Info("reloaded "+kind, "added", added, "removed", removed, "updated", updated)
+	return true
+}
@@ -2,10 +2,15 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -15,25 +20,88 @@ import (
 	"time"
 
 	"github.com/erg0nix/kontekst/internal/agent"
+	"github.com/erg0nix/kontekst/internal/auth"
 	"github.com/erg0nix/kontekst/internal/config"
 	agentConfig "github.com/erg0nix/kontekst/internal/config/agent"
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/gateway"
 	"github.com/erg0nix/kontekst/internal/protocol"
 	"github.com/erg0nix/kontekst/internal/protocol/types"
+	"github.com/erg0nix/kontekst/internal/search"
+	"github.com/erg0nix/kontekst/internal/session"
 )
 
-// RunServer starts the TCP server, listens for connections, and shuts down on signal or request.
+// RunServer starts the server on the configured address, and the WebSocket and OpenAI-compatible
+// listeners if they are configured, and serves connections until it shuts down on signal or request.
 func RunServer(cfg config.Config) error {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
 	slog.SetDefault(logger)
 
-	services := NewServices(cfg)
-	startTime := time.Now()
+	tokens, err := auth.Load(cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+
+	d := &daemon{
+		cfg:        cfg,
+		services:   NewServices(cfg),
+		sessions:   protocol.NewSessionManager(),
+		tokens:     tokens,
+		startTime:  time.Now(),
+		shutdownCh: make(chan struct{}),
+	}
 
-	listener, err := net.Listen("tcp", cfg.Bind)
+	listener, err := listen(cfg, cfg.Bind)
 	if err != nil {
-		return fmt.Errorf("server: listen %s: %w", cfg.Bind, err)
+		return err
+	}
+
+	var httpServers []*http.Server
+	closeAll := func() {
+		listener.Close()
+		for _, server := range httpServers {
+			server.Close()
+		}
+	}
+
+	if cfg.WebSocket.Bind != "" {
+		mux := http.NewServeMux()
+		mux.Handle(protocol.WebSocketPath, protocol.NewWebSocketHandler(cfg.WebSocket.AllowedOrigins, func(stream io.ReadWriteCloser, r *http.Request) {
+			var cert *x509.Certificate
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+				cert = r.TLS.VerifiedChains[0][0]
+			}
+			d.wg.Add(1)
+			defer d.wg.Done()
+			d.serve(stream, cert)
+		}))
+
+		server, err := serveHTTP(cfg, cfg.WebSocket.Bind, mux)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		httpServers = append(httpServers, server)
+		slog.Info("websocket listening", "address", cfg.WebSocket.Bind, "path", protocol.WebSocketPath)
+	}
+
+	if cfg.OpenAI.Bind != "" {
+		server, err := serveHTTP(cfg, cfg.OpenAI.Bind, gateway.New(d.services.Runner, d.services.Agents, d.sessions, tokens, cfg.OpenAI))
+		if err != nil {
+			closeAll()
+			return err
+		}
+		httpServers = append(httpServers, server)
+		slog.Info("openai api listening", "address", cfg.OpenAI.Bind)
 	}
 
+	if d.agents, err = d.loadAgents(); err != nil {
+		slog.Warn("failed to list agents", "error", err)
+	}
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go d.watch(watchInterval, stopWatch)
+
 	pidFile := filepath.Join(cfg.DataDir, "server.pid")
 	if err := writePIDFile(pidFile); err != nil {
 		slog.Warn("failed to write PID file", "error", err)
@@ -42,21 +110,22 @@ func RunServer(cfg config.Config) error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
 
-	shutdownCh := make(chan struct{})
-
-	var wg sync.WaitGroup
-
 	go func() {
 		for {
 			conn, err := listener.Accept()
 			if err != nil {
 				return
 			}
+			if err := protocol.CheckPeer(conn); err != nil {
+				slog.Warn("rejected connection", "error", err)
+				conn.Close()
+				continue
+			}
 
-			wg.Add(1)
+			d.wg.Add(1)
 			go func() {
-				defer wg.Done()
-				handleConnection(conn, services, cfg, startTime, shutdownCh)
+				defer d.wg.Done()
+				d.handleConnection(conn)
 			}()
 		}
 	}()
@@ -66,14 +135,14 @@ func RunServer(cfg config.Config) error {
 	select {
 	case <-ctx.Done():
 		slog.Info("received signal, shutting down")
-	case <-shutdownCh:
+	case <-d.shutdownCh:
 		slog.Info("shutdown requested via protocol")
 	}
 
-	listener.Close()
+	closeAll()
 
 	done := make(chan struct{})
-	go func() { wg.Wait(); close(done) }()
+	go func() { d.wg.Wait(); close(done) }()
 
 	select {
 	case <-done:
@@ -85,40 +154,216 @@ func RunServer(cfg config.Config) error {
 	return nil
 }
 
-func handleConnection(conn net.Conn, services Services, cfg config.Config, startTime time.Time, shutdownCh chan struct{}) {
+// listen opens a listener for addr, with the server's TLS configuration for a tls:// address.
+func listen(cfg config.Config, addr string) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	network, address := protocol.SplitAddress(addr)
+	if network == "tls" {
+		host, _, _ := net.SplitHostPort(address)
+		var err error
+		if tlsConfig, err = auth.ServerTLS(cfg.DataDir, cfg.TLS, host); err != nil {
+			return nil, fmt.Errorf("server: %w", err)
+		}
+	}
+
+	listener, err := protocol.Listen(addr, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("server: listen %s: %w", addr, err)
+	}
+	if network == "tcp" && !isLoopback(address) {
+		slog.Warn("listening on a non-loopback TCP address without TLS; tokens and session data are sent in plaintext", "address", addr)
+	}
+	return listener, nil
+}
+
+// serveHTTP serves handler on a listener for addr until the returned server is closed.
+func serveHTTP(cfg config.Config, addr string, handler http.Handler) (*http.Server, error) {
+	listener, err := listen(cfg, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("http listener stopped", "address", addr, "error", err)
+		}
+	}()
+	return server, nil
+}
+
+// daemon holds what the server's connections share, whichever listener they arrive on.
+type daemon struct {
+	cfg        config.Config
+	services   Services
+	sessions   *protocol.SessionManager
+	tokens     *auth.Store
+	startTime  time.Time
+	shutdownCh chan struct{}
+	wg         sync.WaitGroup
+
+	// reloadMu serializes reloads; agents is each agent's configuration as of the last one.
+	reloadMu sync.Mutex
+	agents   map[string]any
+
+	// clients maps each connection's handler to when it connected.
+	clientsMu sync.Mutex
+	clients   map[*protocol.Handler]time.Time
+}
+
+// handleConnection completes a TLS handshake, if any, and serves the connection.
+func (d *daemon) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	handler := protocol.NewHandler(services.Runner, services.Agents, services.Skills)
+	handshakeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	cert, err := protocol.PeerCertificate(handshakeCtx, conn)
+	cancel()
+	if err != nil {
+		slog.Warn("rejected connection", "remote", conn.RemoteAddr(), "error", err)
+		return
+	}
+
+	d.serve(conn, cert)
+}
+
+// serve runs ACP on a stream until it closes. A verified client certificate authenticates the connection.
+func (d *daemon) serve(stream io.ReadWriteCloser, cert *x509.Certificate) {
+	handler := protocol.NewHandler(d.services.Runner, d.services.Agents, d.services.Skills, d.sessions)
+	handler.RequireAuth(d.tokens)
+	if cert != nil {
+		handler.AuthenticateAs(d.tokens.ForCertificate(cert))
+	}
 
 	dispatch := func(ctx context.Context, method string, params json.RawMessage) (any, error) {
 		switch method {
 		case types.MethodKontekstStatus:
-			uptime := time.Since(startTime).Round(time.Second).String()
-			return types.StatusResponse{
-				Bind:      cfg.Bind,
-				Uptime:    uptime,
-				StartedAt: startTime.Format(time.RFC3339),
-				DataDir:   cfg.DataDir,
-			}, nil
+			return d.status(ctx, handler), nil
 
 		case types.MethodKontekstShutdown:
 			go func() {
 				select {
-				case shutdownCh <- struct{}{}:
+				case d.shutdownCh <- struct{}{}:
 				default:
 				}
 			}()
 			return map[string]any{"message": "shutting down"}, nil
 
+		case types.MethodKontekstSessionFork:
+			return forkSession(d.services.Sessions, params)
+
+		case types.MethodKontekstSessionsSearch:
+			return searchSessions(d.services.Search, params)
+
 		default:
+			if resp, ok, err := d.manage(method, params); ok {
+				return resp, err
+			}
 			return handler.Dispatch(ctx, method, params)
 		}
 	}
 
-	acpConn := handler.ServeWith(dispatch, conn, conn)
+	removeClient := d.addClient(handler)
+	defer removeClient()
+
+	acpConn := handler.ServeWith(dispatch, stream, stream)
 	<-acpConn.Done()
 }
 
+// isLoopback reports whether a TCP listen address only accepts local connections.
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func forkSession(sessions *session.FileService, params json.RawMessage) (types.ForkSessionResponse, error) {
+	var req types.ForkSessionRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return types.ForkSessionResponse{}, protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+
+	if !validName(string(req.SessionID)) {
+		return types.ForkSessionResponse{}, protocol.NewRPCError(types.ErrInvalidParams, fmt.Sprintf("invalid session ID %q", req.SessionID))
+	}
+
+	at := -1
+	if req.At != nil {
+		if *req.At < 0 {
+			return types.ForkSessionResponse{}, protocol.NewRPCError(types.ErrInvalidParams, "at must not be negative")
+		}
+		at = *req.At
+	}
+
+	childID, err := sessions.Fork(core.SessionID(req.SessionID), at)
+	if errors.Is(err, session.ErrNotFound) {
+		return types.ForkSessionResponse{}, protocol.NewRPCError(types.ErrNotFound, err.Error())
+	}
+	if err != nil {
+		return types.ForkSessionResponse{}, protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+
+	info, err := sessions.Get(childID)
+	if err != nil {
+		return types.ForkSessionResponse{}, protocol.NewRPCError(types.ErrInternalError, err.Error())
+	}
+
+	return types.ForkSessionResponse{
+		SessionID: types.SessionID(childID),
+		ParentID:  req.SessionID,
+		Messages:  info.MessageCount,
+	}, nil
+}
+
+func searchSessions(index *search.Index, params json.RawMessage) (types.SearchSessionsResponse, error) {
+	var req types.SearchSessionsRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return types.SearchSessionsResponse{}, protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+
+	role, err := search.ParseRole(req.Role)
+	if err != nil {
+		return types.SearchSessionsResponse{}, protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+	since, until, err := search.ParseRange(req.Since, req.Until)
+	if err != nil {
+		return types.SearchSessionsResponse{}, protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+	results, err := index.Search(search.Query{
+		Text:  req.Query,
+		Agent: req.Agent,
+		Role:  role,
+		Since: since,
+		Until: until,
+		Limit: req.Limit,
+	})
+	if errors.Is(err, search.ErrEmptyQuery) {
+		return types.SearchSessionsResponse{}, protocol.NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+	if err != nil {
+		return types.SearchSessionsResponse{}, protocol.NewRPCError(types.ErrInternalError, err.Error())
+	}
+
+	resp := types.SearchSessionsResponse{Results: make([]types.SessionSearchResult, 0, len(results))}
+	for _, result := range results {
+		resp.Results = append(resp.Results, types.SessionSearchResult{
+			SessionID:    types.SessionID(result.SessionID),
+			MessageIndex: result.MessageIndex,
+			Role:         string(result.Role),
+			Agent:        result.Agent,
+			Time:         result.Time.Format(time.RFC3339),
+			Score:        result.Score,
+			Snippet:      result.Snippet,
+		})
+	}
+	return resp, nil
+}
+
 func writePIDFile(path string) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return fmt.Errorf("write pid file: mkdir: %w", err)
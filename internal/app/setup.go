@@ -13,6 +13,8 @@ import (
 	skillsConfig "github.com/erg0nix/kontekst/internal/config/skill"
 	"github.com/erg0nix/kontekst/internal/conversation"
 	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/memory"
+	"github.com/erg0nix/kontekst/internal/search"
 	"github.com/erg0nix/kontekst/internal/session"
 	"github.com/erg0nix/kontekst/internal/skill"
 	"github.com/erg0nix/kontekst/internal/tool"
@@ -21,9 +23,12 @@ import (
 
 // Services holds the wired-up services needed by the server and CLI.
 type Services struct {
-	Runner *agent.DefaultRunner
-	Agents *agent.Registry
-	Skills *skill.Registry
+	Runner   *agent.DefaultRunner
+	Agents   *agent.Registry
+	Skills   *skill.Registry
+	Commands *command.Registry
+	Sessions *session.FileService
+	Search   *search.Index
 }
 
 type conversationFactory struct {
@@ -68,19 +73,40 @@ func NewServices(cfg config.Config) Services {
 	builtin.RegisterAll(toolRegistry, cfg.DataDir, cfg.Tools)
 	builtin.RegisterSkill(toolRegistry, skillsRegistry)
 	builtin.RegisterCommand(toolRegistry, commandsRegistry)
+	builtin.RegisterTodo(toolRegistry)
+
+	var memoryStore agent.MemoryStore
+	if cfg.Memory.Enabled {
+		store := memory.New(cfg.DataDir)
+		builtin.RegisterMemory(toolRegistry, store)
+		memoryStore = store
+	}
 
 	sessionService := &session.FileService{BaseDir: cfg.DataDir}
 
+	syncPolicy, err := conversation.ParseSyncPolicy(cfg.Sessions.Sync)
+	if err != nil {
+		slog.Warn("invalid sessions.sync, using default", "error", err)
+		syncPolicy = conversation.SyncRun
+	}
+
 	runner := &agent.DefaultRunner{
-		Tools:       toolRegistry,
-		Context:     conversationFactory{conversation.NewFileService(cfg.DataDir)},
-		Sessions:    sessionService,
-		DebugConfig: cfg.Debug,
+		Tools:        toolRegistry,
+		Context:      conversationFactory{conversation.NewFileService(cfg.DataDir, syncPolicy)},
+		Sessions:     sessionService,
+		DebugConfig:  cfg.Debug,
+		Hooks:        cfg.Hooks,
+		AutoTitle:    cfg.Sessions.AutoTitle,
+		Memory:       memoryStore,
+		MemoryTokens: cfg.Memory.IndexTokens,
 	}
 
 	return Services{
-		Runner: runner,
-		Agents: agent.NewRegistry(cfg.DataDir),
-		Skills: skillsRegistry,
+		Runner:   runner,
+		Agents:   agent.NewRegistry(cfg.DataDir),
+		Skills:   skillsRegistry,
+		Commands: commandsRegistry,
+		Sessions: sessionService,
+		Search:   search.New(sessionService),
 	}
 }
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	agentConfig "github.com/erg0nix/kontekst/internal/config/agent"
+	"github.com/erg0nix/kontekst/internal/protocol"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+)
+
+// llamaHealthTimeout bounds the health check of the LLM server made for each status request.
+const llamaHealthTimeout = time.Second
+
+// addClient records a connection's handler for status reports until the returned function is called.
+func (d *daemon) addClient(handler *protocol.Handler) func() {
+	d.clientsMu.Lock()
+	if d.clients == nil {
+		d.clients = make(map[*protocol.Handler]time.Time)
+	}
+	d.clients[handler] = time.Now()
+	d.clientsMu.Unlock()
+
+	return func() {
+		d.clientsMu.Lock()
+		delete(d.clients, handler)
+		d.clientsMu.Unlock()
+	}
+}
+
+// status reports the server's connections other than caller's, its open sessions and the health of the
+// default agent's LLM server.
+func (d *daemon) status(ctx context.Context, caller *protocol.Handler) types.StatusResponse {
+	resp := types.StatusResponse{
+		Bind:      d.cfg.Bind,
+		Uptime:    time.Since(d.startTime).Round(time.Second).String(),
+		StartedAt: d.startTime.Format(time.RFC3339),
+		DataDir:   d.cfg.DataDir,
+		Clients:   d.clientStatus(caller),
+		Sessions:  d.sessions.Status(),
+		Llama:     d.llamaStatus(ctx),
+	}
+	if resp.Sessions == nil {
+		resp.Sessions = []types.SessionStatus{}
+	}
+	return resp
+}
+
+// clientStatus lists the connected clients except caller, oldest first, so a client polling the status does
+// not report itself.
+func (d *daemon) clientStatus(caller *protocol.Handler) []types.ClientStatus {
+	d.clientsMu.Lock()
+	defer d.clientsMu.Unlock()
+
+	type client struct {
+		handler     *protocol.Handler
+		connectedAt time.Time
+	}
+	clients := make([]client, 0, len(d.clients))
+	for handler, connectedAt := range d.clients {
+		if handler != caller {
+			clients = append(clients, client{handler, connectedAt})
+		}
+	}
+	slices.SortFunc(clients, func(a, b client) int { return a.connectedAt.Compare(b.connectedAt) })
+
+	result := make([]types.ClientStatus, 0, len(clients))
+	for _, c := range clients {
+		status := types.ClientStatus{
+			Token:       c.handler.TokenName(),
+			ConnectedAt: c.connectedAt.Format(time.RFC3339),
+		}
+		if info := c.handler.ClientInfo(); info != nil {
+			status.Name = info.Name
+			status.Version = info.Version
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+// llamaStatus checks the /health endpoint of the default agent's LLM server, which llama-server answers
+// with 503 while it loads a model.
+func (d *daemon) llamaStatus(ctx context.Context) types.LlamaStatus {
+	status := types.LlamaStatus{PID: FindProcessPID("llama-server")}
+
+	cfg, err := d.services.Agents.Load(agentConfig.DefaultAgentName)
+	if err != nil {
+		status.Status = "error"
+		return status
+	}
+	status.Endpoint = cfg.Provider.Endpoint
+
+	ctx, cancel := context.WithTimeout(ctx, llamaHealthTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(status.Endpoint, "/")+"/health", nil)
+	if err != nil {
+		status.Status = "error"
+		return status
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		status.Status = "unreachable"
+		return status
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		status.Status = "ok"
+	case http.StatusServiceUnavailable:
+		status.Status = "loading"
+	default:
+		status.Status = "error"
+	}
+	return status
+}
@@ -0,0 +1,163 @@
+// Package auth manages the tokens clients present to the daemon, the scopes each token grants, and the
+// TLS certificates used on tls:// addresses.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Scope is a set of operations a token allows.
+type Scope string
+
+const (
+	// ScopeRead allows status, loading and attaching to sessions, and searching them.
+	ScopeRead Scope = "read"
+	// ScopePrompt allows creating sessions, prompting, forking and cancelling runs.
+	ScopePrompt Scope = "prompt"
+	// ScopeTools lets runs started with the token execute tools, and lets it answer permission requests.
+	ScopeTools Scope = "tools"
+	// ScopeAdmin allows managing the daemon itself, such as shutting it down.
+	ScopeAdmin Scope = "admin"
+)
+
+// AllScopes lists every scope, as granted to the default token.
+var AllScopes = []Scope{ScopeRead, ScopePrompt, ScopeTools, ScopeAdmin}
+
+// DefaultTokenName names the token generated in the data directory.
+const DefaultTokenName = "default"
+
+// ErrInvalidToken is returned when a secret matches no token.
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+// Token is a named secret and the scopes it grants.
+type Token struct {
+	Name   string  `toml:"name"`
+	Secret string  `toml:"secret"`
+	Scopes []Scope `toml:"scopes"`
+}
+
+// Has reports whether the token grants scope.
+func (t Token) Has(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// tokensFile is the on-disk form of tokens.toml.
+type tokensFile struct {
+	Tokens []Token `toml:"token"`
+}
+
+// Store holds the tokens a daemon accepts: the default token in <data dir>/token, which grants every
+// scope, and any named tokens listed in <data dir>/tokens.toml.
+type Store struct {
+	tokens []Token
+}
+
+// TokenPath returns the file holding the default token's secret.
+func TokenPath(dataDir string) string {
+	return filepath.Join(dataDir, "token")
+}
+
+// TokensPath returns the file listing the additional named tokens.
+func TokensPath(dataDir string) string {
+	return filepath.Join(dataDir, "tokens.toml")
+}
+
+// Load reads the daemon's tokens, generating the default token on first start.
+func Load(dataDir string) (*Store, error) {
+	secret, err := ensureDefaultToken(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &Store{tokens: []Token{{Name: DefaultTokenName, Secret: secret, Scopes: AllScopes}}}
+
+	data, err := os.ReadFile(TokensPath(dataDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("auth: read tokens: %w", err)
+	}
+
+	var file tokensFile
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("auth: parse %s: %w", TokensPath(dataDir), err)
+	}
+	for _, token := range file.Tokens {
+		if err := validate(token); err != nil {
+			return nil, fmt.Errorf("auth: token %q: %w", token.Name, err)
+		}
+		store.tokens = append(store.tokens, token)
+	}
+	return store, nil
+}
+
+func validate(token Token) error {
+	if token.Name == "" {
+		return errors.New("name is empty")
+	}
+	if len(token.Secret) < 16 {
+		return errors.New("secret must be at least 16 characters")
+	}
+	for _, scope := range token.Scopes {
+		if !slices.Contains(AllScopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// Verify returns the token whose secret matches, comparing in constant time.
+func (s *Store) Verify(secret string) (Token, error) {
+	for _, token := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Secret), []byte(secret)) == 1 {
+			return token, nil
+		}
+	}
+	return Token{}, ErrInvalidToken
+}
+
+// ReadToken returns the default token's secret, as clients on the daemon's host use to authenticate.
+func ReadToken(dataDir string) (string, error) {
+	data, err := os.ReadFile(TokenPath(dataDir))
+	if err != nil {
+		return "", fmt.Errorf("auth: read token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ensureDefaultToken returns the default token, writing a new random secret readable only by the owner
+// when there is none yet.
+func ensureDefaultToken(dataDir string) (string, error) {
+	secret, err := ReadToken(dataDir)
+	if err == nil && secret != "" {
+		return secret, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("auth: generate token: %w", err)
+	}
+	secret = hex.EncodeToString(buffer)
+
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return "", fmt.Errorf("auth: mkdir: %w", err)
+	}
+	if err := os.WriteFile(TokenPath(dataDir), []byte(secret+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("auth: write token: %w", err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoad_GeneratesDefaultToken(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	info, err := os.Stat(TokenPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("token file permissions = %o, want 600", perm)
+	}
+
+	secret, err := ReadToken(dir)
+	if err != nil {
+		t.Fatalf("ReadToken failed: %v", err)
+	}
+	token, err := store.Verify(secret)
+	if err != nil {
+		t.Fatalf("Verify of the default token failed: %v", err)
+	}
+	if token.Name != DefaultTokenName || !token.Has(ScopeAdmin) || !token.Has(ScopeTools) {
+		t.Errorf("default token = %+v, want every scope", token)
+	}
+
+	if _, err := Load(dir); err != nil {
+		t.Fatalf("second Load failed: %v", err)
+	}
+	if again, _ := ReadToken(dir); again != secret {
+		t.Error("second Load replaced the existing token")
+	}
+}
+
+func TestLoad_NamedTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			file: "[[token]]\nname = \"ci\"\nsecret = \"0123456789abcdef0123\"\nscopes = [\"read\", \"prompt\"]\n",
+		},
+		{
+			name:    "unknown scope",
+			file:    "[[token]]\nname = \"ci\"\nsecret = \"0123456789abcdef0123\"\nscopes = [\"root\"]\n",
+			wantErr: "unknown scope",
+		},
+		{
+			name:    "short secret",
+			file:    "[[token]]\nname = \"ci\"\nsecret = \"short\"\nscopes = [\"read\"]\n",
+			wantErr: "at least 16",
+		},
+		{
+			name:    "missing name",
+			file:    "[[token]]\nsecret = \"0123456789abcdef0123\"\n",
+			wantErr: "name is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(TokensPath(dir), []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			store, err := Load(dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+
+			token, err := store.Verify("0123456789abcdef0123")
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if token.Name != "ci" || !token.Has(ScopePrompt) || token.Has(ScopeTools) || token.Has(ScopeAdmin) {
+				t.Errorf("token = %+v, want ci with read and prompt only", token)
+			}
+		})
+	}
+}
+
+func TestVerify_RejectsUnknownSecret(t *testing.T) {
+	store, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"", "not-the-token"} {
+		if _, err := store.Verify(secret); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify(%q) error = %v, want ErrInvalidToken", secret, err)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/config"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+	// renewBefore is how long before expiry a generated server certificate is reissued.
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// TLSDir returns the directory holding the generated CA and server certificate.
+func TLSDir(dataDir string) string {
+	return filepath.Join(dataDir, "tls")
+}
+
+// CAPath returns the generated CA's certificate, which clients can be given to verify the server.
+func CAPath(dataDir string) string {
+	return filepath.Join(TLSDir(dataDir), "ca.pem")
+}
+
+// ServerTLS returns the TLS configuration for a tls:// listener. bindHost is added to the names the
+// generated certificate is issued for.
+func ServerTLS(dataDir string, cfg config.TLSConfig, bindHost string) (*tls.Config, error) {
+	cert, err := serverCertificate(dataDir, cfg, serverHosts(cfg.Hosts, bindHost))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if !cfg.RequireClientCert {
+		return tlsConfig, nil
+	}
+
+	pool := x509.NewCertPool()
+	if cfg.ClientCAFile != "" {
+		data, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: read client CA: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("auth: no certificates in %s", cfg.ClientCAFile)
+		}
+	} else {
+		ca, _, err := ensureCA(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCert(ca)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConfig, nil
+}
+
+// ClientTLS returns the TLS configuration for connecting to a tls:// server at host.
+func ClientTLS(dataDir string, cfg config.ClientTLSConfig, host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: cfg.ServerName, MinVersion: tls.VersionTLS12}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.Pin != "" {
+		want := strings.ToLower(cfg.Pin)
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 || Pin(state.PeerCertificates[0]) != want {
+				return errors.New("auth: server certificate does not match the pinned key")
+			}
+			return nil
+		}
+		return tlsConfig, nil
+	}
+
+	caFile := cfg.CAFile
+	if caFile == "" {
+		if _, err := os.Stat(CAPath(dataDir)); err == nil {
+			caFile = CAPath(dataDir)
+		}
+	}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: read CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("auth: no certificates in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// Pin returns "sha256:<hex>" of a certificate's public key, the form a client's pin setting takes.
+// It stays the same when a generated certificate is reissued, since the key is kept.
+func Pin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ServerPin returns the pin of the server certificate a tls:// listener uses, generating it if needed.
+func ServerPin(dataDir string, cfg config.TLSConfig) (string, error) {
+	cert, err := serverCertificate(dataDir, cfg, serverHosts(cfg.Hosts, ""))
+	if err != nil {
+		return "", err
+	}
+	return Pin(cert.Leaf), nil
+}
+
+// IssueClientCertificate signs a certificate for mutual TLS with the data directory's CA. The name is
+// the certificate's common name; a connection presenting it is granted the token of that name, or the
+// default token when there is none.
+func IssueClientCertificate(dataDir string, name string) (certPEM []byte, keyPEM []byte, err error) {
+	ca, caKey, err := ensureCA(dataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("auth: generate key: %w", err)
+	}
+	template, err := certTemplate(name, certValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("auth: issue client certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("auth: marshal key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// ForCertificate returns the token a verified client certificate authenticates as: the token named by
+// its common name, or the default token.
+func (s *Store) ForCertificate(cert *x509.Certificate) Token {
+	for _, token := range s.tokens {
+		if token.Name == cert.Subject.CommonName {
+			return token
+		}
+	}
+	return s.tokens[0]
+}
+
+// serverCertificate loads the configured certificate, or returns one issued by the generated CA for hosts.
+// The generated certificate is kept in the data directory and reissued with the same key when it nears
+// expiry or does not cover every host.
+func serverCertificate(dataDir string, cfg config.TLSConfig, hosts []string) (tls.Certificate, error) {
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("auth: load server certificate: %w", err)
+		}
+		return cert, nil
+	}
+
+	certPath := filepath.Join(TLSDir(dataDir), "server.pem")
+	keyPath := filepath.Join(TLSDir(dataDir), "server-key.pem")
+
+	ca, caKey, err := ensureCA(dataDir)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil && coversHosts(cert.Leaf, ca, hosts) {
+		return cert, nil
+	}
+
+	key, err := loadKey(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = newKey(keyPath)
+	}
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template, err := certTemplate("kontekst", certValidity)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("auth: issue server certificate: %w", err)
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0o644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
+func coversHosts(cert *x509.Certificate, ca *x509.Certificate, hosts []string) bool {
+	if cert == nil || time.Until(cert.NotAfter) < renewBefore || cert.CheckSignatureFrom(ca) != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// serverHosts returns the names a generated server certificate is issued for: loopback, the machine's
+// hostname and addresses, the configured hosts and the host the server binds to.
+func serverHosts(configured []string, bindHost string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		hosts = append(hosts, name)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+				hosts = append(hosts, ipNet.IP.String())
+			}
+		}
+	}
+	hosts = append(hosts, configured...)
+	if ip := net.ParseIP(bindHost); bindHost != "" && (ip == nil || !ip.IsUnspecified()) {
+		hosts = append(hosts, bindHost)
+	}
+	slices.Sort(hosts)
+	return slices.Compact(hosts)
+}
+
+// ensureCA returns the data directory's certificate authority, generating it on first use.
+func ensureCA(dataDir string) (*x509.Certificate, crypto.Signer, error) {
+	certPath := CAPath(dataDir)
+	keyPath := filepath.Join(TLSDir(dataDir), "ca-key.pem")
+
+	if pair, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		signer, ok := pair.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("auth: CA key in %s cannot sign", keyPath)
+		}
+		return pair.Leaf, signer, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("auth: load CA: %w", err)
+	}
+
+	key, err := newKey(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := certTemplate("kontekst CA", caValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("auth: create CA: %w", err)
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0o644); err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("auth: parse CA: %w", err)
+	}
+	return ca, key, nil
+}
+
+func certTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("auth: generate serial: %w", err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, nil
+}
+
+// newKey generates a P-256 key and writes it to path, readable only by the owner.
+func newKey(path string) (crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("auth: generate key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("auth: marshal key: %w", err)
+	}
+	if err := writePEM(path, "PRIVATE KEY", der, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func loadKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("auth: no key in %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("auth: parse key %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("auth: key in %s cannot sign", path)
+	}
+	return signer, nil
+}
+
+func writePEM(path string, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("auth: mkdir: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("auth: write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/config"
+)
+
+func TestServerTLS_ReissueKeepsPin(t *testing.T) {
+	dir := t.TempDir()
+
+	before, err := ServerPin(dir, config.TLSConfig{})
+	if err != nil {
+		t.Fatalf("ServerPin failed: %v", err)
+	}
+
+	tlsConfig, err := ServerTLS(dir, config.TLSConfig{Hosts: []string{"devbox.internal"}}, "")
+	if err != nil {
+		t.Fatalf("ServerTLS failed: %v", err)
+	}
+	leaf := tlsConfig.Certificates[0].Leaf
+	if err := leaf.VerifyHostname("devbox.internal"); err != nil {
+		t.Errorf("reissued certificate does not cover the configured host: %v", err)
+	}
+	if got := Pin(leaf); got != before {
+		t.Errorf("pin after reissue = %s, want %s", got, before)
+	}
+
+	info, err := os.Stat(filepath.Join(TLSDir(dir), "server-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("server key permissions = %o, want 600", perm)
+	}
+}
+
+func TestIssueClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(TokensPath(dir), []byte("[[token]]\nname = \"laptop\"\nsecret = \"0123456789abcdef0123\"\nscopes = [\"read\"]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		wantToken string
+	}{
+		{"laptop", "laptop"},
+		{"ci", DefaultTokenName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certPEM, _, err := IssueClientCertificate(dir, tt.name)
+			if err != nil {
+				t.Fatalf("IssueClientCertificate failed: %v", err)
+			}
+			block, _ := pem.Decode(certPEM)
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ca, _, err := ensureCA(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(ca)
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+				t.Errorf("client certificate does not verify against the CA: %v", err)
+			}
+
+			if got := store.ForCertificate(cert).Name; got != tt.wantToken {
+				t.Errorf("ForCertificate = %q, want %q", got, tt.wantToken)
+			}
+		})
+	}
+}
@@ -1,9 +1,15 @@
 package cli
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"strings"
 
+	"github.com/erg0nix/kontekst/internal/auth"
 	"github.com/erg0nix/kontekst/internal/config"
+	"github.com/erg0nix/kontekst/internal/protocol"
 	"github.com/spf13/cobra"
 )
 
@@ -11,11 +17,13 @@ type App struct {
 	Config     config.Config
 	ConfigPath string
 	ServerAddr string
+	Token      string
 }
 
 func newApp(cmd *cobra.Command) (*App, error) {
 	configPath, _ := cmd.Flags().GetString("config")
 	serverOverride, _ := cmd.Flags().GetString("server")
+	token, _ := cmd.Flags().GetString("token")
 
 	cfg, err := loadConfig(configPath)
 	if err != nil {
@@ -26,5 +34,39 @@ func newApp(cmd *cobra.Command) (*App, error) {
 		Config:     cfg,
 		ConfigPath: configPath,
 		ServerAddr: resolveServer(serverOverride, cfg),
+		Token:      token,
 	}, nil
 }
+
+// resolveToken returns the token given on the command line, or the daemon's default token from the data
+// directory. It is read when connecting, since the server writes the file when it first starts.
+func resolveToken(override string, dataDir string) string {
+	if override != "" {
+		return override
+	}
+	token, _ := auth.ReadToken(dataDir)
+	return token
+}
+
+// connect dials the server and sets up the client to authenticate with the app's token. A tls:// or
+// wss:// server is verified as the config's tls.client settings describe.
+func (a *App) connect(ctx context.Context, cb protocol.ClientCallbacks) (*protocol.Client, error) {
+	var tlsConfig *tls.Config
+	if network, address := protocol.SplitAddress(a.ServerAddr); network == "tls" || network == "wss" {
+		hostPort, _, _ := strings.Cut(address, "/")
+		host, _, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			host = hostPort
+		}
+		if tlsConfig, err = auth.ClientTLS(a.Config.DataDir, a.Config.TLS.Client, host); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := protocol.DialTLS(ctx, a.ServerAddr, tlsConfig, cb)
+	if err != nil {
+		return nil, err
+	}
+	client.Token = resolveToken(a.Token, a.Config.DataDir)
+	return client, nil
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+
+	lipgloss "github.com/charmbracelet/lipgloss/v2"
+
+	"github.com/erg0nix/kontekst/internal/conversation"
+	"github.com/erg0nix/kontekst/internal/protocol"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+
+	"github.com/spf13/cobra"
+)
+
+func newAttachCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "attach [session-id]",
+		Short: "Follow a session's run and answer its permission requests",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runAttachCmd,
+	}
+}
+
+func newCancelCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cancel [session-id]",
+		Short: "Cancel a session's run, whichever client started it",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runCancelCmd,
+	}
+}
+
+// targetSession returns the session named on the command line, or the active session.
+func targetSession(dataDir string, args []string) (types.SessionID, error) {
+	if len(args) > 0 {
+		return types.SessionID(args[0]), nil
+	}
+	if active := loadActiveSession(dataDir); active != "" {
+		return types.SessionID(active), nil
+	}
+	return "", fmt.Errorf("no session given and no active session")
+}
+
+func runAttachCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+	autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+
+	sid, err := targetSession(app.Config.DataDir, args)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	reader := bufio.NewReader(os.Stdin)
+	renderer := newMarkdownRenderer()
+	var lastSnapshot *conversation.Snapshot
+	ended := make(chan types.RunEndedNotification, 1)
+
+	client, err := dialServer(ctx, app, protocol.ClientCallbacks{
+		OnUpdate: func(notif types.SessionNotification) {
+			handleSessionUpdate(notif, renderer)
+		},
+		OnPermission: func(req types.RequestPermissionRequest) types.RequestPermissionResponse {
+			return handlePermission(req, autoApprove, reader)
+		},
+		OnContextSnapshot: func(raw json.RawMessage) {
+			var snap conversation.Snapshot
+			if err := json.Unmarshal(raw, &snap); err == nil {
+				lastSnapshot = &snap
+			}
+		},
+		OnRunEnded: func(notif types.RunEndedNotification) {
+			select {
+			case ended <- notif:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	_, err = client.Initialize(ctx, types.InitializeRequest{
+		ProtocolVersion: types.ProtocolVersion,
+		ClientInfo:      &types.Implementation{Name: "kontekst-cli"},
+	})
+	if err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+
+	resp, err := client.AttachSession(ctx, types.AttachSessionRequest{SessionID: sid})
+	if err != nil {
+		return err
+	}
+	if !resp.Running {
+		lipgloss.Println(styleDim.Render("no run in progress in session " + string(sid)))
+		return nil
+	}
+
+	lipgloss.Println(styleSuccess.Render("attached") + " " + styleDim.Render(string(sid)+" ("+resp.Agent+")"))
+	if resp.Prompt != "" {
+		lipgloss.Println(styleDim.Render("> " + truncate(resp.Prompt, 120)))
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	select {
+	case notif := <-ended:
+		if notif.Error != "" {
+			lipgloss.Println(styledError("run failed", notif.Error))
+			return nil
+		}
+		printRunEnd(notif.StopReason, lastSnapshot)
+	case <-interrupts:
+		lipgloss.Println("\n" + styleDim.Render("detached; the run continues in the server"))
+	case <-client.Done():
+		lipgloss.Println(styleWarning.Render("connection to the server closed"))
+	}
+	return nil
+}
+
+func runCancelCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	sid, err := targetSession(app.Config.DataDir, args)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	client, err := dialServer(ctx, app, protocol.ClientCallbacks{})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if _, err := client.Initialize(ctx, types.InitializeRequest{ProtocolVersion: types.ProtocolVersion}); err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+
+	if err := client.Cancel(ctx, sid); err != nil {
+		return fmt.Errorf("cancel: %w", err)
+	}
+
+	lipgloss.Println(styleSuccess.Render("cancel sent") + " " + styleDim.Render(string(sid)))
+	return nil
+}
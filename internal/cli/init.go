@@ -86,7 +86,7 @@ func runInitCmd(cmd *cobra.Command, _ []string) error {
 
 	var client *protocol.Client
 	for range 10 {
-		client, err = protocol.Dial(ctx, app.ServerAddr, callbacks)
+		client, err = app.connect(ctx, callbacks)
 		if err == nil {
 			break
 		}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	lipgloss "github.com/charmbracelet/lipgloss/v2"
+
+	"github.com/erg0nix/kontekst/internal/memory"
+	"github.com/spf13/cobra"
+)
+
+func newMemoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "memory",
+		Short: "List the facts remembered about the current project",
+		Args:  cobra.NoArgs,
+		RunE:  runMemoryCmd,
+	}
+
+	cmd.PersistentFlags().String("dir", "", "project directory; defaults to the current directory")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add <fact...>",
+		Short: "Remember a fact about the project",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runMemoryAddCmd,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "forget <id...>",
+		Short: "Forget memories by ID",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runMemoryForgetCmd,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "edit [id fact...]",
+		Short: "Edit the project's memories in $EDITOR, or replace one memory",
+		RunE:  runMemoryEditCmd,
+	})
+
+	return cmd
+}
+
+// memoryProject returns the memory store and the project directory the command applies to.
+func memoryProject(cmd *cobra.Command) (*memory.Store, string, error) {
+	app, err := newApp(cmd)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dir, _ := cmd.Flags().GetString("dir")
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return nil, "", fmt.Errorf("memory: %w", err)
+		}
+	}
+
+	return memory.New(app.Config.DataDir), dir, nil
+}
+
+func runMemoryCmd(cmd *cobra.Command, _ []string) error {
+	store, dir, err := memoryProject(cmd)
+	if err != nil {
+		return err
+	}
+
+	entries, err := store.List(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		lipgloss.Println(styleDim.Render("No memories for " + dir + "."))
+		return nil
+	}
+
+	t := newTable("ID", "MEMORY", "ADDED")
+	for _, entry := range entries {
+		t.Row(strconv.Itoa(entry.ID), entry.Content, formatTime(entry.CreatedAt))
+	}
+	lipgloss.Println(t.Render())
+	return nil
+}
+
+func runMemoryAddCmd(cmd *cobra.Command, args []string) error {
+	store, dir, err := memoryProject(cmd)
+	if err != nil {
+		return err
+	}
+
+	entry, err := store.Remember(dir, strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+
+	lipgloss.Println(styleSuccess.Render("remembered") + " " + styleDim.Render(fmt.Sprintf("[%d]", entry.ID)) + " " + entry.Content)
+	return nil
+}
+
+func runMemoryForgetCmd(cmd *cobra.Command, args []string) error {
+	ids, err := parseMemoryIDs(args)
+	if err != nil {
+		return err
+	}
+
+	store, dir, err := memoryProject(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := store.Forget(dir, ids...); err != nil {
+		return err
+	}
+
+	lipgloss.Println(styleSuccess.Render("forgot") + " " + strings.Join(args, ", "))
+	return nil
+}
+
+func runMemoryEditCmd(cmd *cobra.Command, args []string) error {
+	store, dir, err := memoryProject(cmd)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 0 {
+		if len(args) < 2 {
+			return fmt.Errorf("usage: memory edit <id> <fact...>")
+		}
+		ids, err := parseMemoryIDs(args[:1])
+		if err != nil {
+			return err
+		}
+		if err := store.Update(dir, ids[0], strings.Join(args[1:], " ")); err != nil {
+			return err
+		}
+		lipgloss.Println(styleSuccess.Render("updated") + " " + args[0])
+		return nil
+	}
+
+	entries, err := store.List(dir)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Project memory for %s\n# One fact per line. Delete a line to forget it; lines starting with # are ignored.\n", dir)
+	for _, entry := range entries {
+		b.WriteString(entry.Content + "\n")
+	}
+
+	edited, err := editInEditor(b.String(), "kontekst-memory-*.txt")
+	if err != nil {
+		return err
+	}
+
+	var facts []string
+	for line := range strings.Lines(edited) {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		facts = append(facts, line)
+	}
+
+	saved, err := store.Replace(dir, facts)
+	if err != nil {
+		return err
+	}
+
+	lipgloss.Println(styleSuccess.Render("saved") + " " + styleDim.Render(fmt.Sprintf("%d memories", len(saved))))
+	return nil
+}
+
+func parseMemoryIDs(args []string) ([]int, error) {
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory ID %q", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
 	"time"
 
 	lipgloss "github.com/charmbracelet/lipgloss/v2"
@@ -12,60 +15,140 @@ import (
 
 	"github.com/erg0nix/kontekst/internal/app"
 	"github.com/erg0nix/kontekst/internal/protocol"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
 
 	"github.com/spf13/cobra"
 )
 
+// clearScreen moves the cursor home and clears the terminal before each refresh of ps --watch.
+const clearScreen = "\033[H\033[2J"
+
 func newPsCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "ps",
-		Short: "Show running processes",
+		Short: "Show running processes, connected clients and open sessions",
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			a, err := newApp(cmd)
 			if err != nil {
 				return err
 			}
 
-			t := newTable("NAME", "STATUS", "PID", "ENDPOINT", "UPTIME")
+			watch, _ := cmd.Flags().GetBool("watch")
+			if !watch {
+				lipgloss.Println(renderPs(cmd.Context(), a))
+				return nil
+			}
+
+			interval, _ := cmd.Flags().GetDuration("interval")
+			if interval <= 0 {
+				return fmt.Errorf("interval must be positive")
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
 
-			addServerRow(cmd.Context(), t, a.Config.DataDir, a.ServerAddr)
-			addLlamaRow(t)
+			for {
+				out := renderPs(ctx, a)
+				fmt.Print(clearScreen)
+				lipgloss.Println(out)
 
-			lipgloss.Println(t.Render())
-			return nil
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
 		},
 	}
+
+	cmd.Flags().BoolP("watch", "w", false, "refresh the tables until interrupted")
+	cmd.Flags().Duration("interval", 2*time.Second, "how often --watch refreshes")
+	return cmd
 }
 
-func addServerRow(ctx context.Context, t *table.Table, dataDir string, serverAddr string) {
-	pid := app.ReadPID(filepath.Join(dataDir, "server.pid"))
+// renderPs renders the process table and, when the server is running, its clients and sessions.
+func renderPs(ctx context.Context, a *App) string {
+	status, pid := fetchStatus(ctx, a)
+
+	t := newTable("NAME", "STATUS", "PID", "ENDPOINT", "UPTIME")
+	addServerRow(t, a, pid, status)
+	if status != nil {
+		addLlamaStatusRow(t, status.Llama)
+	} else {
+		addLlamaRow(t)
+	}
+
+	sections := []string{t.Render()}
+	if status != nil {
+		sections = append(sections, "", renderClients(status.Clients), "", renderSessions(status.Sessions))
+	}
+	return strings.Join(sections, "\n")
+}
+
+// fetchStatus returns the server's PID and its status, which is nil when it is not running or not answering.
+func fetchStatus(ctx context.Context, a *App) (*types.StatusResponse, int) {
+	pid := app.ReadPID(filepath.Join(a.Config.DataDir, "server.pid"))
 	if pid == 0 {
-		t.Row("kontekst", styleError.Render("stopped"), "-", serverAddr, "-")
+		return nil, 0
+	}
+
+	client, err := a.connect(ctx, protocol.ClientCallbacks{})
+	if err != nil {
+		return nil, pid
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	resp, err := client.Status(ctx)
+	if err != nil {
+		return nil, pid
+	}
+	return &resp, pid
+}
+
+func addServerRow(t *table.Table, a *App, pid int, status *types.StatusResponse) {
+	if pid == 0 {
+		t.Row("kontekst", styleError.Render("stopped"), "-", a.ServerAddr, "-")
 		return
 	}
 
-	var uptime string
-	client, err := protocol.Dial(ctx, serverAddr, protocol.ClientCallbacks{})
-	if err == nil {
-		defer client.Close()
-		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-		defer cancel()
-		if resp, err := client.Status(ctx); err == nil {
-			uptime = resp.Uptime
-		}
+	uptime := "-"
+	if status != nil {
+		uptime = status.Uptime
 	}
+	t.Row("kontekst", styleSuccess.Render("running"), fmt.Sprintf("%d", pid), a.ServerAddr, uptime)
+}
 
-	if uptime == "" {
-		uptime = "-"
+// addLlamaStatusRow shows the LLM server as the kontekst server sees it.
+func addLlamaStatusRow(t *table.Table, llama types.LlamaStatus) {
+	var status string
+	switch llama.Status {
+	case "ok":
+		status = styleSuccess.Render("running")
+	case "loading":
+		status = styleWarning.Render("loading")
+	case "unreachable":
+		status = styleError.Render("stopped")
+	default:
+		status = styleWarning.Render(llama.Status)
 	}
 
-	t.Row("kontekst",
-		styleSuccess.Render("running"),
-		fmt.Sprintf("%d", pid),
-		serverAddr,
-		uptime)
+	pid := "-"
+	if llama.PID != 0 {
+		pid = fmt.Sprintf("%d", llama.PID)
+	}
+	endpoint := llama.Endpoint
+	if endpoint == "" {
+		endpoint = "-"
+	}
+	t.Row("llama-server", status, pid, endpoint, "-")
 }
 
+// addLlamaRow checks the local llama-server when the kontekst server cannot report on it.
 func addLlamaRow(t *table.Table) {
 	pid := app.FindProcessPID("llama-server")
 	if pid == 0 {
@@ -85,3 +168,49 @@ func addLlamaRow(t *table.Table) {
 
 	t.Row("llama-server", status, fmt.Sprintf("%d", pid), endpoint, "-")
 }
+
+func renderClients(clients []types.ClientStatus) string {
+	t := newTable("CLIENT", "VERSION", "TOKEN", "CONNECTED")
+	for _, c := range clients {
+		t.Row(orDash(c.Name), orDash(c.Version), orDash(c.Token), since(c.ConnectedAt))
+	}
+	return t.Render()
+}
+
+func renderSessions(sessions []types.SessionStatus) string {
+	t := newTable("SESSION", "AGENT", "STATE", "TOOL", "CLIENTS", "TOK/S")
+	for _, s := range sessions {
+		state := string(s.State)
+		switch s.State {
+		case types.RunStateGenerating, types.RunStateExecutingTool:
+			state = styleActive.Render(state)
+		case types.RunStateAwaitingApproval:
+			state = styleWarning.Render(state)
+		default:
+			state = styleDim.Render(state)
+		}
+
+		rate := "-"
+		if s.TokensPerSecond > 0 {
+			rate = fmt.Sprintf("%.1f", s.TokensPerSecond)
+		}
+		t.Row(string(s.SessionID), orDash(s.Agent), state, orDash(s.Tool), fmt.Sprintf("%d", s.Clients), rate)
+	}
+	return t.Render()
+}
+
+// since formats how long ago an RFC 3339 time was, rounded to the second.
+func since(rfc3339 string) string {
+	at, err := time.Parse(time.RFC3339, rfc3339)
+	if err != nil {
+		return "-"
+	}
+	return time.Since(at).Round(time.Second).String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
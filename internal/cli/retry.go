@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+	"github.com/spf13/cobra"
+)
+
+func newRetryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retry",
+		Short: "Discard the last response and re-run the agent from the previous prompt",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runRewind(cmd, 1)
+		},
+	}
+	addSamplingFlags(cmd)
+	return cmd
+}
+
+func newRewindCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rewind <turns>",
+		Short: "Discard the last turns and re-run the agent from the prompt that started them",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			turns, err := strconv.Atoi(args[0])
+			if err != nil || turns < 1 {
+				return fmt.Errorf("turns must be a positive number, got %q", args[0])
+			}
+			return runRewind(cmd, turns)
+		},
+	}
+	addSamplingFlags(cmd)
+	return cmd
+}
+
+func addSamplingFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64("temperature", 0, "override the agent's temperature for this run")
+	cmd.Flags().Float64("top-p", 0, "override the agent's top_p for this run")
+	cmd.Flags().Int("top-k", 0, "override the agent's top_k for this run")
+	cmd.Flags().Float64("repeat-penalty", 0, "override the agent's repeat_penalty for this run")
+	cmd.Flags().Int("max-tokens", 0, "override the agent's max_tokens for this run")
+}
+
+func runRewind(cmd *cobra.Command, turns int) error {
+	return runPrompt(cmd, "", &types.PromptMeta{Kontekst: types.PromptExtension{
+		Rewind:   turns,
+		Sampling: samplingOverride(cmd),
+	}})
+}
+
+// samplingOverride collects the sampling flags that were set, or nil if none were.
+func samplingOverride(cmd *cobra.Command) *types.SamplingOverride {
+	var override types.SamplingOverride
+	set := false
+
+	floatFlag := func(name string) *float64 {
+		if !cmd.Flags().Changed(name) {
+			return nil
+		}
+		v, _ := cmd.Flags().GetFloat64(name)
+		set = true
+		return &v
+	}
+	intFlag := func(name string) *int {
+		if !cmd.Flags().Changed(name) {
+			return nil
+		}
+		v, _ := cmd.Flags().GetInt(name)
+		set = true
+		return &v
+	}
+
+	override.Temperature = floatFlag("temperature")
+	override.TopP = floatFlag("top-p")
+	override.TopK = intFlag("top-k")
+	override.RepeatPenalty = floatFlag("repeat-penalty")
+	override.MaxTokens = intFlag("max-tokens")
+
+	if !set {
+		return nil
+	}
+	return &override
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net"
 	"os"
 	"os/exec"
@@ -30,16 +31,24 @@ func NewRootCommand() *cobra.Command {
 
 	rootCmd.PersistentFlags().StringP("config", "c", "", "path to config file")
 	rootCmd.PersistentFlags().String("server", "", "server address")
+	rootCmd.PersistentFlags().String("token", "", "auth token; defaults to the token file in the data directory")
 	rootCmd.PersistentFlags().Bool("auto-approve", false, "auto-approve tools")
 	rootCmd.PersistentFlags().String("session", "", "session id to reuse")
 	rootCmd.PersistentFlags().String("agent", "", "agent to use for this run")
+	rootCmd.Flags().Bool("detach", false, "start the run and return; follow it with kontekst attach")
 
 	rootCmd.AddCommand(newServeCmd())
 	rootCmd.AddCommand(newAgentsCmd())
 	rootCmd.AddCommand(newSessionsCmd())
+	rootCmd.AddCommand(newMemoryCmd())
+	rootCmd.AddCommand(newRetryCmd())
+	rootCmd.AddCommand(newRewindCmd())
+	rootCmd.AddCommand(newAttachCmd())
+	rootCmd.AddCommand(newCancelCmd())
 	rootCmd.AddCommand(newStopCmd())
 	rootCmd.AddCommand(newPsCmd())
 	rootCmd.AddCommand(newInitCmd())
+	rootCmd.AddCommand(newTLSCmd())
 
 	return rootCmd
 }
@@ -60,15 +69,23 @@ func resolveServer(override string, cfg config.Config) string {
 }
 
 func clientAddrFromBind(bind string) string {
-	host, port, err := netSplitHostPort(bind)
-	if err != nil || port == "" {
+	network, address := protocol.SplitAddress(bind)
+	if network == "unix" {
 		return bind
 	}
+	if network == "tls" {
+		return "tls://" + clientAddrFromBind(address)
+	}
+
+	host, port, err := netSplitHostPort(address)
+	if err != nil || port == "" {
+		return address
+	}
 
 	if host == "" || host == "0.0.0.0" || host == "::" {
 		return "127.0.0.1:" + port
 	}
-	return bind
+	return address
 }
 
 func netSplitHostPort(addr string) (string, string, error) {
@@ -112,10 +129,16 @@ func saveActiveSession(dataDir string, sessionID string) error {
 	return nil
 }
 
-func dialServer(ctx context.Context, serverAddr string, cb protocol.ClientCallbacks) (*protocol.Client, error) {
-	client, err := protocol.Dial(ctx, serverAddr, cb)
+func clearActiveSession(dataDir string) {
+	if err := os.Remove(filepath.Join(dataDir, "active_session")); err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to clear active session", "error", err)
+	}
+}
+
+func dialServer(ctx context.Context, app *App, cb protocol.ClientCallbacks) (*protocol.Client, error) {
+	client, err := app.connect(ctx, cb)
 	if err != nil {
-		printServerNotRunning(serverAddr, err)
+		printServerNotRunning(app.ServerAddr, err)
 		return nil, err
 	}
 	return client, nil
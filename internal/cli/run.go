@@ -2,10 +2,12 @@ package cli
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/charmbracelet/glamour"
@@ -26,6 +28,18 @@ import (
 )
 
 func runCmd(cmd *cobra.Command, args []string) error {
+	prompt := strings.TrimSpace(strings.Join(args, " "))
+	if prompt == "" {
+		return fmt.Errorf("prompt is required")
+	}
+
+	return runPrompt(cmd, prompt, nil)
+}
+
+// runPrompt sends a prompt to the active or requested session and renders the run until it ends.
+// A prompt meta carrying a rewind re-runs the session's earlier user message instead. With --detach
+// it returns once the run has started, leaving the run to the server.
+func runPrompt(cmd *cobra.Command, prompt string, promptMeta *types.PromptMeta) error {
 	app, err := newApp(cmd)
 	if err != nil {
 		return err
@@ -33,16 +47,22 @@ func runCmd(cmd *cobra.Command, args []string) error {
 	autoApprove, _ := cmd.Flags().GetBool("auto-approve")
 	sessionOverride, _ := cmd.Flags().GetString("session")
 	agentName, _ := cmd.Flags().GetString("agent")
+	detach, _ := cmd.Flags().GetBool("detach")
 
-	prompt := strings.TrimSpace(strings.Join(args, " "))
-	if prompt == "" {
-		return fmt.Errorf("prompt is required")
+	if detach {
+		if promptMeta == nil {
+			promptMeta = &types.PromptMeta{}
+		}
+		promptMeta.Kontekst.Detach = true
 	}
 
 	sessionID := strings.TrimSpace(sessionOverride)
 	if sessionID == "" {
 		sessionID = loadActiveSession(app.Config.DataDir)
 	}
+	if promptMeta != nil && promptMeta.Kontekst.Rewind > 0 && sessionID == "" {
+		return fmt.Errorf("no active session to rewind")
+	}
 
 	if agentName == "" && sessionID != "" {
 		sessionService := &session.FileService{BaseDir: app.Config.DataDir}
@@ -59,7 +79,7 @@ func runCmd(cmd *cobra.Command, args []string) error {
 	renderer := newMarkdownRenderer()
 	var lastSnapshot *conversation.Snapshot
 
-	client, err := dialServer(ctx, app.ServerAddr, protocol.ClientCallbacks{
+	client, err := dialServer(ctx, app, protocol.ClientCallbacks{
 		OnUpdate: func(notif types.SessionNotification) {
 			handleSessionUpdate(notif, renderer)
 		},
@@ -121,30 +141,69 @@ func runCmd(cmd *cobra.Command, args []string) error {
 		slog.Warn("failed to save active session", "error", err)
 	}
 
+	blocks := []types.ContentBlock{}
+	if prompt != "" {
+		blocks = append(blocks, types.TextBlock(prompt))
+	}
+
+	if !detach {
+		cancelOnInterrupt(client, sid)
+	}
+
 	promptResp, err := client.Prompt(ctx, types.PromptRequest{
 		SessionID: sid,
-		Prompt:    []types.ContentBlock{types.TextBlock(prompt)},
+		Prompt:    blocks,
+		Meta:      promptMeta,
 	})
 	if err != nil {
 		lipgloss.Println(styledError("prompt failed", err.Error()))
 		return nil
 	}
 
+	if promptResp.Detached() {
+		lipgloss.Println(styleSuccess.Render("run started") + " " + styleDim.Render("in session "+string(sid)))
+		lipgloss.Println("follow with: " + styleToolName.Render("kontekst attach "+string(sid)))
+		return nil
+	}
+
+	printRunEnd(promptResp.StopReason, lastSnapshot)
+	return nil
+}
+
+// cancelOnInterrupt cancels the session's run on the first Ctrl-C, since the server keeps runs going when
+// the client disconnects. A second Ctrl-C exits without waiting for the run to wind down.
+func cancelOnInterrupt(client *protocol.Client, sid types.SessionID) {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	go func() {
+		<-interrupts
+		lipgloss.Println("\n" + styleWarning.Render("cancelling..."))
+		if err := client.Cancel(context.Background(), sid); err != nil {
+			slog.Warn("failed to cancel run", "error", err)
+		}
+		<-interrupts
+		os.Exit(130)
+	}()
+}
+
+// printRunEnd prints the final context snapshot, if any, and why the run stopped.
+func printRunEnd(reason types.StopReason, lastSnapshot *conversation.Snapshot) {
 	if lastSnapshot != nil {
 		fmt.Println()
 		printContextSnapshot(*lastSnapshot)
 	}
 
-	switch promptResp.StopReason {
+	switch reason {
 	case types.StopReasonEndTurn:
 		lipgloss.Print("\n" + styleSuccess.Render("run completed") + "\n")
 	case types.StopReasonCancelled:
 		lipgloss.Println(styleWarning.Render("cancelled"))
+	case types.StopReasonMaxTurnRequests:
+		lipgloss.Println(styleWarning.Render("stopped: loop detected"))
 	default:
-		lipgloss.Println(styleWarning.Render("stopped: " + string(promptResp.StopReason)))
+		lipgloss.Println(styleWarning.Render("stopped: " + string(reason)))
 	}
-
-	return nil
 }
 
 func handleSessionUpdate(notif types.SessionNotification, renderer *glamour.TermRenderer) {
@@ -170,6 +229,14 @@ func handleSessionUpdate(notif types.SessionNotification, renderer *glamour.Term
 	case "agent_thought_chunk":
 		if content, ok := m["content"].(map[string]any); ok {
 			if text, ok := content["text"].(string); ok {
+				if hookEvent := kontekstMeta(m, "hook"); hookEvent != "" {
+					lipgloss.Println(styleHook.Render("hook") + " " + styleDim.Render(hookEvent+": "+text))
+					return
+				}
+				if loopState := kontekstMeta(m, "loop"); loopState != "" {
+					lipgloss.Println(styleWarning.Render("loop "+loopState) + " " + styleDim.Render(text))
+					return
+				}
 				lipgloss.Print(styleReasoning.Render(text) + "\n\n")
 			}
 		}
@@ -193,10 +260,65 @@ func handleSessionUpdate(notif types.SessionNotification, renderer *glamour.Term
 			lipgloss.Println("  " + styleSuccess.Render("done") + " " + styleDim.Render(truncate(text, 120)))
 		case "failed":
 			lipgloss.Println("  " + styleError.Render("fail") + " " + styleDim.Render(truncate(text, 120)))
+		case "":
+			if rawInput, ok := m["rawInput"]; ok {
+				inputJSON, _ := json.Marshal(rawInput)
+				lipgloss.Println("  " + styleWarning.Render("edited") + " " + styleDim.Render(truncate(string(inputJSON), 120)))
+			}
+		}
+	case "plan":
+		entries, _ := m["entries"].([]any)
+		printPlan(entries)
+	}
+}
+
+func printPlan(entries []any) {
+	lipgloss.Println(stylePlanTitle.Render("plan"))
+	if len(entries) == 0 {
+		lipgloss.Println("  " + styleDim.Render("(empty)"))
+		return
+	}
+
+	for _, e := range entries {
+		entry, ok := e.(map[string]any)
+		if !ok {
+			continue
+		}
+		content, _ := entry["content"].(string)
+		status, _ := entry["status"].(string)
+		priority, _ := entry["priority"].(string)
+
+		if priority == "high" {
+			content += " " + styleWarning.Render("!")
+		}
+
+		switch status {
+		case "completed":
+			lipgloss.Println("  " + styleSuccess.Render("[x]") + " " + styleDim.Render(content))
+		case "in_progress":
+			lipgloss.Println("  " + styleWarning.Render("[~]") + " " + content)
+		default:
+			lipgloss.Println("  " + styleDim.Render("[ ]") + " " + content)
 		}
 	}
 }
 
+// kontekstMeta returns a string field from an update's _meta.kontekst extension.
+func kontekstMeta(m map[string]any, key string) string {
+	meta, ok := m["_meta"].(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	kontekst, ok := meta["kontekst"].(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	value, _ := kontekst[key].(string)
+	return value
+}
+
 func extractToolResultText(m map[string]any) string {
 	content, ok := m["content"].([]any)
 	if !ok || len(content) == 0 {
@@ -251,14 +373,96 @@ func handlePermission(req types.RequestPermissionRequest, autoApprove bool, read
 	argsStyled := styleToolArgs.Render("(" + string(inputJSON) + ")")
 	lipgloss.Println(labelStyled + " " + nameStyled + argsStyled)
 
-	lipgloss.Print(stylePromptAction.Render("approve?") + " " + stylePromptHint.Render("[y/N]") + ": ")
-	line, _ := reader.ReadString('\n')
+	if req.Meta != nil && req.Meta.Kontekst.Error != "" {
+		lipgloss.Println("  " + styleError.Render("edit rejected") + " " + styleDim.Render(req.Meta.Kontekst.Error))
+	}
 
-	if len(line) > 0 && (line[0] == 'y' || line[0] == 'Y') {
-		return types.RequestPermissionResponse{Outcome: types.PermissionSelected("allow")}
+	for {
+		lipgloss.Print(stylePromptAction.Render("approve?") + " " + stylePromptHint.Render("[y/N, e=edit, f=feedback]") + ": ")
+		line, _ := reader.ReadString('\n')
+		line = strings.ToLower(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(line, "y"):
+			return types.RequestPermissionResponse{Outcome: types.PermissionSelected("allow")}
+
+		case strings.HasPrefix(line, "e"):
+			args, err := editToolArguments(title, req.ToolCall.RawInput)
+			if err != nil {
+				lipgloss.Println(styledError("edit failed", err.Error()))
+				continue
+			}
+			if args == nil {
+				lipgloss.Println(styleDim.Render("no changes"))
+				continue
+			}
+			return types.RequestPermissionResponse{
+				Outcome: types.PermissionSelected("allow"),
+				Meta:    &types.PermissionMeta{Kontekst: types.PermissionExtension{Arguments: args}},
+			}
+
+		case strings.HasPrefix(line, "f"):
+			lipgloss.Print(stylePromptAction.Render("feedback") + ": ")
+			feedback, _ := reader.ReadString('\n')
+			feedback = strings.TrimSpace(feedback)
+			if feedback == "" {
+				continue
+			}
+			return types.RequestPermissionResponse{
+				Outcome: types.PermissionSelected("reject"),
+				Meta:    &types.PermissionMeta{Kontekst: types.PermissionExtension{Feedback: feedback}},
+			}
+
+		default:
+			return types.RequestPermissionResponse{Outcome: types.PermissionSelected("reject")}
+		}
+	}
+}
+
+// editToolArguments opens a tool call's arguments in the user's editor and returns the edited arguments,
+// or nil if nothing changed. For write_file only the proposed file content is edited.
+func editToolArguments(toolName string, rawInput any) (map[string]any, error) {
+	args, _ := rawInput.(map[string]any)
+	if args == nil {
+		args = map[string]any{}
 	}
 
-	return types.RequestPermissionResponse{Outcome: types.PermissionSelected("reject")}
+	if content, ok := args["content"].(string); ok && toolName == "write_file" {
+		path, _ := args["path"].(string)
+		edited, err := editInEditor(content, editPattern(path))
+		if err != nil {
+			return nil, err
+		}
+		if edited == content {
+			return nil, nil
+		}
+
+		out := make(map[string]any, len(args))
+		for k, v := range args {
+			out[k] = v
+		}
+		out["content"] = edited
+		return out, nil
+	}
+
+	original, err := json.MarshalIndent(args, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal arguments: %w", err)
+	}
+
+	edited, err := editInEditor(string(original)+"\n", "kontekst-*.json")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(edited) == strings.TrimSpace(string(original)) {
+		return nil, nil
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal([]byte(edited), &out); err != nil {
+		return nil, fmt.Errorf("parse edited arguments: %w", err)
+	}
+	return out, nil
 }
 
 func compactStyle() ansi.StyleConfig {
@@ -311,9 +515,12 @@ func printContextSnapshot(snap conversation.Snapshot) {
 		fmt.Sprintf("%d/%d ", snap.TotalTokens, snap.ContextSize) +
 		pctStr + "  " +
 		styleDim.Render(fmt.Sprintf(
-			"sys:%d tools:%d hist:%d mem:%d free:%d",
-			snap.SystemTokens, snap.ToolTokens, snap.HistoryTokens,
+			"sys:%d projmem:%d tools:%d hist:%d mem:%d free:%d",
+			snap.SystemTokens, snap.ProjectMemoryTokens, snap.ToolTokens, snap.HistoryTokens,
 			snap.MemoryTokens, snap.RemainingTokens))
+	if snap.DedupedMessages > 0 {
+		line += styleDim.Render(fmt.Sprintf(" dedup:%d/-%d", snap.DedupedMessages, snap.DedupedTokens))
+	}
 
 	lipgloss.Println(line)
 }
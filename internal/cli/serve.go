@@ -27,7 +27,7 @@ func newServeCmd() *cobra.Command {
 
 	cmd.Flags().Bool("stdio", false, "run ACP handler over stdio (for editors)")
 	cmd.Flags().Bool("foreground", false, "run server in foreground")
-	cmd.Flags().String("bind", "", "bind address (overrides config)")
+	cmd.Flags().String("bind", "", "listen address, unix:///path, host:port or tls://host:port (overrides config)")
 	cmd.Flags().String("llama-bin", "llama-server", "path to llama-server binary")
 
 	return cmd
@@ -67,7 +67,7 @@ func runStdio(cfg config.Config) error {
 	cfg.Debug = config.LoadDebugConfigFromEnv(cfg.Debug)
 
 	services := app.NewServices(cfg)
-	handler := protocol.NewHandler(services.Runner, services.Agents, services.Skills)
+	handler := protocol.NewHandler(services.Runner, services.Agents, services.Skills, nil)
 	conn := handler.Serve(os.Stdout, os.Stdin)
 
 	<-conn.Done()
@@ -2,21 +2,183 @@ package cli
 
 import (
 	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	lipgloss "github.com/charmbracelet/lipgloss/v2"
 
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/search"
 	"github.com/erg0nix/kontekst/internal/session"
+	"github.com/erg0nix/kontekst/internal/transcript"
 	"github.com/spf13/cobra"
 )
 
 func newSessionsCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "sessions",
 		Short: "List sessions",
 		Args:  cobra.NoArgs,
 		RunE:  runSessionsCmd,
 	}
+
+	cmd.AddCommand(newSessionsShowCmd())
+	cmd.AddCommand(newSessionsRenameCmd())
+	cmd.AddCommand(newSessionsTagCmd())
+	cmd.AddCommand(newSessionsUseCmd())
+	cmd.AddCommand(newSessionsDeleteCmd())
+	cmd.AddCommand(newSessionsPruneCmd())
+	cmd.AddCommand(newSessionsForkCmd())
+	cmd.AddCommand(newSessionsMigrateCmd())
+	cmd.AddCommand(newSessionsRepairCmd())
+	cmd.AddCommand(newSessionsSearchCmd())
+	cmd.AddCommand(newSessionsExportCmd())
+	cmd.AddCommand(newSessionsImportCmd())
+
+	return cmd
+}
+
+func newSessionsShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <session-id>",
+		Short: "Show a session's metadata, usage and plan",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runSessionsShowCmd,
+	}
+}
+
+func newSessionsRenameCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rename <session-id> <title...>",
+		Short: "Set a session's title",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  runSessionsRenameCmd,
+	}
+}
+
+func newSessionsTagCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tag <session-id> <tag...>",
+		Short: "Add tags to a session, or remove them with --remove",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  runSessionsTagCmd,
+	}
+
+	cmd.Flags().Bool("remove", false, "remove the tags instead of adding them")
+
+	return cmd
+}
+
+func newSessionsUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use <session-id>",
+		Short: "Make a session the active one",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runSessionsUseCmd,
+	}
+}
+
+func newSessionsDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <session-id...>",
+		Short: "Delete sessions",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runSessionsDeleteCmd,
+	}
+}
+
+func newSessionsPruneCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune --older-than <age>",
+		Short: "Delete sessions not modified within the given age",
+		Args:  cobra.NoArgs,
+		RunE:  runSessionsPruneCmd,
+	}
+
+	cmd.Flags().String("older-than", "", "age such as 30d or 720h; sessions modified before it are deleted")
+	cmd.Flags().Bool("dry-run", false, "only list the sessions that would be deleted")
+	_ = cmd.MarkFlagRequired("older-than")
+
+	return cmd
+}
+
+func newSessionsForkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fork <session-id>",
+		Short: "Fork a session into a new one, optionally at a message index",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runSessionsForkCmd,
+	}
+
+	cmd.Flags().Int("at", -1, "last message index (0-based) to keep in the fork; defaults to the whole history")
+
+	return cmd
+}
+
+func newSessionsMigrateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Rewrite session files in the current record format",
+		Args:  cobra.NoArgs,
+		RunE:  runSessionsMigrateCmd,
+	}
+}
+
+func newSessionsRepairCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repair [session-id...]",
+		Short: "Find and remove torn or corrupt lines in session files",
+		RunE:  runSessionsRepairCmd,
+	}
+
+	cmd.Flags().Bool("check", false, "only report damage, do not change any files")
+
+	return cmd
+}
+
+func newSessionsSearchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "search <query...>",
+		Short: "Search message content across all sessions",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runSessionsSearchCmd,
+	}
+
+	cmd.Flags().String("agent", "", "only match messages from runs of this agent")
+	cmd.Flags().String("role", "", "only match messages with this role (user, assistant or tool)")
+	cmd.Flags().String("since", "", "only match messages from this date on (YYYY-MM-DD or RFC 3339)")
+	cmd.Flags().String("until", "", "only match messages up to this date (YYYY-MM-DD or RFC 3339)")
+	cmd.Flags().Int("limit", search.DefaultLimit, "maximum number of results")
+
+	return cmd
+}
+
+func newSessionsExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <session-id>",
+		Short: "Export a session as a Markdown, HTML or JSON transcript",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runSessionsExportCmd,
+	}
+
+	cmd.Flags().String("format", "md", "transcript format: md, html or json")
+	cmd.Flags().StringP("output", "o", "", "file to write; defaults to stdout")
+	cmd.Flags().Bool("redact-tool-output", false, "replace tool outputs and diffs with a placeholder")
+	cmd.Flags().Int("max-output-lines", transcript.DefaultMaxToolOutputLines, "lines of each tool output to show in md and html (0 shows all)")
+
+	return cmd
+}
+
+func newSessionsImportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import a JSON transcript as a new session",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runSessionsImportCmd,
+	}
 }
 
 func runSessionsCmd(cmd *cobra.Command, _ []string) error {
@@ -41,8 +203,476 @@ func runSessionsCmd(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
+func runSessionsShowCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	id := core.SessionID(args[0])
+	info, err := svc.Get(id)
+	if err != nil {
+		return fmt.Errorf("show session: %w", err)
+	}
+
+	title := string(info.ID)
+	if string(info.ID) == loadActiveSession(app.Config.DataDir) {
+		title = styleActive.Render(title) + styleDim.Render(" (active)")
+	}
+	lipgloss.Println(title)
+
+	field := func(name, value string) {
+		if value != "" {
+			lipgloss.Println(styleDim.Render(fmt.Sprintf("  %-10s ", name)) + value)
+		}
+	}
+
+	agentName := info.DefaultAgent
+	if agentName == "" {
+		agentName = "default"
+	}
+
+	field("title", info.Title)
+	field("tags", strings.Join(info.Tags, ", "))
+	field("agent", agentName)
+	field("directory", info.WorkingDir)
+	field("messages", fmt.Sprintf("%d", info.MessageCount))
+	field("size", formatSize(info.FileSize))
+	if info.Usage.Total() > 0 {
+		field("tokens", fmt.Sprintf("%d (%d prompt, %d completion)", info.Usage.Total(), info.Usage.PromptTokens, info.Usage.CompletionTokens))
+	}
+	field("created", formatTime(info.CreatedAt))
+	field("modified", formatTime(info.ModifiedAt))
+	if info.ParentID != "" {
+		field("forked", fmt.Sprintf("from %s@%d", info.ParentID, info.ForkedAt))
+	}
+	if len(info.Children) > 0 {
+		children := make([]string, len(info.Children))
+		for i, child := range info.Children {
+			children[i] = string(child)
+		}
+		field("forks", strings.Join(children, ", "))
+	}
+
+	plan, err := svc.GetPlan(id)
+	if err != nil {
+		slog.Warn("failed to read session plan", "session_id", id, "error", err)
+	}
+	if len(plan) > 0 {
+		entries := make([]any, len(plan))
+		for i, entry := range plan {
+			entries[i] = map[string]any{"content": entry.Content, "status": string(entry.Status), "priority": string(entry.Priority)}
+		}
+		lipgloss.Println()
+		printPlan(entries)
+	}
+
+	return nil
+}
+
+func runSessionsRenameCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	title := strings.TrimSpace(strings.Join(args[1:], " "))
+	if title == "" {
+		return fmt.Errorf("title must not be empty")
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	if err := svc.SetTitle(core.SessionID(args[0]), title); err != nil {
+		return fmt.Errorf("rename session: %w", err)
+	}
+
+	lipgloss.Println(styleSuccess.Render("renamed") + " " + args[0] + " " + styleDim.Render("-> "+title))
+	return nil
+}
+
+func runSessionsTagCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	var add, remove []string
+	if ok, _ := cmd.Flags().GetBool("remove"); ok {
+		remove = args[1:]
+	} else {
+		add = args[1:]
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	tags, err := svc.Tag(core.SessionID(args[0]), add, remove)
+	if err != nil {
+		return fmt.Errorf("tag session: %w", err)
+	}
+
+	summary := "(no tags)"
+	if len(tags) > 0 {
+		summary = strings.Join(tags, ", ")
+	}
+	lipgloss.Println(styleSuccess.Render("tagged") + " " + args[0] + " " + styleDim.Render(summary))
+	return nil
+}
+
+func runSessionsUseCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	if _, err := svc.Get(core.SessionID(args[0])); err != nil {
+		return fmt.Errorf("use session: %w", err)
+	}
+
+	if err := saveActiveSession(app.Config.DataDir, args[0]); err != nil {
+		return err
+	}
+
+	lipgloss.Println(styleSuccess.Render("active") + " " + styleActive.Render(args[0]))
+	return nil
+}
+
+func runSessionsDeleteCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	activeID := loadActiveSession(app.Config.DataDir)
+
+	for _, arg := range args {
+		if err := svc.Delete(core.SessionID(arg)); err != nil {
+			return fmt.Errorf("delete session: %w", err)
+		}
+		if arg == activeID {
+			clearActiveSession(app.Config.DataDir)
+		}
+		lipgloss.Println(styleSuccess.Render("deleted") + " " + arg)
+	}
+
+	return nil
+}
+
+func runSessionsPruneCmd(cmd *cobra.Command, _ []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	olderThan, _ := cmd.Flags().GetString("older-than")
+	age, err := parseAge(olderThan)
+	if err != nil {
+		return fmt.Errorf("--older-than: %w", err)
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	var exclude []core.SessionID
+	if activeID := loadActiveSession(app.Config.DataDir); activeID != "" {
+		exclude = append(exclude, core.SessionID(activeID))
+	}
+
+	pruned, err := svc.Prune(time.Now().Add(-age), dryRun, exclude...)
+	for _, info := range pruned {
+		label := styleSuccess.Render("deleted")
+		if dryRun {
+			label = styleWarning.Render("would delete")
+		}
+		lipgloss.Println(label + " " + string(info.ID) + " " + styleDim.Render(formatTime(info.ModifiedAt)))
+	}
+	if err != nil {
+		return fmt.Errorf("prune sessions: %w", err)
+	}
+
+	if len(pruned) == 0 {
+		lipgloss.Println(styleDim.Render("No sessions older than " + olderThan + "."))
+	}
+	return nil
+}
+
+// parseAge parses a duration such as "90m" or "720h", and also accepts whole days such as "30d".
+func parseAge(s string) (time.Duration, error) {
+	var age time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		age = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		age = d
+	}
+
+	if age <= 0 {
+		return 0, fmt.Errorf("age must be positive, got %q", s)
+	}
+	return age, nil
+}
+
+func runSessionsForkCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	at, _ := cmd.Flags().GetInt("at")
+	if cmd.Flags().Changed("at") && at < 0 {
+		return fmt.Errorf("--at must not be negative")
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	childID, err := svc.Fork(core.SessionID(args[0]), at)
+	if err != nil {
+		return fmt.Errorf("fork session: %w", err)
+	}
+
+	info, err := svc.Get(childID)
+	if err != nil {
+		return fmt.Errorf("fork session: %w", err)
+	}
+
+	if err := saveActiveSession(app.Config.DataDir, string(childID)); err != nil {
+		slog.Warn("failed to save active session", "error", err)
+	}
+
+	lipgloss.Println(styleSuccess.Render("forked") + " " + args[0] + " -> " + styleActive.Render(string(childID)) +
+		styleDim.Render(fmt.Sprintf(" (%d messages, now active)", info.MessageCount)))
+	return nil
+}
+
+func runSessionsMigrateCmd(cmd *cobra.Command, _ []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	results, err := svc.Migrate()
+
+	rewritten := 0
+	for _, result := range results {
+		if !result.Rewritten {
+			continue
+		}
+		rewritten++
+
+		line := styleSuccess.Render("migrated") + " " + string(result.ID)
+		if result.Quarantined > 0 {
+			line += styleDim.Render(fmt.Sprintf(" (%d unreadable lines quarantined)", result.Quarantined))
+		}
+		lipgloss.Println(line)
+	}
+
+	if err != nil {
+		return fmt.Errorf("migrate sessions: %w", err)
+	}
+
+	lipgloss.Println(styleDim.Render(fmt.Sprintf("%d of %d sessions rewritten", rewritten, len(results))))
+	return nil
+}
+
+func runSessionsRepairCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	dryRun, _ := cmd.Flags().GetBool("check")
+
+	ids := make([]core.SessionID, 0, len(args))
+	for _, arg := range args {
+		ids = append(ids, core.SessionID(arg))
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	results, err := svc.Repair(ids, dryRun)
+
+	damaged := 0
+	for _, result := range results {
+		if len(result.Damage) == 0 {
+			continue
+		}
+		damaged++
+		printRepairResult(result, dryRun)
+	}
+
+	if err != nil {
+		return fmt.Errorf("repair sessions: %w", err)
+	}
+
+	lipgloss.Println(styleDim.Render(fmt.Sprintf("%d of %d sessions damaged", damaged, len(results))))
+	return nil
+}
+
+func runSessionsSearchCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	agentName, _ := cmd.Flags().GetString("agent")
+	roleFlag, _ := cmd.Flags().GetString("role")
+	sinceFlag, _ := cmd.Flags().GetString("since")
+	untilFlag, _ := cmd.Flags().GetString("until")
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	role, err := search.ParseRole(roleFlag)
+	if err != nil {
+		return fmt.Errorf("--role: %w", err)
+	}
+	since, until, err := search.ParseRange(sinceFlag, untilFlag)
+	if err != nil {
+		return err
+	}
+
+	index := search.New(&session.FileService{BaseDir: app.Config.DataDir})
+	results, err := index.Search(search.Query{
+		Text:  strings.Join(args, " "),
+		Agent: agentName,
+		Role:  role,
+		Since: since,
+		Until: until,
+		Limit: limit,
+	})
+	if err != nil {
+		return fmt.Errorf("search sessions: %w", err)
+	}
+
+	if len(results) == 0 {
+		lipgloss.Println(styleDim.Render("No matches."))
+		return nil
+	}
+
+	for _, result := range results {
+		agentLabel := result.Agent
+		if agentLabel == "" {
+			agentLabel = "default"
+		}
+		lipgloss.Println(styleActive.Render(string(result.SessionID)) + fmt.Sprintf(" #%d ", result.MessageIndex) +
+			string(result.Role) + styleDim.Render(fmt.Sprintf(" (%s) %s  score %.2f", agentLabel, formatTime(result.Time), result.Score)))
+		lipgloss.Println("  " + result.Snippet)
+	}
+	return nil
+}
+
+func runSessionsExportCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	formatFlag, _ := cmd.Flags().GetString("format")
+	output, _ := cmd.Flags().GetString("output")
+	redact, _ := cmd.Flags().GetBool("redact-tool-output")
+	maxLines, _ := cmd.Flags().GetInt("max-output-lines")
+
+	format, err := transcript.ParseFormat(formatFlag)
+	if err != nil {
+		return fmt.Errorf("--format: %w", err)
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	doc, err := transcript.FromSession(svc, core.SessionID(args[0]))
+	if err != nil {
+		return fmt.Errorf("export session: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("export session: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	opts := transcript.Options{RedactToolOutput: redact, MaxToolOutputLines: maxLines}
+	if err := doc.Write(out, format, opts); err != nil {
+		return fmt.Errorf("export session: %w", err)
+	}
+
+	if output != "" {
+		lipgloss.Println(styleSuccess.Render("exported") + " " + args[0] + " -> " + output)
+	}
+	return nil
+}
+
+func runSessionsImportCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("import session: %w", err)
+	}
+	defer file.Close()
+
+	doc, err := transcript.Read(file)
+	if err != nil {
+		return fmt.Errorf("import session: %w", err)
+	}
+
+	svc := &session.FileService{BaseDir: app.Config.DataDir}
+	id, err := transcript.Import(svc, doc)
+	if err != nil {
+		return fmt.Errorf("import session: %w", err)
+	}
+
+	info, err := svc.Get(id)
+	if err != nil {
+		return fmt.Errorf("import session: %w", err)
+	}
+
+	if err := saveActiveSession(app.Config.DataDir, string(id)); err != nil {
+		slog.Warn("failed to save active session", "error", err)
+	}
+
+	lipgloss.Println(styleSuccess.Render("imported") + " " + string(doc.SessionID) + " -> " + styleActive.Render(string(id)) +
+		styleDim.Render(fmt.Sprintf(" (%d messages, now active)", info.MessageCount)))
+	return nil
+}
+
+func printRepairResult(result session.RepairResult, dryRun bool) {
+	label := styleSuccess.Render("repaired")
+	if dryRun {
+		label = styleWarning.Render("damaged")
+	}
+	lipgloss.Println(label + " " + string(result.ID))
+
+	quarantined := false
+	for _, damage := range result.Damage {
+		action, planned := "quarantined", "would quarantine"
+		if damage.Torn {
+			action, planned = "torn, truncated", "torn, would truncate"
+		} else {
+			quarantined = true
+		}
+		if dryRun {
+			action = planned
+		}
+		lipgloss.Println(styleDim.Render(fmt.Sprintf("  line %d: %v (%s)", damage.Line, damage.Err, action)))
+	}
+
+	if quarantined && !dryRun {
+		lipgloss.Println(styleDim.Render("  quarantined lines saved to " + result.QuarantinePath))
+	}
+}
+
 func printSessionsTable(list []session.Info, activeID string) {
-	t := newTable("", "SESSION ID", "AGENT", "MESSAGES", "SIZE", "MODIFIED")
+	t := newTable("", "SESSION ID", "TITLE", "AGENT", "MESSAGES", "SIZE", "MODIFIED", "FORKED FROM")
 
 	for _, info := range list {
 		marker := " "
@@ -57,15 +687,40 @@ func printSessionsTable(list []session.Info, activeID string) {
 			agentName = "default"
 		}
 
-		t.Row(marker, id, agentName,
+		forkedFrom := ""
+		if info.ParentID != "" {
+			forkedFrom = fmt.Sprintf("%s@%d", info.ParentID, info.ForkedAt)
+		}
+		if len(info.Children) > 0 {
+			forkedFrom = strings.TrimSpace(forkedFrom + " " + styleDim.Render(fmt.Sprintf("(%d forks)", len(info.Children))))
+		}
+
+		title := truncateRunes(info.Title, maxTitleWidth)
+		for _, tag := range info.Tags {
+			title = strings.TrimSpace(title + " " + styleDim.Render("#"+tag))
+		}
+
+		t.Row(marker, id, title, agentName,
 			fmt.Sprintf("%d", info.MessageCount),
 			formatSize(info.FileSize),
-			formatTime(info.ModifiedAt))
+			formatTime(info.ModifiedAt),
+			forkedFrom)
 	}
 
 	lipgloss.Println(t.Render())
 }
 
+// maxTitleWidth is how much of a session title the sessions table shows.
+const maxTitleWidth = 40
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
 func formatSize(bytes int64) string {
 	switch {
 	case bytes >= 1024*1024:
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "30d", want: 30 * 24 * time.Hour},
+		{in: "720h", want: 720 * time.Hour},
+		{in: "90m", want: 90 * time.Minute},
+		{in: "0d", wantErr: true},
+		{in: "-1h", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "1.5d", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseAge(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseAge(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -23,15 +23,15 @@ func newStopCmd() *cobra.Command {
 				return err
 			}
 
-			stopKontekstServer(cmd.Context(), app.ServerAddr)
+			stopKontekstServer(cmd.Context(), app)
 			stopLlamaServer()
 			return nil
 		},
 	}
 }
 
-func stopKontekstServer(ctx context.Context, serverAddr string) {
-	client, err := protocol.Dial(ctx, serverAddr, protocol.ClientCallbacks{})
+func stopKontekstServer(ctx context.Context, app *App) {
+	client, err := app.connect(ctx, protocol.ClientCallbacks{})
 	if err != nil {
 		lipgloss.Println(styleDim.Render("kontekst server not running"))
 		return
@@ -26,6 +26,8 @@ var (
 	styleToolArgs = styleDim
 
 	styleReasoning = lipgloss.NewStyle().Faint(true).Italic(true)
+	styleHook      = lipgloss.NewStyle().Foreground(colorPrimary)
+	stylePlanTitle = lipgloss.NewStyle().Bold(true).Foreground(colorPrimary)
 
 	stylePromptAction = lipgloss.NewStyle().Bold(true).Foreground(colorWarning)
 	stylePromptHint   = styleDim
@@ -59,6 +61,7 @@ var toolKindLabels = map[string]string{
 	"execute": "exec",
 	"search":  "search",
 	"fetch":   "fetch",
+	"think":   "plan",
 }
 
 func toolKindLabel(kind string) string {
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	lipgloss "github.com/charmbracelet/lipgloss/v2"
+
+	"github.com/erg0nix/kontekst/internal/auth"
+	"github.com/spf13/cobra"
+)
+
+func newTLSCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tls",
+		Short: "Manage the certificates used on tls:// addresses",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "pin",
+		Short: "Print the server certificate's pin and the CA clients can trust",
+		Args:  cobra.NoArgs,
+		RunE:  runTLSPinCmd,
+	})
+
+	issueCmd := &cobra.Command{
+		Use:   "issue <name>",
+		Short: "Issue a client certificate for mutual TLS, signed by the generated CA",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runTLSIssueCmd,
+	}
+	issueCmd.Flags().String("out", ".", "directory to write <name>.pem and <name>-key.pem to")
+	cmd.AddCommand(issueCmd)
+
+	return cmd
+}
+
+func runTLSPinCmd(cmd *cobra.Command, _ []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+
+	pin, err := auth.ServerPin(app.Config.DataDir, app.Config.TLS)
+	if err != nil {
+		return err
+	}
+
+	lipgloss.Println(pin)
+	if app.Config.TLS.CertFile == "" {
+		lipgloss.Println(styleDim.Render("CA certificate: " + auth.CAPath(app.Config.DataDir)))
+	}
+	return nil
+}
+
+func runTLSIssueCmd(cmd *cobra.Command, args []string) error {
+	app, err := newApp(cmd)
+	if err != nil {
+		return err
+	}
+	outDir, _ := cmd.Flags().GetString("out")
+	name := args[0]
+
+	certPEM, keyPEM, err := auth.IssueClientCertificate(app.Config.DataDir, name)
+	if err != nil {
+		return err
+	}
+
+	certPath := filepath.Join(outDir, name+".pem")
+	keyPath := filepath.Join(outDir, name+"-key.pem")
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return fmt.Errorf("tls: write certificate: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return fmt.Errorf("tls: write key: %w", err)
+	}
+
+	lipgloss.Println(styleSuccess.Render("issued") + " " + certPath + " " + styleDim.Render("and "+keyPath))
+	return nil
+}
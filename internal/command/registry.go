@@ -11,9 +11,12 @@ import (
 )
 
 // Registry loads and stores commands from a directory, providing thread-safe access by name.
+// dirs maps each command directory to the command loaded from it, so a reload can keep a command whose
+// manifest or script has become invalid.
 type Registry struct {
 	commandsDir string
 	commands    map[string]*Command
+	dirs        map[string]*Command
 	mu          sync.RWMutex
 }
 
@@ -22,25 +25,25 @@ func NewRegistry(commandsDir string) *Registry {
 	return &Registry{
 		commandsDir: commandsDir,
 		commands:    make(map[string]*Command),
+		dirs:        make(map[string]*Command),
 	}
 }
 
-// Load discovers and parses all command directories from the registry's base directory.
+// Load discovers and parses all command directories from the registry's base directory and replaces the
+// loaded commands with them in one step. A directory that fails to load keeps the command previously
+// loaded from it, if any, and the registry is left unchanged when the base directory cannot be read.
 func (r *Registry) Load() error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	r.commands = make(map[string]*Command)
-
-	if _, err := os.Stat(r.commandsDir); os.IsNotExist(err) {
-		return nil
-	}
-
 	entries, err := os.ReadDir(r.commandsDir)
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
+	r.mu.RLock()
+	previous := r.dirs
+	r.mu.RUnlock()
+
+	commands := make(map[string]*Command)
+	dirs := make(map[string]*Command)
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -49,12 +52,21 @@ func (r *Registry) Load() error {
 		dirPath := filepath.Join(r.commandsDir, entry.Name())
 		cmd, err := loadCommandDir(dirPath)
 		if err != nil {
-			slog.Warn("skipping command", "dir", entry.Name(), "error", err)
-			continue
+			cmd = previous[dirPath]
+			if cmd == nil {
+				slog.Warn("skipping command", "dir", entry.Name(), "error", err)
+				continue
+			}
+			slog.Warn("keeping previous version of command", "command", cmd.Name, "dir", entry.Name(), "error", err)
 		}
-		r.commands[cmd.Name] = cmd
+		commands[cmd.Name] = cmd
+		dirs[dirPath] = cmd
 	}
 
+	r.mu.Lock()
+	r.commands = commands
+	r.dirs = dirs
+	r.mu.Unlock()
 	return nil
 }
 
@@ -67,6 +79,19 @@ func (r *Registry) Get(name string) (*Command, bool) {
 	return cmd, ok
 }
 
+// List returns every loaded command, sorted by name.
+func (r *Registry) List() []*Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*Command, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		result = append(result, cmd)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
 // Summaries returns a formatted string listing all commands with their descriptions and arguments.
 func (r *Registry) Summaries() string {
 	r.mu.RLock()
@@ -230,6 +230,24 @@ required = true
 	}
 }
 
+func TestRegistryList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"zeta", "alpha"} {
+		writeFile(t, filepath.Join(dir, name, "command.toml"), "name = \""+name+"\"\ndescription = \"d\"\nruntime = \"bash\"\n")
+		writeFile(t, filepath.Join(dir, name, "run.sh"), "echo hi")
+	}
+
+	reg := NewRegistry(dir)
+	if err := reg.Load(); err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	cmds := reg.List()
+	if len(cmds) != 2 || cmds[0].Name != "alpha" || cmds[1].Name != "zeta" {
+		t.Errorf("List() = %v, want alpha then zeta", cmds)
+	}
+}
+
 func TestRegistrySummaries(t *testing.T) {
 	dir := t.TempDir()
 	cmdDir := filepath.Join(dir, "greet")
@@ -305,6 +323,44 @@ runtime = "bash"
 	}
 }
 
+func TestRegistryReloadKeepsPreviousVersion(t *testing.T) {
+	dir := t.TempDir()
+	cmdDir := filepath.Join(dir, "deploy")
+	writeFile(t, filepath.Join(cmdDir, "command.toml"), `
+name = "deploy"
+description = "v1"
+runtime = "bash"
+`)
+	writeFile(t, filepath.Join(cmdDir, "run.sh"), "echo deploy")
+
+	reg := NewRegistry(dir)
+	if err := reg.Load(); err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	writeFile(t, filepath.Join(cmdDir, "command.toml"), `
+name = "deploy"
+description = "v2"
+runtime = "perl"
+`)
+	if err := reg.Load(); err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cmd, ok := reg.Get("deploy"); !ok || cmd.Description != "v1" {
+		t.Errorf("Get(deploy) = %+v, %v, want the previous version", cmd, ok)
+	}
+
+	if err := os.RemoveAll(cmdDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Load(); err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if _, ok := reg.Get("deploy"); ok {
+		t.Error("removed command is still loaded")
+	}
+}
+
 func TestLoadRequirementsPathTraversal(t *testing.T) {
 	dir := t.TempDir()
 	cmdDir := filepath.Join(dir, "traversal")
@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/erg0nix/kontekst/internal/config"
 	"github.com/erg0nix/kontekst/internal/core"
 	"github.com/pelletier/go-toml/v2"
 )
@@ -25,22 +26,26 @@ type ProviderConfig struct {
 
 // AgentConfig is the fully resolved configuration for an agent, ready for use by the agent loop.
 type AgentConfig struct {
-	Name         string
-	DisplayName  string
-	SystemPrompt string
-	ContextSize  int
-	Provider     ProviderConfig
-	Sampling     *core.SamplingConfig
-	ToolRole     bool
+	Name          string
+	DisplayName   string
+	SystemPrompt  string
+	ContextSize   int
+	Provider      ProviderConfig
+	Sampling      *core.SamplingConfig
+	ToolRole      bool
+	Hooks         config.HooksConfig
+	LoopDetection config.LoopDetectionConfig
 }
 
 // AgentTOML is the TOML-serializable representation of an agent's configuration file.
 type AgentTOML struct {
-	Name        string               `toml:"name"`
-	ContextSize int                  `toml:"context_size"`
-	Provider    ProviderTOML         `toml:"provider"`
-	Sampling    *core.SamplingConfig `toml:"sampling"`
-	ToolRole    bool                 `toml:"tool_role"`
+	Name          string                     `toml:"name"`
+	ContextSize   int                        `toml:"context_size"`
+	Provider      ProviderTOML               `toml:"provider"`
+	Sampling      *core.SamplingConfig       `toml:"sampling"`
+	ToolRole      bool                       `toml:"tool_role"`
+	Hooks         config.HooksConfig         `toml:"hooks"`
+	LoopDetection config.LoopDetectionConfig `toml:"loop_detection"`
 }
 
 // LoadTOML reads and parses an agent TOML config file, returning nil if the file does not exist.
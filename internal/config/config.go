@@ -39,19 +39,108 @@ type DebugConfig struct {
 	ValidateRoles bool   `toml:"validate_roles"`
 }
 
-// Config is the top-level server configuration loaded from config.toml.
+// HookConfig describes a single lifecycle hook script and the tools it applies to.
+type HookConfig struct {
+	Command        string `toml:"command"`
+	Matcher        string `toml:"matcher,omitempty"`
+	TimeoutSeconds int    `toml:"timeout_seconds,omitempty"`
+}
+
+// HooksConfig groups lifecycle hooks by the agent event that triggers them.
+type HooksConfig struct {
+	PreToolUse       []HookConfig `toml:"pre_tool_use,omitempty"`
+	PostToolUse      []HookConfig `toml:"post_tool_use,omitempty"`
+	UserPromptSubmit []HookConfig `toml:"user_prompt_submit,omitempty"`
+	RunEnd           []HookConfig `toml:"run_end,omitempty"`
+}
+
+// LoopDetectionConfig sets when the agent loop treats repeated tool activity as a loop.
+// Zero thresholds fall back to the defaults.
+type LoopDetectionConfig struct {
+	Disabled       bool `toml:"disabled,omitempty"`
+	RepeatedCalls  int  `toml:"repeated_calls,omitempty"`
+	RepeatedErrors int  `toml:"repeated_errors,omitempty"`
+	Oscillations   int  `toml:"oscillations,omitempty"`
+}
+
+// SessionsConfig holds settings for session file storage. Sync is when appends are flushed to disk:
+// "never", "run" (at the end of each run) or "always". AutoTitle asks the model for a session title
+// after the first exchange.
+type SessionsConfig struct {
+	Sync      string `toml:"sync"`
+	AutoTitle bool   `toml:"auto_title"`
+}
+
+// MemoryConfig holds settings for project memory. IndexTokens limits the memory index added to the
+// system prompt; older memories past the limit can still be recalled with the memory tool.
+type MemoryConfig struct {
+	Enabled     bool `toml:"enabled"`
+	IndexTokens int  `toml:"index_tokens"`
+}
+
+// TLSConfig holds the settings for "tls://" addresses. The server uses CertFile and KeyFile when set, and
+// otherwise a certificate for Hosts and the machine's own names issued by a CA generated in the data
+// directory. RequireClientCert makes clients present a certificate signed by ClientCAFile, or by the
+// generated CA when that is empty. Client holds the settings the CLI uses to connect to a tls:// server.
+type TLSConfig struct {
+	CertFile          string          `toml:"cert_file,omitempty"`
+	KeyFile           string          `toml:"key_file,omitempty"`
+	Hosts             []string        `toml:"hosts,omitempty"`
+	RequireClientCert bool            `toml:"require_client_cert,omitempty"`
+	ClientCAFile      string          `toml:"client_ca_file,omitempty"`
+	Client            ClientTLSConfig `toml:"client,omitempty"`
+}
+
+// ClientTLSConfig holds how the CLI verifies a tls:// server and the certificate it presents for mutual
+// TLS. Pin is "sha256:<hex>" of the server certificate's public key and replaces CA verification when
+// set; otherwise the server must chain to CAFile, the data directory's generated CA or the system roots.
+type ClientTLSConfig struct {
+	CAFile     string `toml:"ca_file,omitempty"`
+	Pin        string `toml:"pin,omitempty"`
+	ServerName string `toml:"server_name,omitempty"`
+	CertFile   string `toml:"cert_file,omitempty"`
+	KeyFile    string `toml:"key_file,omitempty"`
+}
+
+// WebSocketConfig enables serving ACP over WebSocket, for browser clients, at /acp on an HTTP listener.
+// Bind takes the same forms as Config.Bind, with a tls:// address serving wss://; empty disables it.
+// Browsers may connect from a loopback origin or from AllowedOrigins, where "*" allows any.
+type WebSocketConfig struct {
+	Bind           string   `toml:"bind,omitempty"`
+	AllowedOrigins []string `toml:"allowed_origins,omitempty"`
+}
+
+// OpenAIConfig enables an OpenAI-compatible HTTP API serving /v1/models and /v1/chat/completions, where
+// each agent is a model. Bind takes the same forms as Config.Bind; empty disables it. An HTTP client cannot
+// answer permission requests, so a tool call runs without asking only when its tool is in ApproveTools,
+// where "*" approves every tool; other calls are refused and the model is told to answer without them.
+// WorkingDir is the directory new sessions' runs work in; without it runs get no tools.
+type OpenAIConfig struct {
+	Bind         string   `toml:"bind,omitempty"`
+	ApproveTools []string `toml:"approve_tools,omitempty"`
+	WorkingDir   string   `toml:"working_dir,omitempty"`
+}
+
+// Config is the top-level server configuration loaded from config.toml. Bind is a "unix:///path" socket
+// a TCP "host:port" or a TLS "tls://host:port"; left empty, the server listens on the socket returned by [DefaultBind].
 type Config struct {
-	Bind    string      `toml:"bind"`
-	DataDir string      `toml:"data_dir"`
-	Tools   ToolsConfig `toml:"tools"`
-	Debug   DebugConfig `toml:"debug"`
+	Bind      string          `toml:"bind"`
+	DataDir   string          `toml:"data_dir"`
+	Tools     ToolsConfig     `toml:"tools"`
+	Debug     DebugConfig     `toml:"debug"`
+	Sessions  SessionsConfig  `toml:"sessions"`
+	Memory    MemoryConfig    `toml:"memory"`
+	TLS       TLSConfig       `toml:"tls,omitempty"`
+	WebSocket WebSocketConfig `toml:"websocket,omitempty"`
+	OpenAI    OpenAIConfig    `toml:"openai,omitempty"`
+	Hooks     HooksConfig     `toml:"hooks,omitempty"`
 }
 
 // Default returns a Config populated with sensible default values.
 func Default() Config {
 	defaultDataDir := defaultDataDir()
 	return Config{
-		Bind:    ":50051",
+		Bind:    "",
 		DataDir: defaultDataDir,
 		Tools: ToolsConfig{
 			WorkingDir: "",
@@ -69,6 +158,14 @@ func Default() Config {
 			LogDirectory:  filepath.Join(defaultDataDir, "debug"),
 			ValidateRoles: true,
 		},
+		Sessions: SessionsConfig{
+			Sync:      "run",
+			AutoTitle: true,
+		},
+		Memory: MemoryConfig{
+			Enabled:     true,
+			IndexTokens: 1000,
+		},
 	}
 }
 
@@ -91,6 +188,7 @@ func LoadOrCreate(path string) (Config, error) {
 				return config, fmt.Errorf("config: write defaults: %w", err)
 			}
 
+			config.Bind = DefaultBind(config.DataDir)
 			return config, nil
 		}
 
@@ -108,14 +206,27 @@ func LoadOrCreate(path string) (Config, error) {
 
 	config.DataDir = expandPath(config.DataDir)
 	config.Bind = strings.TrimSpace(config.Bind)
+	config.TLS.CertFile = expandPath(config.TLS.CertFile)
+	config.TLS.KeyFile = expandPath(config.TLS.KeyFile)
+	config.TLS.ClientCAFile = expandPath(config.TLS.ClientCAFile)
+	config.TLS.Client.CAFile = expandPath(config.TLS.Client.CAFile)
+	config.TLS.Client.CertFile = expandPath(config.TLS.Client.CertFile)
+	config.TLS.Client.KeyFile = expandPath(config.TLS.Client.KeyFile)
+	config.OpenAI.WorkingDir = expandPath(config.OpenAI.WorkingDir)
 
 	if config.Bind == "" {
-		config.Bind = ":50051"
+		config.Bind = DefaultBind(config.DataDir)
 	}
 
 	return config, nil
 }
 
+// DefaultBind returns the address the server listens on when none is configured: a unix socket in the
+// data directory, reachable only by its owner.
+func DefaultBind(dataDir string) string {
+	return "unix://" + filepath.Join(dataDir, "kontekst.sock")
+}
+
 func defaultDataDir() string {
 	homeDir, _ := os.UserHomeDir()
 
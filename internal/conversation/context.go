@@ -5,28 +5,35 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/erg0nix/kontekst/internal/core"
 )
 
 // BudgetParams holds the token budget breakdown used to size the context window for a run.
+// SystemTokens excludes the project memory index, which is counted in ProjectMemoryTokens. ReplyTokens is
+// the room kept for the model's reply, its max_tokens.
 type BudgetParams struct {
-	ContextSize      int
-	SystemContent    string
-	SystemTokens     int
-	ToolTokens       int
-	UserPromptTokens int
+	ContextSize         int
+	SystemContent       string
+	SystemTokens        int
+	ProjectMemoryTokens int
+	ToolTokens          int
+	UserPromptTokens    int
+	ReplyTokens         int
 }
 
 // FileService creates Window instances backed by JSONL session files on disk.
 type FileService struct {
 	dataDir string
+	sync    SyncPolicy
 }
 
-// NewFileService creates a FileService rooted at the given data directory.
-func NewFileService(dataDir string) *FileService {
-	return &FileService{dataDir: dataDir}
+// NewFileService creates a FileService rooted at the given data directory whose session files flush per the sync policy.
+func NewFileService(dataDir string, sync SyncPolicy) *FileService {
+	return &FileService{dataDir: dataDir, sync: sync}
 }
 
 // NewWindow creates a new Window backed by the session's JSONL file.
@@ -39,6 +46,7 @@ func (service *FileService) NewWindow(sessionID core.SessionID) (*Window, error)
 
 	sessionPath := filepath.Join(sessionDir, string(sessionID)+".jsonl")
 	sessionFile := NewSessionFile(sessionPath)
+	sessionFile.sync = service.sync
 
 	return NewWindow(sessionFile), nil
 }
@@ -49,11 +57,16 @@ type Window struct {
 	history           []core.Message
 	memory            []core.Message
 	agentSystemPrompt string
+	projectMemory     string
 	activeSkill       *core.SkillMetadata
+	plan              []core.PlanEntry
+	planNote          *core.Message
 	systemContent     string
 	contextSize       int
 	systemTokens      int
+	memoryIndexTokens int
 	toolTokens        int
+	replyTokens       int
 	mu                sync.Mutex
 }
 
@@ -67,12 +80,24 @@ func (cw *Window) SystemContent() string {
 	cw.mu.Lock()
 	defer cw.mu.Unlock()
 
+	return cw.buildSystemContent()
+}
+
+func (cw *Window) buildSystemContent() string {
 	content := cw.agentSystemPrompt
 
+	if cw.projectMemory != "" {
+		content = content + "\n\n" + cw.projectMemory
+	}
+
 	if cw.activeSkill != nil {
 		content = content + fmt.Sprintf("\n\n<active-skill name=%q path=%q />", cw.activeSkill.Name, cw.activeSkill.Path)
 	}
 
+	if len(cw.plan) > 0 {
+		content = content + "\n\n" + PlanNote(cw.plan)
+	}
+
 	return content
 }
 
@@ -83,9 +108,11 @@ func (cw *Window) StartRun(params BudgetParams) error {
 	cw.contextSize = params.ContextSize
 	cw.systemContent = params.SystemContent
 	cw.systemTokens = params.SystemTokens
+	cw.memoryIndexTokens = params.ProjectMemoryTokens
 	cw.toolTokens = params.ToolTokens
+	cw.replyTokens = params.ReplyTokens
 
-	historyBudget := cw.contextSize - params.SystemTokens - params.ToolTokens - params.UserPromptTokens
+	historyBudget := cw.contextSize - params.SystemTokens - params.ProjectMemoryTokens - params.ToolTokens - params.UserPromptTokens
 	if historyBudget < 0 {
 		historyBudget = 0
 	}
@@ -97,15 +124,37 @@ func (cw *Window) StartRun(params BudgetParams) error {
 
 	cw.history = history
 	cw.memory = nil
+	cw.planNote = nil
 
 	return nil
 }
 
+// Rewind supersedes the responses of the last turns in the session file so the next run
+// continues from the user message that started them. It must be called before StartRun.
+func (cw *Window) Rewind(turns int) (int, error) {
+	return cw.sessionFile.Rewind(turns, "rewind")
+}
+
+// RecordRunStart appends a run_start record to the session file.
+func (cw *Window) RecordRunStart(start RunStart) error {
+	rec := newRecord(RecordRunStart)
+	rec.RunStart = &start
+	return cw.sessionFile.AppendRecord(rec)
+}
+
+// RecordRunEnd appends a run_end record to the session file.
+func (cw *Window) RecordRunEnd(end RunEnd) error {
+	rec := newRecord(RecordRunEnd)
+	rec.RunEnd = &end
+	return cw.sessionFile.AppendRecord(rec)
+}
+
 func (cw *Window) CompleteRun() {
 	cw.mu.Lock()
 	defer cw.mu.Unlock()
 
 	cw.memory = nil
+	cw.planNote = nil
 }
 
 func (cw *Window) AddMessage(msg core.Message) error {
@@ -121,17 +170,39 @@ func (cw *Window) AddMessage(msg core.Message) error {
 	return nil
 }
 
+// BuildContext returns the messages to send to the LLM: the system message, history and the current run's
+// messages, followed by the plan note if the plan changed during the run. Stale read_file results are
+// replaced by placeholders; see fitReads. The session file is not changed.
 func (cw *Window) BuildContext() ([]core.Message, error) {
 	cw.mu.Lock()
 	defer cw.mu.Unlock()
 
+	messages := make([]core.Message, 0, len(cw.history)+len(cw.memory)+1)
+	messages = append(messages, cw.history...)
+	messages = append(messages, cw.runMessages()...)
+	messages, _, _ = cw.fitReads(messages)
+
 	systemMessage := core.Message{Role: core.RoleSystem, Content: cw.systemContent}
+	return append([]core.Message{systemMessage}, messages...), nil
+}
 
-	out := []core.Message{systemMessage}
-	out = append(out, cw.history...)
-	out = append(out, cw.memory...)
+// runMessages returns the current run's messages with the plan note, if any, after them.
+func (cw *Window) runMessages() []core.Message {
+	if cw.planNote == nil {
+		return cw.memory
+	}
+	return append(slices.Clip(cw.memory), *cw.planNote)
+}
 
-	return out, nil
+// fitReads replaces read_file results that a later edit made stale, since they would mislead the model
+// about the file. Results merely repeated by a later read are replaced only once the messages no longer
+// leave room for the reply: replacing a result rewrites a message that llama-server has already cached, so
+// every later turn is re-processed from that point. It returns the messages with how many results were
+// replaced and the tokens saved.
+func (cw *Window) fitReads(messages []core.Message) ([]core.Message, int, int) {
+	used := cw.systemTokens + cw.memoryIndexTokens + cw.toolTokens + sumTokens(messages)
+	tight := cw.contextSize > 0 && used > cw.contextSize-cw.replyTokens
+	return dedupeReads(messages, tight)
 }
 
 func (cw *Window) SetAgentSystemPrompt(prompt string) {
@@ -141,6 +212,21 @@ func (cw *Window) SetAgentSystemPrompt(prompt string) {
 	cw.agentSystemPrompt = prompt
 }
 
+// SetProjectMemory sets the project memory index included in the system content.
+func (cw *Window) SetProjectMemory(index string) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	cw.projectMemory = index
+}
+
+func (cw *Window) ProjectMemory() string {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	return cw.projectMemory
+}
+
 func (cw *Window) SetActiveSkill(skill *core.SkillMetadata) {
 	cw.mu.Lock()
 	defer cw.mu.Unlock()
@@ -155,41 +241,76 @@ func (cw *Window) ActiveSkill() *core.SkillMetadata {
 	return cw.activeSkill
 }
 
+// SetPlan sets the todo list included in the system content of later runs. A run in progress keeps its
+// system message, so the provider's cached prompt stays valid; see SetPlanNote.
+func (cw *Window) SetPlan(entries []core.PlanEntry) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	cw.plan = entries
+}
+
+// SetPlanNote sets the message that tells the model about a plan changed during the run. It is sent after
+// the run's messages, replacing any earlier note, until the run ends, and is not written to the session file.
+func (cw *Window) SetPlanNote(note core.Message) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	cw.planNote = &note
+}
+
+func (cw *Window) Plan() []core.PlanEntry {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	return cw.plan
+}
+
 func (cw *Window) Snapshot() Snapshot {
 	cw.mu.Lock()
 	defer cw.mu.Unlock()
 
-	historyTokens := sumTokens(cw.history)
-	memoryTokens := sumTokens(cw.memory)
-	totalTokens := cw.systemTokens + cw.toolTokens + historyTokens + memoryTokens
+	memory := cw.runMessages()
+	shaped := make([]core.Message, 0, len(cw.history)+len(memory))
+	shaped = append(shaped, cw.history...)
+	shaped = append(shaped, memory...)
+	shaped, dedupedMessages, dedupedTokens := cw.fitReads(shaped)
+	history, memory := shaped[:len(cw.history)], shaped[len(cw.history):]
+
+	historyTokens := sumTokens(history)
+	memoryTokens := sumTokens(memory)
+	totalTokens := cw.systemTokens + cw.memoryIndexTokens + cw.toolTokens + historyTokens + memoryTokens
 
-	historyBudget := cw.contextSize - cw.systemTokens - cw.toolTokens - memoryTokens
+	historyBudget := cw.contextSize - cw.systemTokens - cw.memoryIndexTokens - cw.toolTokens - memoryTokens
 	if historyBudget < 0 {
 		historyBudget = 0
 	}
 
-	messages := make([]MessageStats, 0, 1+len(cw.history)+len(cw.memory))
-	messages = append(messages, MessageStats{Role: core.RoleSystem, Tokens: cw.systemTokens, Source: "system"})
-	for _, msg := range cw.history {
+	messages := make([]MessageStats, 0, 1+len(cw.history)+len(memory))
+	messages = append(messages, MessageStats{Role: core.RoleSystem, Tokens: cw.systemTokens + cw.memoryIndexTokens, Source: "system"})
+	for _, msg := range history {
 		messages = append(messages, MessageStats{Role: msg.Role, Tokens: msg.Tokens, Source: "history"})
 	}
-	for _, msg := range cw.memory {
+	for _, msg := range memory {
 		messages = append(messages, MessageStats{Role: msg.Role, Tokens: msg.Tokens, Source: "memory"})
 	}
 
 	return Snapshot{
-		ContextSize:     cw.contextSize,
-		SystemTokens:    cw.systemTokens,
-		ToolTokens:      cw.toolTokens,
-		HistoryTokens:   historyTokens,
-		MemoryTokens:    memoryTokens,
-		TotalTokens:     totalTokens,
-		RemainingTokens: cw.contextSize - totalTokens,
-		HistoryMessages: len(cw.history),
-		MemoryMessages:  len(cw.memory),
-		TotalMessages:   1 + len(cw.history) + len(cw.memory),
-		HistoryBudget:   historyBudget,
-		Messages:        messages,
+		ContextSize:         cw.contextSize,
+		SystemTokens:        cw.systemTokens,
+		ProjectMemoryTokens: cw.memoryIndexTokens,
+		ToolTokens:          cw.toolTokens,
+		HistoryTokens:       historyTokens,
+		MemoryTokens:        memoryTokens,
+		TotalTokens:         totalTokens,
+		RemainingTokens:     cw.contextSize - totalTokens,
+		HistoryMessages:     len(cw.history),
+		MemoryMessages:      len(memory),
+		TotalMessages:       1 + len(cw.history) + len(memory),
+		HistoryBudget:       historyBudget,
+		DedupedMessages:     dedupedMessages,
+		DedupedTokens:       dedupedTokens,
+		Messages:            messages,
 	}
 }
 
@@ -200,3 +321,29 @@ func sumTokens(messages []core.Message) int {
 	}
 	return total
 }
+
+// PlanNote renders a todo list as the block the model is shown.
+func PlanNote(entries []core.PlanEntry) string {
+	return "<todo-list>\n" + formatPlan(entries) + "\n</todo-list>"
+}
+
+func formatPlan(entries []core.PlanEntry) string {
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		mark := " "
+		switch entry.Status {
+		case core.PlanStatusCompleted:
+			mark = "x"
+		case core.PlanStatusInProgress:
+			mark = "~"
+		}
+
+		line := fmt.Sprintf("- [%s] %s", mark, entry.Content)
+		if entry.Priority != "" && entry.Priority != core.PlanPriorityMedium {
+			line += fmt.Sprintf(" (%s priority)", entry.Priority)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -2,6 +2,7 @@ package conversation
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/erg0nix/kontekst/internal/core"
@@ -54,6 +55,76 @@ func TestContextWindow_SystemContentWithActiveSkill(t *testing.T) {
 	}
 }
 
+func TestContextWindow_ProjectMemoryInSystemContent(t *testing.T) {
+	cw := newTestWindow(t)
+	cw.SetAgentSystemPrompt("Base system prompt.")
+	cw.SetProjectMemory("<project-memory>\n- [1] tests run with make test\n</project-memory>")
+	cw.SetActiveSkill(&core.SkillMetadata{Name: "review", Path: "/skills/review"})
+
+	expected := "Base system prompt.\n\n<project-memory>\n- [1] tests run with make test\n</project-memory>" +
+		"\n\n<active-skill name=\"review\" path=\"/skills/review\" />"
+	if content := cw.SystemContent(); content != expected {
+		t.Errorf("system content mismatch:\ngot:  %q\nwant: %q", content, expected)
+	}
+}
+
+func TestContextWindow_PlanInSystemContent(t *testing.T) {
+	cw := newTestWindow(t)
+	cw.SetAgentSystemPrompt("Base system prompt.")
+	cw.SetPlan([]core.PlanEntry{
+		{Content: "Read the code", Priority: core.PlanPriorityMedium, Status: core.PlanStatusCompleted},
+		{Content: "Fix the bug", Priority: core.PlanPriorityHigh, Status: core.PlanStatusInProgress},
+		{Content: "Write tests", Priority: core.PlanPriorityLow, Status: core.PlanStatusPending},
+	})
+
+	expected := "Base system prompt.\n\n<todo-list>\n" +
+		"- [x] Read the code\n" +
+		"- [~] Fix the bug (high priority)\n" +
+		"- [ ] Write tests (low priority)\n" +
+		"</todo-list>"
+	if content := cw.SystemContent(); content != expected {
+		t.Errorf("system content mismatch:\ngot:  %q\nwant: %q", content, expected)
+	}
+}
+
+func TestContextWindow_PlanNoteDuringRun(t *testing.T) {
+	cw := newTestWindow(t)
+	cw.SetAgentSystemPrompt("Base.")
+
+	if err := cw.StartRun(BudgetParams{ContextSize: 1000, SystemContent: cw.SystemContent(), SystemTokens: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.AddMessage(core.Message{Role: core.RoleUser, Content: "hello", Tokens: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := []core.PlanEntry{{Content: "Step one", Priority: core.PlanPriorityMedium, Status: core.PlanStatusPending}}
+	cw.SetPlan(plan)
+	cw.SetPlanNote(core.Message{Role: core.RoleUser, Content: PlanNote(plan), Tokens: 7})
+
+	msgs, err := cw.BuildContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs[0].Content != "Base." {
+		t.Errorf("system message changed during the run: %q", msgs[0].Content)
+	}
+	if last := msgs[len(msgs)-1]; !strings.Contains(last.Content, "- [ ] Step one") {
+		t.Errorf("last message = %q, want the plan note", last.Content)
+	}
+	if snap := cw.Snapshot(); snap.MemoryTokens != 12 || snap.TotalTokens != 22 {
+		t.Errorf("memory tokens = %d, total %d, want 12 and 22", snap.MemoryTokens, snap.TotalTokens)
+	}
+	if !strings.Contains(cw.SystemContent(), "- [ ] Step one") {
+		t.Error("the next run's system content should include the plan")
+	}
+
+	cw.CompleteRun()
+	if msgs, _ := cw.BuildContext(); len(msgs) != 1 {
+		t.Errorf("got %d messages after the run, want only the system message", len(msgs))
+	}
+}
+
 func TestContextWindow_HistoryFromFile(t *testing.T) {
 	dir := t.TempDir()
 	sessionPath := filepath.Join(dir, "session.jsonl")
@@ -0,0 +1,151 @@
+package conversation
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+// Tool names whose results dedupeReads understands.
+const (
+	toolReadFile  = "read_file"
+	toolEditFile  = "edit_file"
+	toolWriteFile = "write_file"
+)
+
+// fileRead is a successful read_file result: the message holding it and the lines it covered.
+// An end of math.MaxInt means the read ran to the end of the file.
+type fileRead struct {
+	index int
+	path  string
+	start int
+	end   int
+}
+
+// covers reports whether r includes every line of other.
+func (r fileRead) covers(other fileRead) bool {
+	return r.path == other.path && r.start <= other.start && r.end >= other.end
+}
+
+func (r fileRead) describe() string {
+	if r.start == 1 && r.end == math.MaxInt {
+		return r.path
+	}
+	if r.end == math.MaxInt {
+		return fmt.Sprintf("%s from line %d", r.path, r.start)
+	}
+	return fmt.Sprintf("%s lines %d-%d", r.path, r.start, r.end)
+}
+
+// dedupeReads replaces read_file results that no longer reflect the file with a short placeholder: reads of
+// a file that a later edit_file or write_file call changed and, when repeated is set, reads covered by a
+// later read of the same lines. Tool calls are kept so every result still pairs with its call. It returns
+// the shaped messages, sharing the input when nothing is stale, along with how many results were replaced
+// and the tokens saved.
+func dedupeReads(messages []core.Message, repeated bool) ([]core.Message, int, int) {
+	calls := make(map[string]core.ToolCall)
+	var reads []fileRead
+	stale := make(map[int]string)
+
+	for i, msg := range messages {
+		for _, call := range msg.ToolCalls {
+			calls[call.ID] = call
+		}
+
+		if msg.Role != core.RoleTool || msg.ToolResult == nil || msg.ToolResult.IsError {
+			continue
+		}
+		call, ok := calls[msg.ToolResult.CallID]
+		if !ok {
+			continue
+		}
+		path, ok := callPath(call)
+		if !ok {
+			continue
+		}
+
+		switch call.Name {
+		case toolReadFile:
+			read := fileRead{index: i, path: path, start: 1, end: math.MaxInt}
+			if n, ok := intArg(call.Arguments, "start_line"); ok && n > 0 {
+				read.start = n
+			}
+			if n, ok := intArg(call.Arguments, "end_line"); ok {
+				read.end = n
+			}
+
+			kept := reads[:0]
+			for _, earlier := range reads {
+				if repeated && read.covers(earlier) {
+					stale[earlier.index] = fmt.Sprintf("[Earlier read_file output for %s removed: the file was read again below.]", earlier.describe())
+					continue
+				}
+				kept = append(kept, earlier)
+			}
+			reads = append(kept, read)
+
+		case toolEditFile, toolWriteFile:
+			kept := reads[:0]
+			for _, earlier := range reads {
+				if earlier.path == path {
+					stale[earlier.index] = fmt.Sprintf("[Earlier read_file output for %s removed: the file was changed by %s below. Read it again for current content.]", earlier.describe(), call.Name)
+					continue
+				}
+				kept = append(kept, earlier)
+			}
+			reads = kept
+		}
+	}
+
+	if len(stale) == 0 {
+		return messages, 0, 0
+	}
+
+	out := make([]core.Message, len(messages))
+	copy(out, messages)
+
+	saved := 0
+	for i, note := range stale {
+		msg := out[i]
+		result := *msg.ToolResult
+		result.Output = note
+		msg.ToolResult = &result
+		msg.Content = note
+
+		tokens := estimateTokens(note)
+		if msg.Tokens > tokens {
+			saved += msg.Tokens - tokens
+			msg.Tokens = tokens
+		}
+		out[i] = msg
+	}
+
+	return out, len(stale), saved
+}
+
+func callPath(call core.ToolCall) (string, bool) {
+	path, ok := call.Arguments["path"].(string)
+	if !ok || path == "" {
+		return "", false
+	}
+	return filepath.Clean(path), true
+}
+
+func intArg(args map[string]any, key string) (int, bool) {
+	switch n := args[key].(type) {
+	case float64:
+		return int(n), true
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// estimateTokens approximates the token count of a placeholder the window writes itself.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -0,0 +1,230 @@
+package conversation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+func toolCall(id, name string, args map[string]any) core.Message {
+	return core.Message{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{{ID: id, Name: name, Arguments: args}}}
+}
+
+func toolResult(id, name, output string, isError bool) core.Message {
+	return core.Message{
+		Role:       core.RoleTool,
+		Content:    output,
+		ToolResult: &core.ToolResult{CallID: id, Name: name, Output: output, IsError: isError},
+		Tokens:     100,
+	}
+}
+
+func TestDedupeReads(t *testing.T) {
+	read := func(id, path string, rng ...float64) []core.Message {
+		args := map[string]any{"path": path}
+		if len(rng) == 2 {
+			args["start_line"], args["end_line"] = rng[0], rng[1]
+		}
+		return []core.Message{toolCall(id, "read_file", args), toolResult(id, "read_file", "contents of "+path, false)}
+	}
+	edit := func(id, tool, path string, isError bool) []core.Message {
+		return []core.Message{toolCall(id, tool, map[string]any{"path": path}), toolResult(id, tool, "ok", isError)}
+	}
+	join := func(parts ...[]core.Message) []core.Message {
+		var out []core.Message
+		for _, part := range parts {
+			out = append(out, part...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		messages  []core.Message
+		wantStale map[int]string
+	}{
+		{
+			name:      "re-read of the whole file",
+			messages:  join(read("c1", "a.go"), read("c2", "./a.go")),
+			wantStale: map[int]string{1: "read again"},
+		},
+		{
+			name:      "different files are kept",
+			messages:  join(read("c1", "a.go"), read("c2", "b.go")),
+			wantStale: map[int]string{},
+		},
+		{
+			name:      "wider range supersedes a narrower one",
+			messages:  join(read("c1", "a.go", 10, 20), read("c2", "a.go", 1, 50)),
+			wantStale: map[int]string{1: "a.go lines 10-20"},
+		},
+		{
+			name:      "narrower range keeps the wider read",
+			messages:  join(read("c1", "a.go"), read("c2", "a.go", 10, 20)),
+			wantStale: map[int]string{},
+		},
+		{
+			name:      "edit invalidates earlier reads",
+			messages:  join(read("c1", "a.go"), edit("c2", "edit_file", "a.go", false), read("c3", "a.go")),
+			wantStale: map[int]string{1: "changed by edit_file"},
+		},
+		{
+			name:      "write invalidates earlier reads",
+			messages:  join(read("c1", "a.go", 1, 5), edit("c2", "write_file", "a.go", false)),
+			wantStale: map[int]string{1: "changed by write_file"},
+		},
+		{
+			name:      "failed edit leaves the read",
+			messages:  join(read("c1", "a.go"), edit("c2", "edit_file", "a.go", true)),
+			wantStale: map[int]string{},
+		},
+		{
+			name: "failed read does not supersede",
+			messages: join(read("c1", "a.go"), []core.Message{
+				toolCall("c2", "read_file", map[string]any{"path": "a.go"}),
+				toolResult("c2", "read_file", "open file: permission denied", true),
+			}),
+			wantStale: map[int]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, repeated := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/repeated=%v", tt.name, repeated), func(t *testing.T) {
+				wantStale := tt.wantStale
+				if !repeated {
+					wantStale = make(map[int]string)
+					for i, want := range tt.wantStale {
+						if strings.Contains(want, "changed by") {
+							wantStale[i] = want
+						}
+					}
+				}
+				checkDedupe(t, tt.messages, repeated, wantStale)
+			})
+		}
+	}
+}
+
+// checkDedupe runs dedupeReads and checks that exactly the results in wantStale were replaced, by
+// placeholders mentioning their value, without modifying the input.
+func checkDedupe(t *testing.T, messages []core.Message, repeated bool, wantStale map[int]string) {
+	t.Helper()
+	original := make([]core.Message, len(messages))
+	copy(original, messages)
+
+	got, count, saved := dedupeReads(messages, repeated)
+
+	if count != len(wantStale) {
+		t.Errorf("replaced %d results, want %d", count, len(wantStale))
+	}
+	for i, msg := range got {
+		want, isStale := wantStale[i]
+		switch {
+		case isStale && !strings.Contains(msg.Content, want):
+			t.Errorf("message %d = %q, want a placeholder mentioning %q", i, msg.Content, want)
+		case isStale && msg.ToolResult.Output != msg.Content:
+			t.Errorf("message %d tool result output not replaced", i)
+		case !isStale && msg.Content != original[i].Content:
+			t.Errorf("message %d changed to %q", i, msg.Content)
+		}
+	}
+	if count > 0 && saved <= 0 {
+		t.Errorf("saved %d tokens, want a positive saving", saved)
+	}
+	for i := range original {
+		if messages[i].Content != original[i].Content || (original[i].ToolResult != nil && messages[i].ToolResult.Output != original[i].Content) {
+			t.Fatalf("input message %d was modified", i)
+		}
+	}
+}
+
+func TestContextWindow_BuildContextDedupesReads(t *testing.T) {
+	cw := newTestWindow(t)
+	if err := cw.StartRun(BudgetParams{ContextSize: 4096, SystemContent: "system", SystemTokens: 10, ReplyTokens: 1024}); err != nil {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+
+	messages := []core.Message{
+		toolCall("c1", "read_file", map[string]any{"path": "a.go"}),
+		toolResult("c1", "read_file", "old contents", false),
+		toolCall("c2", "edit_file", map[string]any{"path": "a.go"}),
+		toolResult("c2", "edit_file", "Applied 1 edit(s) to a.go", false),
+	}
+	for _, msg := range messages {
+		if err := cw.AddMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	built, err := cw.BuildContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(built[2].Content, "old contents") {
+		t.Errorf("stale read sent to the model: %q", built[2].Content)
+	}
+
+	snapshot := cw.Snapshot()
+	if snapshot.DedupedMessages != 1 || snapshot.DedupedTokens <= 0 {
+		t.Errorf("snapshot dedupe = %d messages, %d tokens", snapshot.DedupedMessages, snapshot.DedupedTokens)
+	}
+	if snapshot.MemoryTokens != 200-snapshot.DedupedTokens {
+		t.Errorf("MemoryTokens = %d, want %d after dedupe", snapshot.MemoryTokens, 200-snapshot.DedupedTokens)
+	}
+
+	stored, err := cw.sessionFile.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored[1].Content != "old contents" {
+		t.Errorf("session file was changed: %q", stored[1].Content)
+	}
+}
+
+func TestContextWindow_DedupesRepeatedReadsNearLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		contextSize int
+		replyTokens int
+		wantDeduped int
+	}{
+		{"leaves room for the reply", 1000, 100, 0},
+		{"cuts into the reply", 500, 100, 1},
+		{"overflows the context", 400, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cw := newTestWindow(t)
+			if err := cw.StartRun(BudgetParams{ContextSize: tt.contextSize, SystemContent: "system", SystemTokens: 10, ReplyTokens: tt.replyTokens}); err != nil {
+				t.Fatalf("StartRun failed: %v", err)
+			}
+			for _, msg := range []core.Message{
+				toolCall("c1", "read_file", map[string]any{"path": "a.go"}),
+				toolResult("c1", "read_file", "contents of a.go", false),
+				toolCall("c2", "read_file", map[string]any{"path": "a.go"}),
+				toolResult("c2", "read_file", "contents of a.go", false),
+				{Role: core.RoleAssistant, Content: "done", Tokens: 250},
+			} {
+				if err := cw.AddMessage(msg); err != nil {
+					t.Fatalf("AddMessage failed: %v", err)
+				}
+			}
+
+			msgs, err := cw.BuildContext()
+			if err != nil {
+				t.Fatalf("BuildContext failed: %v", err)
+			}
+			replaced := msgs[2].Content != "contents of a.go"
+			if replaced != (tt.wantDeduped > 0) {
+				t.Errorf("first read replaced = %v, content %q", replaced, msgs[2].Content)
+			}
+			if got := cw.Snapshot().DedupedMessages; got != tt.wantDeduped {
+				t.Errorf("deduped messages = %d, want %d", got, tt.wantDeduped)
+			}
+		})
+	}
+}
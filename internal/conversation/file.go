@@ -1,11 +1,16 @@
 package conversation
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 
 	"github.com/erg0nix/kontekst/internal/core"
@@ -13,36 +18,536 @@ import (
 
 const chunkSize = 8 * 1024
 
-// SessionFile provides append-only storage and tail-based loading of messages in a JSONL file.
+// SyncPolicy controls when appends to a session file are flushed to stable storage.
+type SyncPolicy string
+
+const (
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncPolicy = "never"
+	// SyncRun flushes once per run, when its run_end record is written.
+	SyncRun SyncPolicy = "run"
+	// SyncAlways flushes after every record.
+	SyncAlways SyncPolicy = "always"
+)
+
+// ParseSyncPolicy validates a configured sync policy, defaulting to SyncRun when empty.
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(s); policy {
+	case "":
+		return SyncRun, nil
+	case SyncNever, SyncRun, SyncAlways:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown sync policy %q (want never, run or always)", s)
+}
+
+// SessionFile provides append-only storage and tail-based loading of session records in a JSONL file.
+// Every record is written as one complete line in a single write, under a lock shared with other processes.
 type SessionFile struct {
 	path string
+	sync SyncPolicy
 	mu   sync.Mutex
 }
 
 // NewSessionFile creates a SessionFile that reads from and writes to the given path.
 func NewSessionFile(path string) *SessionFile {
-	return &SessionFile{path: path}
+	return &SessionFile{path: path, sync: SyncRun}
+}
+
+// QuarantinePath returns where Repair moves damaged lines of the session file.
+func (sf *SessionFile) QuarantinePath() string {
+	return sf.path + ".quarantine"
 }
 
-// Append writes a single message as a JSON line to the end of the session file.
+// Append writes a single message as a message record to the end of the session file.
 func (sf *SessionFile) Append(msg core.Message) error {
+	rec := newRecord(RecordMessage)
+	rec.Message = &msg
+
+	return sf.AppendRecord(rec)
+}
+
+// AppendRecord writes a record to the end of the session file.
+func (sf *SessionFile) AppendRecord(rec Record) error {
 	sf.mu.Lock()
 	defer sf.mu.Unlock()
 
-	file, err := os.OpenFile(sf.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	unlock, err := sf.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return sf.appendRecord(rec)
+}
+
+// appendRecord writes the record as one line. If an earlier write was torn and left the file without
+// a trailing newline, the record starts on a fresh line so it is not glued to the damaged one.
+// Callers must hold the file lock.
+func (sf *SessionFile) appendRecord(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("session file: encode record: %w", err)
+	}
+	line = append(line, '\n')
+
+	file, err := os.OpenFile(sf.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
 	if err != nil {
 		return fmt.Errorf("session file: open for append: %w", err)
 	}
 	defer file.Close()
 
-	return json.NewEncoder(file).Encode(msg)
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("session file: stat: %w", err)
+	}
+
+	torn, err := endsTorn(file)
+	if err != nil {
+		return err
+	}
+	offset := stat.Size()
+	if torn {
+		slog.Warn("session file has a torn trailing line", "path", sf.path)
+		line = append([]byte{'\n'}, line...)
+		offset++
+	}
+
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("session file: append: %w", err)
+	}
+
+	if sf.sync == SyncAlways || (sf.sync == SyncRun && rec.Type == RecordRunEnd) {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("session file: sync: %w", err)
+		}
+	}
+
+	sf.indexAppended(rec, offset, len(line)-int(offset-stat.Size())-1, stat.Size())
+	return nil
+}
+
+// endsTorn reports whether a non-empty file is missing its trailing newline.
+func endsTorn(file *os.File) (bool, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("session file: stat: %w", err)
+	}
+	if stat.Size() == 0 {
+		return false, nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, stat.Size()-1); err != nil {
+		return false, fmt.Errorf("session file: read tail: %w", err)
+	}
+	return last[0] != '\n', nil
+}
+
+// Damage describes a line of a session file that could not be parsed.
+type Damage struct {
+	Line int
+	Torn bool
+	Err  error
+}
+
+// scannedLine is one non-empty line of a session file with its parse result.
+type scannedLine struct {
+	raw    []byte
+	record Record
+	err    error
+}
+
+// damaged reports whether the line is unreadable for a reason other than a newer record version.
+func (l scannedLine) damaged() bool {
+	return l.err != nil && !errors.Is(l.err, ErrUnsupportedVersion)
+}
+
+// scan parses every line of the file, returning the lines and the damage found among them.
+// A damaged last line with no trailing newline is reported as torn: a write that never completed.
+func (sf *SessionFile) scan() ([]scannedLine, []Damage, error) {
+	data, err := os.ReadFile(sf.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("session file: read: %w", err)
+	}
+
+	var lines []scannedLine
+	var damage []Damage
+	number := 0
+	for raw := range bytes.Lines(data) {
+		number++
+		trimmed := bytes.TrimSpace(raw)
+		if len(trimmed) == 0 {
+			continue
+		}
+
+		line := scannedLine{raw: trimmed}
+		line.record, line.err = ParseRecord(trimmed)
+		lines = append(lines, line)
+
+		if line.damaged() {
+			damage = append(damage, Damage{Line: number, Torn: !bytes.HasSuffix(raw, []byte{'\n'}), Err: line.err})
+		}
+	}
+
+	return lines, damage, nil
+}
+
+// ReadRecords reads every record in the file, oldest first. Damaged lines are reported with a warning and skipped.
+func (sf *SessionFile) ReadRecords() ([]Record, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	return sf.readRecords()
+}
+
+func (sf *SessionFile) readRecords() ([]Record, error) {
+	lines, damage, err := sf.scan()
+	if err != nil {
+		return nil, err
+	}
+	sf.warnDamage(damage)
+
+	var records []Record
+	for _, line := range lines {
+		if line.err != nil {
+			if !line.damaged() {
+				slog.Warn("skipping session record from a newer version", "path", sf.path, "error", line.err)
+			}
+			continue
+		}
+		records = append(records, line.record)
+	}
+
+	return records, nil
+}
+
+func (sf *SessionFile) warnDamage(damage []Damage) {
+	for _, d := range damage {
+		attrs := []any{"path", sf.path, "torn", d.Torn, "error", d.Err}
+		if d.Line > 0 {
+			attrs = append(attrs, "line", d.Line)
+		}
+		slog.Warn("skipping damaged session record; run `kontekst sessions repair`", attrs...)
+	}
+}
+
+// Check reports the damaged lines of the session file without changing it.
+func (sf *SessionFile) Check() ([]Damage, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	_, damage, err := sf.scan()
+	return damage, err
+}
+
+// Repair removes damaged lines from the session file. A torn trailing line is truncated; other damaged
+// lines are appended to QuarantinePath so nothing is lost. It returns the damage that was removed.
+func (sf *SessionFile) Repair() ([]Damage, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	unlock, err := sf.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	lines, damage, err := sf.scan()
+	if err != nil || len(damage) == 0 {
+		return nil, err
+	}
+
+	var kept, quarantined [][]byte
+	for i, line := range lines {
+		switch {
+		case !line.damaged():
+			kept = append(kept, line.raw)
+		case i == len(lines)-1 && damage[len(damage)-1].Torn:
+		default:
+			quarantined = append(quarantined, line.raw)
+		}
+	}
+
+	if err := sf.quarantine(quarantined); err != nil {
+		return nil, err
+	}
+	if err := sf.rewrite(kept); err != nil {
+		return nil, err
+	}
+
+	return damage, nil
+}
+
+// quarantine appends damaged lines to the quarantine file and flushes it before the originals are removed.
+func (sf *SessionFile) quarantine(lines [][]byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(sf.QuarantinePath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("session file: open quarantine: %w", err)
+	}
+	defer file.Close()
+
+	for _, line := range lines {
+		if _, err := file.Write(append(slices.Clip(line), '\n')); err != nil {
+			return fmt.Errorf("session file: quarantine: %w", err)
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("session file: quarantine: %w", err)
+	}
+	return nil
+}
+
+// rewrite atomically replaces the file's contents with the given lines via a synced temp file and rename.
+func (sf *SessionFile) rewrite(lines [][]byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(sf.path), filepath.Base(sf.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("session file: rewrite: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("session file: rewrite: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("session file: rewrite: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("session file: rewrite: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), sf.path); err != nil {
+		return fmt.Errorf("session file: rewrite: %w", err)
+	}
+	sf.removeIndex()
+
+	if dir, err := os.Open(filepath.Dir(sf.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// LoadAll reads every live message in the file, oldest first, leaving out superseded ones.
+func (sf *SessionFile) LoadAll() ([]core.Message, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	return sf.loadAll()
+}
+
+func (sf *SessionFile) loadAll() ([]core.Message, error) {
+	records, err := sf.readRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []core.Message
+	for _, rec := range LiveRecords(records) {
+		if msg, ok := rec.AsMessage(); ok {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages, nil
+}
+
+// Rewind supersedes everything after the user message that started the given number of turns back,
+// so the next run continues from that message. It returns the number of messages superseded.
+func (sf *SessionFile) Rewind(turns int, reason string) (int, error) {
+	if turns < 1 {
+		return 0, fmt.Errorf("session file: rewind: turns must be at least 1")
+	}
+
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	unlock, err := sf.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	messages, err := sf.loadAll()
+	if err != nil {
+		return 0, err
+	}
+
+	starts := turnStarts(messages)
+	if len(starts) < turns {
+		return 0, fmt.Errorf("session file: rewind: session has %d turns, cannot rewind %d", len(starts), turns)
+	}
+
+	superseded := len(messages) - starts[len(starts)-turns] - 1
+	if superseded == 0 {
+		return 0, nil
+	}
+
+	rec := newRecord(RecordTombstone)
+	rec.Tombstone = &Tombstone{Supersedes: superseded, Reason: reason}
+	if err := sf.appendRecord(rec); err != nil {
+		return 0, err
+	}
+
+	return superseded, nil
+}
+
+// turnStarts returns the indexes of user messages that start a turn. User messages injected while
+// tool results are still outstanding (skill content) or as agent notes (<system-note>) do not.
+func turnStarts(messages []core.Message) []int {
+	var starts []int
+	outstanding := 0
+
+	for i, msg := range messages {
+		switch msg.Role {
+		case core.RoleAssistant:
+			outstanding = len(msg.ToolCalls)
+		case core.RoleTool:
+			outstanding = max(outstanding-1, 0)
+		case core.RoleUser:
+			if outstanding == 0 && !strings.HasPrefix(msg.Content, "<system-note>") {
+				starts = append(starts, i)
+			}
+		}
+	}
+
+	return starts
+}
+
+// Migrate rewrites a file containing legacy bare-message lines into versioned records. Damaged lines
+// are moved to QuarantinePath and records from newer versions are kept as they are.
+// It reports whether the file was rewritten and how many lines were quarantined.
+func (sf *SessionFile) Migrate() (bool, int, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	unlock, err := sf.lock()
+	if err != nil {
+		return false, 0, err
+	}
+	defer unlock()
+
+	lines, damage, err := sf.scan()
+	if err != nil {
+		return false, 0, err
+	}
+
+	legacy := slices.ContainsFunc(lines, func(line scannedLine) bool { return line.err == nil && line.record.Version == 0 })
+	if !legacy && len(damage) == 0 {
+		return false, 0, nil
+	}
+
+	var kept, quarantined [][]byte
+	for _, line := range lines {
+		switch {
+		case line.damaged():
+			quarantined = append(quarantined, line.raw)
+		case line.err == nil && line.record.Version == 0:
+			line.record.Version = RecordVersion
+			data, err := json.Marshal(line.record)
+			if err != nil {
+				return false, 0, fmt.Errorf("session file: migrate: %w", err)
+			}
+			kept = append(kept, data)
+		default:
+			kept = append(kept, line.raw)
+		}
+	}
+
+	if err := sf.quarantine(quarantined); err != nil {
+		return false, 0, err
+	}
+	if err := sf.rewrite(kept); err != nil {
+		return false, 0, err
+	}
+
+	return true, len(quarantined), nil
 }
 
-// LoadTail reads messages from the end of the file until the token budget is exhausted.
+// LoadTail reads the newest live messages that fit the token budget, oldest first. The newest message
+// is always included. It locates the tail through the session index and falls back to scanning the
+// file backwards when the index cannot be used.
 func (sf *SessionFile) LoadTail(tokenBudget int) ([]core.Message, error) {
 	sf.mu.Lock()
 	defer sf.mu.Unlock()
 
+	if _, err := os.Stat(sf.path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("session file: stat: %w", err)
+	}
+
+	messages, err := sf.loadIndexedTail(tokenBudget)
+	if err == nil {
+		return messages, nil
+	}
+
+	slog.Warn("session index unavailable, scanning session file", "path", sf.path, "error", err)
+	if errors.Is(err, errStaleIndex) {
+		sf.removeIndex()
+	}
+	return sf.scanTail(tokenBudget)
+}
+
+func (sf *SessionFile) loadIndexedTail(tokenBudget int) ([]core.Message, error) {
+	unlock, err := sf.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, err := sf.syncIndex(); err != nil {
+		return nil, err
+	}
+
+	entries, err := sf.indexedTail(tokenBudget)
+	if err != nil {
+		return nil, err
+	}
+	return sf.readEntries(entries)
+}
+
+// MessageCount returns the number of live messages in the session file, read from the session index.
+func (sf *SessionFile) MessageCount() (int, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	if _, err := os.Stat(sf.path); err != nil {
+		return 0, fmt.Errorf("session file: stat: %w", err)
+	}
+
+	unlock, err := sf.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	last, err := sf.syncIndex()
+	if err != nil {
+		return 0, err
+	}
+	return last.Live, nil
+}
+
+// scanTail is LoadTail without the index: it parses records backwards from the end of the file.
+func (sf *SessionFile) scanTail(tokenBudget int) ([]core.Message, error) {
 	file, err := os.Open(sf.path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -64,9 +569,50 @@ func (sf *SessionFile) LoadTail(tokenBudget int) ([]core.Message, error) {
 
 	var messages []core.Message
 	tokensUsed := 0
+	superseded := 0
 	remaining := fileSize
 	var carryover []byte
 
+	torn, err := endsTorn(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// accept consumes one record, newest first, and reports whether loading should continue.
+	accept := func(line []byte) bool {
+		last := torn
+		torn = false
+
+		rec, err := ParseRecord(line)
+		if errors.Is(err, ErrUnsupportedVersion) {
+			slog.Warn("skipping session record from a newer version", "path", sf.path, "error", err)
+			return true
+		}
+		if err != nil {
+			sf.warnDamage([]Damage{{Torn: last, Err: err}})
+			return true
+		}
+
+		msg, isMessage := rec.AsMessage()
+		if !isMessage {
+			superseded += rec.supersedes()
+			return true
+		}
+		if superseded > 0 {
+			superseded += rec.supersedes() - 1
+			return true
+		}
+		superseded += rec.supersedes()
+
+		if tokensUsed+msg.Tokens > tokenBudget && len(messages) > 0 {
+			return false
+		}
+
+		messages = append(messages, msg)
+		tokensUsed += msg.Tokens
+		return true
+	}
+
 	for remaining > 0 {
 		readSize := int64(chunkSize)
 		if readSize > remaining {
@@ -102,30 +648,17 @@ func (sf *SessionFile) LoadTail(tokenBudget int) ([]core.Message, error) {
 				continue
 			}
 
-			var msg core.Message
-			if err := json.Unmarshal(line, &msg); err != nil {
-				continue
-			}
-
-			if tokensUsed+msg.Tokens > tokenBudget && len(messages) > 0 {
+			if !accept(line) {
 				slices.Reverse(messages)
 				return messages, nil
 			}
-
-			messages = append(messages, msg)
-			tokensUsed += msg.Tokens
 		}
 
 		remaining = offset
 	}
 
 	if len(carryover) > 0 {
-		var msg core.Message
-		if err := json.Unmarshal(carryover, &msg); err == nil {
-			if tokensUsed+msg.Tokens <= tokenBudget || len(messages) == 0 {
-				messages = append(messages, msg)
-			}
-		}
+		accept(carryover)
 	}
 
 	slices.Reverse(messages)
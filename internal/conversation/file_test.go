@@ -3,10 +3,14 @@ package conversation
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/erg0nix/kontekst/internal/core"
 )
@@ -208,13 +212,16 @@ func TestSessionFile_Append_CreatesFile(t *testing.T) {
 		t.Fatalf("failed to read file: %v", err)
 	}
 
-	var decoded core.Message
+	var decoded Record
 	if err := json.Unmarshal(data, &decoded); err != nil {
 		t.Fatalf("failed to decode: %v", err)
 	}
 
-	if decoded.Content != "hello" {
-		t.Errorf("expected content 'hello', got %q", decoded.Content)
+	if decoded.Version != RecordVersion || decoded.Type != RecordMessage || decoded.Time.IsZero() {
+		t.Errorf("expected versioned, timestamped message record, got %+v", decoded)
+	}
+	if decoded.Message == nil || decoded.Message.Content != "hello" {
+		t.Errorf("expected content 'hello', got %+v", decoded.Message)
 	}
 }
 
@@ -340,3 +347,316 @@ func writeMessages(t *testing.T, path string, messages ...core.Message) {
 		}
 	}
 }
+
+func appendMessages(t *testing.T, sf *SessionFile, messages ...core.Message) {
+	t.Helper()
+	for _, msg := range messages {
+		if err := sf.Append(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionFile_Rewind(t *testing.T) {
+	turn1 := []core.Message{
+		{Role: core.RoleUser, Content: "list files", Tokens: 10},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{{ID: "c1", Name: "skill"}, {ID: "c2", Name: "list_files"}}, Tokens: 10},
+		{Role: core.RoleUser, Content: "[Skill: review]", Tokens: 10},
+		{Role: core.RoleTool, Content: "skill loaded", Tokens: 10},
+		{Role: core.RoleTool, Content: "a.go", Tokens: 10},
+		{Role: core.RoleUser, Content: "<system-note>\nstop repeating\n</system-note>", Tokens: 10},
+		{Role: core.RoleAssistant, Content: "a.go", Tokens: 10},
+	}
+	turn2 := []core.Message{
+		{Role: core.RoleUser, Content: "read it", Tokens: 10},
+		{Role: core.RoleAssistant, Content: "bad answer", Tokens: 10},
+	}
+
+	tests := []struct {
+		name           string
+		turns          int
+		wantSuperseded int
+		wantLast       string
+	}{
+		{"retry last turn", 1, 1, "read it"},
+		{"rewind two turns", 2, 8, "list files"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sf := NewSessionFile(filepath.Join(t.TempDir(), "session.jsonl"))
+			appendMessages(t, sf, append(append([]core.Message{}, turn1...), turn2...)...)
+
+			superseded, err := sf.Rewind(tt.turns, "test")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if superseded != tt.wantSuperseded {
+				t.Fatalf("superseded = %d, want %d", superseded, tt.wantSuperseded)
+			}
+
+			for name, load := range map[string]func() ([]core.Message, error){
+				"LoadAll":  sf.LoadAll,
+				"LoadTail": func() ([]core.Message, error) { return sf.LoadTail(1000) },
+			} {
+				msgs, err := load()
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if got := msgs[len(msgs)-1].Content; got != tt.wantLast {
+					t.Fatalf("%s: last message = %q, want %q", name, got, tt.wantLast)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionFile_RewindTwiceAndContinue(t *testing.T) {
+	sf := NewSessionFile(filepath.Join(t.TempDir(), "session.jsonl"))
+	appendMessages(t, sf,
+		core.Message{Role: core.RoleUser, Content: "q1"},
+		core.Message{Role: core.RoleAssistant, Content: "a1"},
+		core.Message{Role: core.RoleUser, Content: "q2"},
+		core.Message{Role: core.RoleAssistant, Content: "a2"},
+	)
+
+	if _, err := sf.Rewind(1, "retry"); err != nil {
+		t.Fatal(err)
+	}
+	appendMessages(t, sf, core.Message{Role: core.RoleAssistant, Content: "a2 again"})
+	if _, err := sf.Rewind(2, "rewind"); err != nil {
+		t.Fatal(err)
+	}
+	appendMessages(t, sf, core.Message{Role: core.RoleAssistant, Content: "a1 again"})
+
+	msgs, err := sf.LoadTail(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, msg := range msgs {
+		got = append(got, msg.Content)
+	}
+	if want := []string{"q1", "a1 again"}; !slices.Equal(got, want) {
+		t.Fatalf("messages = %v, want %v", got, want)
+	}
+}
+
+func TestSessionFile_RewindErrors(t *testing.T) {
+	sf := NewSessionFile(filepath.Join(t.TempDir(), "session.jsonl"))
+	appendMessages(t, sf,
+		core.Message{Role: core.RoleUser, Content: "q1"},
+		core.Message{Role: core.RoleAssistant, Content: "a1"},
+	)
+
+	if _, err := sf.Rewind(0, ""); err == nil {
+		t.Error("expected error for zero turns")
+	}
+	if _, err := sf.Rewind(2, ""); err == nil || !strings.Contains(err.Error(), "cannot rewind 2") {
+		t.Errorf("expected not enough turns error, got %v", err)
+	}
+}
+
+func TestSessionFile_MixedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	content := `{"role":"user","content":"legacy","tokens":5}
+{"v":1,"type":"run_start","run_start":{"run_id":"run_1"}}
+{"v":1,"type":"message","message":{"role":"assistant","content":"a1","tokens":5}}
+{"v":1,"type":"summary","summary":{"content":"both","supersedes":2,"tokens":3}}
+{"v":1,"type":"run_end","run_end":{"run_id":"run_1","outcome":"completed","turns":1,"duration_ms":4}}
+{"v":1,"type":"message","message":{"role":"user","content":"q2","tokens":5}}
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sf := NewSessionFile(path)
+	want := []string{"<summary>\nboth\n</summary>", "q2"}
+
+	all, err := sf.LoadAll()
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	tail, err := sf.LoadTail(1000)
+	if err != nil {
+		t.Fatalf("LoadTail: %v", err)
+	}
+
+	for name, msgs := range map[string][]core.Message{"LoadAll": all, "LoadTail": tail} {
+		var got []string
+		for _, msg := range msgs {
+			got = append(got, msg.Content)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSessionFile_Migrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	content := `{"role":"user","content":"q1"}
+not json
+{"role":"assistant","content":"a1"}
+{"tombstone":{"supersedes":1,"reason":"retry"}}
+{"v":1,"type":"message","message":{"role":"assistant","content":"a2"}}
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sf := NewSessionFile(path)
+	before, err := sf.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewritten, dropped, err := sf.Migrate()
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if !rewritten || dropped != 1 {
+		t.Fatalf("migrate = (%v, %d), want (true, 1)", rewritten, dropped)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range splitLines(data) {
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil || rec.Version != RecordVersion {
+			t.Errorf("line not migrated: %s", line)
+		}
+	}
+
+	after, err := sf.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) || after[1].Content != "a2" {
+		t.Errorf("history changed by migration: before %v, after %v", before, after)
+	}
+
+	if rewritten, _, err := sf.Migrate(); err != nil || rewritten {
+		t.Errorf("second migrate = (%v, %v), want no rewrite", rewritten, err)
+	}
+}
+
+func TestSessionFile_AppendAfterTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	content := `{"v":1,"type":"message","message":{"role":"user","content":"q1"}}
+{"v":1,"type":"message","message":{"role":"assis`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sf := NewSessionFile(path)
+	if damage, err := sf.Check(); err != nil || len(damage) != 1 || !damage[0].Torn || damage[0].Line != 2 {
+		t.Fatalf("Check = %+v, %v; want one torn line 2", damage, err)
+	}
+
+	if err := sf.Append(core.Message{Role: core.RoleUser, Content: "q2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := sf.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[1].Content != "q2" {
+		t.Fatalf("expected the new record to survive the torn line, got %v", msgs)
+	}
+
+	damage, err := sf.Check()
+	if err != nil || len(damage) != 1 || damage[0].Torn {
+		t.Fatalf("Check = %+v, %v; want one corrupt, no longer trailing, line", damage, err)
+	}
+}
+
+func TestSessionFile_Repair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	content := `{"v":1,"type":"message","message":{"role":"user","content":"q1"}}
+garbage
+{"v":9,"type":"message","message":{"role":"user","content":"future"}}
+{"role":"assistant","content":"a1"}
+{"v":1,"type":"mess`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sf := NewSessionFile(path)
+	damage, err := sf.Repair()
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if len(damage) != 2 || damage[0].Line != 2 || damage[0].Torn || damage[1].Line != 5 || !damage[1].Torn {
+		t.Fatalf("unexpected damage: %+v", damage)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], `"v":9`) {
+		t.Fatalf("expected good and future-version lines to be kept, got %q", lines)
+	}
+
+	quarantined, err := os.ReadFile(sf.QuarantinePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(quarantined) != "garbage\n" {
+		t.Fatalf("quarantine = %q, want only the corrupt line", quarantined)
+	}
+
+	if damage, err := sf.Repair(); err != nil || len(damage) != 0 {
+		t.Fatalf("second repair = %+v, %v; want nothing to do", damage, err)
+	}
+}
+
+func TestSessionFile_AppendWaitsForLock(t *testing.T) {
+	defer func(timeout time.Duration) { lockTimeout = timeout }(lockTimeout)
+	lockTimeout = 50 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	other := NewSessionFile(path)
+	unlock, err := other.lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sf := NewSessionFile(path)
+	err = sf.Append(core.Message{Role: core.RoleUser, Content: "blocked"})
+	if !errors.Is(err, ErrSessionLocked) {
+		t.Fatalf("expected ErrSessionLocked while another holder has the lock, got %v", err)
+	}
+
+	unlock()
+	if err := sf.Append(core.Message{Role: core.RoleUser, Content: "ok"}); err != nil {
+		t.Fatalf("append after unlock: %v", err)
+	}
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    SyncPolicy
+		wantErr bool
+	}{
+		{in: "", want: SyncRun},
+		{in: "never", want: SyncNever},
+		{in: "run", want: SyncRun},
+		{in: "always", want: SyncAlways},
+		{in: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSyncPolicy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSyncPolicy(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
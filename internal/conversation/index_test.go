@@ -0,0 +1,283 @@
+package conversation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+// indexRows returns how many rows the session's index holds, or -1 if it has none.
+func indexRows(sf *SessionFile) int {
+	stat, err := os.Stat(sf.indexPath())
+	if err != nil {
+		return -1
+	}
+	return int(stat.Size()-int64(len(indexMagic))) / indexRowSize
+}
+
+func contents(messages []core.Message) []string {
+	var out []string
+	for _, msg := range messages {
+		out = append(out, msg.Content)
+	}
+	return out
+}
+
+func newIndexedSession(t testing.TB) *SessionFile {
+	t.Helper()
+	sf := NewSessionFile(filepath.Join(t.TempDir(), "session.jsonl"))
+
+	appendAll := func(records ...Record) {
+		for _, rec := range records {
+			if err := sf.AppendRecord(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	message := func(role core.Role, content string, tokens int) Record {
+		rec := newRecord(RecordMessage)
+		rec.Message = &core.Message{Role: role, Content: content, Tokens: tokens}
+		return rec
+	}
+	run := newRecord(RecordRunStart)
+	run.RunStart = &RunStart{RunID: "run_1"}
+	tombstone := newRecord(RecordTombstone)
+	tombstone.Tombstone = &Tombstone{Supersedes: 2}
+	summary := newRecord(RecordSummary)
+	summary.Summary = &Summary{Content: "s", Supersedes: 2, Tokens: 4}
+
+	appendAll(
+		run,
+		message(core.RoleUser, "q1", 10),
+		message(core.RoleAssistant, "a1", 20),
+		message(core.RoleUser, "q2", 10),
+		message(core.RoleAssistant, "dropped", 30),
+		message(core.RoleAssistant, "dropped", 30),
+		tombstone,
+		message(core.RoleAssistant, "a2", 20),
+		summary,
+		message(core.RoleUser, "q3", 5),
+		message(core.RoleAssistant, "a3", 15),
+	)
+	return sf
+}
+
+func TestLoadTail_IndexMatchesScan(t *testing.T) {
+	sf := newIndexedSession(t)
+
+	for _, budget := range []int{0, 14, 15, 20, 24, 60, 1000} {
+		t.Run(fmt.Sprintf("budget=%d", budget), func(t *testing.T) {
+			indexed, err := sf.loadIndexedTail(budget)
+			if err != nil {
+				t.Fatalf("indexed: %v", err)
+			}
+			scanned, err := sf.scanTail(budget)
+			if err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			if !slices.Equal(contents(indexed), contents(scanned)) {
+				t.Fatalf("indexed %q, scanned %q", contents(indexed), contents(scanned))
+			}
+		})
+	}
+
+	all, err := sf.LoadTail(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"q1", "a1", "<summary>\ns\n</summary>", "q3", "a3"}
+	if !slices.Equal(contents(all), want) {
+		t.Fatalf("LoadTail = %q, want %q", contents(all), want)
+	}
+
+	if count, err := sf.MessageCount(); err != nil || count != 5 {
+		t.Fatalf("MessageCount = %d, %v; want 5", count, err)
+	}
+}
+
+func TestLoadTail_SearchMatchesScan(t *testing.T) {
+	sf := NewSessionFile(filepath.Join(t.TempDir(), "session.jsonl"))
+	sf.sync = SyncNever
+
+	for i := range 300 {
+		rec := newRecord(RecordMessage)
+		rec.Message = &core.Message{Role: core.RoleUser, Content: fmt.Sprintf("m%d", i), Tokens: i*7%50 + 1}
+		switch {
+		case i%97 == 96:
+			rec = newRecord(RecordSummary)
+			rec.Summary = &Summary{Content: fmt.Sprintf("s%d", i), Supersedes: 5, Tokens: 12}
+		case i%40 == 39:
+			rec = newRecord(RecordTombstone)
+			rec.Tombstone = &Tombstone{Supersedes: 3}
+		}
+		if err := sf.AppendRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for budget := 0; budget <= 10000; budget += 37 {
+		indexed, err := sf.loadIndexedTail(budget)
+		if err != nil {
+			t.Fatalf("budget %d: indexed: %v", budget, err)
+		}
+		scanned, err := sf.scanTail(budget)
+		if err != nil {
+			t.Fatalf("budget %d: scan: %v", budget, err)
+		}
+		if !slices.Equal(contents(indexed), contents(scanned)) {
+			t.Fatalf("budget %d: indexed %q, scanned %q", budget, contents(indexed), contents(scanned))
+		}
+	}
+}
+
+func TestIndex_KeptInStepWithFile(t *testing.T) {
+	sf := newIndexedSession(t)
+	if _, err := sf.LoadTail(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows := indexRows(sf); rows != 11 {
+		t.Fatalf("expected 11 indexed records, got %d", rows)
+	}
+
+	if err := sf.Append(core.Message{Role: core.RoleUser, Content: "q4", Tokens: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if rows := indexRows(sf); rows != 12 {
+		t.Fatalf("expected append to extend the index, got %d rows", rows)
+	}
+
+	// A writer that does not maintain the index: the next load catches up.
+	file, err := os.OpenFile(sf.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"role":"assistant","content":"a4","tokens":1}` + "\n")
+	file.Close()
+
+	msgs, err := sf.LoadTail(1)
+	if err != nil || !slices.Equal(contents(msgs), []string{"a4"}) {
+		t.Fatalf("LoadTail after external append = %q, %v", contents(msgs), err)
+	}
+	if rows := indexRows(sf); rows != 13 {
+		t.Fatalf("expected the index to catch up, got %d rows", rows)
+	}
+
+	// Rewriting the file discards the index; it is rebuilt on the next load.
+	if _, _, err := sf.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sf.indexPath()); !os.IsNotExist(err) {
+		t.Fatal("expected migrate to remove the index")
+	}
+	if msgs, err := sf.LoadTail(1000); err != nil || len(msgs) != 7 {
+		t.Fatalf("LoadTail after rebuild = %q, %v", contents(msgs), err)
+	}
+
+	// A corrupt index falls back to scanning and is rebuilt.
+	if err := os.WriteFile(sf.indexPath(), []byte("junk"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, err := sf.LoadTail(1000); err != nil || len(msgs) != 7 {
+		t.Fatalf("LoadTail with corrupt index = %q, %v", contents(msgs), err)
+	}
+	if rows := indexRows(sf); rows != 13 {
+		t.Fatalf("expected rebuilt index, got %d rows", rows)
+	}
+}
+
+func TestIndex_StaleOffsetsAreDetected(t *testing.T) {
+	sf := newIndexedSession(t)
+	if _, err := sf.LoadTail(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(sf.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shifted := strings.Replace(string(data), `"content":"q1"`, `"content":"q1 edited by hand"`, 1)
+	if err := os.WriteFile(sf.path, []byte(shifted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := sf.LoadTail(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents(msgs)[0] != "q1 edited by hand" {
+		t.Fatalf("expected stale index to be rebuilt, got %q", contents(msgs))
+	}
+}
+
+func BenchmarkLoadTail(b *testing.B) {
+	for _, size := range []int{1_000, 20_000} {
+		path := filepath.Join(b.TempDir(), "session.jsonl")
+		sf := NewSessionFile(path)
+		sf.sync = SyncNever
+
+		content := strings.Repeat("lorem ipsum dolor sit amet ", 20)
+		for i := range size {
+			role := core.RoleUser
+			if i%2 == 1 {
+				role = core.RoleAssistant
+			}
+			if err := sf.Append(core.Message{Role: role, Content: content, Tokens: 150}); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		if _, err := sf.MessageCount(); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("index/messages=%d", size), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := sf.loadIndexedTail(8192); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		for _, budget := range []int{8192, 131072} {
+			b.Run(fmt.Sprintf("search/messages=%d/budget=%d", size, budget), func(b *testing.B) {
+				for b.Loop() {
+					if _, err := sf.indexedTail(budget); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+
+		b.Run(fmt.Sprintf("scan/messages=%d", size), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := sf.scanTail(8192); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("count-index/messages=%d", size), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := sf.MessageCount(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("count-scan/messages=%d", size), func(b *testing.B) {
+			for b.Loop() {
+				records, err := sf.ReadRecords()
+				if err != nil {
+					b.Fatal(err)
+				}
+				_ = LiveRecords(records)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package conversation
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lockTimeout bounds how long a write waits for another process to release a session file.
+var lockTimeout = 5 * time.Second
+
+// ErrSessionLocked is returned when another process holds a session file's lock for longer than lockTimeout.
+var ErrSessionLocked = errors.New("session file is locked by another process")
+
+// Lock takes the session's lock for a write to one of its companion files, such as its metadata, and
+// returns a function that releases it.
+func (sf *SessionFile) Lock() (func(), error) {
+	return sf.lock()
+}
+
+// lock takes an exclusive advisory lock on the session's lock file, shared by every process using the
+// data directory, and returns a function that releases it.
+func (sf *SessionFile) lock() (func(), error) {
+	file, err := os.OpenFile(sf.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("session file: open lock: %w", err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("session file: lock: %w", err)
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("session file: %s: %w", sf.path, ErrSessionLocked)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
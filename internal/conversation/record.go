@@ -0,0 +1,225 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+// RecordVersion is the version of the session record envelope written by this build.
+const RecordVersion = 1
+
+// ErrUnsupportedVersion is returned for records written by a newer build. Such lines are intact,
+// so they are skipped on load but never treated as damage.
+var ErrUnsupportedVersion = errors.New("unsupported record version")
+
+// RecordType identifies what a session file record holds.
+type RecordType string
+
+const (
+	// RecordMessage holds a conversation message.
+	RecordMessage RecordType = "message"
+	// RecordRunStart marks the start of an agent run and which agent, model and sampling produced it.
+	RecordRunStart RecordType = "run_start"
+	// RecordRunEnd marks the end of an agent run with its outcome and duration.
+	RecordRunEnd RecordType = "run_end"
+	// RecordSummary replaces the live messages before it with a condensed message.
+	RecordSummary RecordType = "summary"
+	// RecordTombstone supersedes the live messages before it.
+	RecordTombstone RecordType = "tombstone"
+	// RecordMetadata holds free-form session metadata.
+	RecordMetadata RecordType = "metadata"
+)
+
+// Record is the versioned envelope for every line of a session file.
+type Record struct {
+	Version   int            `json:"v"`
+	Type      RecordType     `json:"type"`
+	Time      time.Time      `json:"ts,omitzero"`
+	Message   *core.Message  `json:"message,omitempty"`
+	RunStart  *RunStart      `json:"run_start,omitempty"`
+	RunEnd    *RunEnd        `json:"run_end,omitempty"`
+	Summary   *Summary       `json:"summary,omitempty"`
+	Tombstone *Tombstone     `json:"tombstone,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+}
+
+// RunStart describes the run that produced the messages following it.
+type RunStart struct {
+	RunID     core.RunID           `json:"run_id"`
+	AgentName string               `json:"agent_name,omitempty"`
+	Model     string               `json:"model,omitempty"`
+	Sampling  *core.SamplingConfig `json:"sampling,omitempty"`
+}
+
+// RunEnd records how a run finished.
+type RunEnd struct {
+	RunID      core.RunID `json:"run_id"`
+	Outcome    string     `json:"outcome"`
+	Turns      int        `json:"turns"`
+	DurationMS int64      `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Summary is a condensed stand-in for the given number of live messages written before it.
+type Summary struct {
+	Content    string `json:"content"`
+	Supersedes int    `json:"supersedes"`
+	Tokens     int    `json:"tokens,omitempty"`
+}
+
+// Tombstone supersedes the given number of live messages written before it, so they are no longer loaded.
+// It is how turns are retried or rewound without rewriting the file.
+type Tombstone struct {
+	Supersedes int    `json:"supersedes"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Tokens returns the token count of the message or summary the record carries.
+func (r Record) Tokens() int {
+	switch {
+	case r.Message != nil:
+		return r.Message.Tokens
+	case r.Summary != nil:
+		return r.Summary.Tokens
+	}
+	return 0
+}
+
+// AsMessage returns the conversation message a message or summary record stands for.
+func (r Record) AsMessage() (core.Message, bool) {
+	switch r.Type {
+	case RecordMessage:
+		return *r.Message, true
+	case RecordSummary:
+		return core.Message{
+			Role:    core.RoleUser,
+			Content: fmt.Sprintf("<summary>\n%s\n</summary>", r.Summary.Content),
+			Tokens:  r.Summary.Tokens,
+		}, true
+	}
+	return core.Message{}, false
+}
+
+// supersedes returns how many earlier live messages the record removes.
+func (r Record) supersedes() int {
+	switch r.Type {
+	case RecordTombstone:
+		return r.Tombstone.Supersedes
+	case RecordSummary:
+		return r.Summary.Supersedes
+	}
+	return 0
+}
+
+// legacyRecord is the unversioned line format: a bare message, or a bare tombstone.
+type legacyRecord struct {
+	core.Message
+	Tombstone *Tombstone `json:"tombstone,omitempty"`
+}
+
+// ParseRecord decodes a session file line in either the versioned envelope or the legacy bare-message format.
+func ParseRecord(line []byte) (Record, error) {
+	var rec Record
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return Record{}, fmt.Errorf("parse record: %w", err)
+	}
+
+	if rec.Version == 0 {
+		return parseLegacyRecord(line)
+	}
+	if rec.Version > RecordVersion {
+		return Record{}, fmt.Errorf("parse record: %w %d", ErrUnsupportedVersion, rec.Version)
+	}
+	if err := rec.validate(); err != nil {
+		return Record{}, fmt.Errorf("parse record: %w", err)
+	}
+
+	return rec, nil
+}
+
+func parseLegacyRecord(line []byte) (Record, error) {
+	var legacy legacyRecord
+	if err := json.Unmarshal(line, &legacy); err != nil {
+		return Record{}, fmt.Errorf("parse legacy record: %w", err)
+	}
+
+	if legacy.Tombstone != nil {
+		return Record{Type: RecordTombstone, Tombstone: legacy.Tombstone}, nil
+	}
+	if legacy.Role == "" {
+		return Record{}, errors.New("parse legacy record: missing role")
+	}
+
+	msg := legacy.Message
+	return Record{Type: RecordMessage, Message: &msg}, nil
+}
+
+func (r Record) validate() error {
+	var ok bool
+	switch r.Type {
+	case RecordMessage:
+		ok = r.Message != nil
+	case RecordRunStart:
+		ok = r.RunStart != nil
+	case RecordRunEnd:
+		ok = r.RunEnd != nil
+	case RecordSummary:
+		ok = r.Summary != nil
+	case RecordTombstone:
+		ok = r.Tombstone != nil
+	case RecordMetadata:
+		ok = true
+	default:
+		return fmt.Errorf("unknown record type %q", r.Type)
+	}
+
+	if !ok {
+		return fmt.Errorf("%s record has no %s payload", r.Type, r.Type)
+	}
+	return nil
+}
+
+// LiveRecords applies tombstones and summaries, returning the records that are still in effect, oldest first.
+// Run, metadata and summary records are kept; superseded messages and tombstones are dropped. Kept summaries
+// no longer supersede anything, so the result can be written out as a history of its own.
+func LiveRecords(records []Record) []Record {
+	live := make([]Record, 0, len(records))
+
+	for _, rec := range records {
+		for n := rec.supersedes(); n > 0; n-- {
+			i := lastMessageIndex(live)
+			if i < 0 {
+				break
+			}
+			live = append(live[:i], live[i+1:]...)
+		}
+
+		if rec.Type == RecordSummary {
+			summary := *rec.Summary
+			summary.Supersedes = 0
+			rec.Summary = &summary
+		}
+		if rec.Type != RecordTombstone {
+			live = append(live, rec)
+		}
+	}
+
+	return live
+}
+
+func lastMessageIndex(records []Record) int {
+	for i := len(records) - 1; i >= 0; i-- {
+		if _, ok := records[i].AsMessage(); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+func newRecord(recordType RecordType) Record {
+	return Record{Version: RecordVersion, Type: recordType, Time: time.Now().UTC()}
+}
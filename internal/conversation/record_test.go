@@ -0,0 +1,92 @@
+package conversation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+func TestParseRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    RecordType
+		content string
+		wantErr string
+	}{
+		{name: "legacy message", line: `{"role":"user","content":"hi"}`, want: RecordMessage, content: "hi"},
+		{name: "legacy tombstone", line: `{"tombstone":{"supersedes":2,"reason":"retry"}}`, want: RecordTombstone},
+		{name: "message", line: `{"v":1,"type":"message","ts":"2026-01-02T03:04:05Z","message":{"role":"assistant","content":"ok"}}`, want: RecordMessage, content: "ok"},
+		{name: "run start", line: `{"v":1,"type":"run_start","run_start":{"run_id":"run_1","agent_name":"coder"}}`, want: RecordRunStart},
+		{name: "run end", line: `{"v":1,"type":"run_end","run_end":{"run_id":"run_1","outcome":"completed","turns":2,"duration_ms":10}}`, want: RecordRunEnd},
+		{name: "metadata", line: `{"v":1,"type":"metadata","metadata":{"title":"x"}}`, want: RecordMetadata},
+		{name: "not json", line: `not json`, wantErr: "parse record"},
+		{name: "legacy without role", line: `{"content":"orphan"}`, wantErr: "missing role"},
+		{name: "unknown type", line: `{"v":1,"type":"bogus"}`, wantErr: `unknown record type "bogus"`},
+		{name: "missing payload", line: `{"v":1,"type":"summary"}`, wantErr: "has no summary payload"},
+		{name: "future version", line: `{"v":99,"type":"message","message":{"role":"user"}}`, wantErr: "unsupported record version 99"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := ParseRecord([]byte(tt.line))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if rec.Type != tt.want {
+				t.Errorf("type = %q, want %q", rec.Type, tt.want)
+			}
+			if tt.content != "" && rec.Message.Content != tt.content {
+				t.Errorf("content = %q, want %q", rec.Message.Content, tt.content)
+			}
+		})
+	}
+}
+
+func TestLiveRecords(t *testing.T) {
+	message := func(content string) Record {
+		return Record{Type: RecordMessage, Message: &core.Message{Role: core.RoleUser, Content: content}}
+	}
+
+	records := []Record{
+		{Type: RecordRunStart, RunStart: &RunStart{RunID: "run_1"}},
+		message("m1"),
+		message("m2"),
+		message("m3"),
+		{Type: RecordRunEnd, RunEnd: &RunEnd{RunID: "run_1", Outcome: "completed"}},
+		{Type: RecordTombstone, Tombstone: &Tombstone{Supersedes: 1}},
+		{Type: RecordSummary, Summary: &Summary{Content: "earlier", Supersedes: 2}},
+		message("m4"),
+	}
+
+	var got []string
+	for _, rec := range LiveRecords(records) {
+		if msg, ok := rec.AsMessage(); ok {
+			got = append(got, msg.Content)
+			continue
+		}
+		got = append(got, string(rec.Type))
+	}
+
+	want := []string{"run_start", "run_end", "<summary>\nearlier\n</summary>", "m4"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("live records = %q, want %q", got, want)
+	}
+
+	// Replaying the live records must not supersede anything again.
+	again := LiveRecords(LiveRecords(records))
+	if len(again) != len(want) {
+		t.Errorf("replayed live records = %d, want %d", len(again), len(want))
+	}
+	if records[6].Summary.Supersedes != 2 {
+		t.Error("LiveRecords modified its input")
+	}
+}
@@ -3,19 +3,25 @@ package conversation
 import "github.com/erg0nix/kontekst/internal/core"
 
 // Snapshot captures the token and message budget state of a conversation context at a point in time.
+// MemoryTokens counts the current run's messages; ProjectMemoryTokens counts the project memory index
+// in the system prompt, which SystemTokens excludes. DedupedMessages stale read_file results were replaced
+// by placeholders, saving DedupedTokens; the other token counts are after that replacement.
 type Snapshot struct {
-	ContextSize     int            `json:"context_size"`
-	SystemTokens    int            `json:"system_tokens"`
-	ToolTokens      int            `json:"tool_tokens"`
-	HistoryTokens   int            `json:"history_tokens"`
-	MemoryTokens    int            `json:"memory_tokens"`
-	TotalTokens     int            `json:"total_tokens"`
-	RemainingTokens int            `json:"remaining_tokens"`
-	HistoryMessages int            `json:"history_messages"`
-	MemoryMessages  int            `json:"memory_messages"`
-	TotalMessages   int            `json:"total_messages"`
-	HistoryBudget   int            `json:"history_budget"`
-	Messages        []MessageStats `json:"messages,omitempty"`
+	ContextSize         int            `json:"context_size"`
+	SystemTokens        int            `json:"system_tokens"`
+	ProjectMemoryTokens int            `json:"project_memory_tokens"`
+	ToolTokens          int            `json:"tool_tokens"`
+	HistoryTokens       int            `json:"history_tokens"`
+	MemoryTokens        int            `json:"memory_tokens"`
+	TotalTokens         int            `json:"total_tokens"`
+	RemainingTokens     int            `json:"remaining_tokens"`
+	HistoryMessages     int            `json:"history_messages"`
+	MemoryMessages      int            `json:"memory_messages"`
+	TotalMessages       int            `json:"total_messages"`
+	HistoryBudget       int            `json:"history_budget"`
+	DedupedMessages     int            `json:"deduped_messages"`
+	DedupedTokens       int            `json:"deduped_tokens"`
+	Messages            []MessageStats `json:"messages,omitempty"`
 }
 
 // MessageStats holds token count and source metadata for a single message in a context snapshot.
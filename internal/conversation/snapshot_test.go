@@ -65,6 +65,29 @@ func TestContextWindow_Snapshot(t *testing.T) {
 	}
 }
 
+func TestContextWindow_SnapshotProjectMemory(t *testing.T) {
+	cw := newTestWindow(t)
+
+	if err := cw.StartRun(BudgetParams{ContextSize: 4096, SystemContent: "system", SystemTokens: 100, ProjectMemoryTokens: 40, ToolTokens: 60}); err != nil {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+
+	snapshot := cw.Snapshot()
+
+	if snapshot.SystemTokens != 100 || snapshot.ProjectMemoryTokens != 40 {
+		t.Errorf("system/project memory tokens: got %d/%d, want 100/40", snapshot.SystemTokens, snapshot.ProjectMemoryTokens)
+	}
+	if snapshot.TotalTokens != 200 {
+		t.Errorf("TotalTokens: got %d, want 200", snapshot.TotalTokens)
+	}
+	if snapshot.HistoryBudget != 4096-200 {
+		t.Errorf("HistoryBudget: got %d, want %d", snapshot.HistoryBudget, 4096-200)
+	}
+	if snapshot.Messages[0].Tokens != 140 {
+		t.Errorf("system message tokens: got %d, want 140", snapshot.Messages[0].Tokens)
+	}
+}
+
 func TestContextWindow_SnapshotEmpty(t *testing.T) {
 	cw := newTestWindow(t)
 
@@ -18,6 +18,7 @@ const (
 type Message struct {
 	Role       Role        `json:"role"`
 	Content    string      `json:"content"`
+	Reasoning  string      `json:"reasoning,omitempty"`
 	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
 	ToolResult *ToolResult `json:"tool_result,omitempty"`
 	AgentName  string      `json:"agent_name,omitempty"`
@@ -37,6 +38,7 @@ type ToolResult struct {
 	Name    string `json:"name"`
 	Output  string `json:"output"`
 	IsError bool   `json:"is_error,omitempty"`
+	Diff    string `json:"diff,omitempty"`
 }
 
 // ToolDef describes a tool's name, description, and parameter schema for the LLM.
@@ -60,3 +62,34 @@ type SkillMetadata struct {
 	Name string
 	Path string
 }
+
+// PlanEntryStatus is the progress state of a single plan entry.
+type PlanEntryStatus string
+
+const (
+	// PlanStatusPending marks an entry that has not been started.
+	PlanStatusPending PlanEntryStatus = "pending"
+	// PlanStatusInProgress marks the entry currently being worked on.
+	PlanStatusInProgress PlanEntryStatus = "in_progress"
+	// PlanStatusCompleted marks a finished entry.
+	PlanStatusCompleted PlanEntryStatus = "completed"
+)
+
+// PlanEntryPriority is the relative importance of a plan entry.
+type PlanEntryPriority string
+
+const (
+	// PlanPriorityHigh marks an entry as critical to the task.
+	PlanPriorityHigh PlanEntryPriority = "high"
+	// PlanPriorityMedium marks an entry of normal importance.
+	PlanPriorityMedium PlanEntryPriority = "medium"
+	// PlanPriorityLow marks an entry as optional or nice to have.
+	PlanPriorityLow PlanEntryPriority = "low"
+)
+
+// PlanEntry is a single item of the agent's todo list for a session.
+type PlanEntry struct {
+	Content  string            `json:"content"`
+	Priority PlanEntryPriority `json:"priority"`
+	Status   PlanEntryStatus   `json:"status"`
+}
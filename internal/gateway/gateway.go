@@ -0,0 +1,474 @@
+// Package gateway serves kontekst agents over an OpenAI-compatible HTTP API, for clients that only speak
+// the chat completions protocol. Each agent is listed as a model, and a completion request runs that agent
+// with its system prompt, context management and the server's tools.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/agent"
+	"github.com/erg0nix/kontekst/internal/auth"
+	"github.com/erg0nix/kontekst/internal/config"
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/protocol"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+	"github.com/erg0nix/kontekst/internal/tool"
+)
+
+// SessionHeader names the header that carries a kontekst session ID. A request that sends it continues
+// that session; every completion response returns the session the run used.
+const SessionHeader = "X-Kontekst-Session"
+
+// maxRequestSize limits the body of a chat completion request.
+const maxRequestSize = 4 * 1024 * 1024
+
+// TokenVerifier checks the bearer token a client sends and returns the token it belongs to.
+type TokenVerifier interface {
+	Verify(secret string) (auth.Token, error)
+}
+
+// Gateway serves /v1/models and /v1/chat/completions.
+type Gateway struct {
+	runner     agent.Runner
+	agents     *agent.Registry
+	sessions   *protocol.SessionManager
+	tokens     TokenVerifier
+	approve    []string
+	workingDir string
+	mux        *http.ServeMux
+}
+
+// New returns a gateway that starts runs on runner for the agents in agents. Runs claim their session in
+// sessions, the daemon's session manager, so they show in its status and ACP clients can follow or cancel
+// them. Requests must carry a bearer token known to tokens, unless tokens is nil. Since an HTTP client
+// cannot answer permission requests, tool calls are approved only when the tool is listed in
+// cfg.ApproveTools. A run works in its session's directory, which is cfg.WorkingDir unless an ACP client
+// opened the session, and gets no tools when there is none.
+func New(runner agent.Runner, agents *agent.Registry, sessions *protocol.SessionManager, tokens TokenVerifier, cfg config.OpenAIConfig) *Gateway {
+	g := &Gateway{
+		runner:     runner,
+		agents:     agents,
+		sessions:   sessions,
+		tokens:     tokens,
+		approve:    cfg.ApproveTools,
+		workingDir: cfg.WorkingDir,
+		mux:        http.NewServeMux(),
+	}
+	g.mux.HandleFunc("/v1/models", g.handleModels)
+	g.mux.HandleFunc("/v1/chat/completions", g.handleChat)
+	return g
+}
+
+// ServeHTTP implements [http.Handler].
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// authenticate returns the request's token if it grants scope, writing an error response otherwise.
+// Every scope is granted when the gateway does not require authentication.
+func (g *Gateway) authenticate(w http.ResponseWriter, r *http.Request, scope auth.Scope) (auth.Token, bool) {
+	if g.tokens == nil {
+		return auth.Token{Name: auth.DefaultTokenName, Scopes: auth.AllScopes}, true
+	}
+
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication_error", "missing bearer token")
+		return auth.Token{}, false
+	}
+	token, err := g.tokens.Verify(strings.TrimSpace(secret))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "authentication_error", "invalid token")
+		return auth.Token{}, false
+	}
+	if !token.Has(scope) {
+		writeError(w, http.StatusForbidden, "permission_error", fmt.Sprintf("token %q lacks the %s scope", token.Name, scope))
+		return auth.Token{}, false
+	}
+	return token, true
+}
+
+// handleModels lists the registered agents as models.
+func (g *Gateway) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "use GET")
+		return
+	}
+	if _, ok := g.authenticate(w, r, auth.ScopeRead); !ok {
+		return
+	}
+
+	agents, err := g.agents.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	list := modelList{Object: "list", Data: make([]model, 0, len(agents))}
+	for _, a := range agents {
+		list.Data = append(list.Data, model{ID: a.Name, Object: "model", OwnedBy: "kontekst"})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleChat runs the requested agent on the conversation's last user message and returns what it said,
+// streamed as server-sent events when the request asks for it.
+func (g *Gateway) handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "use POST")
+		return
+	}
+	token, ok := g.authenticate(w, r, auth.ScopePrompt)
+	if !ok {
+		return
+	}
+
+	var req chatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	agentCfg, err := g.agents.Load(req.Model)
+	if notFound := (*agent.NotFoundError)(nil); errors.As(err, &notFound) {
+		writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("model %q does not exist", req.Model))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	sessionID := core.SessionID(r.Header.Get(SessionHeader))
+	continued := sessionID != ""
+	if continued && !validSessionID(sessionID) {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid %s header", SessionHeader))
+		return
+	}
+	if !continued {
+		sessionID = core.NewSessionID()
+	}
+
+	prompt := buildPrompt(req.Messages, continued)
+	if strings.TrimSpace(prompt) == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages must end with a user message")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	shared, err := g.sessions.BeginRun(types.SessionID(sessionID), req.Model, g.workingDir, prompt, cancel)
+	if err != nil {
+		writeError(w, http.StatusConflict, "invalid_request_error", err.Error())
+		return
+	}
+	defer shared.End()
+
+	runCfg := agent.RunConfig{
+		Prompt:              prompt,
+		SessionID:           sessionID,
+		AgentName:           req.Model,
+		AgentSystemPrompt:   agentCfg.SystemPrompt,
+		ContextSize:         agentCfg.ContextSize,
+		Sampling:            protocol.OverrideSampling(agentCfg.Sampling, req.samplingOverride()),
+		ProviderEndpoint:    agentCfg.Provider.Endpoint,
+		ProviderModel:       agentCfg.Provider.Model,
+		ProviderHTTPTimeout: agentCfg.Provider.HTTPTimeout,
+		WorkingDir:          shared.Cwd(),
+		ToolRole:            agentCfg.ToolRole,
+		Hooks:               agentCfg.Hooks,
+		LoopDetection:       agentCfg.LoopDetection,
+	}
+	if runCfg.WorkingDir == "" || !token.Has(auth.ScopeTools) {
+		runCfg.Tools = tool.NewRegistry()
+	}
+
+	commands, events, err := g.runner.StartRun(runCfg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	shared.SetCommands(commands)
+
+	run := &completionRun{gateway: g, shared: shared, commands: commands, events: events, model: req.Model, created: time.Now().Unix()}
+	if first, ok := <-events; ok {
+		run.handle(first)
+	}
+	w.Header().Set(SessionHeader, string(run.sessionID))
+
+	if req.Stream {
+		run.stream(ctx, w, req.StreamOptions != nil && req.StreamOptions.IncludeUsage)
+		return
+	}
+	run.complete(ctx, w)
+}
+
+// approves reports whether the policy allows the tool to run without asking.
+func (g *Gateway) approves(name string) bool {
+	return slices.Contains(g.approve, "*") || slices.Contains(g.approve, name)
+}
+
+// validSessionID reports whether id can name a session file.
+func validSessionID(id core.SessionID) bool {
+	s := string(id)
+	return s == filepath.Base(s) && !strings.HasPrefix(s, ".")
+}
+
+// buildPrompt returns the prompt for a run from the request's messages: the last user message, after a
+// transcript of the messages before it. A continued session already holds the earlier conversation, so
+// only the last user message is used.
+func buildPrompt(messages []chatMessage, continued bool) string {
+	if len(messages) == 0 || messages[len(messages)-1].Role != "user" {
+		return ""
+	}
+	last := messages[len(messages)-1].text()
+	if continued || len(messages) == 1 {
+		return last
+	}
+
+	var b strings.Builder
+	b.WriteString("<conversation>\n")
+	for _, msg := range messages[:len(messages)-1] {
+		fmt.Fprintf(&b, "%s: %s\n", msg.Role, msg.text())
+	}
+	b.WriteString("</conversation>\n\n")
+	b.WriteString(last)
+	return b.String()
+}
+
+// completionRun follows one agent run, answering its tool approvals by the gateway's policy and passing
+// its events on to the shared session, if any, for the ACP clients attached to it. The runner reports each
+// turn's content once the turn completes; wrote records that a turn has produced content, so turns are
+// separated by a blank line.
+type completionRun struct {
+	gateway  *Gateway
+	shared   *protocol.ExternalRun
+	commands chan<- agent.Command
+	events   <-chan agent.Event
+	model    string
+	created  int64
+	wrote    bool
+
+	runID     core.RunID
+	sessionID core.SessionID
+	usage     usage
+	err       string
+	finish    string
+}
+
+// next returns the run's next piece of content, or false once the run has ended. If ctx ends first the
+// run is cancelled and drained.
+func (c *completionRun) next(ctx context.Context) (string, bool) {
+	for {
+		select {
+		case event, ok := <-c.events:
+			if !ok {
+				return "", false
+			}
+			if content := c.handle(event); content != "" {
+				return content, true
+			}
+		case <-ctx.Done():
+			c.cancel()
+			return "", false
+		}
+	}
+}
+
+// cancel tells the run to stop and drains its events until it ends. The command buffer may be full, so
+// the cancel is sent alongside the draining rather than dropped. A run that has already ended is only
+// drained.
+func (c *completionRun) cancel() {
+	commands := c.commands
+	if c.finish != "" || c.err != "" {
+		commands = nil
+	}
+	for {
+		select {
+		case commands <- agent.Command{Type: agent.CmdCancel}:
+			commands = nil
+		case event, ok := <-c.events:
+			if !ok {
+				if c.finish == "" {
+					c.finish = "stop"
+				}
+				return
+			}
+			c.publish(event)
+		}
+	}
+}
+
+// handle records an event and returns the content it carries for the client.
+func (c *completionRun) handle(event agent.Event) string {
+	c.publish(event)
+
+	switch event.Type {
+	case agent.EvtRunStarted:
+		c.runID, c.sessionID = event.RunID, event.SessionID
+
+	case agent.EvtTurnCompleted:
+		if u := event.Response.Usage; u != nil {
+			c.usage.PromptTokens += u.PromptTokens
+			c.usage.CompletionTokens += u.CompletionTokens
+			c.usage.TotalTokens += u.TotalTokens
+		}
+		return c.text(event.Response.Content)
+
+	case agent.EvtToolsProposed:
+		for _, call := range event.Calls {
+			if call.Approved {
+				continue
+			}
+			if c.gateway.approves(call.Name) {
+				c.commands <- agent.Command{Type: agent.CmdApproveTool, CallID: call.CallID}
+				continue
+			}
+			c.commands <- agent.Command{
+				Type:     agent.CmdRejectTool,
+				CallID:   call.CallID,
+				Feedback: fmt.Sprintf("The %s tool is not allowed for requests through the OpenAI-compatible API. Answer without it.", call.Name),
+			}
+		}
+
+	case agent.EvtRunCompleted, agent.EvtRunCancelled:
+		c.finish = "stop"
+
+	case agent.EvtRunStopped:
+		c.finish = "length"
+
+	case agent.EvtRunFailed:
+		c.err = event.Error
+	}
+	return ""
+}
+
+func (c *completionRun) publish(event agent.Event) {
+	if c.shared != nil {
+		c.shared.Publish(event)
+	}
+}
+
+// text returns a turn's content for the client, starting with a blank line after earlier turns.
+func (c *completionRun) text(content string) string {
+	if content == "" {
+		return ""
+	}
+	if c.wrote {
+		content = "\n\n" + content
+	}
+	c.wrote = true
+	return content
+}
+
+// complete waits for the run to end and writes the whole answer as one chat completion.
+func (c *completionRun) complete(ctx context.Context, w http.ResponseWriter) {
+	var content strings.Builder
+	for {
+		text, ok := c.next(ctx)
+		if !ok {
+			break
+		}
+		content.WriteString(text)
+	}
+
+	if c.err != "" {
+		writeError(w, http.StatusBadGateway, "server_error", c.err)
+		return
+	}
+
+	finish := c.finish
+	writeJSON(w, http.StatusOK, chatCompletion{
+		ID:      c.id(),
+		Object:  "chat.completion",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []chatChoice{{
+			Message:      &assistantReply{Role: "assistant", Content: content.String()},
+			FinishReason: &finish,
+		}},
+		Usage: &c.usage,
+	})
+}
+
+// stream writes the answer as server-sent chat completion chunks, one for each turn's content as the turn
+// completes, ending with "data: [DONE]". A failed run ends the stream with an error event.
+func (c *completionRun) stream(ctx context.Context, w http.ResponseWriter, includeUsage bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	c.writeChunk(w, assistantReply{Role: "assistant"}, nil, nil)
+	for {
+		content, ok := c.next(ctx)
+		if !ok {
+			break
+		}
+		c.writeChunk(w, assistantReply{Content: content}, nil, nil)
+	}
+
+	if c.err != "" {
+		writeEvent(w, errorResponse{Error: errorBody{Message: c.err, Type: "server_error"}})
+	} else {
+		var u *usage
+		if includeUsage {
+			u = &c.usage
+		}
+		finish := c.finish
+		c.writeChunk(w, assistantReply{}, &finish, u)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flush(w)
+}
+
+func (c *completionRun) writeChunk(w http.ResponseWriter, delta assistantReply, finish *string, u *usage) {
+	writeEvent(w, chatCompletion{
+		ID:      c.id(),
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []chatChoice{{Delta: &delta, FinishReason: finish}},
+		Usage:   u,
+	})
+}
+
+func (c *completionRun) id() string {
+	return "chatcmpl-" + string(c.runID)
+}
+
+func writeEvent(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Warn("failed to encode completion chunk", "error", err)
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	flush(w)
+}
+
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, kind, message string) {
+	writeJSON(w, status, errorResponse{Error: errorBody{Message: message, Type: kind}})
+}
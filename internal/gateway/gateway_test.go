@@ -0,0 +1,456 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/agent"
+	"github.com/erg0nix/kontekst/internal/auth"
+	"github.com/erg0nix/kontekst/internal/config"
+	agentConfig "github.com/erg0nix/kontekst/internal/config/agent"
+	"github.com/erg0nix/kontekst/internal/protocol"
+	"github.com/erg0nix/kontekst/internal/provider"
+)
+
+type mockRunner struct {
+	events   []agent.Event
+	cfg      agent.RunConfig
+	commands chan agent.Command
+}
+
+func (m *mockRunner) StartRun(cfg agent.RunConfig) (chan<- agent.Command, <-chan agent.Event, error) {
+	m.cfg = cfg
+	m.commands = make(chan agent.Command, 16)
+	events := make(chan agent.Event, len(m.events))
+	for _, event := range m.events {
+		events <- event
+	}
+	close(events)
+	return m.commands, events, nil
+}
+
+type mapVerifier map[string]auth.Token
+
+func (v mapVerifier) Verify(secret string) (auth.Token, error) {
+	token, ok := v[secret]
+	if !ok {
+		return auth.Token{}, auth.ErrInvalidToken
+	}
+	return token, nil
+}
+
+var testTokens = mapVerifier{
+	"admin-secret":    {Name: "admin", Scopes: auth.AllScopes},
+	"reader-secret":   {Name: "reader", Scopes: []auth.Scope{auth.ScopeRead}},
+	"no-tools-secret": {Name: "no-tools", Scopes: []auth.Scope{auth.ScopeRead, auth.ScopePrompt}},
+}
+
+func answerEvents(turns ...string) []agent.Event {
+	events := []agent.Event{{Type: agent.EvtRunStarted, RunID: "run1", SessionID: "sess1"}}
+	for _, content := range turns {
+		events = append(events, agent.Event{
+			Type:     agent.EvtTurnCompleted,
+			Response: provider.Response{Content: content, Usage: &provider.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}},
+		})
+	}
+	return append(events, agent.Event{Type: agent.EvtRunCompleted})
+}
+
+func newTestGateway(t *testing.T, runner agent.Runner, cfg config.OpenAIConfig) *Gateway {
+	t.Helper()
+	dir := t.TempDir()
+	if err := agentConfig.EnsureDefaults(dir); err != nil {
+		t.Fatal(err)
+	}
+	return New(runner, agent.NewRegistry(dir), protocol.NewSessionManager(), testTokens, cfg)
+}
+
+func do(g *Gateway, method, path, token, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	g.ServeHTTP(rec, req)
+	return rec
+}
+
+const helloRequest = `{"model":"default","messages":[{"role":"user","content":"hello"}]}`
+
+func TestModels(t *testing.T) {
+	g := newTestGateway(t, &mockRunner{}, config.OpenAIConfig{})
+
+	rec := do(g, http.MethodGet, "/v1/models", "reader-secret", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var list modelList
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	if !strings.Contains(strings.Join(ids, ","), "default") {
+		t.Errorf("models = %v, want the default agent", ids)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"models without token", http.MethodGet, "/v1/models", "", http.StatusUnauthorized},
+		{"models with bad token", http.MethodGet, "/v1/models", "wrong", http.StatusUnauthorized},
+		{"chat with read-only token", http.MethodPost, "/v1/chat/completions", "reader-secret", http.StatusForbidden},
+		{"chat with prompt token", http.MethodPost, "/v1/chat/completions", "no-tools-secret", http.StatusOK},
+		{"chat with GET", http.MethodGet, "/v1/chat/completions", "admin-secret", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGateway(t, &mockRunner{events: answerEvents("hi")}, config.OpenAIConfig{})
+			rec := do(g, tt.method, tt.path, tt.token, helloRequest, nil)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestChatCompletion(t *testing.T) {
+	runner := &mockRunner{events: answerEvents("Looking.", "Done.")}
+	g := newTestGateway(t, runner, config.OpenAIConfig{})
+
+	rec := do(g, http.MethodPost, "/v1/chat/completions", "admin-secret", helloRequest, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get(SessionHeader); got != "sess1" {
+		t.Errorf("session header = %q, want sess1", got)
+	}
+
+	var resp chatCompletion
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Object != "chat.completion" || resp.Model != "default" || resp.ID != "chatcmpl-run1" {
+		t.Errorf("response = %+v", resp)
+	}
+	if got := resp.Choices[0].Message.Content; got != "Looking.\n\nDone." {
+		t.Errorf("content = %q", got)
+	}
+	if got := *resp.Choices[0].FinishReason; got != "stop" {
+		t.Errorf("finish_reason = %q, want stop", got)
+	}
+	if resp.Usage.TotalTokens != 24 {
+		t.Errorf("total tokens = %d, want 24", resp.Usage.TotalTokens)
+	}
+
+	if runner.cfg.Prompt != "hello" || runner.cfg.AgentName != "default" || runner.cfg.AgentSystemPrompt == "" {
+		t.Errorf("run config = %+v", runner.cfg)
+	}
+}
+
+func TestChatCompletionStream(t *testing.T) {
+	g := newTestGateway(t, &mockRunner{events: answerEvents("Looking.", "Done.")}, config.OpenAIConfig{})
+
+	body := `{"model":"default","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hello"}]}`
+	rec := do(g, http.MethodPost, "/v1/chat/completions", "admin-secret", body, nil)
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("content type = %q", got)
+	}
+
+	var chunks []chatCompletion
+	var done bool
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk chatCompletion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if !done {
+		t.Error("stream did not end with [DONE]")
+	}
+	if len(chunks) != 4 {
+		t.Fatalf("got %d chunks, want 4", len(chunks))
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Errorf("first delta = %+v, want the assistant role", chunks[0].Choices[0].Delta)
+	}
+	var content string
+	for _, chunk := range chunks {
+		content += chunk.Choices[0].Delta.Content
+	}
+	if content != "Looking.\n\nDone." {
+		t.Errorf("content = %q", content)
+	}
+	last := chunks[len(chunks)-1]
+	if last.Choices[0].FinishReason == nil || *last.Choices[0].FinishReason != "stop" || last.Usage == nil {
+		t.Errorf("last chunk = %+v, want finish_reason stop and usage", last)
+	}
+}
+
+func TestCancelledRequestCancelsRun(t *testing.T) {
+	commands := make(chan agent.Command)
+	events := make(chan agent.Event)
+	received := make(chan agent.Command, 1)
+	go func() {
+		cmd := <-commands
+		received <- cmd
+		events <- agent.Event{Type: agent.EvtRunCancelled}
+		close(events)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	run := &completionRun{commands: commands, events: events}
+	if _, ok := run.next(ctx); ok {
+		t.Fatal("next returned content after the request was cancelled")
+	}
+
+	select {
+	case cmd := <-received:
+		if cmd.Type != agent.CmdCancel {
+			t.Errorf("command = %v, want cancel", cmd.Type)
+		}
+	default:
+		t.Fatal("the run was not sent a cancel")
+	}
+	if run.finish != "stop" {
+		t.Errorf("finish = %q, want stop", run.finish)
+	}
+}
+
+func TestChatCompletionFailure(t *testing.T) {
+	events := []agent.Event{
+		{Type: agent.EvtRunStarted, RunID: "run1", SessionID: "sess1"},
+		{Type: agent.EvtRunFailed, Error: "provider unreachable"},
+	}
+	g := newTestGateway(t, &mockRunner{events: events}, config.OpenAIConfig{})
+
+	rec := do(g, http.MethodPost, "/v1/chat/completions", "admin-secret", helloRequest, nil)
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "provider unreachable") {
+		t.Errorf("status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestChatCompletionRequestErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		header http.Header
+		want   int
+	}{
+		{"unknown model", `{"model":"nope","messages":[{"role":"user","content":"hi"}]}`, nil, http.StatusNotFound},
+		{"bad json", `{"model":`, nil, http.StatusBadRequest},
+		{"no user message", `{"model":"default","messages":[{"role":"system","content":"hi"}]}`, nil, http.StatusBadRequest},
+		{"path in session", helloRequest, http.Header{SessionHeader: {"../../etc"}}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGateway(t, &mockRunner{events: answerEvents("hi")}, config.OpenAIConfig{})
+			rec := do(g, http.MethodPost, "/v1/chat/completions", "admin-secret", tt.body, tt.header)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestToolsScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		workingDir string
+		wantTools  bool
+	}{
+		{"tools scope and working dir", "admin-secret", "/src/app", true},
+		{"no tools scope", "no-tools-secret", "/src/app", false},
+		{"no working dir", "admin-secret", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &mockRunner{events: answerEvents("hi")}
+			g := newTestGateway(t, runner, config.OpenAIConfig{WorkingDir: tt.workingDir})
+
+			if rec := do(g, http.MethodPost, "/v1/chat/completions", tt.token, helloRequest, nil); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			if runner.cfg.WorkingDir != tt.workingDir {
+				t.Errorf("working dir = %q, want %q", runner.cfg.WorkingDir, tt.workingDir)
+			}
+			if gotTools := runner.cfg.Tools == nil; gotTools != tt.wantTools {
+				t.Errorf("server tools = %v, want %v", gotTools, tt.wantTools)
+			}
+		})
+	}
+}
+
+func TestApprovalPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		approve []string
+		want    agent.CommandType
+	}{
+		{"unlisted tool is rejected", nil, agent.CmdRejectTool},
+		{"listed tool is approved", []string{"read_file"}, agent.CmdApproveTool},
+		{"wildcard approves any tool", []string{"*"}, agent.CmdApproveTool},
+		{"other listed tool does not approve", []string{"list_files"}, agent.CmdRejectTool},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := []agent.Event{
+				{Type: agent.EvtRunStarted, RunID: "run1", SessionID: "sess1"},
+				{Type: agent.EvtToolsProposed, Calls: []agent.ProposedToolCall{
+					{CallID: "auto", Name: "todo", Approved: true},
+					{CallID: "call1", Name: "read_file"},
+				}},
+				{Type: agent.EvtRunCompleted},
+			}
+			runner := &mockRunner{events: events}
+			g := newTestGateway(t, runner, config.OpenAIConfig{ApproveTools: tt.approve})
+
+			if rec := do(g, http.MethodPost, "/v1/chat/completions", "admin-secret", helloRequest, nil); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+
+			if len(runner.commands) != 1 {
+				t.Fatalf("got %d commands, want 1", len(runner.commands))
+			}
+			cmd := <-runner.commands
+			if cmd.Type != tt.want || cmd.CallID != "call1" {
+				t.Errorf("command = %+v, want %s for call1", cmd, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionHeader(t *testing.T) {
+	runner := &mockRunner{events: answerEvents("hi")}
+	g := newTestGateway(t, runner, config.OpenAIConfig{})
+
+	body := `{"model":"default","messages":[{"role":"user","content":"first"},{"role":"assistant","content":"ok"},{"role":"user","content":"second"}]}`
+	rec := do(g, http.MethodPost, "/v1/chat/completions", "admin-secret", body, http.Header{SessionHeader: {"sess1"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if runner.cfg.SessionID != "sess1" || runner.cfg.Prompt != "second" {
+		t.Errorf("run config session %q prompt %q, want sess1 and only the last message", runner.cfg.SessionID, runner.cfg.Prompt)
+	}
+
+	if g.sessions.Running("sess1") {
+		t.Error("session should be released after the request")
+	}
+	run, err := g.sessions.BeginRun("sess1", "default", "", "busy", func() {})
+	if err != nil {
+		t.Fatalf("begin run failed: %v", err)
+	}
+	defer run.End()
+	rec = do(g, http.MethodPost, "/v1/chat/completions", "admin-secret", helloRequest, http.Header{SessionHeader: {"sess1"}})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d for a session with an active run", rec.Code, http.StatusConflict)
+	}
+}
+
+// chanRunner streams the events the test sends.
+type chanRunner struct {
+	events chan agent.Event
+}
+
+func (r *chanRunner) StartRun(_ agent.RunConfig) (chan<- agent.Command, <-chan agent.Event, error) {
+	return make(chan agent.Command, 16), r.events, nil
+}
+
+func TestRunClaimsSharedSession(t *testing.T) {
+	runner := &chanRunner{events: make(chan agent.Event, 4)}
+	g := newTestGateway(t, runner, config.OpenAIConfig{})
+	runner.events <- agent.Event{Type: agent.EvtRunStarted, RunID: "run1", SessionID: "sess1"}
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- do(g, http.MethodPost, "/v1/chat/completions", "admin-secret", helloRequest, http.Header{SessionHeader: {"sess1"}})
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !g.sessions.Running("sess1") {
+		if time.Now().After(deadline) {
+			t.Fatal("the run never showed in the session manager")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := g.sessions.Status(); len(status) != 1 || status[0].Agent != "default" || status[0].Prompt != "hello" {
+		t.Errorf("status = %+v, want the gateway's run", status)
+	}
+
+	runner.events <- agent.Event{Type: agent.EvtRunCompleted}
+	close(runner.events)
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if g.sessions.Running("sess1") {
+		t.Error("session still running after the request")
+	}
+}
+
+func TestBuildPrompt(t *testing.T) {
+	msg := func(role, content string) chatMessage {
+		return chatMessage{Role: role, Content: json.RawMessage(content)}
+	}
+
+	tests := []struct {
+		name      string
+		messages  []chatMessage
+		continued bool
+		want      string
+	}{
+		{"single message", []chatMessage{msg("user", `"hi"`)}, false, "hi"},
+		{"content parts", []chatMessage{msg("user", `[{"type":"text","text":"a"},{"type":"image_url"},{"type":"text","text":"b"}]`)}, false, "a\nb"},
+		{"ends with assistant", []chatMessage{msg("user", `"hi"`), msg("assistant", `"yo"`)}, false, ""},
+		{"empty", nil, false, ""},
+		{
+			"earlier messages become a transcript",
+			[]chatMessage{msg("system", `"be brief"`), msg("user", `"hi"`), msg("assistant", `"yo"`), msg("user", `"bye"`)},
+			false,
+			"<conversation>\nsystem: be brief\nuser: hi\nassistant: yo\n</conversation>\n\nbye",
+		},
+		{"continued session uses the last message", []chatMessage{msg("user", `"hi"`), msg("assistant", `"yo"`), msg("user", `"bye"`)}, true, "bye"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildPrompt(tt.messages, tt.continued); got != tt.want {
+				t.Errorf("buildPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
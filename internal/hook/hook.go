@@ -0,0 +1,301 @@
+// Package hook runs user-defined lifecycle scripts at fixed points of the agent loop.
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/config"
+)
+
+// Event identifies the point in the agent loop at which a hook runs.
+type Event string
+
+const (
+	// PreToolUse runs before a proposed tool call is shown for approval.
+	PreToolUse Event = "pre_tool_use"
+	// PostToolUse runs after a tool call has executed.
+	PostToolUse Event = "post_tool_use"
+	// UserPromptSubmit runs before the user prompt is added to the conversation.
+	UserPromptSubmit Event = "user_prompt_submit"
+	// RunEnd runs once when the agent run terminates for any reason.
+	RunEnd Event = "run_end"
+)
+
+// DefaultTimeout is the time a hook script may run when no timeout is configured.
+const DefaultTimeout = 30 * time.Second
+
+// exitCodeDeny is the exit code a pre_tool_use hook uses to block a tool call.
+const exitCodeDeny = 2
+
+// Decision is a pre_tool_use hook's verdict on a tool call.
+type Decision string
+
+const (
+	// DecisionNone leaves the tool call to the regular approval flow.
+	DecisionNone Decision = ""
+	// DecisionAllow approves the tool call without asking the user.
+	DecisionAllow Decision = "allow"
+	// DecisionDeny blocks the tool call and returns the reason to the model.
+	DecisionDeny Decision = "deny"
+)
+
+// Input is the JSON payload written to a hook script's stdin.
+type Input struct {
+	Event      Event          `json:"event"`
+	SessionID  string         `json:"session_id,omitempty"`
+	RunID      string         `json:"run_id,omitempty"`
+	AgentName  string         `json:"agent_name,omitempty"`
+	WorkingDir string         `json:"working_dir,omitempty"`
+	Prompt     string         `json:"prompt,omitempty"`
+	ToolName   string         `json:"tool_name,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+	ToolArgs   map[string]any `json:"tool_args,omitempty"`
+	ToolOutput string         `json:"tool_output,omitempty"`
+	ToolError  bool           `json:"tool_error,omitempty"`
+	StopReason string         `json:"stop_reason,omitempty"`
+}
+
+// Output is the optional JSON document a hook script prints to stdout.
+type Output struct {
+	Decision          Decision       `json:"decision,omitempty"`
+	Reason            string         `json:"reason,omitempty"`
+	Arguments         map[string]any `json:"arguments,omitempty"`
+	AdditionalContext string         `json:"additional_context,omitempty"`
+	Message           string         `json:"message,omitempty"`
+}
+
+// Message is a piece of hook output that should be shown to the user.
+type Message struct {
+	Event   Event
+	Command string
+	Text    string
+}
+
+// Result is the combined outcome of all hooks that ran for an event.
+type Result struct {
+	Decision          Decision
+	Reason            string
+	Arguments         map[string]any
+	AdditionalContext string
+	Messages          []Message
+}
+
+// Hook is a single compiled hook script.
+type Hook struct {
+	Command string
+	Matcher *regexp.Regexp
+	Timeout time.Duration
+}
+
+// Runner holds the compiled hooks for each event and executes them in configuration order.
+type Runner struct {
+	hooks map[Event][]Hook
+}
+
+// NewRunner compiles the given hook configurations into a Runner, in order; later configs run after earlier ones.
+func NewRunner(configs ...config.HooksConfig) (*Runner, error) {
+	r := &Runner{hooks: make(map[Event][]Hook)}
+
+	for _, cfg := range configs {
+		groups := []struct {
+			event Event
+			hooks []config.HookConfig
+		}{
+			{PreToolUse, cfg.PreToolUse},
+			{PostToolUse, cfg.PostToolUse},
+			{UserPromptSubmit, cfg.UserPromptSubmit},
+			{RunEnd, cfg.RunEnd},
+		}
+
+		for _, group := range groups {
+			for _, hc := range group.hooks {
+				h, err := compile(hc)
+				if err != nil {
+					return nil, fmt.Errorf("hook %s: %w", group.event, err)
+				}
+				r.hooks[group.event] = append(r.hooks[group.event], h)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func compile(hc config.HookConfig) (Hook, error) {
+	command := strings.TrimSpace(hc.Command)
+	if command == "" {
+		return Hook{}, errors.New("command is required")
+	}
+
+	h := Hook{Command: command, Timeout: DefaultTimeout}
+	if hc.TimeoutSeconds > 0 {
+		h.Timeout = time.Duration(hc.TimeoutSeconds) * time.Second
+	}
+
+	if hc.Matcher != "" {
+		matcher, err := regexp.Compile("^(?:" + hc.Matcher + ")$")
+		if err != nil {
+			return Hook{}, fmt.Errorf("invalid matcher %q: %w", hc.Matcher, err)
+		}
+		h.Matcher = matcher
+	}
+
+	return h, nil
+}
+
+// Has reports whether any hooks are configured for the event.
+func (r *Runner) Has(event Event) bool {
+	return r != nil && len(r.hooks[event]) > 0
+}
+
+// Run executes every hook registered for in.Event whose matcher accepts the tool name.
+// A deny decision stops further hooks; argument rewrites are passed on to subsequent hooks.
+func (r *Runner) Run(ctx context.Context, in Input) Result {
+	var result Result
+	if r == nil {
+		return result
+	}
+
+	var contexts []string
+
+	for _, h := range r.hooks[in.Event] {
+		if h.Matcher != nil && !h.Matcher.MatchString(in.ToolName) {
+			continue
+		}
+
+		out, err := h.run(ctx, in)
+		if err != nil {
+			var denied *deniedError
+			if errors.As(err, &denied) && in.Event == PreToolUse {
+				result.Decision = DecisionDeny
+				result.Reason = denied.reason
+				break
+			}
+
+			slog.Warn("hook failed", "event", in.Event, "command", h.Command, "error", err)
+			result.Messages = append(result.Messages, Message{Event: in.Event, Command: h.Command, Text: "hook failed: " + err.Error()})
+			continue
+		}
+
+		if out.Message != "" {
+			result.Messages = append(result.Messages, Message{Event: in.Event, Command: h.Command, Text: out.Message})
+		}
+		if out.AdditionalContext != "" {
+			contexts = append(contexts, out.AdditionalContext)
+		}
+
+		if in.Event != PreToolUse {
+			continue
+		}
+
+		if out.Arguments != nil {
+			result.Arguments = out.Arguments
+			in.ToolArgs = out.Arguments
+		}
+
+		switch out.Decision {
+		case DecisionDeny:
+			result.Decision = DecisionDeny
+			result.Reason = out.Reason
+		case DecisionAllow:
+			result.Decision = DecisionAllow
+		}
+
+		if result.Decision == DecisionDeny {
+			break
+		}
+	}
+
+	result.AdditionalContext = strings.Join(contexts, "\n\n")
+
+	return result
+}
+
+type deniedError struct {
+	reason string
+}
+
+func (e *deniedError) Error() string {
+	return "denied: " + e.reason
+}
+
+func (h Hook) run(ctx context.Context, in Input) (Output, error) {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return Output{}, fmt.Errorf("marshal input: %w", err)
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(execCtx, "sh", "-c", h.Command)
+	cmd.Dir = in.WorkingDir
+	cmd.Env = append(os.Environ(),
+		"KONTEKST_HOOK_EVENT="+string(in.Event),
+		"KONTEKST_SESSION_ID="+in.SessionID,
+		"KONTEKST_WORKDIR="+in.WorkingDir,
+		"KONTEKST_TOOL_NAME="+in.ToolName,
+	)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 2 * time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+
+	if execCtx.Err() == context.DeadlineExceeded {
+		return Output{}, fmt.Errorf("timed out after %s", h.Timeout)
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == exitCodeDeny {
+			reason := strings.TrimSpace(stderr.String())
+			if reason == "" {
+				reason = strings.TrimSpace(stdout.String())
+			}
+			return Output{}, &deniedError{reason: reason}
+		}
+
+		detail := strings.TrimSpace(stderr.String())
+		if detail != "" {
+			return Output{}, fmt.Errorf("%w: %s", err, detail)
+		}
+		return Output{}, err
+	}
+
+	return parseOutput(stdout.Bytes()), nil
+}
+
+func parseOutput(data []byte) Output {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return Output{}
+	}
+
+	if trimmed[0] == '{' {
+		var out Output
+		if err := json.Unmarshal(trimmed, &out); err == nil {
+			return out
+		}
+	}
+
+	return Output{Message: string(trimmed)}
+}
@@ -0,0 +1,198 @@
+package hook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/config"
+)
+
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewRunner_InvalidMatcher(t *testing.T) {
+	_, err := NewRunner(config.HooksConfig{
+		PreToolUse: []config.HookConfig{{Command: "true", Matcher: "("}},
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid matcher")
+	}
+}
+
+func TestNewRunner_EmptyCommand(t *testing.T) {
+	_, err := NewRunner(config.HooksConfig{
+		RunEnd: []config.HookConfig{{Command: "  "}},
+	})
+	if err == nil {
+		t.Fatal("expected error for empty command")
+	}
+}
+
+func TestRun_NilRunner(t *testing.T) {
+	var r *Runner
+	if r.Has(PreToolUse) {
+		t.Fatal("nil runner should have no hooks")
+	}
+	result := r.Run(context.Background(), Input{Event: PreToolUse})
+	if result.Decision != DecisionNone {
+		t.Fatalf("expected no decision, got %q", result.Decision)
+	}
+}
+
+func TestRun_DenyViaJSON(t *testing.T) {
+	script := writeScript(t, `echo '{"decision":"deny","reason":"no vendor writes"}'`)
+	r, err := NewRunner(config.HooksConfig{
+		PreToolUse: []config.HookConfig{{Command: script}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := r.Run(context.Background(), Input{Event: PreToolUse, ToolName: "write_file"})
+	if result.Decision != DecisionDeny {
+		t.Fatalf("decision = %q, want deny", result.Decision)
+	}
+	if result.Reason != "no vendor writes" {
+		t.Fatalf("reason = %q", result.Reason)
+	}
+}
+
+func TestRun_DenyViaExitCode(t *testing.T) {
+	script := writeScript(t, "echo 'blocked path' >&2\nexit 2\n")
+	r, err := NewRunner(config.HooksConfig{
+		PreToolUse: []config.HookConfig{{Command: script}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := r.Run(context.Background(), Input{Event: PreToolUse, ToolName: "write_file"})
+	if result.Decision != DecisionDeny {
+		t.Fatalf("decision = %q, want deny", result.Decision)
+	}
+	if result.Reason != "blocked path" {
+		t.Fatalf("reason = %q, want 'blocked path'", result.Reason)
+	}
+}
+
+func TestRun_MatcherSkipsOtherTools(t *testing.T) {
+	script := writeScript(t, `echo '{"decision":"deny"}'`)
+	r, err := NewRunner(config.HooksConfig{
+		PreToolUse: []config.HookConfig{{Command: script, Matcher: "write_file|edit_file"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := r.Run(context.Background(), Input{Event: PreToolUse, ToolName: "read_file"}); result.Decision != DecisionNone {
+		t.Fatalf("read_file decision = %q, want none", result.Decision)
+	}
+	if result := r.Run(context.Background(), Input{Event: PreToolUse, ToolName: "edit_file"}); result.Decision != DecisionDeny {
+		t.Fatalf("edit_file decision = %q, want deny", result.Decision)
+	}
+}
+
+func TestRun_RewriteArguments(t *testing.T) {
+	first := writeScript(t, `echo '{"arguments":{"path":"safe.txt"}}'`)
+	second := writeScript(t, `grep -q safe.txt && echo '{"decision":"allow"}'`)
+	r, err := NewRunner(config.HooksConfig{
+		PreToolUse: []config.HookConfig{{Command: first}, {Command: second}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := r.Run(context.Background(), Input{
+		Event:    PreToolUse,
+		ToolName: "write_file",
+		ToolArgs: map[string]any{"path": "vendor/x.txt"},
+	})
+	if result.Arguments["path"] != "safe.txt" {
+		t.Fatalf("arguments = %v, want rewritten path", result.Arguments)
+	}
+	if result.Decision != DecisionAllow {
+		t.Fatalf("decision = %q, want allow (second hook should see rewritten args)", result.Decision)
+	}
+}
+
+func TestRun_PayloadOnStdin(t *testing.T) {
+	script := writeScript(t, `grep -q '"prompt":"hello"' && echo "saw $KONTEKST_HOOK_EVENT"`)
+	r, err := NewRunner(config.HooksConfig{
+		UserPromptSubmit: []config.HookConfig{{Command: script}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := r.Run(context.Background(), Input{Event: UserPromptSubmit, Prompt: "hello"})
+	if len(result.Messages) != 1 || result.Messages[0].Text != "saw user_prompt_submit" {
+		t.Fatalf("expected hook to read payload from stdin, got %+v", result.Messages)
+	}
+}
+
+func TestRun_AdditionalContextIsJoined(t *testing.T) {
+	a := writeScript(t, `echo '{"additional_context":"first"}'`)
+	b := writeScript(t, `echo '{"additional_context":"second","message":"formatted"}'`)
+	r, err := NewRunner(
+		config.HooksConfig{PostToolUse: []config.HookConfig{{Command: a}}},
+		config.HooksConfig{PostToolUse: []config.HookConfig{{Command: b}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := r.Run(context.Background(), Input{Event: PostToolUse, ToolName: "edit_file"})
+	if result.AdditionalContext != "first\n\nsecond" {
+		t.Fatalf("additional context = %q", result.AdditionalContext)
+	}
+	if len(result.Messages) != 1 || result.Messages[0].Text != "formatted" {
+		t.Fatalf("messages = %+v", result.Messages)
+	}
+}
+
+func TestRun_FailureIsReportedNotFatal(t *testing.T) {
+	script := writeScript(t, "echo boom >&2\nexit 1\n")
+	r, err := NewRunner(config.HooksConfig{
+		PreToolUse: []config.HookConfig{{Command: script}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := r.Run(context.Background(), Input{Event: PreToolUse, ToolName: "write_file"})
+	if result.Decision != DecisionNone {
+		t.Fatalf("failing hook should not decide, got %q", result.Decision)
+	}
+	if len(result.Messages) != 1 || !strings.Contains(result.Messages[0].Text, "boom") {
+		t.Fatalf("expected failure message, got %+v", result.Messages)
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	script := writeScript(t, "sleep 5\n")
+	r, err := NewRunner(config.HooksConfig{
+		RunEnd: []config.HookConfig{{Command: script, TimeoutSeconds: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	result := r.Run(context.Background(), Input{Event: RunEnd})
+	if time.Since(start) > 4*time.Second {
+		t.Fatal("hook was not killed at its timeout")
+	}
+	if len(result.Messages) != 1 || !strings.Contains(result.Messages[0].Text, "timed out") {
+		t.Fatalf("expected timeout message, got %+v", result.Messages)
+	}
+}
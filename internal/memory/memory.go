@@ -0,0 +1,344 @@
+// Package memory stores short facts about a project that persist across sessions, one file per working directory.
+package memory
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxContentRunes is the longest fact a memory may hold; memories are meant to be short.
+const MaxContentRunes = 500
+
+// DefaultIndexTokens is the token budget of the memory index injected into the system prompt.
+const DefaultIndexTokens = 1000
+
+// ErrNotFound is returned when no memory has the given ID.
+var ErrNotFound = errors.New("memory: not found")
+
+// Entry is one remembered fact.
+type Entry struct {
+	ID        int       `json:"id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// projectFile is the on-disk form of a project's memories.
+type projectFile struct {
+	WorkingDir string  `json:"working_dir"`
+	NextID     int     `json:"next_id"`
+	Entries    []Entry `json:"entries"`
+}
+
+// Store keeps each project's memories in <data dir>/memory/<dir name>-<hash>.json, keyed by the
+// cleaned absolute working directory.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// New creates a Store rooted at the given data directory.
+func New(dataDir string) *Store {
+	return &Store{dir: filepath.Join(dataDir, "memory")}
+}
+
+// Path returns the memory file of the project at workingDir.
+func (s *Store) Path(workingDir string) string {
+	dir := projectKey(workingDir)
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(s.dir, filepath.Base(dir)+"-"+hex.EncodeToString(sum[:6])+".json")
+}
+
+// List returns the project's memories in the order they were added.
+func (s *Store) List(workingDir string) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.read(workingDir)
+	if err != nil {
+		return nil, err
+	}
+	return file.Entries, nil
+}
+
+// Remember adds a memory and returns it. Remembering a fact that is already stored returns the existing entry.
+func (s *Store) Remember(workingDir, content string) (Entry, error) {
+	content, err := validContent(content)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.read(workingDir)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	for _, entry := range file.Entries {
+		if strings.EqualFold(entry.Content, content) {
+			return entry, nil
+		}
+	}
+
+	entry := file.add(content)
+	return entry, s.write(workingDir, file)
+}
+
+// Update replaces the content of the memory with the given ID.
+func (s *Store) Update(workingDir string, id int, content string) error {
+	content, err := validContent(content)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.read(workingDir)
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(file.Entries, func(e Entry) bool { return e.ID == id })
+	if i < 0 {
+		return fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	file.Entries[i].Content = content
+	file.Entries[i].UpdatedAt = time.Now().UTC()
+
+	return s.write(workingDir, file)
+}
+
+// Forget removes the memories with the given IDs. Nothing is removed if any ID does not exist.
+func (s *Store) Forget(workingDir string, ids ...int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.read(workingDir)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if !slices.ContainsFunc(file.Entries, func(e Entry) bool { return e.ID == id }) {
+			return fmt.Errorf("%w: %d", ErrNotFound, id)
+		}
+	}
+
+	file.Entries = slices.DeleteFunc(file.Entries, func(e Entry) bool { return slices.Contains(ids, e.ID) })
+	return s.write(workingDir, file)
+}
+
+// Replace sets the project's memories to the given contents. Unchanged facts keep their ID and creation
+// time; new ones get fresh IDs. Blank contents are dropped.
+func (s *Store) Replace(workingDir string, contents []string) ([]Entry, error) {
+	cleaned := make([]string, 0, len(contents))
+	for _, content := range contents {
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		content, err := validContent(content)
+		if err != nil {
+			return nil, err
+		}
+		cleaned = append(cleaned, content)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.read(workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := file.Entries
+	file.Entries = nil
+	for _, content := range cleaned {
+		if slices.ContainsFunc(file.Entries, func(e Entry) bool { return e.Content == content }) {
+			continue
+		}
+		if i := slices.IndexFunc(existing, func(e Entry) bool { return e.Content == content }); i >= 0 {
+			file.Entries = append(file.Entries, existing[i])
+			continue
+		}
+		file.add(content)
+	}
+
+	return file.Entries, s.write(workingDir, file)
+}
+
+// Recall returns the memories containing any of the query's words, best matches first. An empty query
+// returns every memory.
+func (s *Store) Recall(workingDir, query string) ([]Entry, error) {
+	entries, err := s.List(workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return entries, nil
+	}
+
+	type match struct {
+		entry Entry
+		score int
+	}
+	var matches []match
+	for _, entry := range entries {
+		content := strings.ToLower(entry.Content)
+		score := 0
+		for _, term := range terms {
+			if strings.Contains(content, term) {
+				score++
+			}
+		}
+		if score > 0 {
+			matches = append(matches, match{entry: entry, score: score})
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int { return cmp.Compare(b.score, a.score) })
+
+	out := make([]Entry, len(matches))
+	for i, m := range matches {
+		out[i] = m.entry
+	}
+	return out, nil
+}
+
+// Index renders the memories as a <project-memory> block for the system prompt, keeping the newest ones
+// that fit in budget tokens as measured by count. It returns the block, empty when there are no memories,
+// and how many memories were left out.
+func Index(entries []Entry, budget int, count func(string) (int, error)) (string, int) {
+	if len(entries) == 0 {
+		return "", 0
+	}
+
+	const header = "<project-memory>\nFacts remembered about this project in earlier sessions. Use the memory tool to recall, remember or forget them.\n"
+	const footer = "</project-memory>"
+
+	used := tokens(count, header+footer)
+	var shown []Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		line := formatEntry(entries[i])
+		cost := tokens(count, line)
+		if budget > 0 && used+cost > budget {
+			break
+		}
+		used += cost
+		shown = append(shown, entries[i])
+	}
+	slices.Reverse(shown)
+
+	omitted := len(entries) - len(shown)
+
+	var b strings.Builder
+	b.WriteString(header)
+	for _, entry := range shown {
+		b.WriteString(formatEntry(entry))
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "(%d older memories not shown; use memory recall to search them.)\n", omitted)
+	}
+	b.WriteString(footer)
+
+	return b.String(), omitted
+}
+
+func formatEntry(entry Entry) string {
+	return fmt.Sprintf("- [%d] %s\n", entry.ID, entry.Content)
+}
+
+func tokens(count func(string) (int, error), text string) int {
+	n, err := count(text)
+	if err != nil {
+		return len(text) / 4
+	}
+	return n
+}
+
+func (f *projectFile) add(content string) Entry {
+	f.NextID++
+	entry := Entry{ID: f.NextID, Content: content, CreatedAt: time.Now().UTC()}
+	f.Entries = append(f.Entries, entry)
+	return entry
+}
+
+func (s *Store) read(workingDir string) (projectFile, error) {
+	file := projectFile{WorkingDir: projectKey(workingDir)}
+
+	data, err := os.ReadFile(s.Path(workingDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return file, nil
+		}
+		return file, fmt.Errorf("memory: read: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("memory: parse %s: %w", s.Path(workingDir), err)
+	}
+	return file, nil
+}
+
+func (s *Store) write(workingDir string, file projectFile) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("memory: create directory: %w", err)
+	}
+
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("memory: marshal: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "memory-*.json")
+	if err != nil {
+		return fmt.Errorf("memory: write: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("memory: write: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("memory: write: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.Path(workingDir)); err != nil {
+		return fmt.Errorf("memory: write: %w", err)
+	}
+	return nil
+}
+
+func validContent(content string) (string, error) {
+	content = strings.Join(strings.Fields(content), " ")
+	if content == "" {
+		return "", errors.New("memory: content must not be empty")
+	}
+	if n := len([]rune(content)); n > MaxContentRunes {
+		return "", fmt.Errorf("memory: content is %d characters, the limit is %d", n, MaxContentRunes)
+	}
+	return content, nil
+}
+
+func projectKey(workingDir string) string {
+	if abs, err := filepath.Abs(workingDir); err == nil {
+		workingDir = abs
+	}
+	return filepath.Clean(workingDir)
+}
@@ -0,0 +1,180 @@
+package memory
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func countWords(text string) (int, error) {
+	return len(strings.Fields(text)), nil
+}
+
+func contents(entries []Entry) []string {
+	out := make([]string, len(entries))
+	for i, entry := range entries {
+		out[i] = entry.Content
+	}
+	return out
+}
+
+func TestRememberAndForget(t *testing.T) {
+	store := New(t.TempDir())
+	project := "/src/app"
+
+	first, err := store.Remember(project, "  tests run with   make test ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != 1 || first.Content != "tests run with make test" {
+		t.Errorf("first = %+v", first)
+	}
+
+	again, err := store.Remember(project, "Tests run with make test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("duplicate got ID %d, want existing %d", again.ID, first.ID)
+	}
+
+	second, err := store.Remember(project, "the API lives in internal/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Forget(project, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Forget(project, first.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("forgetting twice: err = %v, want ErrNotFound", err)
+	}
+
+	third, err := store.Remember(project, "use tabs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID != 3 {
+		t.Errorf("IDs must not be reused, got %d", third.ID)
+	}
+
+	entries, err := store.List(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != second.ID || entries[1].ID != third.ID {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	other, err := store.List("/src/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other) != 0 {
+		t.Errorf("projects must not share memories, got %+v", other)
+	}
+}
+
+func TestRemember_Rejects(t *testing.T) {
+	store := New(t.TempDir())
+
+	if _, err := store.Remember("/src/app", "   "); err == nil {
+		t.Error("expected error for empty content")
+	}
+	if _, err := store.Remember("/src/app", strings.Repeat("x", MaxContentRunes+1)); err == nil {
+		t.Error("expected error for content over the limit")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	store := New(t.TempDir())
+	entry, _ := store.Remember("/src/app", "go 1.24")
+
+	if err := store.Update("/src/app", entry.ID, "go 1.25"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := store.List("/src/app")
+	if entries[0].Content != "go 1.25" || entries[0].UpdatedAt.IsZero() {
+		t.Errorf("entry = %+v", entries[0])
+	}
+
+	if err := store.Update("/src/app", 9, "x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	store := New(t.TempDir())
+	kept, _ := store.Remember("/src/app", "keep me")
+	store.Remember("/src/app", "drop me")
+
+	entries, err := store.Replace("/src/app", []string{"new fact", "", "keep me", "new fact"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(contents(entries), "|"); got != "new fact|keep me" {
+		t.Errorf("contents = %s", got)
+	}
+	if entries[1].ID != kept.ID || !entries[1].CreatedAt.Equal(kept.CreatedAt) {
+		t.Errorf("unchanged memory lost its identity: %+v", entries[1])
+	}
+	if entries[0].ID != 3 {
+		t.Errorf("new memory ID = %d, want 3", entries[0].ID)
+	}
+}
+
+func TestRecall(t *testing.T) {
+	store := New(t.TempDir())
+	for _, fact := range []string{"tests run with make test", "deploys go through CI", "make lint before pushing"} {
+		if _, err := store.Remember("/src/app", fact); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "make test", want: "tests run with make test|make lint before pushing"},
+		{query: "DEPLOYS", want: "deploys go through CI"},
+		{query: "kubernetes", want: ""},
+		{query: "", want: "tests run with make test|deploys go through CI|make lint before pushing"},
+	}
+
+	for _, tt := range tests {
+		got, err := store.Recall("/src/app", tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if joined := strings.Join(contents(got), "|"); joined != tt.want {
+			t.Errorf("Recall(%q) = %s, want %s", tt.query, joined, tt.want)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	entries := []Entry{
+		{ID: 1, Content: "one two three"},
+		{ID: 2, Content: "four five"},
+		{ID: 3, Content: "six"},
+	}
+
+	if block, omitted := Index(nil, 100, countWords); block != "" || omitted != 0 {
+		t.Errorf("empty index = %q, %d", block, omitted)
+	}
+
+	block, omitted := Index(entries, 0, countWords)
+	if omitted != 0 || !strings.Contains(block, "- [1] one two three\n- [2] four five\n- [3] six\n</project-memory>") {
+		t.Errorf("unlimited index = %q, omitted %d", block, omitted)
+	}
+
+	header, _ := countWords("<project-memory>\nFacts remembered about this project in earlier sessions. Use the memory tool to recall, remember or forget them.\n</project-memory>")
+	block, omitted = Index(entries, header+7, countWords)
+	if omitted != 1 || strings.Contains(block, "[1]") || !strings.Contains(block, "- [2] four five\n- [3] six\n") {
+		t.Errorf("budgeted index = %q, omitted %d", block, omitted)
+	}
+	if !strings.Contains(block, "(1 older memories not shown") {
+		t.Errorf("budgeted index must mention omitted memories: %q", block)
+	}
+}
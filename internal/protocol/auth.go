@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/erg0nix/kontekst/internal/auth"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+)
+
+// TokenVerifier checks the secret a client authenticates with and returns the token it belongs to.
+type TokenVerifier interface {
+	Verify(secret string) (auth.Token, error)
+}
+
+// methodScopes is the scope each client method requires once a connection has authenticated.
+// initialize and authenticate need none; a method missing here requires [auth.ScopeAdmin].
+var methodScopes = map[string]auth.Scope{
+	types.MethodSessionLoad:            auth.ScopeRead,
+	types.MethodKontekstStatus:         auth.ScopeRead,
+	types.MethodKontekstSessionsSearch: auth.ScopeRead,
+	types.MethodKontekstSessionAttach:  auth.ScopeRead,
+	types.MethodKontekstSessionDetach:  auth.ScopeRead,
+	types.MethodKontekstAgentsList:     auth.ScopeRead,
+	types.MethodKontekstAgentsGet:      auth.ScopeRead,
+	types.MethodKontekstSessionsList:   auth.ScopeRead,
+	types.MethodKontekstSessionsGet:    auth.ScopeRead,
+	types.MethodKontekstSkillsList:     auth.ScopeRead,
+	types.MethodKontekstSkillsGet:      auth.ScopeRead,
+	types.MethodKontekstCommandsList:   auth.ScopeRead,
+	types.MethodKontekstCommandsGet:    auth.ScopeRead,
+	types.MethodSessionNew:             auth.ScopePrompt,
+	types.MethodSessionPrompt:          auth.ScopePrompt,
+	types.MethodSessionCancel:          auth.ScopePrompt,
+	types.MethodSessionSetMode:         auth.ScopePrompt,
+	types.MethodSessionSetConfig:       auth.ScopePrompt,
+	types.MethodKontekstSessionFork:    auth.ScopePrompt,
+	types.MethodKontekstSessionsDelete: auth.ScopeAdmin,
+	types.MethodKontekstReload:         auth.ScopeAdmin,
+	types.MethodKontekstShutdown:       auth.ScopeAdmin,
+}
+
+// RequireAuth makes the connection authenticate with one of the verifier's tokens before calling any
+// method other than initialize and authenticate, and limits it to the token's scopes afterwards.
+// It must be called before the handler serves the connection.
+func (h *Handler) RequireAuth(tokens TokenVerifier) {
+	h.tokens = tokens
+}
+
+// AuthenticateAs grants the connection a token without an authenticate request, as when the client
+// presented a verified certificate.
+func (h *Handler) AuthenticateAs(token auth.Token) {
+	h.token.Store(&token)
+}
+
+// authorized wraps a dispatch function so each method is checked against the connection's token.
+func (h *Handler) authorized(dispatch MethodHandler) MethodHandler {
+	return func(ctx context.Context, method string, params json.RawMessage) (any, error) {
+		if err := h.authorize(method); err != nil {
+			return nil, err
+		}
+		return dispatch(ctx, method, params)
+	}
+}
+
+func (h *Handler) authorize(method string) error {
+	if h.tokens == nil || method == types.MethodInitialize || method == types.MethodAuthenticate {
+		return nil
+	}
+	if h.token.Load() == nil {
+		return NewRPCError(types.ErrAuthRequired, "authentication required")
+	}
+
+	scope, ok := methodScopes[method]
+	if !ok {
+		scope = auth.ScopeAdmin
+	}
+	if !h.allows(scope) {
+		return NewRPCError(types.ErrAuthRequired, fmt.Sprintf("token %q lacks the %s scope needed for %s", h.token.Load().Name, scope, method))
+	}
+	return nil
+}
+
+// TokenName returns the name of the token the connection authenticated with, or "" before it has.
+func (h *Handler) TokenName() string {
+	if token := h.token.Load(); token != nil {
+		return token.Name
+	}
+	return ""
+}
+
+// allows reports whether the connection's token grants scope. Every scope is allowed when the handler
+// does not require authentication.
+func (h *Handler) allows(scope auth.Scope) bool {
+	if h.tokens == nil {
+		return true
+	}
+	token := h.token.Load()
+	return token != nil && token.Has(scope)
+}
+
+// authMethods returns the authentication methods advertised in the initialize response.
+func (h *Handler) authMethods() []types.AuthMethod {
+	if h.tokens == nil {
+		return []types.AuthMethod{}
+	}
+	return []types.AuthMethod{{
+		ID:          types.AuthMethodToken,
+		Name:        "Kontekst token",
+		Description: "Send the secret from the token file in the kontekst data directory as _meta.kontekst.token.",
+	}}
+}
+
+// handleAuthenticate verifies the client's token and grants the connection its scopes.
+//
+// ACP: "authenticate"
+// Request:  [types.AuthenticateRequest] — the method ID and, in _meta, the token's secret.
+// Response: [types.AuthenticateResponse] — empty on success; an auth error otherwise.
+func (h *Handler) handleAuthenticate(params json.RawMessage) (types.AuthenticateResponse, error) {
+	if h.tokens == nil {
+		return types.AuthenticateResponse{}, nil
+	}
+
+	var req types.AuthenticateRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return types.AuthenticateResponse{}, NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+	if req.MethodID != types.AuthMethodToken {
+		return types.AuthenticateResponse{}, NewRPCError(types.ErrInvalidParams, fmt.Sprintf("unknown auth method: %s", req.MethodID))
+	}
+
+	token, err := h.tokens.Verify(req.Token())
+	if err != nil {
+		return types.AuthenticateResponse{}, NewRPCError(types.ErrAuthRequired, "invalid token")
+	}
+	h.token.Store(&token)
+	return types.AuthenticateResponse{}, nil
+}
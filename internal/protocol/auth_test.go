@@ -0,0 +1,195 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/agent"
+	"github.com/erg0nix/kontekst/internal/auth"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+	"github.com/erg0nix/kontekst/internal/tool"
+)
+
+type mapVerifier map[string]auth.Token
+
+func (v mapVerifier) Verify(secret string) (auth.Token, error) {
+	if token, ok := v[secret]; ok {
+		return token, nil
+	}
+	return auth.Token{}, auth.ErrInvalidToken
+}
+
+var testTokens = mapVerifier{
+	"admin-secret":    {Name: "admin", Scopes: auth.AllScopes},
+	"reader-secret":   {Name: "reader", Scopes: []auth.Scope{auth.ScopeRead}},
+	"no-tools-secret": {Name: "no-tools", Scopes: []auth.Scope{auth.ScopeRead, auth.ScopePrompt}},
+}
+
+// connectAuthClient connects to a handler requiring one of testTokens and performs the handshake.
+func connectAuthClient(t *testing.T, runner agent.Runner, sessions *SessionManager) (*Connection, types.InitializeResponse) {
+	t.Helper()
+
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+
+	handler := NewHandler(runner, testRegistry(t), nil, sessions)
+	handler.RequireAuth(testTokens)
+	serverConn := handler.Serve(serverW, serverR)
+	client := NewClient(NewConnection(nil, clientW, clientR))
+
+	t.Cleanup(func() {
+		serverConn.Close()
+		client.Close()
+	})
+
+	resp, err := client.Initialize(context.Background(), types.InitializeRequest{ProtocolVersion: 1})
+	if err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	return client.conn, resp
+}
+
+func authenticate(conn *Connection, secret string) error {
+	_, err := conn.Request(context.Background(), types.MethodAuthenticate, types.AuthenticateRequest{
+		MethodID: types.AuthMethodToken,
+		Meta:     &types.AuthenticateRequestMeta{Kontekst: types.AuthenticateExtension{Token: secret}},
+	})
+	return err
+}
+
+func rpcCode(err error) int {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code
+	}
+	return 0
+}
+
+func TestAuth_RequiresToken(t *testing.T) {
+	conn, resp := connectAuthClient(t, &mockRunner{}, nil)
+
+	if len(resp.AuthMethods) != 1 || resp.AuthMethods[0].ID != types.AuthMethodToken {
+		t.Fatalf("auth methods = %+v, want the token method", resp.AuthMethods)
+	}
+
+	newSession := func() error {
+		_, err := conn.Request(context.Background(), types.MethodSessionNew, types.NewSessionRequest{Cwd: "/tmp", McpServers: []types.McpServer{}})
+		return err
+	}
+
+	if err := newSession(); rpcCode(err) != int(types.ErrAuthRequired) {
+		t.Fatalf("session/new before authenticate error = %v, want auth required", err)
+	}
+	if err := authenticate(conn, "wrong"); rpcCode(err) != int(types.ErrAuthRequired) {
+		t.Fatalf("authenticate with a wrong token error = %v, want auth required", err)
+	}
+	if err := authenticate(conn, "admin-secret"); err != nil {
+		t.Fatalf("authenticate failed: %v", err)
+	}
+	if err := newSession(); err != nil {
+		t.Fatalf("session/new after authenticate failed: %v", err)
+	}
+}
+
+func TestAuth_Scopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		method  string
+		params  any
+		allowed bool
+	}{
+		{"reader loads sessions", "reader-secret", types.MethodSessionLoad, types.LoadSessionRequest{SessionID: "sess_missing"}, true},
+		{"reader cannot create sessions", "reader-secret", types.MethodSessionNew, types.NewSessionRequest{Cwd: "/tmp"}, false},
+		{"reader cannot cancel", "reader-secret", types.MethodSessionCancel, types.CancelNotification{SessionID: "sess_1"}, false},
+		{"no-tools creates sessions", "no-tools-secret", types.MethodSessionNew, types.NewSessionRequest{Cwd: "/tmp"}, true},
+		{"no-tools cannot shut down", "no-tools-secret", types.MethodKontekstShutdown, nil, false},
+		{"admin shuts down", "admin-secret", types.MethodKontekstShutdown, nil, true},
+		{"unlisted methods need admin", "no-tools-secret", "_kontekst/unknown", nil, false},
+		{"reader lists agents", "reader-secret", types.MethodKontekstAgentsList, nil, true},
+		{"reader reads skills", "reader-secret", types.MethodKontekstSkillsGet, types.NameRequest{Name: "x"}, true},
+		{"no-tools cannot delete sessions", "no-tools-secret", types.MethodKontekstSessionsDelete, types.SessionRequest{SessionID: "sess_1"}, false},
+		{"no-tools cannot reload", "no-tools-secret", types.MethodKontekstReload, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _ := connectAuthClient(t, &mockRunner{}, nil)
+			if err := authenticate(conn, tt.secret); err != nil {
+				t.Fatalf("authenticate failed: %v", err)
+			}
+
+			_, err := conn.Request(context.Background(), tt.method, tt.params)
+			denied := rpcCode(err) == int(types.ErrAuthRequired)
+			if denied == tt.allowed {
+				t.Errorf("%s error = %v, want allowed = %v", tt.method, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestAuth_NoToolsScopeRunsWithoutTools(t *testing.T) {
+	var runTools tool.ToolExecutor
+	runner := &mockRunner{
+		events: []agent.Event{
+			{Type: agent.EvtRunStarted, RunID: "run_1"},
+			{Type: agent.EvtRunCompleted, RunID: "run_1"},
+		},
+		onStart: func(cfg agent.RunConfig) { runTools = cfg.Tools },
+	}
+
+	conn, _ := connectAuthClient(t, runner, nil)
+	if err := authenticate(conn, "no-tools-secret"); err != nil {
+		t.Fatalf("authenticate failed: %v", err)
+	}
+	sid := initAndCreateSession(t, conn)
+
+	_, err := conn.Request(context.Background(), types.MethodSessionPrompt, types.PromptRequest{
+		SessionID: sid,
+		Prompt:    []types.ContentBlock{types.TextBlock("delete everything")},
+	})
+	if err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+
+	if runTools == nil || len(runTools.ToolDefinitions()) != 0 {
+		t.Errorf("run tools = %v, want an empty tool set", runTools)
+	}
+}
+
+func TestAuth_ReadOnlyAttachGetsNoPermissionRequests(t *testing.T) {
+	sessions := NewSessionManager()
+	sid := types.SessionID("sess_shared")
+	sess := sessions.open(sid, "default", "/tmp", nil)
+
+	reader, _ := connectAuthClient(t, &mockRunner{}, sessions)
+	if err := authenticate(reader, "reader-secret"); err != nil {
+		t.Fatalf("authenticate failed: %v", err)
+	}
+	asked := make(chan struct{}, 1)
+	reader.handler = func(_ context.Context, method string, _ json.RawMessage) (any, error) {
+		if method == types.MethodRequestPermission {
+			asked <- struct{}{}
+		}
+		return nil, nil
+	}
+	if _, err := reader.Request(context.Background(), types.MethodKontekstSessionAttach, types.AttachSessionRequest{SessionID: sid}); err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := sess.requestPermission(ctx, types.RequestPermissionRequest{SessionID: sid}); err == nil {
+		t.Fatal("permission request was answered without an approver attached")
+	}
+
+	select {
+	case <-asked:
+		t.Error("read-only connection was asked for permission")
+	default:
+	}
+}
@@ -4,9 +4,10 @@ package protocol
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"net"
+	"slices"
 
 	"github.com/erg0nix/kontekst/internal/protocol/types"
 )
@@ -20,32 +21,48 @@ type PermissionHandler func(types.RequestPermissionRequest) types.RequestPermiss
 // ContextSnapshotHandler is a callback invoked when the server sends a context snapshot.
 type ContextSnapshotHandler func(json.RawMessage)
 
+// RunEndedHandler is a callback invoked when a run ends in a session the client is attached to.
+type RunEndedHandler func(types.RunEndedNotification)
+
 // ClientCallbacks holds the callback functions for handling server-initiated messages.
 type ClientCallbacks struct {
 	OnUpdate          UpdateHandler
 	OnPermission      PermissionHandler
 	OnContextSnapshot ContextSnapshotHandler
+	OnRunEnded        RunEndedHandler
 }
 
 // Client is an ACP client that communicates with the agent server over a JSON-RPC connection.
+// Token, when set, is presented to servers that advertise token authentication during [Client.Initialize].
 type Client struct {
 	conn              *Connection
+	Token             string
 	OnUpdate          UpdateHandler
 	OnPermission      PermissionHandler
 	OnContextSnapshot ContextSnapshotHandler
+	OnRunEnded        RunEndedHandler
 }
 
-// Dial connects to an ACP server at the given address and returns a Client.
+// Dial connects to an ACP server at the given address and returns a Client. The address is a
+// "unix:///path" socket, a TCP "host:port", a "tls://host:port" or a "ws://" or "wss://" URL, as accepted
+// by [SplitAddress]. TLS servers are verified against the system roots; use [DialTLS] to configure
+// verification.
 func Dial(ctx context.Context, addr string, callbacks ClientCallbacks) (*Client, error) {
-	conn, err := net.Dial("tcp", addr)
+	return DialTLS(ctx, addr, nil, callbacks)
+}
+
+// DialTLS is like [Dial], using tlsConfig when the address is a tls:// or wss:// one.
+func DialTLS(ctx context.Context, addr string, tlsConfig *tls.Config, callbacks ClientCallbacks) (*Client, error) {
+	conn, err := dial(ctx, addr, tlsConfig)
 	if err != nil {
-		return nil, fmt.Errorf("protocol: dial %s: %w", addr, err)
+		return nil, err
 	}
 
 	client := &Client{
 		OnUpdate:          callbacks.OnUpdate,
 		OnPermission:      callbacks.OnPermission,
 		OnContextSnapshot: callbacks.OnContextSnapshot,
+		OnRunEnded:        callbacks.OnRunEnded,
 	}
 	client.conn = NewConnection(client.dispatch, conn, conn)
 
@@ -71,6 +88,7 @@ func NewClient(conn *Connection) *Client {
 //	"session/update"             → [ClientCallbacks.OnUpdate]     — streaming session events (notification)
 //	"session/request_permission" → [ClientCallbacks.OnPermission] — tool approval request
 //	"_kontekst/context"          → [ClientCallbacks.OnContextSnapshot] — context window snapshot (notification)
+//	"_kontekst/session/run_ended" → [ClientCallbacks.OnRunEnded]  — attached session's run ended (notification)
 func (c *Client) dispatch(ctx context.Context, method string, params json.RawMessage) (any, error) {
 	switch method {
 	case types.MethodSessionUpdate:
@@ -99,12 +117,22 @@ func (c *Client) dispatch(ctx context.Context, method string, params json.RawMes
 			c.OnContextSnapshot(params)
 		}
 		return nil, nil
+
+	case types.MethodKontekstRunEnded:
+		if c.OnRunEnded != nil {
+			var notif types.RunEndedNotification
+			if err := json.Unmarshal(params, &notif); err == nil {
+				c.OnRunEnded(notif)
+			}
+		}
+		return nil, nil
 	}
 
 	return nil, nil
 }
 
-// Initialize performs the ACP protocol handshake with the server.
+// Initialize performs the ACP protocol handshake with the server, then authenticates with the client's
+// Token if the server requires it.
 func (c *Client) Initialize(ctx context.Context, req types.InitializeRequest) (types.InitializeResponse, error) {
 	result, err := c.conn.Request(ctx, types.MethodInitialize, req)
 	if err != nil {
@@ -115,9 +143,27 @@ func (c *Client) Initialize(ctx context.Context, req types.InitializeRequest) (t
 	if err := json.Unmarshal(result, &resp); err != nil {
 		return types.InitializeResponse{}, fmt.Errorf("protocol: unmarshal initialize response: %w", err)
 	}
+
+	if c.Token != "" && slices.ContainsFunc(resp.AuthMethods, func(m types.AuthMethod) bool { return m.ID == types.AuthMethodToken }) {
+		if err := c.Authenticate(ctx, c.Token); err != nil {
+			return types.InitializeResponse{}, err
+		}
+	}
 	return resp, nil
 }
 
+// Authenticate presents a token to the server using the token authentication method.
+func (c *Client) Authenticate(ctx context.Context, token string) error {
+	req := types.AuthenticateRequest{
+		MethodID: types.AuthMethodToken,
+		Meta:     &types.AuthenticateRequestMeta{Kontekst: types.AuthenticateExtension{Token: token}},
+	}
+	if _, err := c.conn.Request(ctx, types.MethodAuthenticate, req); err != nil {
+		return fmt.Errorf("protocol: authenticate: %w", err)
+	}
+	return nil
+}
+
 // NewSession creates a new session on the server.
 func (c *Client) NewSession(ctx context.Context, req types.NewSessionRequest) (types.NewSessionResponse, error) {
 	result, err := c.conn.Request(ctx, types.MethodSessionNew, req)
@@ -167,7 +213,10 @@ func (c *Client) Cancel(ctx context.Context, sessionID types.SessionID) error {
 
 // Status queries the server for its current status after performing a handshake.
 func (c *Client) Status(ctx context.Context) (types.StatusResponse, error) {
-	_, err := c.conn.Request(ctx, types.MethodInitialize, types.InitializeRequest{ProtocolVersion: types.ProtocolVersion})
+	_, err := c.Initialize(ctx, types.InitializeRequest{
+		ProtocolVersion: types.ProtocolVersion,
+		ClientInfo:      &types.Implementation{Name: "kontekst-cli"},
+	})
 	if err != nil {
 		return types.StatusResponse{}, fmt.Errorf("protocol: initialize: %w", err)
 	}
@@ -186,7 +235,7 @@ func (c *Client) Status(ctx context.Context) (types.StatusResponse, error) {
 
 // Shutdown requests the server to shut down gracefully after performing a handshake.
 func (c *Client) Shutdown(ctx context.Context) error {
-	_, err := c.conn.Request(ctx, types.MethodInitialize, types.InitializeRequest{ProtocolVersion: types.ProtocolVersion})
+	_, err := c.Initialize(ctx, types.InitializeRequest{ProtocolVersion: types.ProtocolVersion})
 	if err != nil {
 		return fmt.Errorf("protocol: initialize: %w", err)
 	}
@@ -198,6 +247,139 @@ func (c *Client) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// ForkSession asks the server to fork a session at the given message index.
+func (c *Client) ForkSession(ctx context.Context, req types.ForkSessionRequest) (types.ForkSessionResponse, error) {
+	result, err := c.conn.Request(ctx, types.MethodKontekstSessionFork, req)
+	if err != nil {
+		return types.ForkSessionResponse{}, fmt.Errorf("protocol: fork session: %w", err)
+	}
+
+	var resp types.ForkSessionResponse
+	if err := json.Unmarshal(result, &resp); err != nil {
+		return types.ForkSessionResponse{}, fmt.Errorf("protocol: unmarshal fork session response: %w", err)
+	}
+	return resp, nil
+}
+
+// SearchSessions asks the server to search the messages of all sessions.
+func (c *Client) SearchSessions(ctx context.Context, req types.SearchSessionsRequest) (types.SearchSessionsResponse, error) {
+	result, err := c.conn.Request(ctx, types.MethodKontekstSessionsSearch, req)
+	if err != nil {
+		return types.SearchSessionsResponse{}, fmt.Errorf("protocol: search sessions: %w", err)
+	}
+
+	var resp types.SearchSessionsResponse
+	if err := json.Unmarshal(result, &resp); err != nil {
+		return types.SearchSessionsResponse{}, fmt.Errorf("protocol: unmarshal search sessions response: %w", err)
+	}
+	return resp, nil
+}
+
+// AttachSession subscribes the client to a session's live updates and permission requests.
+func (c *Client) AttachSession(ctx context.Context, req types.AttachSessionRequest) (types.AttachSessionResponse, error) {
+	result, err := c.conn.Request(ctx, types.MethodKontekstSessionAttach, req)
+	if err != nil {
+		return types.AttachSessionResponse{}, fmt.Errorf("protocol: attach session: %w", err)
+	}
+
+	var resp types.AttachSessionResponse
+	if err := json.Unmarshal(result, &resp); err != nil {
+		return types.AttachSessionResponse{}, fmt.Errorf("protocol: unmarshal attach session response: %w", err)
+	}
+	return resp, nil
+}
+
+// DetachSession stops the client receiving a session's updates without affecting its run.
+func (c *Client) DetachSession(ctx context.Context, sessionID types.SessionID) error {
+	if _, err := c.conn.Request(ctx, types.MethodKontekstSessionDetach, types.DetachSessionRequest{SessionID: sessionID}); err != nil {
+		return fmt.Errorf("protocol: detach session: %w", err)
+	}
+	return nil
+}
+
+// ListAgents returns the server's agents.
+func (c *Client) ListAgents(ctx context.Context) (types.ListAgentsResponse, error) {
+	var resp types.ListAgentsResponse
+	err := c.call(ctx, types.MethodKontekstAgentsList, nil, &resp, "list agents")
+	return resp, err
+}
+
+// GetAgent returns an agent's resolved configuration.
+func (c *Client) GetAgent(ctx context.Context, name string) (types.AgentDetail, error) {
+	var resp types.AgentDetail
+	err := c.call(ctx, types.MethodKontekstAgentsGet, types.NameRequest{Name: name}, &resp, "get agent")
+	return resp, err
+}
+
+// ListSessions returns the metadata of every session on the server.
+func (c *Client) ListSessions(ctx context.Context) (types.ListSessionsResponse, error) {
+	var resp types.ListSessionsResponse
+	err := c.call(ctx, types.MethodKontekstSessionsList, nil, &resp, "list sessions")
+	return resp, err
+}
+
+// GetSession returns a session's metadata.
+func (c *Client) GetSession(ctx context.Context, sessionID types.SessionID) (types.SessionInfo, error) {
+	var resp types.SessionInfo
+	err := c.call(ctx, types.MethodKontekstSessionsGet, types.SessionRequest{SessionID: sessionID}, &resp, "get session")
+	return resp, err
+}
+
+// DeleteSession deletes a session that has no active run.
+func (c *Client) DeleteSession(ctx context.Context, sessionID types.SessionID) error {
+	return c.call(ctx, types.MethodKontekstSessionsDelete, types.SessionRequest{SessionID: sessionID}, nil, "delete session")
+}
+
+// ListSkills returns the server's skills, without their templates.
+func (c *Client) ListSkills(ctx context.Context) (types.ListSkillsResponse, error) {
+	var resp types.ListSkillsResponse
+	err := c.call(ctx, types.MethodKontekstSkillsList, nil, &resp, "list skills")
+	return resp, err
+}
+
+// GetSkill returns a skill and its template.
+func (c *Client) GetSkill(ctx context.Context, name string) (types.SkillInfo, error) {
+	var resp types.SkillInfo
+	err := c.call(ctx, types.MethodKontekstSkillsGet, types.NameRequest{Name: name}, &resp, "get skill")
+	return resp, err
+}
+
+// ListCommands returns the server's commands.
+func (c *Client) ListCommands(ctx context.Context) (types.ListCommandsResponse, error) {
+	var resp types.ListCommandsResponse
+	err := c.call(ctx, types.MethodKontekstCommandsList, nil, &resp, "list commands")
+	return resp, err
+}
+
+// GetCommand returns a command and its arguments.
+func (c *Client) GetCommand(ctx context.Context, name string) (types.CommandInfo, error) {
+	var resp types.CommandInfo
+	err := c.call(ctx, types.MethodKontekstCommandsGet, types.NameRequest{Name: name}, &resp, "get command")
+	return resp, err
+}
+
+// Reload asks the server to reread its skills and commands from disk.
+func (c *Client) Reload(ctx context.Context) (types.ReloadResponse, error) {
+	var resp types.ReloadResponse
+	err := c.call(ctx, types.MethodKontekstReload, nil, &resp, "reload")
+	return resp, err
+}
+
+// call sends a request and decodes its result into resp, unless resp is nil. what names the operation in errors.
+func (c *Client) call(ctx context.Context, method string, params, resp any, what string) error {
+	result, err := c.conn.Request(ctx, method, params)
+	if err != nil {
+		return fmt.Errorf("protocol: %s: %w", what, err)
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := json.Unmarshal(result, resp); err != nil {
+		return fmt.Errorf("protocol: unmarshal %s response: %w", what, err)
+	}
+	return nil
+}
+
 // Done returns a channel that is closed when the client's connection is closed.
 func (c *Client) Done() <-chan struct{} {
 	return c.conn.Done()
@@ -99,3 +99,59 @@ func TestClientPermissionCallback(t *testing.T) {
 		t.Errorf("outcome = %+v, want selected allow", resp.Outcome)
 	}
 }
+
+func TestClientManagementHelpers(t *testing.T) {
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+
+	calls := make(chan string, 16)
+	server := NewConnection(func(_ context.Context, method string, params json.RawMessage) (any, error) {
+		calls <- method + " " + string(params)
+		switch method {
+		case types.MethodKontekstAgentsList:
+			return types.ListAgentsResponse{Agents: []types.AgentSummary{{Name: "default"}}}, nil
+		case types.MethodKontekstSessionsGet:
+			return types.SessionInfo{SessionID: "sess_1", Messages: 3}, nil
+		case types.MethodKontekstSessionsDelete:
+			return nil, NewRPCError(types.ErrNotFound, "session not found: sess_2")
+		case types.MethodKontekstReload:
+			return types.ReloadResponse{Agents: 4, Skills: 2, Commands: 1}, nil
+		}
+		return nil, NewRPCError(types.ErrMethodNotFound, method)
+	}, serverW, serverR)
+	defer server.Close()
+
+	clientConn := newConnection(nil, clientW, clientR)
+	client := NewClient(clientConn)
+	clientConn.Start()
+	defer client.Close()
+
+	ctx := context.Background()
+
+	agents, err := client.ListAgents(ctx)
+	if err != nil || len(agents.Agents) != 1 || agents.Agents[0].Name != "default" {
+		t.Errorf("ListAgents() = %+v, %v", agents, err)
+	}
+	if got := <-calls; got != types.MethodKontekstAgentsList+" " {
+		t.Errorf("request = %q", got)
+	}
+
+	info, err := client.GetSession(ctx, "sess_1")
+	if err != nil || info.SessionID != "sess_1" || info.Messages != 3 {
+		t.Errorf("GetSession() = %+v, %v", info, err)
+	}
+	if got := <-calls; got != types.MethodKontekstSessionsGet+` {"sessionId":"sess_1"}` {
+		t.Errorf("request = %q", got)
+	}
+
+	err = client.DeleteSession(ctx, "sess_2")
+	if code := rpcCode(err); code != int(types.ErrNotFound) {
+		t.Errorf("DeleteSession() error = %v, want code %d", err, types.ErrNotFound)
+	}
+	<-calls
+
+	reloaded, err := client.Reload(ctx)
+	if err != nil || reloaded != (types.ReloadResponse{Agents: 4, Skills: 2, Commands: 1}) {
+		t.Errorf("Reload() = %+v, %v", reloaded, err)
+	}
+}
@@ -4,25 +4,45 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/erg0nix/kontekst/internal/core"
 	"github.com/erg0nix/kontekst/internal/protocol/types"
+	"github.com/erg0nix/kontekst/internal/tool"
 )
 
+// clientRequestTimeout bounds each request the executor sends the client, except waiting for a command
+// to exit. A request that times out is cancelled on the client.
+const clientRequestTimeout = 30 * time.Second
+
 // ToolExecutor delegates tool execution to the ACP client based on its declared capabilities.
 type ToolExecutor struct {
 	conn      *Connection
 	sessionID types.SessionID
 	caps      types.ClientCapabilities
+	schemas   map[string]*tool.Schema
 }
 
 // NewToolExecutor creates a ToolExecutor that routes tool calls over the given connection.
 func NewToolExecutor(conn *Connection, sessionID types.SessionID, caps types.ClientCapabilities) *ToolExecutor {
-	return &ToolExecutor{
+	e := &ToolExecutor{
 		conn:      conn,
 		sessionID: sessionID,
 		caps:      caps,
+		schemas:   make(map[string]*tool.Schema),
+	}
+
+	for _, def := range e.ToolDefinitions() {
+		schema, err := tool.CompileSchema(def.Parameters)
+		if err != nil {
+			slog.Warn("failed to compile tool schema", "tool", def.Name, "error", err)
+			schema = &tool.Schema{}
+		}
+		e.schemas[def.Name] = schema
 	}
+
+	return e
 }
 
 // ToolDefinitions returns tool definitions based on the client's declared capabilities.
@@ -118,11 +138,27 @@ func (e *ToolExecutor) Execute(name string, args map[string]any, ctx context.Con
 	}
 }
 
+// ValidateArguments coerces and validates arguments against the named tool's compiled schema.
+func (e *ToolExecutor) ValidateArguments(name string, args map[string]any) (map[string]any, error) {
+	schema, ok := e.schemas[name]
+	if !ok {
+		return nil, fmt.Errorf("acp executor: unknown tool %q", name)
+	}
+	return schema.Validate(args)
+}
+
 // Preview returns an empty string because ACP-delegated tools do not support previews.
 func (e *ToolExecutor) Preview(_ string, _ map[string]any, _ context.Context) (string, error) {
 	return "", nil
 }
 
+// request sends a request to the client, giving up after clientRequestTimeout.
+func (e *ToolExecutor) request(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, clientRequestTimeout)
+	defer cancel()
+	return e.conn.Request(ctx, method, params)
+}
+
 func (e *ToolExecutor) executeReadFile(args map[string]any, ctx context.Context) (string, error) {
 	path, _ := args["path"].(string)
 	if path == "" {
@@ -141,7 +177,7 @@ func (e *ToolExecutor) executeReadFile(args map[string]any, ctx context.Context)
 		req.Limit = &limit
 	}
 
-	result, err := e.conn.Request(ctx, types.MethodFsReadTextFile, req)
+	result, err := e.request(ctx, types.MethodFsReadTextFile, req)
 	if err != nil {
 		return "", fmt.Errorf("acp executor: fs/read_text_file: %w", err)
 	}
@@ -168,7 +204,7 @@ func (e *ToolExecutor) executeWriteFile(args map[string]any, ctx context.Context
 		Content:   content,
 	}
 
-	_, err := e.conn.Request(ctx, types.MethodFsWriteTextFile, req)
+	_, err := e.request(ctx, types.MethodFsWriteTextFile, req)
 	if err != nil {
 		return "", fmt.Errorf("acp executor: fs/write_text_file: %w", err)
 	}
@@ -196,7 +232,7 @@ func (e *ToolExecutor) executeRunCommand(args map[string]any, ctx context.Contex
 		req.Cwd = cwd
 	}
 
-	result, err := e.conn.Request(ctx, types.MethodTerminalCreate, req)
+	result, err := e.request(ctx, types.MethodTerminalCreate, req)
 	if err != nil {
 		return "", fmt.Errorf("acp executor: terminal/create: %w", err)
 	}
@@ -226,7 +262,7 @@ func (e *ToolExecutor) executeRunCommand(args map[string]any, ctx context.Contex
 		TerminalID: createResp.TerminalID,
 	}
 
-	outResult, err := e.conn.Request(ctx, types.MethodTerminalOutput, outReq)
+	outResult, err := e.request(ctx, types.MethodTerminalOutput, outReq)
 	if err != nil {
 		return "", fmt.Errorf("acp executor: terminal/output: %w", err)
 	}
@@ -236,7 +272,7 @@ func (e *ToolExecutor) executeRunCommand(args map[string]any, ctx context.Contex
 		return "", fmt.Errorf("acp executor: unmarshal output response: %w", err)
 	}
 
-	_, _ = e.conn.Request(ctx, types.MethodTerminalRelease, types.ReleaseTerminalRequest{
+	_, _ = e.request(ctx, types.MethodTerminalRelease, types.ReleaseTerminalRequest{
 		SessionID:  e.sessionID,
 		TerminalID: createResp.TerminalID,
 	})
@@ -358,7 +358,7 @@ func TestServerACPToolExecutorWired(t *testing.T) {
 	clientR, serverW := io.Pipe()
 
 	registry := testRegistry(t)
-	handler := NewHandler(runner, registry, nil)
+	handler := NewHandler(runner, registry, nil, nil)
 
 	serverConn := handler.Serve(serverW, serverR)
 	clientConn := NewConnection(nil, clientW, clientR)
@@ -31,6 +31,11 @@ func (m *mockContextWindow) CompleteRun()                             {}
 func (m *mockContextWindow) SetActiveSkill(*core.SkillMetadata)       {}
 func (m *mockContextWindow) ActiveSkill() *core.SkillMetadata         { return nil }
 func (m *mockContextWindow) SetAgentSystemPrompt(string)              {}
+func (m *mockContextWindow) SetProjectMemory(string)                  {}
+func (m *mockContextWindow) ProjectMemory() string                    { return "" }
+func (m *mockContextWindow) SetPlan([]core.PlanEntry)                 {}
+func (m *mockContextWindow) SetPlanNote(core.Message)                 {}
+func (m *mockContextWindow) Plan() []core.PlanEntry                   { return nil }
 func (m *mockContextWindow) Snapshot() conversation.Snapshot          { return conversation.Snapshot{} }
 
 func (m *mockContextWindow) BuildContext() ([]core.Message, error) {
@@ -135,7 +140,7 @@ func TestIntegrationACPReadFile(t *testing.T) {
 	clientR, serverW := io.Pipe()
 
 	registry := testRegistryWithEndpoint(t, llm.URL)
-	handler := NewHandler(runner, registry, nil)
+	handler := NewHandler(runner, registry, nil, nil)
 
 	serverConn := handler.Serve(serverW, serverR)
 	clientConn := NewConnection(nil, clientW, clientR)
@@ -258,7 +263,7 @@ func TestIntegrationACPRunCommand(t *testing.T) {
 	clientR, serverW := io.Pipe()
 
 	registry := testRegistryWithEndpoint(t, llm.URL)
-	handler := NewHandler(runner, registry, nil)
+	handler := NewHandler(runner, registry, nil, nil)
 
 	serverConn := handler.Serve(serverW, serverR)
 	clientConn := NewConnection(nil, clientW, clientR)
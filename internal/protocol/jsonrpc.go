@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -17,17 +18,21 @@ const maxMessageSize = 10 * 1024 * 1024
 // MethodHandler is a function that handles an incoming JSON-RPC method call.
 type MethodHandler func(ctx context.Context, method string, params json.RawMessage) (any, error)
 
-// Connection is a bidirectional JSON-RPC 2.0 connection over line-delimited JSON.
+// Connection is a bidirectional JSON-RPC 2.0 connection over line-delimited JSON. It accepts batches,
+// and either side can cancel a request it is waiting on with a $/cancel_request notification, which
+// cancels the context of the receiving side's handler.
 type Connection struct {
-	writer  io.Writer
-	scanner *bufio.Scanner
-	handler MethodHandler
-	pending map[int]chan jsonrpcResponse
-	nextID  int
-	mu      sync.Mutex
-	done    chan struct{}
-	ctx     context.Context
-	cancel  context.CancelFunc
+	writer   io.Writer
+	scanner  *bufio.Scanner
+	handler  MethodHandler
+	pending  map[int]chan jsonrpcResponse
+	inflight map[int]context.CancelFunc
+	nextID   int
+	mu       sync.Mutex
+	writeMu  sync.Mutex
+	done     chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
 }
 
 // RPCError represents a JSON-RPC 2.0 error with a code and message.
@@ -67,6 +72,18 @@ type jsonrpcError struct {
 	Message string `json:"message"`
 }
 
+// invalidResponse is the error response to a batch entry that is not a valid message, or to an empty batch.
+// Its id is always null.
+type invalidResponse struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      *int          `json:"id"`
+	Error   *jsonrpcError `json:"error"`
+}
+
+func newInvalidResponse(message string) invalidResponse {
+	return invalidResponse{JSONRPC: "2.0", Error: &jsonrpcError{Code: int(types.ErrInvalidRequest), Message: message}}
+}
+
 type jsonrpcResponse struct {
 	Result json.RawMessage
 	Error  *jsonrpcError
@@ -78,13 +95,14 @@ func newConnection(handler MethodHandler, w io.Writer, r io.Reader) *Connection
 
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Connection{
-		writer:  w,
-		scanner: scanner,
-		handler: handler,
-		pending: make(map[int]chan jsonrpcResponse),
-		done:    make(chan struct{}),
-		ctx:     ctx,
-		cancel:  cancel,
+		writer:   w,
+		scanner:  scanner,
+		handler:  handler,
+		pending:  make(map[int]chan jsonrpcResponse),
+		inflight: make(map[int]context.CancelFunc),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
 }
 
@@ -98,25 +116,30 @@ func (c *Connection) readLoop() {
 	defer c.cancel()
 
 	for c.scanner.Scan() {
-		line := c.scanner.Bytes()
+		line := bytes.TrimSpace(c.scanner.Bytes())
 		if len(line) == 0 {
 			continue
 		}
 
+		if line[0] == '[' {
+			c.handleBatch(line)
+			continue
+		}
+
 		var msg jsonrpcMessage
 		if err := json.Unmarshal(line, &msg); err != nil {
 			continue
 		}
-
-		if msg.ID != nil && msg.Method == "" {
-			c.deliverResponse(msg)
-		} else if msg.ID != nil && msg.Method != "" {
-			go c.handleRequest(msg)
-		} else if msg.Method != "" {
-			c.handleNotification(msg)
+		if msg.ID != nil && msg.Method != "" {
+			ctx, untrack := c.track(*msg.ID)
+			go c.handleRequest(ctx, untrack, msg)
+			continue
 		}
+		c.route(msg)
 	}
 
+	c.cancel()
+
 	c.mu.Lock()
 	for id, ch := range c.pending {
 		ch <- jsonrpcResponse{Error: &jsonrpcError{Code: -32603, Message: "connection closed"}}
@@ -138,36 +161,140 @@ func (c *Connection) deliverResponse(msg jsonrpcMessage) {
 	}
 }
 
-func (c *Connection) handleRequest(msg jsonrpcMessage) {
-	if c.handler == nil {
-		resp := jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Error: &jsonrpcError{Code: int(types.ErrMethodNotFound), Message: "no handler"}}
-		c.writeMessage(resp)
+// route handles a response or notification. Notifications are handled in order on the read loop.
+func (c *Connection) route(msg jsonrpcMessage) {
+	switch {
+	case msg.ID != nil && msg.Method == "":
+		c.deliverResponse(msg)
+	case msg.Method == types.MethodCancelRequest:
+		c.cancelInflight(msg.Params)
+	case msg.Method != "":
+		c.handleNotification(msg)
+	}
+}
+
+// handleBatch handles each message of a batch. The batch's requests run concurrently, and their responses
+// are written together as one batch once all have finished. Each entry that is not a valid message is
+// answered in the batch with an invalid request error, and an empty batch with a single one.
+func (c *Connection) handleBatch(line []byte) {
+	var batch []json.RawMessage
+	if err := json.Unmarshal(line, &batch); err != nil {
+		return
+	}
+	if len(batch) == 0 {
+		c.write(newInvalidResponse("empty batch"))
 		return
 	}
 
-	result, err := c.handler(c.ctx, msg.Method, msg.Params)
+	var responses []any
+	var requests []jsonrpcMessage
+	var slots []int
+	var contexts []context.Context
+	var untracks []func()
+	for _, raw := range batch {
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(raw, &msg); err != nil || (msg.ID == nil && msg.Method == "") {
+			responses = append(responses, newInvalidResponse("invalid request"))
+			continue
+		}
+		if msg.ID != nil && msg.Method != "" {
+			ctx, untrack := c.track(*msg.ID)
+			requests = append(requests, msg)
+			slots = append(slots, len(responses))
+			contexts = append(contexts, ctx)
+			untracks = append(untracks, untrack)
+			responses = append(responses, nil)
+			continue
+		}
+		c.route(msg)
+	}
+	if len(responses) == 0 {
+		return
+	}
 
-	var resp jsonrpcMessage
-	resp.JSONRPC = "2.0"
-	resp.ID = msg.ID
+	go func() {
+		var wg sync.WaitGroup
+		for i, msg := range requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer untracks[i]()
+				responses[slots[i]] = c.respond(contexts[i], msg)
+			}()
+		}
+		wg.Wait()
+		c.write(responses)
+	}()
+}
+
+func (c *Connection) handleRequest(ctx context.Context, untrack func(), msg jsonrpcMessage) {
+	defer untrack()
+	c.write(c.respond(ctx, msg))
+}
+
+// track records the cancel function of a request's handler context, so a $/cancel_request read right after
+// the request finds it even before the handler starts. It returns the context with a function that drops
+// the record and releases the context once the request is answered. Requests are tracked on the read loop.
+func (c *Connection) track(id int) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.mu.Lock()
+	c.inflight[id] = cancel
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.inflight, id)
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// respond runs the handler for a request with the context track returned for it and returns its response.
+// The context is cancelled when the connection closes or the peer cancels the request.
+func (c *Connection) respond(ctx context.Context, msg jsonrpcMessage) jsonrpcMessage {
+	resp := jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID}
+	if c.handler == nil {
+		resp.Error = &jsonrpcError{Code: int(types.ErrMethodNotFound), Message: "no handler"}
+		return resp
+	}
+
+	result, err := c.handler(ctx, msg.Method, msg.Params)
 
 	if err != nil {
 		var rpcErr *RPCError
-		if errors.As(err, &rpcErr) {
+		switch {
+		case ctx.Err() != nil && c.ctx.Err() == nil:
+			resp.Error = &jsonrpcError{Code: int(types.ErrRequestCancelled), Message: "request cancelled"}
+		case errors.As(err, &rpcErr):
 			resp.Error = &jsonrpcError{Code: rpcErr.Code, Message: rpcErr.Message}
-		} else {
+		default:
 			resp.Error = &jsonrpcError{Code: int(types.ErrInternalError), Message: err.Error()}
 		}
+		return resp
+	}
+
+	data, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		resp.Error = &jsonrpcError{Code: int(types.ErrInternalError), Message: marshalErr.Error()}
 	} else {
-		data, marshalErr := json.Marshal(result)
-		if marshalErr != nil {
-			resp.Error = &jsonrpcError{Code: int(types.ErrInternalError), Message: marshalErr.Error()}
-		} else {
-			resp.Result = data
-		}
+		resp.Result = data
 	}
+	return resp
+}
 
-	c.writeMessage(resp)
+// cancelInflight cancels the context of the handler serving the request a $/cancel_request names.
+func (c *Connection) cancelInflight(params json.RawMessage) {
+	var notif types.CancelRequestNotification
+	if err := json.Unmarshal(params, &notif); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	cancel, ok := c.inflight[notif.RequestID]
+	c.mu.Unlock()
+	if ok {
+		cancel()
+	}
 }
 
 func (c *Connection) handleNotification(msg jsonrpcMessage) {
@@ -177,14 +304,15 @@ func (c *Connection) handleNotification(msg jsonrpcMessage) {
 	_, _ = c.handler(c.ctx, msg.Method, msg.Params)
 }
 
-func (c *Connection) writeMessage(msg jsonrpcMessage) error {
+// write sends one message, or a batch of them, as a single line.
+func (c *Connection) write(msg any) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("protocol: marshal message: %w", err)
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
 
 	data = append(data, '\n')
 	_, err = c.writer.Write(data)
@@ -194,7 +322,8 @@ func (c *Connection) writeMessage(msg jsonrpcMessage) error {
 	return nil
 }
 
-// Request sends a JSON-RPC request and blocks until a response is received or the context is cancelled.
+// Request sends a JSON-RPC request and blocks until a response is received or the context ends. When the
+// context ends first, for instance at its deadline, the peer is sent a $/cancel_request for the request.
 func (c *Connection) Request(ctx context.Context, method string, params any) (json.RawMessage, error) {
 	c.mu.Lock()
 	c.nextID++
@@ -222,7 +351,7 @@ func (c *Connection) Request(ctx context.Context, method string, params any) (js
 		Params:  rawParams,
 	}
 
-	if err := c.writeMessage(msg); err != nil {
+	if err := c.write(msg); err != nil {
 		c.mu.Lock()
 		delete(c.pending, id)
 		c.mu.Unlock()
@@ -239,7 +368,8 @@ func (c *Connection) Request(ctx context.Context, method string, params any) (js
 		c.mu.Lock()
 		delete(c.pending, id)
 		c.mu.Unlock()
-		return nil, ctx.Err()
+		_ = c.Notify(c.ctx, types.MethodCancelRequest, types.CancelRequestNotification{RequestID: id})
+		return nil, fmt.Errorf("protocol: %s: %w", method, ctx.Err())
 	case <-c.done:
 		return nil, fmt.Errorf("protocol: connection closed")
 	}
@@ -262,7 +392,7 @@ func (c *Connection) Notify(ctx context.Context, method string, params any) erro
 		Params:  rawParams,
 	}
 
-	return c.writeMessage(msg)
+	return c.write(msg)
 }
 
 // Done returns a channel that is closed when the connection's read loop terminates.
@@ -1,10 +1,15 @@
 package protocol
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -270,3 +275,325 @@ func TestNonBlockingDispatch(t *testing.T) {
 
 	wg.Wait()
 }
+
+// rawPeer serves handler on a connection whose peer is driven by hand: lines written to the returned
+// writer arrive at the connection, and its replies are read from the returned reader.
+func rawPeer(t *testing.T, handler MethodHandler) (io.Writer, *bufio.Reader) {
+	t.Helper()
+	serverR, peerW := io.Pipe()
+	peerR, serverW := io.Pipe()
+
+	conn := NewConnection(handler, serverW, serverR)
+	t.Cleanup(func() {
+		conn.Close()
+		peerW.Close()
+	})
+	return peerW, bufio.NewReader(peerR)
+}
+
+func readLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := r.ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		return strings.TrimSpace(line)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func TestCancelRequestCancelsHandler(t *testing.T) {
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+
+	started := make(chan struct{})
+	handlerCancelled := make(chan struct{})
+	serverHandler := func(ctx context.Context, _ string, _ json.RawMessage) (any, error) {
+		close(started)
+		<-ctx.Done()
+		close(handlerCancelled)
+		return nil, ctx.Err()
+	}
+
+	server := NewConnection(serverHandler, serverW, serverR)
+	defer server.Close()
+	client := NewConnection(nil, clientW, clientR)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err := client.Request(ctx, "slow", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+
+	select {
+	case <-handlerCancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler context was not cancelled")
+	}
+	if server.Context().Err() != nil {
+		t.Error("cancelling one request closed the connection")
+	}
+}
+
+func TestCancelledRequestResponse(t *testing.T) {
+	handler := func(ctx context.Context, _ string, _ json.RawMessage) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	w, r := rawPeer(t, handler)
+
+	io.WriteString(w, `{"jsonrpc":"2.0","id":7,"method":"slow"}`+"\n")
+	io.WriteString(w, `{"jsonrpc":"2.0","method":"$/cancel_request","params":{"requestId":7}}`+"\n")
+
+	var resp jsonrpcMessage
+	if err := json.Unmarshal([]byte(readLine(t, r)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID == nil || *resp.ID != 7 || resp.Error == nil || resp.Error.Code != int(types.ErrRequestCancelled) {
+		t.Errorf("response = %+v, want request 7 cancelled with code %d", resp, types.ErrRequestCancelled)
+	}
+}
+
+func TestCancelRequestReadBeforeHandlerStarts(t *testing.T) {
+	handler := func(ctx context.Context, _ string, _ json.RawMessage) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	w, r := rawPeer(t, handler)
+
+	const n = 50
+	var lines strings.Builder
+	for id := 1; id <= n; id++ {
+		fmt.Fprintf(&lines, `{"jsonrpc":"2.0","id":%d,"method":"slow"}`+"\n", id)
+		fmt.Fprintf(&lines, `{"jsonrpc":"2.0","method":"$/cancel_request","params":{"requestId":%d}}`+"\n", id)
+	}
+	io.WriteString(w, lines.String())
+
+	for range n {
+		var resp jsonrpcMessage
+		if err := json.Unmarshal([]byte(readLine(t, r)), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error == nil || resp.Error.Code != int(types.ErrRequestCancelled) {
+			t.Fatalf("response = %+v, want cancelled with code %d", resp, types.ErrRequestCancelled)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+
+	handlerCancelled := make(chan struct{})
+	serverHandler := func(ctx context.Context, _ string, _ json.RawMessage) (any, error) {
+		<-ctx.Done()
+		close(handlerCancelled)
+		return nil, ctx.Err()
+	}
+
+	server := NewConnection(serverHandler, serverW, serverR)
+	defer server.Close()
+	client := NewConnection(nil, clientW, clientR)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.Request(ctx, "slow", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+
+	select {
+	case <-handlerCancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed-out request was not cancelled on the server")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		batch         string
+		wantIDs       []int // 0 marks an invalid request error with a null id
+		notifications int
+	}{
+		{
+			name:    "requests answered in one batch",
+			batch:   `[{"jsonrpc":"2.0","id":1,"method":"echo","params":{"n":1}},{"jsonrpc":"2.0","id":2,"method":"echo","params":{"n":2}}]`,
+			wantIDs: []int{1, 2},
+		},
+		{
+			name:          "notifications get no response",
+			batch:         `[{"jsonrpc":"2.0","method":"note"},{"jsonrpc":"2.0","id":3,"method":"echo","params":{"n":3}},{"jsonrpc":"2.0","method":"note"}]`,
+			wantIDs:       []int{3},
+			notifications: 2,
+		},
+		{
+			name:    "invalid members are answered with errors",
+			batch:   `[1,{"jsonrpc":"2.0","id":4,"method":"echo","params":{"n":4}},"x",{"jsonrpc":"2.0"}]`,
+			wantIDs: []int{0, 4, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var notified atomic.Int32
+			handler := func(_ context.Context, method string, params json.RawMessage) (any, error) {
+				if method == "note" {
+					notified.Add(1)
+					return nil, nil
+				}
+				var m map[string]any
+				json.Unmarshal(params, &m)
+				return m, nil
+			}
+			w, r := rawPeer(t, handler)
+
+			io.WriteString(w, tt.batch+"\n")
+
+			var responses []jsonrpcMessage
+			if err := json.Unmarshal([]byte(readLine(t, r)), &responses); err != nil {
+				t.Fatalf("response is not a batch: %v", err)
+			}
+			if len(responses) != len(tt.wantIDs) {
+				t.Fatalf("got %d responses, want %d", len(responses), len(tt.wantIDs))
+			}
+			for i, resp := range responses {
+				if tt.wantIDs[i] == 0 {
+					if resp.ID != nil || resp.Error == nil || resp.Error.Code != int(types.ErrInvalidRequest) {
+						t.Errorf("response %d = %+v, want null id with code %d", i, resp, types.ErrInvalidRequest)
+					}
+					continue
+				}
+				var m map[string]any
+				json.Unmarshal(resp.Result, &m)
+				if *resp.ID != tt.wantIDs[i] || int(m["n"].(float64)) != tt.wantIDs[i] {
+					t.Errorf("response %d = id %d result %s, want id and n %d", i, *resp.ID, resp.Result, tt.wantIDs[i])
+				}
+			}
+			if got := int(notified.Load()); got != tt.notifications {
+				t.Errorf("handled %d notifications, want %d", got, tt.notifications)
+			}
+		})
+	}
+}
+
+func TestEmptyBatch(t *testing.T) {
+	w, r := rawPeer(t, nil)
+
+	io.WriteString(w, "[]\n")
+
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(readLine(t, r)), &resp); err != nil {
+		t.Fatalf("response is not a single message: %v", err)
+	}
+	var rpcErr jsonrpcError
+	json.Unmarshal(resp["error"], &rpcErr)
+	if string(resp["id"]) != "null" || rpcErr.Code != int(types.ErrInvalidRequest) {
+		t.Errorf("response = %v, want null id with code %d", resp, types.ErrInvalidRequest)
+	}
+}
+
+func TestBatchOfNotificationsHasNoResponse(t *testing.T) {
+	notified := make(chan struct{}, 2)
+	handler := func(_ context.Context, method string, _ json.RawMessage) (any, error) {
+		if method != "c" {
+			notified <- struct{}{}
+		}
+		return nil, nil
+	}
+	w, r := rawPeer(t, handler)
+
+	io.WriteString(w, `[{"jsonrpc":"2.0","method":"a"},{"jsonrpc":"2.0","method":"b"}]`+"\n")
+	io.WriteString(w, `{"jsonrpc":"2.0","id":1,"method":"c"}`+"\n")
+
+	var resp jsonrpcMessage
+	if err := json.Unmarshal([]byte(readLine(t, r)), &resp); err != nil {
+		t.Fatalf("first message is not a single response: %v", err)
+	}
+	if *resp.ID != 1 {
+		t.Errorf("first response id = %d, want 1", *resp.ID)
+	}
+	if len(notified) != 2 {
+		t.Errorf("handled %d notifications, want 2", len(notified))
+	}
+}
+
+func TestInterleavedBidirectionalRequests(t *testing.T) {
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+
+	var server, client *Connection
+
+	// Each "outer" request to the server asks the client for a value, and the client asks the server
+	// for part of it while answering, so requests in both directions are outstanding at once.
+	serverHandler := func(ctx context.Context, method string, params json.RawMessage) (any, error) {
+		var n int
+		json.Unmarshal(params, &n)
+		switch method {
+		case "outer":
+			result, err := server.Request(ctx, "inner", n)
+			if err != nil {
+				return nil, err
+			}
+			var inner int
+			json.Unmarshal(result, &inner)
+			return inner + 1, nil
+		case "leaf":
+			return n * 10, nil
+		}
+		return nil, NewRPCError(types.ErrMethodNotFound, method)
+	}
+	clientHandler := func(ctx context.Context, method string, params json.RawMessage) (any, error) {
+		var n int
+		json.Unmarshal(params, &n)
+		result, err := client.Request(ctx, "leaf", n)
+		if err != nil {
+			return nil, err
+		}
+		var leaf int
+		json.Unmarshal(result, &leaf)
+		return leaf + 100, nil
+	}
+
+	server = newConnection(serverHandler, serverW, serverR)
+	client = newConnection(clientHandler, clientW, clientR)
+	server.Start()
+	client.Start()
+	defer server.Close()
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := client.Request(ctx, "outer", i)
+			if err != nil {
+				t.Errorf("outer %d: %v", i, err)
+				return
+			}
+			var got int
+			json.Unmarshal(result, &got)
+			if want := i*10 + 101; got != want {
+				t.Errorf("outer %d = %d, want %d", i, got, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
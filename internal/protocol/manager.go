@@ -0,0 +1,662 @@
+package protocol
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/agent"
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+)
+
+// SessionManager owns the sessions a daemon has open and their active runs, independent of the connections
+// that opened them. A run keeps going when the client that started it disconnects, and any connection can
+// attach to a session to receive its updates, answer its permission requests or cancel it.
+type SessionManager struct {
+	sessions sync.Map
+}
+
+// NewSessionManager creates an empty SessionManager.
+func NewSessionManager() *SessionManager {
+	return &SessionManager{}
+}
+
+// open registers a session with the given agent and working directory and records conn as one of its
+// openers. A session that is already open keeps its settings, so loading it from another client does not
+// change the agent or directory the other clients' prompts run with; see setCwd.
+func (m *SessionManager) open(sid types.SessionID, agentName string, cwd string, conn *Connection) *sessionState {
+	for {
+		val, _ := m.sessions.LoadOrStore(sid, &sessionState{
+			manager:   m,
+			agentName: agentName,
+			sessionID: core.SessionID(sid),
+			cwd:       cwd,
+		})
+		sess := val.(*sessionState)
+
+		sess.mu.Lock()
+		if sess.closed {
+			sess.mu.Unlock()
+			continue
+		}
+		sess.addOpenerLocked(conn)
+		sess.mu.Unlock()
+		return sess
+	}
+}
+
+func (m *SessionManager) get(sid types.SessionID) (*sessionState, bool) {
+	val, ok := m.sessions.Load(sid)
+	if !ok {
+		return nil, false
+	}
+	return val.(*sessionState), true
+}
+
+// UpdateCommands sends an available_commands_update with the given commands to every connection that
+// opened or attached to one of the open sessions.
+func (m *SessionManager) UpdateCommands(commands []types.Command) {
+	m.sessions.Range(func(_, val any) bool {
+		sess := val.(*sessionState)
+		sess.mu.RLock()
+		conns := sess.subscriberList()
+		for conn := range sess.openers {
+			if _, ok := sess.subscribers[conn]; !ok {
+				conns = append(conns, conn)
+			}
+		}
+		sess.mu.RUnlock()
+
+		update := types.SessionNotification{
+			SessionID: types.SessionID(sess.sessionID),
+			Update:    types.AvailableCommandsUpdate(commands),
+		}
+		for _, conn := range conns {
+			_ = conn.Notify(conn.Context(), types.MethodSessionUpdate, update)
+		}
+		return true
+	})
+}
+
+// Status reports every open session, sorted by ID.
+func (m *SessionManager) Status() []types.SessionStatus {
+	var sessions []types.SessionStatus
+	m.sessions.Range(func(_, val any) bool {
+		sessions = append(sessions, val.(*sessionState).status())
+		return true
+	})
+	slices.SortFunc(sessions, func(a, b types.SessionStatus) int { return cmp.Compare(a.SessionID, b.SessionID) })
+	return sessions
+}
+
+// Running reports whether the session has an active run.
+func (m *SessionManager) Running(sid types.SessionID) bool {
+	sess, ok := m.get(sid)
+	if !ok {
+		return false
+	}
+	sess.mu.RLock()
+	defer sess.mu.RUnlock()
+	return sess.run != nil
+}
+
+// ExternalRun is a session's run started by something other than an ACP client, such as the
+// OpenAI-compatible gateway. The starter answers the run's tool approvals itself and passes every event to
+// Publish, so the run shows in the daemon's status and attached clients follow it and can cancel it.
+type ExternalRun struct {
+	sess *sessionState
+	run  *activeRun
+	once sync.Once
+}
+
+// BeginRun reserves a session for a run, opening it with agentName and cwd unless it is already open.
+// cancelFn is called when a client cancels the run. It fails if the session already has an active run or is
+// open with a different agent.
+func (m *SessionManager) BeginRun(sid types.SessionID, agentName string, cwd string, prompt string, cancelFn context.CancelFunc) (*ExternalRun, error) {
+	for {
+		val, _ := m.sessions.LoadOrStore(sid, &sessionState{
+			manager:   m,
+			agentName: agentName,
+			sessionID: core.SessionID(sid),
+			cwd:       cwd,
+		})
+		sess := val.(*sessionState)
+
+		sess.mu.Lock()
+		if sess.closed {
+			sess.mu.Unlock()
+			continue
+		}
+		if sess.agentName != agentName {
+			sess.mu.Unlock()
+			return nil, NewRPCError(types.ErrInvalidParams, fmt.Sprintf("session is open with agent %q", sess.agentName))
+		}
+		run, err := sess.beginRunLocked(prompt, cancelFn)
+		sess.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return &ExternalRun{sess: sess, run: run}, nil
+	}
+}
+
+// Cwd returns the working directory of the run's session.
+func (r *ExternalRun) Cwd() string {
+	r.sess.mu.RLock()
+	defer r.sess.mu.RUnlock()
+	return r.sess.cwd
+}
+
+// SetCommands gives the run's command channel to the session, so clients can cancel the run.
+func (r *ExternalRun) SetCommands(commandCh chan<- agent.Command) {
+	r.sess.setCommands(r.run, commandCh)
+}
+
+// Publish sends the updates an event carries to the attached clients, and ends the run on a terminal event.
+func (r *ExternalRun) Publish(event agent.Event) {
+	resp, done, err := r.sess.publishEvent(event)
+	if done {
+		r.end(resp, err)
+	}
+}
+
+// End frees the session if Publish has not already seen the run end.
+func (r *ExternalRun) End() {
+	r.end(types.PromptResponse{StopReason: types.StopReasonEndTurn}, nil)
+}
+
+func (r *ExternalRun) end(resp types.PromptResponse, err error) {
+	r.once.Do(func() { r.sess.endRun(r.run, resp, err) })
+}
+
+// sessionState is an open session: its settings, the run in progress if any, and the attached connections.
+// replay holds the notifications of the run's current turn so a connection attaching mid-turn can catch up.
+// subscribers maps each attached connection to whether it may answer permission requests. openers holds
+// the connections that created or loaded the session, which are told when the available commands change.
+// Once it has no run and no connections left it is closed and removed from its manager. deliverMu orders
+// what is sent to the subscribers, so a connection's replay reaches it before any later update.
+type sessionState struct {
+	manager         *SessionManager
+	deliverMu       sync.Mutex
+	mu              sync.RWMutex
+	closed          bool
+	agentName       string
+	sessionID       core.SessionID
+	cwd             string
+	run             *activeRun
+	subscribers     map[*Connection]bool
+	openers         map[*Connection]struct{}
+	replay          []notification
+	permissions     map[*pendingPermission]struct{}
+	tokensPerSecond float64
+}
+
+// activeRun is a session's run in progress. resp and err are set before done is closed. state and tool
+// say what the run is doing; toolNames maps the calls proposed so far to their tools. turnStart, firstToken
+// and deltas measure the current turn's generation rate.
+type activeRun struct {
+	prompt    string
+	commandCh chan<- agent.Command
+	cancelFn  context.CancelFunc
+	done      chan struct{}
+	resp      types.PromptResponse
+	err       error
+
+	state      types.RunState
+	tool       string
+	toolNames  map[string]string
+	turnStart  time.Time
+	firstToken time.Time
+	deltas     int
+}
+
+type notification struct {
+	method string
+	params any
+}
+
+// beginRun reserves the session for a new run, failing if one is already in progress or the session has
+// been closed.
+func (s *sessionState) beginRun(prompt string, cancelFn context.CancelFunc) (*activeRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beginRunLocked(prompt, cancelFn)
+}
+
+func (s *sessionState) beginRunLocked(prompt string, cancelFn context.CancelFunc) (*activeRun, error) {
+	if s.closed {
+		return nil, NewRPCError(types.ErrNotFound, "session not found")
+	}
+	if s.run != nil {
+		return nil, NewRPCError(types.ErrInvalidParams, "session already has an active run")
+	}
+	s.run = &activeRun{
+		prompt:    prompt,
+		cancelFn:  cancelFn,
+		done:      make(chan struct{}),
+		state:     types.RunStateGenerating,
+		toolNames: make(map[string]string),
+		turnStart: time.Now(),
+	}
+	s.replay = nil
+	return s.run, nil
+}
+
+// setCwd changes the working directory later runs use. It fails while a run is in progress.
+func (s *sessionState) setCwd(cwd string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.run != nil {
+		return NewRPCError(types.ErrInvalidParams, "session has an active run")
+	}
+	s.cwd = cwd
+	return nil
+}
+
+func (s *sessionState) setCommands(run *activeRun, commandCh chan<- agent.Command) {
+	s.mu.Lock()
+	run.commandCh = commandCh
+	s.mu.Unlock()
+}
+
+// endRun records the run's outcome, frees the session for the next run and tells attached clients.
+func (s *sessionState) endRun(run *activeRun, resp types.PromptResponse, err error) {
+	s.mu.Lock()
+	run.resp = resp
+	run.err = err
+	run.commandCh = nil
+	if s.run == run {
+		s.run = nil
+		s.replay = nil
+	}
+	conns := s.subscriberList()
+	s.releaseLocked()
+	s.mu.Unlock()
+
+	close(run.done)
+	run.cancelFn()
+
+	ended := types.RunEndedNotification{SessionID: types.SessionID(s.sessionID), StopReason: resp.StopReason}
+	if err != nil {
+		ended = types.RunEndedNotification{SessionID: ended.SessionID, Error: err.Error()}
+	}
+	for _, conn := range conns {
+		_ = conn.Notify(conn.Context(), types.MethodKontekstRunEnded, ended)
+	}
+}
+
+// cancel asks the active run to stop and abandons its pending permission requests.
+func (s *sessionState) cancel() {
+	s.sendCommand(agent.Command{Type: agent.CmdCancel})
+
+	s.mu.RLock()
+	run := s.run
+	s.mu.RUnlock()
+	if run != nil {
+		run.cancelFn()
+	}
+}
+
+func (s *sessionState) sendCommand(cmd agent.Command) bool {
+	s.mu.RLock()
+	run := s.run
+	var ch chan<- agent.Command
+	if run != nil {
+		ch = run.commandCh
+	}
+	s.mu.RUnlock()
+
+	if ch == nil {
+		return false
+	}
+	select {
+	case ch <- cmd:
+		return true
+	case <-run.done:
+		return false
+	}
+}
+
+// attach subscribes conn to the session. It replays the current turn and, if conn may approve tools,
+// re-sends pending permission requests to it before any later update. It returns the run in progress, if
+// any, and false when the session has been closed.
+func (s *sessionState) attach(conn *Connection, canApprove bool) (types.AttachSessionResponse, bool) {
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return types.AttachSessionResponse{}, false
+	}
+	resp := types.AttachSessionResponse{SessionID: types.SessionID(s.sessionID), Agent: s.agentName}
+	if s.run != nil {
+		resp.Running = true
+		resp.Prompt = s.run.prompt
+	}
+
+	var replay []notification
+	var permissions []*pendingPermission
+	if s.subscribeLocked(conn, canApprove) {
+		replay = slices.Clone(s.replay)
+		if canApprove {
+			permissions = slices.Collect(maps.Keys(s.permissions))
+		}
+	}
+	s.mu.Unlock()
+
+	for _, n := range replay {
+		_ = conn.Notify(conn.Context(), n.method, n.params)
+	}
+	for _, p := range permissions {
+		go p.ask(conn)
+	}
+	return resp, true
+}
+
+func (s *sessionState) subscribe(conn *Connection, canApprove bool) {
+	s.mu.Lock()
+	s.subscribeLocked(conn, canApprove)
+	s.mu.Unlock()
+}
+
+// subscribeLocked adds conn to the subscribers and reports whether it was new. The connection is
+// dropped again when it closes.
+func (s *sessionState) subscribeLocked(conn *Connection, canApprove bool) bool {
+	if _, ok := s.subscribers[conn]; ok {
+		return false
+	}
+	if s.subscribers == nil {
+		s.subscribers = make(map[*Connection]bool)
+	}
+	s.subscribers[conn] = canApprove
+
+	go func() {
+		<-conn.Done()
+		s.detach(conn)
+	}()
+	return true
+}
+
+// addOpenerLocked records that conn created or loaded the session, until the connection closes.
+func (s *sessionState) addOpenerLocked(conn *Connection) {
+	if conn == nil {
+		return
+	}
+	if _, ok := s.openers[conn]; ok {
+		return
+	}
+	if s.openers == nil {
+		s.openers = make(map[*Connection]struct{})
+	}
+	s.openers[conn] = struct{}{}
+
+	go func() {
+		<-conn.Done()
+		s.mu.Lock()
+		delete(s.openers, conn)
+		s.releaseLocked()
+		s.mu.Unlock()
+	}()
+}
+
+func (s *sessionState) detach(conn *Connection) {
+	s.mu.Lock()
+	delete(s.subscribers, conn)
+	s.releaseLocked()
+	s.mu.Unlock()
+}
+
+// releaseLocked closes the session and removes it from its manager once it has no run, subscribers or
+// openers left.
+func (s *sessionState) releaseLocked() {
+	if s.closed || s.run != nil || len(s.subscribers) > 0 || len(s.openers) > 0 {
+		return
+	}
+	s.closed = true
+	if s.manager != nil {
+		s.manager.sessions.CompareAndDelete(types.SessionID(s.sessionID), s)
+	}
+}
+
+func (s *sessionState) subscriberList() []*Connection {
+	return slices.Collect(maps.Keys(s.subscribers))
+}
+
+// approverList returns the subscribers that may answer permission requests.
+func (s *sessionState) approverList() []*Connection {
+	var conns []*Connection
+	for conn, canApprove := range s.subscribers {
+		if canApprove {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// publish sends a notification to every attached connection, keeping it for replay while a run is active.
+func (s *sessionState) publish(method string, params any) {
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+
+	s.mu.Lock()
+	if s.run != nil {
+		s.replay = append(s.replay, notification{method: method, params: params})
+	}
+	conns := s.subscriberList()
+	s.mu.Unlock()
+
+	for _, conn := range conns {
+		_ = conn.Notify(conn.Context(), method, params)
+	}
+}
+
+func (s *sessionState) sendUpdate(update any) {
+	s.publish(types.MethodSessionUpdate, types.SessionNotification{
+		SessionID: types.SessionID(s.sessionID),
+		Update:    update,
+	})
+}
+
+// startTurn drops the replay of the previous turn once the agent moves on to the next one.
+func (s *sessionState) startTurn() {
+	s.mu.Lock()
+	s.replay = nil
+	if run := s.run; run != nil {
+		run.state = types.RunStateGenerating
+		run.tool = ""
+		run.turnStart = time.Now()
+		run.firstToken = time.Time{}
+		run.deltas = 0
+	}
+	s.mu.Unlock()
+}
+
+// countDelta records a streamed token or reasoning chunk of the current turn.
+func (s *sessionState) countDelta() {
+	s.mu.Lock()
+	if run := s.run; run != nil {
+		if run.firstToken.IsZero() {
+			run.firstToken = time.Now()
+		}
+		run.deltas++
+	}
+	s.mu.Unlock()
+}
+
+// endTurn records the generation rate of the turn that just completed: the completion tokens the provider
+// reported, or the streamed chunks when it reported none, over the time since the first chunk arrived.
+func (s *sessionState) endTurn(completionTokens int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := s.run
+	if run == nil {
+		return
+	}
+	start := run.firstToken
+	if start.IsZero() {
+		start = run.turnStart
+	}
+	tokens := completionTokens
+	if tokens <= 0 {
+		tokens = run.deltas
+	}
+	if elapsed := time.Since(start).Seconds(); tokens > 0 && elapsed > 0 {
+		s.tokensPerSecond = float64(tokens) / elapsed
+	}
+}
+
+// nameTools remembers the tool of each proposed call so a call that starts executing can be reported by name.
+func (s *sessionState) nameTools(calls []agent.ProposedToolCall) {
+	s.mu.Lock()
+	if run := s.run; run != nil {
+		for _, call := range calls {
+			run.toolNames[call.CallID] = call.Name
+		}
+	}
+	s.mu.Unlock()
+}
+
+// executeTool records that the run is executing the given call.
+func (s *sessionState) executeTool(callID string) {
+	s.mu.Lock()
+	if run := s.run; run != nil {
+		run.state = types.RunStateExecutingTool
+		run.tool = run.toolNames[callID]
+	}
+	s.mu.Unlock()
+}
+
+// awaitApproval records that the run waits for a tool call to be approved, and returns a function that
+// restores what the run was doing before.
+func (s *sessionState) awaitApproval(tool string) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := s.run
+	if run == nil {
+		return func() {}
+	}
+	state, previous := run.state, run.tool
+	run.state = types.RunStateAwaitingApproval
+	run.tool = tool
+	return func() {
+		s.mu.Lock()
+		run.state = state
+		run.tool = previous
+		s.mu.Unlock()
+	}
+}
+
+// status reports the session's state for _kontekst/status.
+func (s *sessionState) status() types.SessionStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := len(s.subscribers)
+	for conn := range s.openers {
+		if _, ok := s.subscribers[conn]; !ok {
+			clients++
+		}
+	}
+	status := types.SessionStatus{
+		SessionID:       types.SessionID(s.sessionID),
+		Agent:           s.agentName,
+		State:           types.RunStateIdle,
+		Clients:         clients,
+		TokensPerSecond: s.tokensPerSecond,
+	}
+	if run := s.run; run != nil {
+		status.State = run.state
+		status.Tool = run.tool
+		status.Prompt = run.prompt
+	}
+	return status
+}
+
+// requestPermission sends a permission request to every attached connection that may approve tools,
+// including ones that attach while it is pending, and returns the first answer. The requests still open on other connections are
+// cancelled. It waits for a client to attach when none is, until ctx is cancelled.
+func (s *sessionState) requestPermission(ctx context.Context, req types.RequestPermissionRequest) (types.RequestPermissionResponse, error) {
+	permCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := &pendingPermission{req: req, ctx: permCtx, answer: make(chan permissionAnswer, 1)}
+
+	var tool string
+	if req.ToolCall.Title != nil {
+		tool = *req.ToolCall.Title
+	}
+	defer s.awaitApproval(tool)()
+
+	s.mu.Lock()
+	if s.permissions == nil {
+		s.permissions = make(map[*pendingPermission]struct{})
+	}
+	s.permissions[p] = struct{}{}
+	conns := s.approverList()
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.permissions, p)
+		s.mu.Unlock()
+	}()
+
+	for _, conn := range conns {
+		go p.ask(conn)
+	}
+
+	select {
+	case answer := <-p.answer:
+		return answer.resp, answer.err
+	case <-ctx.Done():
+		return types.RequestPermissionResponse{}, fmt.Errorf("protocol: request permission: %w", ctx.Err())
+	}
+}
+
+type pendingPermission struct {
+	req    types.RequestPermissionRequest
+	ctx    context.Context
+	answer chan permissionAnswer
+}
+
+type permissionAnswer struct {
+	resp types.RequestPermissionResponse
+	err  error
+}
+
+// ask sends the request to one connection. A connection that closes before answering is ignored so another
+// client can still answer; an error response from a live client counts as its answer.
+func (p *pendingPermission) ask(conn *Connection) {
+	result, err := conn.Request(p.ctx, types.MethodRequestPermission, p.req)
+	if p.ctx.Err() != nil {
+		return
+	}
+
+	var answer permissionAnswer
+	switch {
+	case err != nil:
+		if conn.Context().Err() != nil {
+			return
+		}
+		answer.err = fmt.Errorf("protocol: request permission: %w", err)
+	default:
+		if err := json.Unmarshal(result, &answer.resp); err != nil {
+			answer.err = fmt.Errorf("protocol: unmarshal permission response: %w", err)
+		}
+	}
+
+	select {
+	case p.answer <- answer:
+	default:
+	}
+}
@@ -0,0 +1,605 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/agent"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+	"github.com/erg0nix/kontekst/internal/provider"
+)
+
+// chanRunner streams the events the test sends and passes on every command the server sends back.
+type chanRunner struct {
+	eventCh  chan agent.Event
+	commands chan agent.Command
+}
+
+func newChanRunner() *chanRunner {
+	return &chanRunner{eventCh: make(chan agent.Event, 32), commands: make(chan agent.Command, 16)}
+}
+
+func (r *chanRunner) StartRun(_ agent.RunConfig) (chan<- agent.Command, <-chan agent.Event, error) {
+	cmdCh := make(chan agent.Command, 16)
+	go func() {
+		for cmd := range cmdCh {
+			r.commands <- cmd
+		}
+	}()
+	return cmdCh, r.eventCh, nil
+}
+
+func (r *chanRunner) waitCommand(t *testing.T) agent.Command {
+	t.Helper()
+	select {
+	case cmd := <-r.commands:
+		return cmd
+	case <-time.After(2 * time.Second):
+		t.Fatal("no command received")
+		return agent.Command{}
+	}
+}
+
+// testClient is a connection to a handler sharing the test's session manager, recording what it receives.
+type testClient struct {
+	conn       *Connection
+	updates    chan types.SessionNotification
+	ended      chan types.RunEndedNotification
+	permission func(context.Context, types.RequestPermissionRequest) (any, error)
+}
+
+func connectClient(t *testing.T, runner agent.Runner, sessions *SessionManager) *testClient {
+	t.Helper()
+
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+
+	handler := NewHandler(runner, testRegistry(t), nil, sessions)
+	serverConn := handler.Serve(serverW, serverR)
+
+	c := &testClient{
+		updates: make(chan types.SessionNotification, 32),
+		ended:   make(chan types.RunEndedNotification, 4),
+	}
+	c.conn = NewConnection(c.dispatch, clientW, clientR)
+
+	t.Cleanup(func() {
+		serverConn.Close()
+		c.conn.Close()
+	})
+
+	if _, err := c.conn.Request(context.Background(), types.MethodInitialize, types.InitializeRequest{ProtocolVersion: 1}); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	return c
+}
+
+func (c *testClient) dispatch(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case types.MethodSessionUpdate:
+		var notif types.SessionNotification
+		json.Unmarshal(params, &notif)
+		c.updates <- notif
+	case types.MethodKontekstRunEnded:
+		var notif types.RunEndedNotification
+		json.Unmarshal(params, &notif)
+		c.ended <- notif
+	case types.MethodRequestPermission:
+		var req types.RequestPermissionRequest
+		json.Unmarshal(params, &req)
+		if c.permission != nil {
+			return c.permission(ctx, req)
+		}
+	}
+	return nil, nil
+}
+
+func (c *testClient) newSession(t *testing.T) types.SessionID {
+	t.Helper()
+	result, err := c.conn.Request(context.Background(), types.MethodSessionNew, types.NewSessionRequest{Cwd: "/tmp", McpServers: []types.McpServer{}})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	var resp types.NewSessionResponse
+	json.Unmarshal(result, &resp)
+	return resp.SessionID
+}
+
+func (c *testClient) prompt(t *testing.T, sid types.SessionID, detach bool) types.PromptResponse {
+	t.Helper()
+	req := types.PromptRequest{SessionID: sid, Prompt: []types.ContentBlock{types.TextBlock("fix the build")}}
+	if detach {
+		req.Meta = &types.PromptMeta{Kontekst: types.PromptExtension{Detach: true}}
+	}
+	result, err := c.conn.Request(context.Background(), types.MethodSessionPrompt, req)
+	if err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+	var resp types.PromptResponse
+	json.Unmarshal(result, &resp)
+	return resp
+}
+
+func (c *testClient) attach(t *testing.T, sid types.SessionID) types.AttachSessionResponse {
+	t.Helper()
+	result, err := c.conn.Request(context.Background(), types.MethodKontekstSessionAttach, types.AttachSessionRequest{SessionID: sid})
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+	var resp types.AttachSessionResponse
+	json.Unmarshal(result, &resp)
+	return resp
+}
+
+func (c *testClient) waitText(t *testing.T) string {
+	t.Helper()
+	select {
+	case notif := <-c.updates:
+		m, _ := notif.Update.(map[string]any)
+		content, _ := m["content"].(map[string]any)
+		text, _ := content["text"].(string)
+		return text
+	case <-time.After(2 * time.Second):
+		t.Fatal("no update received")
+		return ""
+	}
+}
+
+func (c *testClient) waitEnded(t *testing.T) types.RunEndedNotification {
+	t.Helper()
+	select {
+	case notif := <-c.ended:
+		return notif
+	case <-time.After(2 * time.Second):
+		t.Fatal("run_ended not received")
+		return types.RunEndedNotification{}
+	}
+}
+
+func TestSessionManager_DetachedRunSurvivesDisconnect(t *testing.T) {
+	runner := newChanRunner()
+	sessions := NewSessionManager()
+
+	starter := connectClient(t, runner, sessions)
+	sid := starter.newSession(t)
+
+	resp := starter.prompt(t, sid, true)
+	if !resp.Detached() {
+		t.Fatalf("prompt response = %+v, want detached", resp)
+	}
+
+	runner.eventCh <- agent.Event{Type: agent.EvtTokenDelta, Token: "first "}
+	if got := starter.waitText(t); got != "first " {
+		t.Errorf("starter update = %q, want %q", got, "first ")
+	}
+
+	starter.conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	watcher := connectClient(t, runner, sessions)
+	attached := watcher.attach(t, sid)
+	if !attached.Running || attached.Prompt != "fix the build" {
+		t.Errorf("attach = %+v, want the running prompt", attached)
+	}
+	if got := watcher.waitText(t); got != "first " {
+		t.Errorf("replayed update = %q, want %q", got, "first ")
+	}
+
+	runner.eventCh <- agent.Event{Type: agent.EvtTokenDelta, Token: "second"}
+	if got := watcher.waitText(t); got != "second" {
+		t.Errorf("live update = %q, want %q", got, "second")
+	}
+
+	runner.eventCh <- agent.Event{Type: agent.EvtRunCompleted}
+	if ended := watcher.waitEnded(t); ended.StopReason != types.StopReasonEndTurn {
+		t.Errorf("run_ended = %+v, want end_turn", ended)
+	}
+
+	select {
+	case cmd := <-runner.commands:
+		t.Errorf("run received %v after the client disconnected", cmd.Type)
+	default:
+	}
+}
+
+func TestSessionManager_ReplayOnlyCoversCurrentTurn(t *testing.T) {
+	runner := newChanRunner()
+	sessions := NewSessionManager()
+
+	starter := connectClient(t, runner, sessions)
+	sid := starter.newSession(t)
+	starter.prompt(t, sid, true)
+
+	runner.eventCh <- agent.Event{Type: agent.EvtTokenDelta, Token: "old turn"}
+	runner.eventCh <- agent.Event{Type: agent.EvtToolsCompleted}
+	runner.eventCh <- agent.Event{Type: agent.EvtTokenDelta, Token: "new turn"}
+	starter.waitText(t)
+	starter.waitText(t)
+
+	watcher := connectClient(t, runner, sessions)
+	watcher.attach(t, sid)
+	if got := watcher.waitText(t); got != "new turn" {
+		t.Errorf("replayed update = %q, want %q", got, "new turn")
+	}
+
+	runner.eventCh <- agent.Event{Type: agent.EvtRunCompleted}
+	watcher.waitEnded(t)
+}
+
+func TestSessionManager_FirstPermissionAnswerWins(t *testing.T) {
+	runner := newChanRunner()
+	sessions := NewSessionManager()
+
+	starter := connectClient(t, runner, sessions)
+	sid := starter.newSession(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	starter.permission = func(context.Context, types.RequestPermissionRequest) (any, error) {
+		<-release
+		return types.RequestPermissionResponse{Outcome: types.PermissionSelected("reject")}, nil
+	}
+
+	watcher := connectClient(t, runner, sessions)
+	watcher.permission = func(context.Context, types.RequestPermissionRequest) (any, error) {
+		return types.RequestPermissionResponse{Outcome: types.PermissionSelected("allow")}, nil
+	}
+
+	starter.prompt(t, sid, true)
+	watcher.attach(t, sid)
+
+	runner.eventCh <- agent.Event{Type: agent.EvtToolsProposed, Calls: []agent.ProposedToolCall{
+		{CallID: "call_1", Name: "write_file", ArgumentsJSON: `{"path":"a.go"}`},
+	}}
+
+	if cmd := runner.waitCommand(t); cmd.Type != agent.CmdApproveTool || cmd.CallID != "call_1" {
+		t.Errorf("command = %+v, want approval of call_1", cmd)
+	}
+
+	runner.eventCh <- agent.Event{Type: agent.EvtRunCompleted}
+	watcher.waitEnded(t)
+
+	select {
+	case cmd := <-runner.commands:
+		t.Errorf("late answer produced command %+v", cmd)
+	default:
+	}
+}
+
+func TestSessionManager_PermissionWaitsForAttach(t *testing.T) {
+	runner := newChanRunner()
+	sessions := NewSessionManager()
+
+	starter := connectClient(t, runner, sessions)
+	sid := starter.newSession(t)
+	starter.prompt(t, sid, true)
+	starter.conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	runner.eventCh <- agent.Event{Type: agent.EvtToolsProposed, Calls: []agent.ProposedToolCall{
+		{CallID: "call_1", Name: "run_command", ArgumentsJSON: `{"command":"make"}`},
+	}}
+	time.Sleep(50 * time.Millisecond)
+
+	watcher := connectClient(t, runner, sessions)
+	watcher.permission = func(context.Context, types.RequestPermissionRequest) (any, error) {
+		return types.RequestPermissionResponse{Outcome: types.PermissionSelected("reject")}, nil
+	}
+	watcher.attach(t, sid)
+
+	if cmd := runner.waitCommand(t); cmd.Type != agent.CmdDenyTool || cmd.CallID != "call_1" {
+		t.Errorf("command = %+v, want denial of call_1", cmd)
+	}
+
+	runner.eventCh <- agent.Event{Type: agent.EvtRunCompleted}
+	watcher.waitEnded(t)
+}
+
+func TestSessionManager_CancelFromAnotherConnection(t *testing.T) {
+	runner := newChanRunner()
+	sessions := NewSessionManager()
+
+	starter := connectClient(t, runner, sessions)
+	sid := starter.newSession(t)
+
+	promptDone := make(chan types.PromptResponse, 1)
+	go func() { promptDone <- starter.prompt(t, sid, false) }()
+	time.Sleep(50 * time.Millisecond)
+
+	other := connectClient(t, runner, sessions)
+	other.conn.Notify(context.Background(), types.MethodSessionCancel, types.CancelNotification{SessionID: sid})
+
+	if cmd := runner.waitCommand(t); cmd.Type != agent.CmdCancel {
+		t.Fatalf("command = %v, want cancel", cmd.Type)
+	}
+	runner.eventCh <- agent.Event{Type: agent.EvtRunCancelled}
+
+	select {
+	case resp := <-promptDone:
+		if resp.StopReason != types.StopReasonCancelled {
+			t.Errorf("stopReason = %v, want cancelled", resp.StopReason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("prompt did not return after cancel")
+	}
+}
+
+func TestSessionManager_RejectsConcurrentPrompt(t *testing.T) {
+	runner := newChanRunner()
+	sessions := NewSessionManager()
+
+	client := connectClient(t, runner, sessions)
+	sid := client.newSession(t)
+	client.prompt(t, sid, true)
+
+	_, err := client.conn.Request(context.Background(), types.MethodSessionPrompt, types.PromptRequest{
+		SessionID: sid,
+		Prompt:    []types.ContentBlock{types.TextBlock("again")},
+	})
+	if err == nil {
+		t.Fatal("second prompt succeeded while a run was active")
+	}
+
+	runner.eventCh <- agent.Event{Type: agent.EvtRunCompleted}
+	client.waitEnded(t)
+}
+
+func TestSessionManager_AttachUnknownSession(t *testing.T) {
+	client := connectClient(t, newChanRunner(), NewSessionManager())
+
+	_, err := client.conn.Request(context.Background(), types.MethodKontekstSessionAttach, types.AttachSessionRequest{SessionID: "sess_missing"})
+	if err == nil {
+		t.Fatal("attach to an unknown session succeeded")
+	}
+}
+
+func TestSessionManager_UpdateCommands(t *testing.T) {
+	sessions := NewSessionManager()
+	opener := connectClient(t, newChanRunner(), sessions)
+	attached := connectClient(t, newChanRunner(), sessions)
+	other := connectClient(t, newChanRunner(), sessions)
+
+	sid := opener.newSession(t)
+	attached.attach(t, sid)
+
+	sessions.UpdateCommands([]types.Command{{Name: "summarize", Description: "Summarize a file"}})
+
+	for name, client := range map[string]*testClient{"opener": opener, "attached": attached} {
+		select {
+		case notif := <-client.updates:
+			update, _ := notif.Update.(map[string]any)
+			commands, _ := update["availableCommands"].([]any)
+			if notif.SessionID != sid || update["sessionUpdate"] != "available_commands_update" || len(commands) != 1 {
+				t.Errorf("%s got %+v, want the new commands for %s", name, notif, sid)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s received no commands update", name)
+		}
+	}
+
+	select {
+	case notif := <-other.updates:
+		t.Errorf("unrelated connection got %+v", notif)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// waitStatus polls the manager until the session's status satisfies ok.
+func waitStatus(t *testing.T, sessions *SessionManager, sid types.SessionID, ok func(types.SessionStatus) bool) types.SessionStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var status types.SessionStatus
+		for _, s := range sessions.Status() {
+			if s.SessionID == sid {
+				status = s
+			}
+		}
+		if ok(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %+v, condition not met", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSessionManager_Status(t *testing.T) {
+	runner := newChanRunner()
+	sessions := NewSessionManager()
+
+	client := connectClient(t, runner, sessions)
+	sid := client.newSession(t)
+
+	waitStatus(t, sessions, sid, func(s types.SessionStatus) bool {
+		return s.State == types.RunStateIdle && s.Agent == "default" && s.Clients == 1
+	})
+
+	approve := make(chan struct{})
+	client.permission = func(context.Context, types.RequestPermissionRequest) (any, error) {
+		<-approve
+		return types.RequestPermissionResponse{Outcome: types.PermissionSelected("allow")}, nil
+	}
+	client.prompt(t, sid, true)
+	waitStatus(t, sessions, sid, func(s types.SessionStatus) bool {
+		return s.State == types.RunStateGenerating && s.Prompt == "fix the build"
+	})
+
+	runner.eventCh <- agent.Event{Type: agent.EvtToolsProposed, Calls: []agent.ProposedToolCall{
+		{CallID: "call_1", Name: "write_file", ArgumentsJSON: `{"path":"a.go"}`},
+	}}
+	waitStatus(t, sessions, sid, func(s types.SessionStatus) bool {
+		return s.State == types.RunStateAwaitingApproval && s.Tool == "write_file"
+	})
+	close(approve)
+	runner.waitCommand(t)
+
+	runner.eventCh <- agent.Event{Type: agent.EvtToolStarted, CallID: "call_1"}
+	waitStatus(t, sessions, sid, func(s types.SessionStatus) bool {
+		return s.State == types.RunStateExecutingTool && s.Tool == "write_file"
+	})
+
+	runner.eventCh <- agent.Event{Type: agent.EvtToolsCompleted}
+	runner.eventCh <- agent.Event{Type: agent.EvtTokenDelta, Token: "done"}
+	time.Sleep(20 * time.Millisecond)
+	runner.eventCh <- agent.Event{Type: agent.EvtTurnCompleted, Response: provider.Response{Usage: &provider.Usage{CompletionTokens: 40}}}
+	status := waitStatus(t, sessions, sid, func(s types.SessionStatus) bool {
+		return s.State == types.RunStateGenerating && s.Tool == "" && s.TokensPerSecond > 0
+	})
+	if status.TokensPerSecond > 2000 {
+		t.Errorf("tokensPerSecond = %f, want 40 tokens over at least 20ms", status.TokensPerSecond)
+	}
+
+	runner.eventCh <- agent.Event{Type: agent.EvtRunCompleted}
+	client.waitEnded(t)
+	waitStatus(t, sessions, sid, func(s types.SessionStatus) bool {
+		return s.State == types.RunStateIdle && s.TokensPerSecond == status.TokensPerSecond
+	})
+}
+
+// waitOpen polls the manager until whether it holds the session matches want.
+func waitOpen(t *testing.T, sessions *SessionManager, sid types.SessionID, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := sessions.get(sid); ok == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session %s open = %v, want %v", sid, !want, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSessionManager_RemovesIdleSessions(t *testing.T) {
+	runner := newChanRunner()
+	sessions := NewSessionManager()
+
+	opener := connectClient(t, runner, sessions)
+	watcher := connectClient(t, runner, sessions)
+	sid := opener.newSession(t)
+	watcher.attach(t, sid)
+
+	opener.conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	waitOpen(t, sessions, sid, true)
+
+	if _, err := watcher.conn.Request(context.Background(), types.MethodKontekstSessionDetach, types.DetachSessionRequest{SessionID: sid}); err != nil {
+		t.Fatalf("detach failed: %v", err)
+	}
+	waitOpen(t, sessions, sid, false)
+
+	starter := connectClient(t, runner, sessions)
+	sid = starter.newSession(t)
+	starter.prompt(t, sid, true)
+	starter.conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	waitOpen(t, sessions, sid, true)
+
+	runner.eventCh <- agent.Event{Type: agent.EvtRunCompleted}
+	waitOpen(t, sessions, sid, false)
+
+	reopened := connectClient(t, runner, sessions)
+	if _, err := reopened.conn.Request(context.Background(), types.MethodSessionLoad, types.LoadSessionRequest{SessionID: sid, Cwd: "/tmp", McpServers: []types.McpServer{}}); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	waitOpen(t, sessions, sid, true)
+}
+
+func TestSessionManager_LoadKeepsSettings(t *testing.T) {
+	sessions := NewSessionManager()
+	editor := connectClient(t, newChanRunner(), sessions)
+	other := connectClient(t, newChanRunner(), sessions)
+	sid := types.SessionID("sess_shared")
+
+	load := func(c *testClient, cwd string) {
+		t.Helper()
+		if _, err := c.conn.Request(context.Background(), types.MethodSessionLoad, types.LoadSessionRequest{SessionID: sid, Cwd: cwd, McpServers: []types.McpServer{}}); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+	}
+	cwd := func() string {
+		sess, ok := sessions.get(sid)
+		if !ok {
+			t.Fatal("session is not open")
+		}
+		sess.mu.RLock()
+		defer sess.mu.RUnlock()
+		return sess.cwd
+	}
+
+	load(editor, "/src/app")
+	load(other, "/home/me")
+	if got := cwd(); got != "/src/app" {
+		t.Errorf("cwd after a second load = %q, want /src/app", got)
+	}
+
+	if _, err := other.conn.Request(context.Background(), types.MethodSessionSetConfig, types.SetSessionConfigOptionRequest{SessionID: sid, ConfigID: "cwd", Value: "/src/lib"}); err != nil {
+		t.Fatalf("set_config_option failed: %v", err)
+	}
+	if got := cwd(); got != "/src/lib" {
+		t.Errorf("cwd after set_config_option = %q, want /src/lib", got)
+	}
+
+	if _, err := other.conn.Request(context.Background(), types.MethodSessionSetConfig, types.SetSessionConfigOptionRequest{SessionID: sid, ConfigID: "cwd", Value: "relative"}); err == nil {
+		t.Error("set_config_option accepted a relative cwd")
+	}
+}
+
+func TestSessionManager_ExternalRun(t *testing.T) {
+	sessions := NewSessionManager()
+	sid := types.SessionID("sess_gateway")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run, err := sessions.BeginRun(sid, "default", "/src/app", "fix the build", cancel)
+	if err != nil {
+		t.Fatalf("begin run failed: %v", err)
+	}
+	commands := make(chan agent.Command, 1)
+	run.SetCommands(commands)
+
+	if _, err := sessions.BeginRun(sid, "default", "/src/app", "again", func() {}); err == nil {
+		t.Error("a second run began while the first was active")
+	}
+	if status := sessions.Status(); len(status) != 1 || status[0].State != types.RunStateGenerating || status[0].Prompt != "fix the build" {
+		t.Errorf("status = %+v, want one generating session", status)
+	}
+
+	client := connectClient(t, newChanRunner(), sessions)
+	if resp := client.attach(t, sid); !resp.Running {
+		t.Error("attach did not report the run")
+	}
+	run.Publish(agent.Event{Type: agent.EvtTurnCompleted, Response: provider.Response{Content: "on it"}})
+	if text := client.waitText(t); text != "on it" {
+		t.Errorf("update = %q, want on it", text)
+	}
+
+	client.conn.Notify(context.Background(), types.MethodSessionCancel, types.CancelNotification{SessionID: sid})
+	select {
+	case cmd := <-commands:
+		if cmd.Type != agent.CmdCancel {
+			t.Errorf("command = %v, want cancel", cmd.Type)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the run was not sent a cancel")
+	}
+	<-ctx.Done()
+
+	run.Publish(agent.Event{Type: agent.EvtRunCancelled})
+	if ended := client.waitEnded(t); ended.StopReason != types.StopReasonCancelled {
+		t.Errorf("stopReason = %v, want cancelled", ended.StopReason)
+	}
+	run.End()
+	if sessions.Running(sid) {
+		t.Error("session still running after the run ended")
+	}
+
+	if _, err := sessions.BeginRun(sid, "other", "/src/app", "hi", func() {}); err == nil {
+		t.Error("a run began with a different agent than the open session's")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package protocol
+
+import "net"
+
+// peerUID is not available on this platform; the socket's file permissions are the only check.
+func peerUID(_ *net.UnixConn) (int, error) {
+	return 0, errPeerCredUnsupported
+}
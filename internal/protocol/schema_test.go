@@ -131,6 +131,25 @@ func TestSchemaSessionUpdates(t *testing.T) {
 		assertSchemaValid(t, "SessionUpdate", types.AgentThoughtChunk("thinking..."))
 	})
 
+	t.Run("HookOutput", func(t *testing.T) {
+		assertSchemaValid(t, "SessionUpdate", types.HookOutput("post_tool_use", "gofmt: ok"))
+	})
+
+	t.Run("LoopNotice", func(t *testing.T) {
+		assertSchemaValid(t, "SessionUpdate", types.LoopNotice("stopped", "read_file called 3 times with the same arguments"))
+	})
+
+	t.Run("Plan", func(t *testing.T) {
+		assertSchemaValid(t, "SessionUpdate", types.PlanUpdate([]types.PlanEntry{
+			{Content: "Read the code", Priority: "high", Status: "completed"},
+			{Content: "Fix the bug", Priority: "medium", Status: "in_progress"},
+		}))
+	})
+
+	t.Run("EmptyPlan", func(t *testing.T) {
+		assertSchemaValid(t, "SessionUpdate", types.PlanUpdate(nil))
+	})
+
 	t.Run("ToolCall", func(t *testing.T) {
 		assertSchemaValid(t, "SessionUpdate", types.ToolCallStart(
 			"call_1",
@@ -159,6 +178,14 @@ func TestSchemaSessionUpdates(t *testing.T) {
 		))
 	})
 
+	t.Run("ToolCallUpdate/EditedInput", func(t *testing.T) {
+		assertSchemaValid(t, "SessionUpdate", types.ToolCallInputUpdate(
+			"call_1",
+			map[string]any{"path": "internal/x.go"},
+			map[string]any{"diff": "+line"},
+		))
+	})
+
 	t.Run("ToolCallUpdate/InProgressNoContent", func(t *testing.T) {
 		assertSchemaValid(t, "SessionUpdate", types.ToolCallUpdate(
 			"call_1",
@@ -201,6 +228,21 @@ func TestSchemaPermission(t *testing.T) {
 		})
 	})
 
+	t.Run("RequestPermissionRequest/InvalidEdit", func(t *testing.T) {
+		assertSchemaValid(t, "RequestPermissionRequest", types.RequestPermissionRequest{
+			SessionID: "sess_1",
+			ToolCall: types.ToolCallDetail{
+				ToolCallID: "call_1",
+				Title:      ptrTo("write_file"),
+				RawInput:   map[string]any{"path": "/tmp/config.json"},
+			},
+			Options: []types.PermissionOption{
+				{OptionID: "allow", Name: "Allow", Kind: types.PermissionOptionKindAllowOnce},
+			},
+			Meta: &types.PermissionMeta{Kontekst: types.PermissionExtension{Error: "invalid arguments: at '/path': got number, want string"}},
+		})
+	})
+
 	t.Run("RequestPermissionRequest/WithPreview", func(t *testing.T) {
 		assertSchemaValid(t, "RequestPermissionRequest", types.RequestPermissionRequest{
 			SessionID: "sess_1",
@@ -234,6 +276,20 @@ func TestSchemaPermission(t *testing.T) {
 		})
 	})
 
+	t.Run("RequestPermissionResponse/EditedArguments", func(t *testing.T) {
+		assertSchemaValid(t, "RequestPermissionResponse", types.RequestPermissionResponse{
+			Outcome: types.PermissionSelected("allow"),
+			Meta:    &types.PermissionMeta{Kontekst: types.PermissionExtension{Arguments: map[string]any{"path": "internal/x.go"}}},
+		})
+	})
+
+	t.Run("RequestPermissionResponse/Feedback", func(t *testing.T) {
+		assertSchemaValid(t, "RequestPermissionResponse", types.RequestPermissionResponse{
+			Outcome: types.PermissionSelected("reject"),
+			Meta:    &types.PermissionMeta{Kontekst: types.PermissionExtension{Feedback: "use a table test"}},
+		})
+	})
+
 	t.Run("RequestPermissionResponse/Cancelled", func(t *testing.T) {
 		assertSchemaValid(t, "RequestPermissionResponse", types.RequestPermissionResponse{
 			Outcome: types.PermissionCancelled(),
@@ -270,6 +326,18 @@ func TestSchemaRequests(t *testing.T) {
 		})
 	})
 
+	t.Run("PromptRequest/Rewind", func(t *testing.T) {
+		temperature := 0.2
+		assertSchemaValid(t, "PromptRequest", types.PromptRequest{
+			SessionID: "sess_1",
+			Prompt:    []types.ContentBlock{},
+			Meta: &types.PromptMeta{Kontekst: types.PromptExtension{
+				Rewind:   1,
+				Sampling: &types.SamplingOverride{Temperature: &temperature},
+			}},
+		})
+	})
+
 	t.Run("CancelNotification", func(t *testing.T) {
 		assertSchemaValid(t, "CancelNotification", types.CancelNotification{
 			SessionID: "sess_1",
@@ -1,71 +1,96 @@
 package protocol
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"path/filepath"
+	"slices"
 	"strings"
-	"sync"
+	"sync/atomic"
 
 	"github.com/erg0nix/kontekst/internal/agent"
+	"github.com/erg0nix/kontekst/internal/auth"
 	agentConfig "github.com/erg0nix/kontekst/internal/config/agent"
 	"github.com/erg0nix/kontekst/internal/core"
 	"github.com/erg0nix/kontekst/internal/protocol/types"
 	"github.com/erg0nix/kontekst/internal/skill"
+	"github.com/erg0nix/kontekst/internal/tool"
 )
 
-// Handler is the server-side ACP request handler that manages sessions and routes agent events.
+// Handler is the server-side ACP request handler for one connection. It opens sessions in a
+// [SessionManager] shared with the daemon's other connections and routes agent events to them.
 type Handler struct {
 	runner   agent.Runner
 	registry *agent.Registry
 	skills   *skill.Registry
 	conn     *Connection
-	sessions sync.Map
+	sessions *SessionManager
 	caps     types.ClientCapabilities
+	tokens   TokenVerifier
+	token    atomic.Pointer[auth.Token]
+	client   atomic.Pointer[types.Implementation]
 }
 
-// NewHandler creates a Handler with the given agent runner, registry, and skills registry.
-func NewHandler(runner agent.Runner, registry *agent.Registry, skillsRegistry *skill.Registry) *Handler {
+// NewHandler creates a Handler with the given agent runner, registry, skills registry and session manager.
+// A nil manager gives the handler sessions of its own, as when serving a single client over stdio.
+func NewHandler(runner agent.Runner, registry *agent.Registry, skillsRegistry *skill.Registry, sessions *SessionManager) *Handler {
+	if sessions == nil {
+		sessions = NewSessionManager()
+	}
 	return &Handler{
 		runner:   runner,
 		registry: registry,
 		skills:   skillsRegistry,
+		sessions: sessions,
 	}
 }
 
-// Serve creates a Connection using the handler's default dispatch and returns it.
+// Serve creates a Connection using the handler's default dispatch and returns it. The connection starts
+// reading only once the handler holds it, so early requests never see it unset.
 func (h *Handler) Serve(w io.Writer, r io.Reader) *Connection {
-	conn := NewConnection(h.Dispatch, w, r)
+	conn := newConnection(h.authorized(h.Dispatch), w, r)
 	h.conn = conn
+	conn.Start()
 	return conn
 }
 
-// ServeWith creates a Connection using a custom dispatch function and returns it.
+// ServeWith creates a Connection using a custom dispatch function and returns it. Methods are checked
+// against the connection's token before dispatch when the handler requires authentication.
 func (h *Handler) ServeWith(dispatch MethodHandler, w io.Writer, r io.Reader) *Connection {
-	conn := NewConnection(dispatch, w, r)
+	conn := newConnection(h.authorized(dispatch), w, r)
 	h.conn = conn
+	conn.Start()
 	return conn
 }
 
+// ClientInfo returns the name and version the client sent in its initialize request, or nil if it sent none.
+func (h *Handler) ClientInfo() *types.Implementation {
+	return h.client.Load()
+}
+
 // Dispatch routes an incoming JSON-RPC method call to the appropriate handler.
 //
 // ACP: Client → Server methods:
 //
 //	"initialize"          → [handleInitialize]  — protocol handshake
-//	"authenticate"        → no-op               — reserved for future auth
+//	"authenticate"        → [handleAuthenticate] — present a token
 //	"session/new"         → [handleNewSession]   — create session
 //	"session/load"        → [handleLoadSession]  — resume session
 //	"session/prompt"      → [handlePrompt]       — run agent loop (long-lived)
 //	"session/cancel"      → [handleCancel]       — cancel active prompt (notification)
 //	"session/set_mode"    → no-op stub
-//	"session/set_config"  → no-op stub
+//	"session/set_config"  → [handleSetConfig]    — change the session's working directory
+//	"_kontekst/session/attach" → [handleAttach]  — receive a session's updates
+//	"_kontekst/session/detach" → [handleDetach]  — stop receiving them
 func (h *Handler) Dispatch(ctx context.Context, method string, params json.RawMessage) (any, error) {
 	switch method {
 	case types.MethodInitialize:
 		return h.handleInitialize(ctx, params)
 	case types.MethodAuthenticate:
-		return types.AuthenticateResponse{}, nil
+		return h.handleAuthenticate(params)
 	case types.MethodSessionNew:
 		return h.handleNewSession(ctx, params)
 	case types.MethodSessionLoad:
@@ -78,7 +103,11 @@ func (h *Handler) Dispatch(ctx context.Context, method string, params json.RawMe
 	case types.MethodSessionSetMode:
 		return types.SetSessionModeResponse{}, nil
 	case types.MethodSessionSetConfig:
-		return types.SetSessionConfigOptionResponse{ConfigOptions: []types.SessionConfigOption{}}, nil
+		return h.handleSetConfig(params)
+	case types.MethodKontekstSessionAttach:
+		return h.handleAttach(params)
+	case types.MethodKontekstSessionDetach:
+		return h.handleDetach(params)
 	default:
 		if strings.HasPrefix(method, "_") {
 			return nil, NewRPCError(types.ErrMethodNotFound, fmt.Sprintf("unknown extension: %s", method))
@@ -103,6 +132,9 @@ func (h *Handler) handleInitialize(_ context.Context, params json.RawMessage) (t
 	}
 
 	h.caps = req.ClientCapabilities
+	if req.ClientInfo != nil {
+		h.client.Store(req.ClientInfo)
+	}
 
 	return types.InitializeResponse{
 		ProtocolVersion: types.ProtocolVersion,
@@ -114,7 +146,7 @@ func (h *Handler) handleInitialize(_ context.Context, params json.RawMessage) (t
 			Title:   "Kontekst",
 			Version: "0.1.0",
 		},
-		AuthMethods: []types.AuthMethod{},
+		AuthMethods: h.authMethods(),
 	}, nil
 }
 
@@ -124,7 +156,8 @@ func (h *Handler) handleInitialize(_ context.Context, params json.RawMessage) (t
 // Request:  [types.NewSessionRequest] — working directory, MCP servers, and optional agent name in _meta.
 // Response: [types.NewSessionResponse] — the new session ID.
 //
-// Also pushes an available_commands_update notification if skills are registered.
+// Also pushes an available_commands_update notification if skills are registered, and again to the
+// connection whenever the daemon reloads them.
 func (h *Handler) handleNewSession(ctx context.Context, params json.RawMessage) (types.NewSessionResponse, error) {
 	var req types.NewSessionRequest
 	if err := json.Unmarshal(params, &req); err != nil {
@@ -140,28 +173,32 @@ func (h *Handler) handleNewSession(ctx context.Context, params json.RawMessage)
 
 	sid := types.SessionID(core.NewSessionID())
 
-	h.sessions.Store(sid, &sessionState{
-		agentName: agentName,
-		sessionID: core.SessionID(sid),
-		cwd:       req.Cwd,
-	})
+	h.sessions.open(sid, agentName, req.Cwd, h.conn)
 
-	if h.skills != nil {
-		var commands []types.Command
-		for _, s := range h.skills.ModelInvocableSkills() {
-			commands = append(commands, types.Command{Name: s.Name, Description: s.Description})
-		}
-		if len(commands) > 0 {
-			_ = h.conn.Notify(ctx, types.MethodSessionUpdate, types.SessionNotification{
-				SessionID: sid,
-				Update:    types.AvailableCommandsUpdate(commands),
-			})
-		}
+	if commands := AvailableCommands(h.skills); len(commands) > 0 {
+		_ = h.conn.Notify(ctx, types.MethodSessionUpdate, types.SessionNotification{
+			SessionID: sid,
+			Update:    types.AvailableCommandsUpdate(commands),
+		})
 	}
 
 	return types.NewSessionResponse{SessionID: sid}, nil
 }
 
+// AvailableCommands returns the skills offered to clients as slash commands: every skill the model may
+// invoke. A nil registry has none.
+func AvailableCommands(skills *skill.Registry) []types.Command {
+	if skills == nil {
+		return nil
+	}
+	var commands []types.Command
+	for _, s := range skills.ModelInvocableSkills() {
+		commands = append(commands, types.Command{Name: s.Name, Description: s.Description})
+	}
+	slices.SortFunc(commands, func(a, b types.Command) int { return cmp.Compare(a.Name, b.Name) })
+	return commands
+}
+
 // handleLoadSession resumes an existing session by ID.
 //
 // ACP: "session/load"
@@ -173,13 +210,7 @@ func (h *Handler) handleLoadSession(_ context.Context, params json.RawMessage) (
 		return types.LoadSessionResponse{}, NewRPCError(types.ErrInvalidParams, err.Error())
 	}
 
-	agentName := agentConfig.DefaultAgentName
-
-	h.sessions.Store(req.SessionID, &sessionState{
-		agentName: agentName,
-		sessionID: core.SessionID(req.SessionID),
-		cwd:       req.Cwd,
-	})
+	h.sessions.open(req.SessionID, agentConfig.DefaultAgentName, req.Cwd, h.conn)
 
 	return types.LoadSessionResponse{SessionID: req.SessionID}, nil
 }
@@ -193,20 +224,28 @@ func (h *Handler) handleLoadSession(_ context.Context, params json.RawMessage) (
 // This is a long-lived request. While the agent runs, the server streams
 // session/update notifications (text chunks, tool calls, tool results) and
 // may send session/request_permission requests back to the client.
-// The response is returned only when the agent loop completes.
+// The response is returned only when the agent loop completes, unless _meta.kontekst.detach asks for it
+// as soon as the run has started. The run belongs to the session rather than the connection: it keeps
+// going if the client disconnects, and its updates reach every client attached to the session.
 func (h *Handler) handlePrompt(ctx context.Context, params json.RawMessage) (types.PromptResponse, error) {
 	var req types.PromptRequest
 	if err := json.Unmarshal(params, &req); err != nil {
 		return types.PromptResponse{}, NewRPCError(types.ErrInvalidParams, err.Error())
 	}
 
-	val, ok := h.sessions.Load(req.SessionID)
+	sess, ok := h.sessions.get(req.SessionID)
 	if !ok {
 		return types.PromptResponse{}, NewRPCError(types.ErrNotFound, "session not found")
 	}
-	sess := val.(*sessionState)
 
 	promptText := extractText(req.Prompt)
+	ext := req.Extension()
+	if ext.Rewind < 0 {
+		return types.PromptResponse{}, NewRPCError(types.ErrInvalidParams, "rewind must not be negative")
+	}
+	if ext.Rewind > 0 && strings.TrimSpace(promptText) != "" {
+		return types.PromptResponse{}, NewRPCError(types.ErrInvalidParams, "rewind re-runs the previous user message and cannot take a new prompt")
+	}
 
 	var skill *skill.Skill
 	var skillContent string
@@ -225,169 +264,251 @@ func (h *Handler) handlePrompt(ctx context.Context, params json.RawMessage) (typ
 		}
 	}
 
-	agentCfg, err := h.registry.Load(sess.agentName)
+	sess.mu.RLock()
+	agentName, cwd := sess.agentName, sess.cwd
+	sess.mu.RUnlock()
+
+	agentCfg, err := h.registry.Load(agentName)
 	if err != nil {
 		return types.PromptResponse{}, NewRPCError(types.ErrInvalidParams, err.Error())
 	}
 
-	runCtx, cancelFn := context.WithCancel(ctx)
-
 	runCfg := agent.RunConfig{
 		Prompt:              promptText,
 		SessionID:           sess.sessionID,
-		AgentName:           sess.agentName,
+		AgentName:           agentName,
 		AgentSystemPrompt:   agentCfg.SystemPrompt,
 		ContextSize:         agentCfg.ContextSize,
-		Sampling:            agentCfg.Sampling,
+		Sampling:            OverrideSampling(agentCfg.Sampling, ext.Sampling),
 		ProviderEndpoint:    agentCfg.Provider.Endpoint,
 		ProviderModel:       agentCfg.Provider.Model,
 		ProviderHTTPTimeout: agentCfg.Provider.HTTPTimeout,
-		WorkingDir:          sess.cwd,
+		WorkingDir:          cwd,
 		Skill:               skill,
 		SkillContent:        skillContent,
 		ToolRole:            agentCfg.ToolRole,
+		Hooks:               agentCfg.Hooks,
+		LoopDetection:       agentCfg.LoopDetection,
+		Rewind:              ext.Rewind,
 	}
 
-	if hasACPTools(h.caps) {
+	switch {
+	case !h.allows(auth.ScopeTools):
+		runCfg.Tools = tool.NewRegistry()
+	case hasACPTools(h.caps):
 		runCfg.Tools = NewToolExecutor(h.conn, req.SessionID, h.caps)
 	}
 
-	commandCh, eventCh, err := h.runner.StartRun(runCfg)
+	runCtx, cancelFn := context.WithCancel(context.Background())
+	run, err := sess.beginRun(promptText, cancelFn)
 	if err != nil {
 		cancelFn()
+		return types.PromptResponse{}, err
+	}
+	sess.subscribe(h.conn, h.allows(auth.ScopeTools))
+
+	commandCh, eventCh, err := h.runner.StartRun(runCfg)
+	if err != nil {
+		sess.endRun(run, types.PromptResponse{}, err)
 		return types.PromptResponse{}, NewRPCError(types.ErrInternalError, err.Error())
 	}
+	sess.setCommands(run, commandCh)
+
+	go h.forwardEvents(runCtx, req.SessionID, sess, run, eventCh)
+
+	if ext.Detach {
+		return types.PromptResponse{Meta: &types.PromptResponseMeta{Kontekst: types.PromptResponseExtension{Detached: true}}}, nil
+	}
+
+	select {
+	case <-run.done:
+		return run.resp, run.err
+	case <-ctx.Done():
+		return types.PromptResponse{StopReason: types.StopReasonCancelled}, nil
+	}
+}
 
-	sess.mu.Lock()
-	sess.cancelFn = cancelFn
-	sess.commandCh = commandCh
-	sess.doneCh = make(chan struct{})
-	sess.mu.Unlock()
+// OverrideSampling returns the agent's sampling configuration with any per-run overrides applied. The base
+// configuration is never modified.
+func OverrideSampling(base *core.SamplingConfig, override *types.SamplingOverride) *core.SamplingConfig {
+	if override == nil {
+		return base
+	}
 
-	return h.forwardEvents(runCtx, req.SessionID, sess, eventCh)
+	var merged core.SamplingConfig
+	if base != nil {
+		merged = *base
+	}
+	if override.Temperature != nil {
+		merged.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		merged.TopP = override.TopP
+	}
+	if override.TopK != nil {
+		merged.TopK = override.TopK
+	}
+	if override.RepeatPenalty != nil {
+		merged.RepeatPenalty = override.RepeatPenalty
+	}
+	if override.MaxTokens != nil {
+		merged.MaxTokens = override.MaxTokens
+	}
+	return &merged
 }
 
-func (h *Handler) forwardEvents(ctx context.Context, sid types.SessionID, sess *sessionState, eventCh <-chan agent.Event) (types.PromptResponse, error) {
-	defer func() {
-		sess.mu.Lock()
-		if sess.doneCh != nil {
-			close(sess.doneCh)
+// forwardEvents publishes the run's events to the session until the run ends, then records its outcome.
+// ctx is cancelled when a client cancels the run.
+func (h *Handler) forwardEvents(ctx context.Context, sid types.SessionID, sess *sessionState, run *activeRun, eventCh <-chan agent.Event) {
+	for event := range eventCh {
+		resp, done, err := h.processEvent(ctx, sid, sess, event)
+		if done || err != nil {
+			sess.endRun(run, resp, err)
+			return
 		}
-		if sess.cancelFn != nil {
-			sess.cancelFn()
+	}
+	sess.endRun(run, types.PromptResponse{StopReason: types.StopReasonEndTurn}, nil)
+}
+
+func (h *Handler) processEvent(ctx context.Context, sid types.SessionID, sess *sessionState, event agent.Event) (types.PromptResponse, bool, error) {
+	resp, done, err := sess.publishEvent(event)
+	if event.Type != agent.EvtToolsProposed {
+		return resp, done, err
+	}
+
+	for _, call := range event.Calls {
+		if call.Approved {
+			continue
 		}
-		sess.commandCh = nil
-		sess.cancelFn = nil
-		sess.doneCh = nil
-		sess.mu.Unlock()
-	}()
-
-	for {
-		select {
-		case event, ok := <-eventCh:
-			if !ok {
-				return types.PromptResponse{StopReason: types.StopReasonEndTurn}, nil
-			}
+		kind := types.ToolKindFromName(call.Name)
 
-			resp, done, err := h.processEvent(ctx, sid, sess, event)
-			if err != nil {
-				return types.PromptResponse{}, err
-			}
-			if done {
-				return resp, nil
-			}
+		options := []types.PermissionOption{
+			{OptionID: "allow", Name: "Allow", Kind: types.PermissionOptionKindAllowOnce},
+			{OptionID: "reject", Name: "Reject", Kind: types.PermissionOptionKindRejectOnce},
+		}
 
-		case <-h.conn.Done():
-			sess.sendCommand(agent.Command{Type: agent.CmdCancel})
-			return types.PromptResponse{StopReason: types.StopReasonCancelled}, nil
+		permResp, err := requestPermission(ctx, sid, sess, call, kind, options)
+		if err != nil {
+			sess.sendCommand(agent.Command{Type: agent.CmdDenyTool, CallID: call.CallID, Reason: "permission request failed"})
+			continue
+		}
 
-		case <-ctx.Done():
-			sess.sendCommand(agent.Command{Type: agent.CmdCancel})
-			return types.PromptResponse{StopReason: types.StopReasonCancelled}, nil
+		ext := permResp.Extension()
+		switch {
+		case outcomeIsAllowed(permResp.Outcome, options):
+			sess.sendCommand(agent.Command{Type: agent.CmdApproveTool, CallID: call.CallID, Arguments: ext.Arguments})
+		case permResp.Outcome.Outcome == "selected" && ext.Feedback != "":
+			sess.sendCommand(agent.Command{Type: agent.CmdRejectTool, CallID: call.CallID, Feedback: ext.Feedback})
+		default:
+			reason := "denied by user"
+			if permResp.Outcome.Outcome == "cancelled" {
+				reason = "cancelled"
+			}
+			sess.sendCommand(agent.Command{Type: agent.CmdDenyTool, CallID: call.CallID, Reason: reason})
 		}
 	}
+	return resp, done, err
 }
 
-func (h *Handler) processEvent(ctx context.Context, sid types.SessionID, sess *sessionState, event agent.Event) (types.PromptResponse, bool, error) {
+// publishEvent sends the updates an event carries to the session's clients and records what the run is
+// doing. It reports the run's outcome once the event ends the run.
+func (s *sessionState) publishEvent(event agent.Event) (types.PromptResponse, bool, error) {
 	switch event.Type {
 	case agent.EvtRunStarted:
 		return types.PromptResponse{}, false, nil
 
 	case agent.EvtTokenDelta:
-		h.sendUpdate(ctx, sid, types.AgentMessageChunk(event.Token))
+		s.countDelta()
+		s.sendUpdate(types.AgentMessageChunk(event.Token))
 		return types.PromptResponse{}, false, nil
 
 	case agent.EvtReasoningDelta:
-		h.sendUpdate(ctx, sid, types.AgentThoughtChunk(event.Reasoning))
+		s.countDelta()
+		s.sendUpdate(types.AgentThoughtChunk(event.Reasoning))
 		return types.PromptResponse{}, false, nil
 
 	case agent.EvtTurnCompleted:
+		if usage := event.Response.Usage; usage != nil {
+			s.endTurn(usage.CompletionTokens)
+		} else {
+			s.endTurn(0)
+		}
 		if event.Response.Reasoning != "" {
-			h.sendUpdate(ctx, sid, types.AgentThoughtChunk(event.Response.Reasoning))
+			s.sendUpdate(types.AgentThoughtChunk(event.Response.Reasoning))
 		}
 		if event.Response.Content != "" {
-			h.sendUpdate(ctx, sid, types.AgentMessageChunk(event.Response.Content))
+			s.sendUpdate(types.AgentMessageChunk(event.Response.Content))
 		}
 		if event.Snapshot != nil {
-			_ = h.conn.Notify(ctx, types.MethodKontekstContext, event.Snapshot)
+			s.publish(types.MethodKontekstContext, event.Snapshot)
 		}
 		return types.PromptResponse{}, false, nil
 
 	case agent.EvtToolsProposed:
+		s.nameTools(event.Calls)
 		for _, call := range event.Calls {
 			rawInput := parseRawInput(call.ArgumentsJSON)
 			kind := types.ToolKindFromName(call.Name)
-			h.sendUpdate(ctx, sid, types.ToolCallStart(
-				types.ToolCallID(call.CallID),
-				call.Name,
-				kind,
-				nil,
-				rawInput,
-			))
-
-			options := []types.PermissionOption{
-				{OptionID: "allow", Name: "Allow", Kind: types.PermissionOptionKindAllowOnce},
-				{OptionID: "reject", Name: "Reject", Kind: types.PermissionOptionKindRejectOnce},
-			}
-
-			permResp, err := h.requestPermission(ctx, sid, call, kind, options)
-			if err != nil {
-				sess.sendCommand(agent.Command{Type: agent.CmdDenyTool, CallID: call.CallID, Reason: "permission request failed"})
-				continue
+			if call.Error == "" {
+				s.sendUpdate(types.ToolCallStart(
+					types.ToolCallID(call.CallID),
+					call.Name,
+					kind,
+					nil,
+					rawInput,
+				))
 			}
+		}
+		return types.PromptResponse{}, false, nil
 
-			if outcomeIsAllowed(permResp.Outcome, options) {
-				sess.sendCommand(agent.Command{Type: agent.CmdApproveTool, CallID: call.CallID})
-			} else {
-				reason := "denied by user"
-				if permResp.Outcome.Outcome == "cancelled" {
-					reason = "cancelled"
-				}
-				sess.sendCommand(agent.Command{Type: agent.CmdDenyTool, CallID: call.CallID, Reason: reason})
-			}
+	case agent.EvtToolEdited:
+		for _, call := range event.Calls {
+			s.sendUpdate(types.ToolCallInputUpdate(
+				types.ToolCallID(call.CallID),
+				parseRawInput(call.ArgumentsJSON),
+				parsePreview(call.Preview),
+			))
 		}
 		return types.PromptResponse{}, false, nil
 
 	case agent.EvtToolStarted:
-		h.sendUpdate(ctx, sid, types.ToolCallUpdate(types.ToolCallID(event.CallID), types.ToolCallStatusInProgress, nil, nil))
+		s.executeTool(event.CallID)
+		s.sendUpdate(types.ToolCallUpdate(types.ToolCallID(event.CallID), types.ToolCallStatusInProgress, nil, nil))
 		return types.PromptResponse{}, false, nil
 
 	case agent.EvtToolCompleted:
 		content := []types.ToolCallContent{types.TextToolContent(event.Output)}
-		h.sendUpdate(ctx, sid, types.ToolCallUpdate(types.ToolCallID(event.CallID), types.ToolCallStatusCompleted, content, map[string]any{"content": event.Output}))
+		s.sendUpdate(types.ToolCallUpdate(types.ToolCallID(event.CallID), types.ToolCallStatusCompleted, content, map[string]any{"content": event.Output}))
 		return types.PromptResponse{}, false, nil
 
 	case agent.EvtToolFailed:
 		content := []types.ToolCallContent{types.TextToolContent(event.Error)}
-		h.sendUpdate(ctx, sid, types.ToolCallUpdate(types.ToolCallID(event.CallID), types.ToolCallStatusFailed, content, map[string]any{"error": event.Error}))
+		s.sendUpdate(types.ToolCallUpdate(types.ToolCallID(event.CallID), types.ToolCallStatusFailed, content, map[string]any{"error": event.Error}))
 		return types.PromptResponse{}, false, nil
 
 	case agent.EvtToolsCompleted:
+		s.startTurn()
+		return types.PromptResponse{}, false, nil
+
+	case agent.EvtHookOutput:
+		s.sendUpdate(types.HookOutput(event.HookEvent, event.Output))
+		return types.PromptResponse{}, false, nil
+
+	case agent.EvtPlanUpdated:
+		s.sendUpdate(types.PlanUpdate(planEntries(event.Plan)))
+		return types.PromptResponse{}, false, nil
+
+	case agent.EvtLoopDetected:
+		s.sendUpdate(types.LoopNotice("warning", event.Output))
 		return types.PromptResponse{}, false, nil
 
 	case agent.EvtRunCompleted:
 		return types.PromptResponse{StopReason: types.StopReasonEndTurn}, true, nil
 
+	case agent.EvtRunStopped:
+		s.sendUpdate(types.LoopNotice("stopped", event.Error))
+		return types.PromptResponse{StopReason: types.StopReasonMaxTurnRequests}, true, nil
+
 	case agent.EvtRunCancelled:
 		return types.PromptResponse{StopReason: types.StopReasonCancelled}, true, nil
 
@@ -398,16 +519,9 @@ func (h *Handler) processEvent(ctx context.Context, sid types.SessionID, sess *s
 	return types.PromptResponse{}, false, nil
 }
 
-func (h *Handler) requestPermission(ctx context.Context, sid types.SessionID, call agent.ProposedToolCall, kind types.ToolKind, options []types.PermissionOption) (types.RequestPermissionResponse, error) {
+func requestPermission(ctx context.Context, sid types.SessionID, sess *sessionState, call agent.ProposedToolCall, kind types.ToolKind, options []types.PermissionOption) (types.RequestPermissionResponse, error) {
 	status := types.ToolCallStatusPending
 
-	var previewData any
-	if call.Preview != "" {
-		if err := json.Unmarshal([]byte(call.Preview), &previewData); err != nil {
-			previewData = nil
-		}
-	}
-
 	req := types.RequestPermissionRequest{
 		SessionID: sid,
 		ToolCall: types.ToolCallDetail{
@@ -416,48 +530,15 @@ func (h *Handler) requestPermission(ctx context.Context, sid types.SessionID, ca
 			Kind:       &kind,
 			Status:     &status,
 			RawInput:   parseRawInput(call.ArgumentsJSON),
-			Preview:    previewData,
+			Preview:    parsePreview(call.Preview),
 		},
 		Options: options,
 	}
-
-	result, err := h.conn.Request(ctx, types.MethodRequestPermission, req)
-	if err != nil {
-		return types.RequestPermissionResponse{}, fmt.Errorf("protocol: request permission: %w", err)
-	}
-
-	var resp types.RequestPermissionResponse
-	if err := json.Unmarshal(result, &resp); err != nil {
-		return types.RequestPermissionResponse{}, fmt.Errorf("protocol: unmarshal permission response: %w", err)
+	if call.Error != "" {
+		req.Meta = &types.PermissionMeta{Kontekst: types.PermissionExtension{Error: call.Error}}
 	}
-	return resp, nil
-}
-
-type sessionState struct {
-	mu        sync.RWMutex
-	agentName string
-	sessionID core.SessionID
-	cwd       string
-	commandCh chan<- agent.Command
-	cancelFn  context.CancelFunc
-	doneCh    chan struct{}
-}
 
-func (s *sessionState) sendCommand(cmd agent.Command) bool {
-	s.mu.RLock()
-	ch := s.commandCh
-	done := s.doneCh
-	s.mu.RUnlock()
-
-	if ch == nil {
-		return false
-	}
-	select {
-	case ch <- cmd:
-		return true
-	case <-done:
-		return false
-	}
+	return sess.requestPermission(ctx, req)
 }
 
 func outcomeIsAllowed(outcome types.PermissionOutcome, options []types.PermissionOption) bool {
@@ -472,7 +553,7 @@ func outcomeIsAllowed(outcome types.PermissionOutcome, options []types.Permissio
 	return false
 }
 
-// handleCancel stops the active agent run in a session.
+// handleCancel stops the active agent run in a session, whichever connection started it.
 //
 // ACP: "session/cancel" (notification — no response)
 // Params: [types.CancelNotification] — the session ID to cancel.
@@ -482,20 +563,90 @@ func (h *Handler) handleCancel(params json.RawMessage) {
 		return
 	}
 
-	val, ok := h.sessions.Load(notif.SessionID)
+	sess, ok := h.sessions.get(notif.SessionID)
 	if !ok {
 		return
 	}
-	sess := val.(*sessionState)
+	sess.cancel()
+}
+
+// cwdConfigID is the session configuration option holding the working directory of the session's runs.
+const cwdConfigID = "cwd"
+
+// handleSetConfig changes a session configuration option. The only option is the working directory,
+// which an open session otherwise keeps from whichever client opened it first.
+//
+// ACP: "session/set_config_option"
+// Request:  [types.SetSessionConfigOptionRequest] — configId "cwd" and an absolute path.
+// Response: [types.SetSessionConfigOptionResponse] — the session's options after the change.
+func (h *Handler) handleSetConfig(params json.RawMessage) (types.SetSessionConfigOptionResponse, error) {
+	var req types.SetSessionConfigOptionRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return types.SetSessionConfigOptionResponse{}, NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+	if req.ConfigID != cwdConfigID {
+		return types.SetSessionConfigOptionResponse{}, NewRPCError(types.ErrInvalidParams, fmt.Sprintf("unknown config option %q", req.ConfigID))
+	}
+	if !filepath.IsAbs(req.Value) {
+		return types.SetSessionConfigOptionResponse{}, NewRPCError(types.ErrInvalidParams, "cwd must be an absolute path")
+	}
+
+	sess, ok := h.sessions.get(req.SessionID)
+	if !ok {
+		return types.SetSessionConfigOptionResponse{}, NewRPCError(types.ErrNotFound, "session is not open in the server")
+	}
+	if err := sess.setCwd(req.Value); err != nil {
+		return types.SetSessionConfigOptionResponse{}, err
+	}
 
-	sess.sendCommand(agent.Command{Type: agent.CmdCancel})
+	return types.SetSessionConfigOptionResponse{ConfigOptions: []types.SessionConfigOption{{
+		ID:         cwdConfigID,
+		Label:      "Working directory",
+		Values:     []types.SessionConfigOptionValue{{ID: req.Value, Label: req.Value}},
+		SelectedID: req.Value,
+	}}}, nil
 }
 
-func (h *Handler) sendUpdate(ctx context.Context, sid types.SessionID, update any) {
-	_ = h.conn.Notify(ctx, types.MethodSessionUpdate, types.SessionNotification{
-		SessionID: sid,
-		Update:    update,
-	})
+// handleAttach subscribes the connection to a session's updates.
+//
+// Extension: "_kontekst/session/attach"
+// Request:  [types.AttachSessionRequest] — the session to attach to.
+// Response: [types.AttachSessionResponse] — whether a run is active, and its prompt.
+//
+// Before responding, the updates of the run's current turn are replayed and any pending permission
+// request is sent to the connection. Later updates, permission requests and a final
+// _kontekst/session/run_ended notification follow until the connection detaches or closes.
+func (h *Handler) handleAttach(params json.RawMessage) (types.AttachSessionResponse, error) {
+	var req types.AttachSessionRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return types.AttachSessionResponse{}, NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+
+	sess, ok := h.sessions.get(req.SessionID)
+	if !ok {
+		return types.AttachSessionResponse{}, NewRPCError(types.ErrNotFound, "session is not open in the server")
+	}
+	resp, ok := sess.attach(h.conn, h.allows(auth.ScopeTools))
+	if !ok {
+		return types.AttachSessionResponse{}, NewRPCError(types.ErrNotFound, "session is not open in the server")
+	}
+	return resp, nil
+}
+
+// handleDetach stops the connection receiving a session's updates. The session's run is not affected.
+//
+// Extension: "_kontekst/session/detach"
+// Request:  [types.DetachSessionRequest] — the session to detach from.
+func (h *Handler) handleDetach(params json.RawMessage) (any, error) {
+	var req types.DetachSessionRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, NewRPCError(types.ErrInvalidParams, err.Error())
+	}
+
+	if sess, ok := h.sessions.get(req.SessionID); ok {
+		sess.detach(h.conn)
+	}
+	return map[string]any{}, nil
 }
 
 func extractText(blocks []types.ContentBlock) string {
@@ -520,6 +671,18 @@ func parseRawInput(argumentsJSON string) any {
 	return args
 }
 
+func parsePreview(preview string) any {
+	if preview == "" {
+		return nil
+	}
+
+	var data any
+	if err := json.Unmarshal([]byte(preview), &data); err != nil {
+		return nil
+	}
+	return data
+}
+
 func parseSkillInvocation(text string) (name string, args string) {
 	text = strings.TrimPrefix(text, "/")
 	idx := strings.IndexByte(text, ' ')
@@ -538,3 +701,15 @@ func hasACPTools(caps types.ClientCapabilities) bool {
 	}
 	return false
 }
+
+func planEntries(plan []core.PlanEntry) []types.PlanEntry {
+	entries := make([]types.PlanEntry, len(plan))
+	for i, entry := range plan {
+		entries[i] = types.PlanEntry{
+			Content:  entry.Content,
+			Priority: string(entry.Priority),
+			Status:   string(entry.Status),
+		}
+	}
+	return entries
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/erg0nix/kontekst/internal/agent"
 	agentConfig "github.com/erg0nix/kontekst/internal/config/agent"
 	"github.com/erg0nix/kontekst/internal/conversation"
+	"github.com/erg0nix/kontekst/internal/core"
 	"github.com/erg0nix/kontekst/internal/protocol/types"
 	"github.com/erg0nix/kontekst/internal/provider"
 )
@@ -62,7 +63,7 @@ func setupTestPair(t *testing.T, runner agent.Runner) (*Connection, *Connection)
 	clientR, serverW := io.Pipe()
 
 	registry := testRegistry(t)
-	handler := NewHandler(runner, registry, nil)
+	handler := NewHandler(runner, registry, nil, nil)
 
 	serverConn := handler.Serve(serverW, serverR)
 	clientConn := NewConnection(nil, clientW, clientR)
@@ -274,6 +275,86 @@ func TestServerToolDenied(t *testing.T) {
 	}
 }
 
+func TestServerToolApprovalWithEditsAndFeedback(t *testing.T) {
+	commands := make(chan agent.Command, 4)
+	runner := &mockRunner{
+		events: []agent.Event{
+			{Type: agent.EvtRunStarted, RunID: "run_1"},
+			{Type: agent.EvtToolsProposed, RunID: "run_1", Calls: []agent.ProposedToolCall{
+				{CallID: "call_1", Name: "write_file", ArgumentsJSON: `{"path":"vendor/x.go"}`},
+				{CallID: "call_2", Name: "edit_file", ArgumentsJSON: `{"path":"main.go"}`},
+			}},
+			{Type: agent.EvtToolsProposed, RunID: "run_1", Calls: []agent.ProposedToolCall{
+				{CallID: "call_1", Name: "write_file", ArgumentsJSON: `{"path":"vendor/x.go"}`, Error: "invalid arguments: at '/path': got number, want string"},
+			}},
+			{Type: agent.EvtRunCompleted, RunID: "run_1"},
+		},
+		onCmd: func(cmd agent.Command) {
+			commands <- cmd
+		},
+	}
+
+	_, client := setupTestPair(t, runner)
+	sid := initAndCreateSession(t, client)
+
+	var sawError bool
+	client.handler = func(_ context.Context, method string, params json.RawMessage) (any, error) {
+		if method != types.MethodRequestPermission {
+			return nil, nil
+		}
+
+		var req types.RequestPermissionRequest
+		json.Unmarshal(params, &req)
+
+		switch {
+		case req.Meta != nil && req.Meta.Kontekst.Error != "":
+			sawError = true
+			return types.RequestPermissionResponse{Outcome: types.PermissionSelected("allow")}, nil
+		case req.ToolCall.ToolCallID == "call_1":
+			return types.RequestPermissionResponse{
+				Outcome: types.PermissionSelected("allow"),
+				Meta:    &types.PermissionMeta{Kontekst: types.PermissionExtension{Arguments: map[string]any{"path": "internal/x.go"}}},
+			}, nil
+		default:
+			return types.RequestPermissionResponse{
+				Outcome: types.PermissionSelected("reject"),
+				Meta:    &types.PermissionMeta{Kontekst: types.PermissionExtension{Feedback: "keep main.go untouched"}},
+			}, nil
+		}
+	}
+
+	_, err := client.Request(context.Background(), types.MethodSessionPrompt, types.PromptRequest{
+		SessionID: sid,
+		Prompt:    []types.ContentBlock{types.TextBlock("write file")},
+	})
+	if err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+
+	var got []agent.Command
+	for len(got) < 3 {
+		select {
+		case cmd := <-commands:
+			got = append(got, cmd)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected 3 commands, got %+v", got)
+		}
+	}
+
+	if got[0].Type != agent.CmdApproveTool || got[0].Arguments["path"] != "internal/x.go" {
+		t.Errorf("first command = %+v, want approve with edited path", got[0])
+	}
+	if got[1].Type != agent.CmdRejectTool || got[1].Feedback != "keep main.go untouched" {
+		t.Errorf("second command = %+v, want reject with feedback", got[1])
+	}
+	if got[2].Type != agent.CmdApproveTool || got[2].Arguments != nil {
+		t.Errorf("third command = %+v, want plain approve after re-proposal", got[2])
+	}
+	if !sawError {
+		t.Error("expected re-proposal to carry validation error in _meta")
+	}
+}
+
 func TestServerCancel(t *testing.T) {
 	cancelReceived := make(chan struct{})
 	eventCh := make(chan agent.Event, 32)
@@ -420,53 +501,6 @@ func TestServerRunFailed(t *testing.T) {
 	}
 }
 
-func TestServerConnectionCloseCancel(t *testing.T) {
-	cancelReceived := make(chan struct{})
-	eventCh := make(chan agent.Event, 32)
-
-	runner := &mockRunnerChan{
-		eventCh:        eventCh,
-		cancelReceived: cancelReceived,
-	}
-
-	serverConn, clientConn := setupTestPair(t, runner)
-	sid := initAndCreateSession(t, clientConn)
-
-	clientConn.handler = func(_ context.Context, _ string, _ json.RawMessage) (any, error) {
-		return nil, nil
-	}
-
-	eventCh <- agent.Event{Type: agent.EvtRunStarted, RunID: "run_1"}
-
-	promptDone := make(chan struct{})
-	go func() {
-		clientConn.Request(context.Background(), types.MethodSessionPrompt, types.PromptRequest{
-			SessionID: sid,
-			Prompt:    []types.ContentBlock{types.TextBlock("test")},
-		})
-		close(promptDone)
-	}()
-
-	time.Sleep(50 * time.Millisecond)
-
-	serverConn.Close()
-
-	select {
-	case <-cancelReceived:
-	case <-time.After(2 * time.Second):
-		t.Fatal("cancel not received after connection close")
-	}
-
-	eventCh <- agent.Event{Type: agent.EvtRunCancelled, RunID: "run_1"}
-	close(eventCh)
-
-	select {
-	case <-promptDone:
-	case <-time.After(2 * time.Second):
-		t.Fatal("prompt did not return after connection close")
-	}
-}
-
 func TestIsAllowOutcome(t *testing.T) {
 	options := []types.PermissionOption{
 		{OptionID: "allow", Name: "Allow", Kind: types.PermissionOptionKindAllowOnce},
@@ -519,7 +553,7 @@ model = "test"
 `), 0o644)
 
 	registry := agent.NewRegistry(tmpDir)
-	handler := NewHandler(runner, registry, nil)
+	handler := NewHandler(runner, registry, nil, nil)
 
 	serverConn := handler.Serve(serverW, serverR)
 	clientConn := NewConnection(nil, clientW, clientR)
@@ -746,3 +780,69 @@ func TestServerContextSnapshot(t *testing.T) {
 		t.Fatal("context snapshot not received")
 	}
 }
+
+func TestServerPromptRewind(t *testing.T) {
+	started := make(chan agent.RunConfig, 1)
+	runner := &mockRunner{
+		events: []agent.Event{
+			{Type: agent.EvtRunStarted, RunID: "run_1"},
+			{Type: agent.EvtRunCompleted, RunID: "run_1"},
+		},
+		onStart: func(cfg agent.RunConfig) { started <- cfg },
+	}
+
+	_, client := setupTestPair(t, runner)
+	sid := initAndCreateSession(t, client)
+	ctx := context.Background()
+
+	temperature := 1.2
+	_, err := client.Request(ctx, types.MethodSessionPrompt, types.PromptRequest{
+		SessionID: sid,
+		Prompt:    []types.ContentBlock{},
+		Meta: &types.PromptMeta{Kontekst: types.PromptExtension{
+			Rewind:   2,
+			Sampling: &types.SamplingOverride{Temperature: &temperature},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+
+	cfg := <-started
+	if cfg.Rewind != 2 || cfg.Prompt != "" {
+		t.Fatalf("expected rewind of 2 turns without prompt, got rewind=%d prompt=%q", cfg.Rewind, cfg.Prompt)
+	}
+	if cfg.Sampling == nil || cfg.Sampling.Temperature == nil || *cfg.Sampling.Temperature != 1.2 {
+		t.Fatalf("expected temperature override, got %+v", cfg.Sampling)
+	}
+
+	_, err = client.Request(ctx, types.MethodSessionPrompt, types.PromptRequest{
+		SessionID: sid,
+		Prompt:    []types.ContentBlock{types.TextBlock("new question")},
+		Meta:      &types.PromptMeta{Kontekst: types.PromptExtension{Rewind: 1}},
+	})
+	if err == nil {
+		t.Fatal("expected error when combining rewind with a new prompt")
+	}
+}
+
+func TestOverrideSampling(t *testing.T) {
+	temperature, topP, topK := 0.7, 0.9, 40
+	base := &core.SamplingConfig{Temperature: &temperature, TopP: &topP}
+
+	if got := OverrideSampling(base, nil); got != base {
+		t.Error("nil override should return the base config")
+	}
+
+	got := OverrideSampling(base, &types.SamplingOverride{TopK: &topK})
+	if got == base || *got.Temperature != 0.7 || *got.TopP != 0.9 || *got.TopK != 40 {
+		t.Errorf("unexpected merged sampling: %+v", got)
+	}
+	if base.TopK != nil {
+		t.Error("override must not modify the base config")
+	}
+
+	if got := OverrideSampling(nil, &types.SamplingOverride{TopK: &topK}); got == nil || *got.TopK != 40 {
+		t.Errorf("expected override applied to empty base, got %+v", got)
+	}
+}
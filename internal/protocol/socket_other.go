@@ -0,0 +1,15 @@
+//go:build !unix
+
+package protocol
+
+import "net"
+
+// checkSocketDir accepts any directory on platforms without unix file ownership.
+func checkSocketDir(string) error {
+	return nil
+}
+
+// listenUnix binds the socket; Listen restricts its permissions afterwards.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
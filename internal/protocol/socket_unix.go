@@ -0,0 +1,36 @@
+//go:build unix
+
+package protocol
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkSocketDir refuses a socket directory that is not owned by the server's user or that other users
+// can write to, since they could replace the socket.
+func checkSocketDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("socket directory %s is owned by uid %d, not the server's uid %d", dir, stat.Uid, os.Getuid())
+	}
+	if perm := info.Mode().Perm(); perm&0o022 != 0 {
+		return fmt.Errorf("socket directory %s is writable by other users (mode %o)", dir, perm)
+	}
+	return nil
+}
+
+// listenUnix creates the socket with 0600 permissions by narrowing the umask while it is bound. The umask
+// is process-wide, so files other goroutines create in that moment are private too.
+func listenUnix(path string) (net.Listener, error) {
+	previous := unix.Umask(0o177)
+	defer unix.Umask(previous)
+	return net.Listen("unix", path)
+}
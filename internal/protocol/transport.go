@@ -0,0 +1,173 @@
+package protocol
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Address schemes accepted by [Listen] and [Dial].
+const (
+	unixScheme = "unix://"
+	tcpScheme  = "tcp://"
+	tlsScheme  = "tls://"
+	wsScheme   = "ws://"
+	wssScheme  = "wss://"
+)
+
+// errPeerCredUnsupported is returned by peerUID on platforms that cannot report a socket peer's user.
+var errPeerCredUnsupported = errors.New("peer credentials not supported on this platform")
+
+// SplitAddress returns the network and address to dial or listen on for a server address:
+// "unix:///path/to/socket" is a unix domain socket, "tls://host:port" is TLS over TCP, and
+// "tcp://host:port" or a bare "host:port" is plain TCP. "ws://host:port/path" and "wss://..." are
+// WebSocket URLs, which can only be dialed; their address is the URL without the scheme.
+func SplitAddress(addr string) (network string, address string) {
+	if path, ok := strings.CutPrefix(addr, unixScheme); ok {
+		return "unix", path
+	}
+	if address, ok := strings.CutPrefix(addr, tlsScheme); ok {
+		return "tls", address
+	}
+	if address, ok := strings.CutPrefix(addr, wsScheme); ok {
+		return "ws", address
+	}
+	if address, ok := strings.CutPrefix(addr, wssScheme); ok {
+		return "wss", address
+	}
+	return "tcp", strings.TrimPrefix(addr, tcpScheme)
+}
+
+// Listen opens a listener for a server address. A unix socket is created with 0600 permissions so only
+// the owner can connect. A missing parent directory is created private to the owner, and an existing one
+// is refused unless the owner owns it and no other user can write to it. A stale socket file left behind
+// by a server that did not shut down cleanly is replaced; Listen fails if another server is still
+// listening on the socket. A tls:// address needs tlsConfig; it is ignored for the other networks.
+func Listen(addr string, tlsConfig *tls.Config) (net.Listener, error) {
+	network, address := SplitAddress(addr)
+	switch network {
+	case "tcp":
+		return net.Listen(network, address)
+	case "tls":
+		if tlsConfig == nil {
+			return nil, fmt.Errorf("protocol: listen %s: no TLS configuration", addr)
+		}
+		return tls.Listen("tcp", address, tlsConfig)
+	case "ws", "wss":
+		return nil, fmt.Errorf("protocol: listen %s: WebSocket addresses can only be dialed", addr)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(address), 0o700); err != nil {
+		return nil, fmt.Errorf("protocol: listen %s: mkdir: %w", addr, err)
+	}
+	if err := checkSocketDir(filepath.Dir(address)); err != nil {
+		return nil, fmt.Errorf("protocol: listen %s: %w", addr, err)
+	}
+	if err := removeStaleSocket(address); err != nil {
+		return nil, fmt.Errorf("protocol: listen %s: %w", addr, err)
+	}
+
+	listener, err := listenUnix(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(address, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("protocol: listen %s: chmod: %w", addr, err)
+	}
+	return listener, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another server is listening on %s", path)
+	}
+	return os.Remove(path)
+}
+
+// CheckPeer rejects a unix socket connection from a user other than the one running the server.
+// TCP connections, and platforms that cannot report the peer's user, pass; the socket's file
+// permissions still apply to those.
+func CheckPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+
+	uid, err := peerUID(unixConn)
+	if errors.Is(err, errPeerCredUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("protocol: peer credentials: %w", err)
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("protocol: peer uid %d is not the server's uid %d", uid, os.Getuid())
+	}
+	return nil
+}
+
+// PeerCertificate completes the TLS handshake on a connection accepted from a tls:// listener and returns
+// the client's verified certificate, or nil when it presented none. Other connections return nil.
+func PeerCertificate(ctx context.Context, conn net.Conn) (*x509.Certificate, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, nil
+	}
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("protocol: tls handshake: %w", err)
+	}
+
+	chains := tlsConn.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil, nil
+	}
+	return chains[0][0], nil
+}
+
+// dial connects to a server address. tls:// and wss:// addresses use tlsConfig, or the system roots when
+// it is nil.
+func dial(ctx context.Context, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+	network, address := SplitAddress(addr)
+	if network == "ws" || network == "wss" {
+		return dialWebSocket(ctx, addr, tlsConfig)
+	}
+
+	var conn net.Conn
+	var err error
+	if network == "tls" {
+		if tlsConfig == nil {
+			host, _, _ := net.SplitHostPort(address)
+			tlsConfig = &tls.Config{ServerName: host}
+		}
+		dialer := tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, network, address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("protocol: dial %s: %w", addr, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,265 @@
+package protocol
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/auth"
+	"github.com/erg0nix/kontekst/internal/config"
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+)
+
+func TestSplitAddress(t *testing.T) {
+	tests := []struct {
+		addr        string
+		wantNetwork string
+		wantAddress string
+	}{
+		{"unix:///home/me/.kontekst/kontekst.sock", "unix", "/home/me/.kontekst/kontekst.sock"},
+		{"tcp://127.0.0.1:50051", "tcp", "127.0.0.1:50051"},
+		{"127.0.0.1:50051", "tcp", "127.0.0.1:50051"},
+		{":50051", "tcp", ":50051"},
+		{"tls://devbox:7000", "tls", "devbox:7000"},
+	}
+
+	for _, tt := range tests {
+		network, address := SplitAddress(tt.addr)
+		if network != tt.wantNetwork || address != tt.wantAddress {
+			t.Errorf("SplitAddress(%q) = %q, %q; want %q, %q", tt.addr, network, address, tt.wantNetwork, tt.wantAddress)
+		}
+	}
+}
+
+// shortSocketPath returns a socket path short enough for the platform's sun_path limit.
+func shortSocketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "kx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "s.sock")
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := shortSocketPath(t)
+	addr := "unix://" + path
+
+	listener, err := Listen(addr, nil)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		if err := CheckPeer(conn); err != nil {
+			t.Errorf("CheckPeer rejected the server's own user: %v", err)
+		}
+		NewConnection(func(context.Context, string, json.RawMessage) (any, error) {
+			return types.StatusResponse{Bind: addr}, nil
+		}, conn, conn)
+	}()
+
+	client, err := Dial(context.Background(), addr, ClientCallbacks{})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Status(context.Background()); err != nil {
+		t.Fatalf("status over unix socket failed: %v", err)
+	}
+
+	if _, err := Listen(addr, nil); err == nil || !strings.Contains(err.Error(), "another server") {
+		t.Errorf("second Listen error = %v, want the socket reported in use", err)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := shortSocketPath(t)
+
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := Listen("unix://"+path, nil)
+	if err != nil {
+		t.Fatalf("Listen over a stale socket failed: %v", err)
+	}
+	listener.Close()
+}
+
+func TestListenRefusesRegularFile(t *testing.T) {
+	path := shortSocketPath(t)
+	if err := os.WriteFile(path, []byte("not a socket"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Listen("unix://"+path, nil); err == nil {
+		t.Fatal("Listen replaced a regular file")
+	}
+}
+
+func TestListenRefusesSharedDirectory(t *testing.T) {
+	path := shortSocketPath(t)
+	if err := os.Chmod(filepath.Dir(path), 0o777); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Listen("unix://"+path, nil); err == nil || !strings.Contains(err.Error(), "writable by other users") {
+		t.Fatalf("Listen error = %v, want the directory refused", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket was created in a shared directory")
+	}
+}
+
+// serveTLS starts a status-only server on a tls:// address with certificates generated in dataDir and
+// returns its address and the client certificates it was shown.
+func serveTLS(t *testing.T, dataDir string, cfg config.TLSConfig) (string, <-chan *x509.Certificate) {
+	t.Helper()
+
+	tlsConfig, err := auth.ServerTLS(dataDir, cfg, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("ServerTLS failed: %v", err)
+	}
+	listener, err := Listen("tls://127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	peers := make(chan *x509.Certificate, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			cert, err := PeerCertificate(context.Background(), conn)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			peers <- cert
+			NewConnection(func(context.Context, string, json.RawMessage) (any, error) {
+				return types.StatusResponse{}, nil
+			}, conn, conn)
+		}
+	}()
+	return "tls://" + listener.Addr().String(), peers
+}
+
+func TestDialTLS(t *testing.T) {
+	serverDir := t.TempDir()
+	addr, _ := serveTLS(t, serverDir, config.TLSConfig{})
+
+	pin, err := auth.ServerPin(serverDir, config.TLSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := os.ReadFile(auth.CAPath(serverDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, caPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dataDir string
+		cfg     config.ClientTLSConfig
+		wantErr bool
+	}{
+		{name: "data dir CA", dataDir: serverDir},
+		{name: "CA file", dataDir: t.TempDir(), cfg: config.ClientTLSConfig{CAFile: caFile}},
+		{name: "pin", dataDir: t.TempDir(), cfg: config.ClientTLSConfig{Pin: pin}},
+		{name: "wrong pin", dataDir: serverDir, cfg: config.ClientTLSConfig{Pin: "sha256:00"}, wantErr: true},
+		{name: "unknown CA", dataDir: t.TempDir(), wantErr: true},
+		{name: "wrong server name", dataDir: serverDir, cfg: config.ClientTLSConfig{ServerName: "elsewhere.example"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := auth.ClientTLS(tt.dataDir, tt.cfg, "127.0.0.1")
+			if err != nil {
+				t.Fatalf("ClientTLS failed: %v", err)
+			}
+
+			client, err := DialTLS(context.Background(), addr, tlsConfig, ClientCallbacks{})
+			if err == nil {
+				defer client.Close()
+				_, err = client.Status(context.Background())
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("status over TLS error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialMutualTLS(t *testing.T) {
+	serverDir := t.TempDir()
+	addr, peers := serveTLS(t, serverDir, config.TLSConfig{RequireClientCert: true})
+
+	certPEM, keyPEM, err := auth.IssueClientCertificate(serverDir, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certDir := t.TempDir()
+	certFile, keyFile := filepath.Join(certDir, "laptop.pem"), filepath.Join(certDir, "laptop-key.pem")
+	os.WriteFile(certFile, certPEM, 0o644)
+	os.WriteFile(keyFile, keyPEM, 0o600)
+
+	anonymous, err := auth.ClientTLS(serverDir, config.ClientTLSConfig{}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client, err := DialTLS(context.Background(), addr, anonymous, ClientCallbacks{}); err == nil {
+		_, err = client.Status(context.Background())
+		client.Close()
+		if err == nil {
+			t.Fatal("server accepted a client without a certificate")
+		}
+	}
+
+	withCert, err := auth.ClientTLS(serverDir, config.ClientTLSConfig{CertFile: certFile, KeyFile: keyFile}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := DialTLS(context.Background(), addr, withCert, ClientCallbacks{})
+	if err != nil {
+		t.Fatalf("DialTLS with a client certificate failed: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Status(context.Background()); err != nil {
+		t.Fatalf("status over mutual TLS failed: %v", err)
+	}
+
+	if peer := <-peers; peer == nil || peer.Subject.CommonName != "laptop" {
+		t.Errorf("peer certificate = %v, want laptop", peer)
+	}
+}
@@ -59,15 +59,38 @@ type McpCapabilities struct {
 // SessionCapabilities declares which optional session features the agent supports.
 type SessionCapabilities struct{}
 
+// AuthMethodToken is the ID of kontekst's token authentication method.
+const AuthMethodToken = "kontekst-token"
+
 // AuthMethod describes an available authentication method offered by the agent.
 type AuthMethod struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
 }
 
 // AuthenticateRequest is a client request to authenticate using a specific method.
 type AuthenticateRequest struct {
-	MethodID string `json:"methodId"`
+	MethodID string                   `json:"methodId"`
+	Meta     *AuthenticateRequestMeta `json:"_meta,omitempty"`
+}
+
+// AuthenticateRequestMeta is the _meta payload kontekst accepts on authenticate requests.
+type AuthenticateRequestMeta struct {
+	Kontekst AuthenticateExtension `json:"kontekst"`
+}
+
+// AuthenticateExtension carries the secret for the [AuthMethodToken] method.
+type AuthenticateExtension struct {
+	Token string `json:"token"`
+}
+
+// Token returns the secret sent with the request, or an empty string if none was sent.
+func (r AuthenticateRequest) Token() string {
+	if r.Meta == nil {
+		return ""
+	}
+	return r.Meta.Kontekst.Token
 }
 
 // AuthenticateResponse is the server's response to a successful authentication request.
@@ -15,6 +15,38 @@ func TextBlock(text string) ContentBlock {
 type PromptRequest struct {
 	SessionID SessionID      `json:"sessionId"`
 	Prompt    []ContentBlock `json:"prompt"`
+	Meta      *PromptMeta    `json:"_meta,omitempty"`
+}
+
+// PromptMeta is the _meta payload kontekst accepts on prompt requests.
+type PromptMeta struct {
+	Kontekst PromptExtension `json:"kontekst"`
+}
+
+// PromptExtension asks the server to rewind the session by Rewind turns and re-run the agent from the
+// user message that started them, instead of sending a new prompt, optionally with sampling overrides.
+// Detach makes the server answer as soon as the run has started; the run continues in the daemon.
+type PromptExtension struct {
+	Rewind   int               `json:"rewind,omitempty"`
+	Sampling *SamplingOverride `json:"sampling,omitempty"`
+	Detach   bool              `json:"detach,omitempty"`
+}
+
+// SamplingOverride replaces individual sampling parameters of the agent's configuration for one run.
+type SamplingOverride struct {
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"topP,omitempty"`
+	TopK          *int     `json:"topK,omitempty"`
+	RepeatPenalty *float64 `json:"repeatPenalty,omitempty"`
+	MaxTokens     *int     `json:"maxTokens,omitempty"`
+}
+
+// Extension returns the kontekst extension of the request, or an empty one if none was sent.
+func (r PromptRequest) Extension() PromptExtension {
+	if r.Meta == nil {
+		return PromptExtension{}
+	}
+	return r.Meta.Kontekst
 }
 
 // StopReason indicates why the agent stopped generating a response.
@@ -34,8 +66,25 @@ const (
 )
 
 // PromptResponse is the server's final response after processing a prompt.
+// A detached prompt is answered before the run ends, with no stop reason and Detached set in _meta.
 type PromptResponse struct {
-	StopReason StopReason `json:"stopReason"`
+	StopReason StopReason          `json:"stopReason"`
+	Meta       *PromptResponseMeta `json:"_meta,omitempty"`
+}
+
+// PromptResponseMeta is the _meta payload kontekst attaches to prompt responses.
+type PromptResponseMeta struct {
+	Kontekst PromptResponseExtension `json:"kontekst"`
+}
+
+// PromptResponseExtension reports that the prompt started a detached run.
+type PromptResponseExtension struct {
+	Detached bool `json:"detached,omitempty"`
+}
+
+// Detached reports whether the response answers a detached prompt whose run is still going.
+func (r PromptResponse) Detached() bool {
+	return r.Meta != nil && r.Meta.Kontekst.Detached
 }
 
 // CancelNotification is a client notification to cancel an active prompt.
@@ -41,11 +41,33 @@ type RequestPermissionRequest struct {
 	SessionID SessionID          `json:"sessionId"`
 	ToolCall  ToolCallDetail     `json:"toolCall"`
 	Options   []PermissionOption `json:"options"`
+	Meta      *PermissionMeta    `json:"_meta,omitempty"`
 }
 
 // RequestPermissionResponse is the client's response to a permission request.
 type RequestPermissionResponse struct {
 	Outcome PermissionOutcome `json:"outcome"`
+	Meta    *PermissionMeta   `json:"_meta,omitempty"`
+}
+
+// PermissionMeta is the _meta payload kontekst attaches to permission requests and responses.
+type PermissionMeta struct {
+	Kontekst PermissionExtension `json:"kontekst"`
+}
+
+// PermissionExtension holds edited arguments or feedback from the client, or a validation error from the server.
+type PermissionExtension struct {
+	Arguments map[string]any `json:"arguments,omitempty"`
+	Feedback  string         `json:"feedback,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// Extension returns the kontekst extension of the response, or an empty one if none was sent.
+func (r RequestPermissionResponse) Extension() PermissionExtension {
+	if r.Meta == nil {
+		return PermissionExtension{}
+	}
+	return r.Meta.Kontekst
 }
 
 // PermissionOutcome represents the user's decision on a permission request.
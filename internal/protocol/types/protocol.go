@@ -31,6 +31,39 @@ const (
 	MethodKontekstShutdown = "_kontekst/shutdown"
 	// MethodKontekstContext is the extension method for sending context snapshots to the client.
 	MethodKontekstContext = "_kontekst/context"
+	// MethodKontekstSessionFork is the extension method for forking a session at a message index.
+	MethodKontekstSessionFork = "_kontekst/session/fork"
+	// MethodKontekstSessionsSearch is the extension method for full-text search across sessions.
+	MethodKontekstSessionsSearch = "_kontekst/sessions/search"
+	// MethodKontekstSessionAttach is the extension method for subscribing to a session's live updates.
+	MethodKontekstSessionAttach = "_kontekst/session/attach"
+	// MethodKontekstSessionDetach is the extension method for unsubscribing from a session's updates.
+	MethodKontekstSessionDetach = "_kontekst/session/detach"
+	// MethodKontekstAgentsList is the extension method for listing the server's agents.
+	MethodKontekstAgentsList = "_kontekst/agents/list"
+	// MethodKontekstAgentsGet is the extension method for reading an agent's configuration.
+	MethodKontekstAgentsGet = "_kontekst/agents/get"
+	// MethodKontekstSessionsList is the extension method for listing sessions.
+	MethodKontekstSessionsList = "_kontekst/sessions/list"
+	// MethodKontekstSessionsGet is the extension method for reading a session's metadata.
+	MethodKontekstSessionsGet = "_kontekst/sessions/get"
+	// MethodKontekstSessionsDelete is the extension method for deleting a session.
+	MethodKontekstSessionsDelete = "_kontekst/sessions/delete"
+	// MethodKontekstSkillsList is the extension method for listing skills.
+	MethodKontekstSkillsList = "_kontekst/skills/list"
+	// MethodKontekstSkillsGet is the extension method for reading a skill and its template.
+	MethodKontekstSkillsGet = "_kontekst/skills/get"
+	// MethodKontekstCommandsList is the extension method for listing commands.
+	MethodKontekstCommandsList = "_kontekst/commands/list"
+	// MethodKontekstCommandsGet is the extension method for reading a command.
+	MethodKontekstCommandsGet = "_kontekst/commands/get"
+	// MethodKontekstReload is the extension method for reloading agents, skills and commands from disk.
+	MethodKontekstReload = "_kontekst/reload"
+	// MethodKontekstRunEnded is the extension notification sent to attached clients when a session's run ends.
+	MethodKontekstRunEnded = "_kontekst/session/run_ended"
+
+	// MethodCancelRequest is the notification either side sends to cancel a request it is still waiting on.
+	MethodCancelRequest = "$/cancel_request"
 
 	// MethodFsReadTextFile is the method for reading a text file via the client filesystem.
 	MethodFsReadTextFile = "fs/read_text_file"
@@ -66,4 +99,26 @@ const (
 	ErrAuthRequired ErrorCode = -32000
 	// ErrNotFound indicates the requested resource was not found.
 	ErrNotFound ErrorCode = -32002
+	// ErrRequestCancelled indicates the request was cancelled by a $/cancel_request notification.
+	ErrRequestCancelled ErrorCode = -32800
 )
+
+// HookOutput creates a session update payload for text produced by a lifecycle hook.
+// It is sent as a thought chunk tagged with the hook event in _meta so generic ACP clients still display it.
+func HookOutput(event string, text string) map[string]any {
+	return map[string]any{
+		"sessionUpdate": "agent_thought_chunk",
+		"content":       map[string]any{"type": "text", "text": text},
+		"_meta":         map[string]any{"kontekst": map[string]any{"hook": event}},
+	}
+}
+
+// LoopNotice creates a session update payload reporting that the agent loop detected repetition.
+// State is "warning" when a corrective note was injected and "stopped" when the run was ended.
+func LoopNotice(state string, text string) map[string]any {
+	return map[string]any{
+		"sessionUpdate": "agent_thought_chunk",
+		"content":       map[string]any{"type": "text", "text": text},
+		"_meta":         map[string]any{"kontekst": map[string]any{"loop": state}},
+	}
+}
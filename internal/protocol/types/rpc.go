@@ -1,11 +1,130 @@
 package types
 
-// StatusResponse contains server status information returned by the _kontekst/status method.
+// CancelRequestNotification cancels the request with the given JSON-RPC ID.
+type CancelRequestNotification struct {
+	RequestID int `json:"requestId"`
+}
+
+// StatusResponse contains server status information returned by the _kontekst/status method: the connected
+// clients, the open sessions and what their runs are doing, and the health of the LLM server.
 type StatusResponse struct {
-	Bind      string `json:"bind"`
-	Uptime    string `json:"uptime"`
-	StartedAt string `json:"startedAt"`
-	DataDir   string `json:"dataDir"`
+	Bind      string          `json:"bind"`
+	Uptime    string          `json:"uptime"`
+	StartedAt string          `json:"startedAt"`
+	DataDir   string          `json:"dataDir"`
+	Clients   []ClientStatus  `json:"clients"`
+	Sessions  []SessionStatus `json:"sessions"`
+	Llama     LlamaStatus     `json:"llama"`
+}
+
+// ClientStatus describes a connected client. Name and Version come from the client's initialize request.
+type ClientStatus struct {
+	Name        string `json:"name,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Token       string `json:"token,omitempty"`
+	ConnectedAt string `json:"connectedAt"`
+}
+
+// RunState is what a session's run is doing.
+type RunState string
+
+const (
+	// RunStateIdle means the session has no active run.
+	RunStateIdle RunState = "idle"
+	// RunStateGenerating means the run is waiting for or receiving the model's response.
+	RunStateGenerating RunState = "generating"
+	// RunStateAwaitingApproval means the run is waiting for a client to approve a tool call.
+	RunStateAwaitingApproval RunState = "awaiting_approval"
+	// RunStateExecutingTool means the run is executing a tool call.
+	RunStateExecutingTool RunState = "executing_tool"
+)
+
+// SessionStatus describes a session the server has open. Tool is set while a tool is awaiting approval or
+// executing, and TokensPerSecond is the generation rate of the session's last completed turn.
+type SessionStatus struct {
+	SessionID       SessionID `json:"sessionId"`
+	Agent           string    `json:"agent"`
+	State           RunState  `json:"state"`
+	Tool            string    `json:"tool,omitempty"`
+	Prompt          string    `json:"prompt,omitempty"`
+	Clients         int       `json:"clients"`
+	TokensPerSecond float64   `json:"tokensPerSecond,omitempty"`
+}
+
+// LlamaStatus is the health of the LLM server used by the default agent. Status is "ok", "loading" while
+// it loads a model, "error" for any other answer, or "unreachable". PID is 0 when no llama-server process
+// is running on the server's machine.
+type LlamaStatus struct {
+	Endpoint string `json:"endpoint"`
+	Status   string `json:"status"`
+	PID      int    `json:"pid,omitempty"`
+}
+
+// ForkSessionRequest is a request to fork a session, copying its history up to and including the message at
+// 0-based index At, that is its first At+1 messages. A nil At copies the whole history.
+type ForkSessionRequest struct {
+	SessionID SessionID `json:"sessionId"`
+	At        *int      `json:"at,omitempty"`
+}
+
+// ForkSessionResponse contains the ID of the forked session and how many messages it inherited.
+type ForkSessionResponse struct {
+	SessionID SessionID `json:"sessionId"`
+	ParentID  SessionID `json:"parentId"`
+	Messages  int       `json:"messages"`
+}
+
+// SearchSessionsRequest is a full-text search across the messages of all sessions. Empty filters match
+// everything; Since and Until take RFC 3339 times or YYYY-MM-DD dates, and a date-only Until includes that day.
+type SearchSessionsRequest struct {
+	Query string `json:"query"`
+	Agent string `json:"agent,omitempty"`
+	Role  string `json:"role,omitempty"`
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// SearchSessionsResponse contains the matching messages, best match first.
+type SearchSessionsResponse struct {
+	Results []SessionSearchResult `json:"results"`
+}
+
+// AttachSessionRequest subscribes the connection to a session's updates and permission requests.
+type AttachSessionRequest struct {
+	SessionID SessionID `json:"sessionId"`
+}
+
+// AttachSessionResponse reports whether the session has an active run, and the prompt that started it.
+type AttachSessionResponse struct {
+	SessionID SessionID `json:"sessionId"`
+	Agent     string    `json:"agent"`
+	Running   bool      `json:"running"`
+	Prompt    string    `json:"prompt,omitempty"`
+}
+
+// DetachSessionRequest stops the connection receiving a session's updates.
+type DetachSessionRequest struct {
+	SessionID SessionID `json:"sessionId"`
+}
+
+// RunEndedNotification tells the clients attached to a session that its run ended.
+// Error is set when the run failed, and StopReason otherwise.
+type RunEndedNotification struct {
+	SessionID  SessionID  `json:"sessionId"`
+	StopReason StopReason `json:"stopReason,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// SessionSearchResult is one matching message with a snippet of its content.
+type SessionSearchResult struct {
+	SessionID    SessionID `json:"sessionId"`
+	MessageIndex int       `json:"messageIndex"`
+	Role         string    `json:"role"`
+	Agent        string    `json:"agent,omitempty"`
+	Time         string    `json:"time,omitempty"`
+	Score        float64   `json:"score"`
+	Snippet      string    `json:"snippet"`
 }
 
 // ReadTextFileRequest is a request to read a text file via the client filesystem.
@@ -100,3 +219,108 @@ type ReleaseTerminalRequest struct {
 
 // ReleaseTerminalResponse is the response after releasing a terminal's resources.
 type ReleaseTerminalResponse struct{}
+
+// NameRequest names the agent, skill or command to read.
+type NameRequest struct {
+	Name string `json:"name"`
+}
+
+// SessionRequest names the session to read or delete.
+type SessionRequest struct {
+	SessionID SessionID `json:"sessionId"`
+}
+
+// AgentSummary describes an agent in the server's agents directory.
+type AgentSummary struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	HasPrompt   bool   `json:"hasPrompt"`
+	HasConfig   bool   `json:"hasConfig"`
+}
+
+// ListAgentsResponse lists the agents, sorted by name.
+type ListAgentsResponse struct {
+	Agents []AgentSummary `json:"agents"`
+}
+
+// AgentDetail is an agent's resolved configuration. Sampling takes the same form as a prompt's override.
+type AgentDetail struct {
+	Name               string            `json:"name"`
+	DisplayName        string            `json:"displayName"`
+	SystemPrompt       string            `json:"systemPrompt"`
+	ContextSize        int               `json:"contextSize"`
+	Endpoint           string            `json:"endpoint"`
+	Model              string            `json:"model,omitempty"`
+	HTTPTimeoutSeconds int               `json:"httpTimeoutSeconds"`
+	ToolRole           bool              `json:"toolRole"`
+	Sampling           *SamplingOverride `json:"sampling,omitempty"`
+}
+
+// SessionInfo is a session's metadata. Times are RFC 3339.
+type SessionInfo struct {
+	SessionID        SessionID   `json:"sessionId"`
+	Title            string      `json:"title,omitempty"`
+	Tags             []string    `json:"tags,omitempty"`
+	Agent            string      `json:"agent,omitempty"`
+	WorkingDir       string      `json:"workingDir,omitempty"`
+	PromptTokens     int         `json:"promptTokens"`
+	CompletionTokens int         `json:"completionTokens"`
+	ParentID         SessionID   `json:"parentId,omitempty"`
+	ForkedAt         int         `json:"forkedAt,omitempty"`
+	Children         []SessionID `json:"children,omitempty"`
+	Messages         int         `json:"messages"`
+	FileSize         int64       `json:"fileSize"`
+	CreatedAt        string      `json:"createdAt"`
+	ModifiedAt       string      `json:"modifiedAt"`
+	Running          bool        `json:"running"`
+}
+
+// ListSessionsResponse lists the sessions, most recently modified first.
+type ListSessionsResponse struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// SkillInfo describes a skill. Content, the skill's template, is only sent by _kontekst/skills/get.
+type SkillInfo struct {
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	Path           string `json:"path"`
+	UserInvocable  bool   `json:"userInvocable"`
+	ModelInvocable bool   `json:"modelInvocable"`
+	Content        string `json:"content,omitempty"`
+}
+
+// ListSkillsResponse lists the skills, sorted by name.
+type ListSkillsResponse struct {
+	Skills []SkillInfo `json:"skills"`
+}
+
+// CommandInfo describes a command and the arguments it takes.
+type CommandInfo struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Runtime     string            `json:"runtime"`
+	Timeout     int               `json:"timeout,omitempty"`
+	Arguments   []CommandArgument `json:"arguments"`
+}
+
+// CommandArgument is one argument of a command.
+type CommandArgument struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	Default     string `json:"default,omitempty"`
+}
+
+// ListCommandsResponse lists the commands, sorted by name.
+type ListCommandsResponse struct {
+	Commands []CommandInfo `json:"commands"`
+}
+
+// ReloadResponse reports how many agents, skills and commands the server found after reloading.
+type ReloadResponse struct {
+	Agents   int `json:"agents"`
+	Skills   int `json:"skills"`
+	Commands int `json:"commands"`
+}
@@ -104,6 +104,21 @@ func ToolCallUpdate(id ToolCallID, status ToolCallStatus, content []ToolCallCont
 	return m
 }
 
+// ToolCallInputUpdate creates a session update payload replacing a tool call's input and preview after the user edited it.
+func ToolCallInputUpdate(id ToolCallID, rawInput any, preview any) map[string]any {
+	m := map[string]any{
+		"sessionUpdate": "tool_call_update",
+		"toolCallId":    id,
+	}
+	if rawInput != nil {
+		m["rawInput"] = rawInput
+	}
+	if preview != nil {
+		m["preview"] = preview
+	}
+	return m
+}
+
 // Command represents a slash command available to the user within a session.
 type Command struct {
 	Name        string `json:"name"`
@@ -118,6 +133,24 @@ func AvailableCommandsUpdate(commands []Command) map[string]any {
 	}
 }
 
+// PlanEntry is a single item of an agent's execution plan, as reported to the client.
+type PlanEntry struct {
+	Content  string `json:"content"`
+	Priority string `json:"priority"`
+	Status   string `json:"status"`
+}
+
+// PlanUpdate creates a session update payload carrying the agent's complete current plan.
+func PlanUpdate(entries []PlanEntry) map[string]any {
+	if entries == nil {
+		entries = []PlanEntry{}
+	}
+	return map[string]any{
+		"sessionUpdate": "plan",
+		"entries":       entries,
+	}
+}
+
 var toolKindMap = map[string]ToolKind{
 	"read_file":   ToolKindRead,
 	"list_files":  ToolKindSearch,
@@ -126,4 +159,5 @@ var toolKindMap = map[string]ToolKind{
 	"web_fetch":   ToolKindFetch,
 	"run_command": ToolKindExecute,
 	"skill":       ToolKindOther,
+	"todo":        ToolKindThink,
 }
@@ -14,6 +14,7 @@ func TestToolKindFromName(t *testing.T) {
 		{"run_command", ToolKindExecute},
 		{"web_fetch", ToolKindFetch},
 		{"skill", ToolKindOther},
+		{"todo", ToolKindThink},
 		{"unknown_tool", ToolKindOther},
 	}
 
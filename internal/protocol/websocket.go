@@ -0,0 +1,136 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketPath is the HTTP path the daemon serves ACP on over WebSocket.
+const WebSocketPath = "/acp"
+
+// ServeFunc runs the protocol on one connection until it closes. r is the HTTP request that opened it.
+type ServeFunc func(stream io.ReadWriteCloser, r *http.Request)
+
+// NewWebSocketHandler returns an HTTP handler that upgrades requests to WebSocket and passes each
+// connection to serve as a stream of line-delimited JSON-RPC, carrying one message per text frame.
+// Browsers may connect from a loopback origin or one of allowedOrigins ("*" allows any); requests
+// without an Origin header, which browsers always send, are accepted.
+func NewWebSocketHandler(allowedOrigins []string, serve ServeFunc) http.Handler {
+	return websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			return checkOrigin(r, allowedOrigins)
+		},
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = maxMessageSize
+			serve(&wsStream{ws: ws}, ws.Request())
+		},
+	}
+}
+
+func checkOrigin(r *http.Request, allowedOrigins []string) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(allowedOrigins, "*") || slices.Contains(allowedOrigins, origin) {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("protocol: bad origin %q: %w", origin, err)
+	}
+	if isLoopbackHost(u.Hostname()) {
+		return nil
+	}
+	return fmt.Errorf("protocol: origin %q is not allowed", origin)
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP. The origin's name is checked rather
+// than the request's Host: a page on a domain rebound to a loopback address still has its own origin.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// wsStream adapts a WebSocket connection to the line-delimited stream a [Connection] reads and writes.
+// Each received frame becomes one line, compacted so a pretty-printed message cannot span lines, and
+// each write, which is always one whole message, is sent as one frame.
+type wsStream struct {
+	ws  *websocket.Conn
+	buf []byte
+}
+
+func (s *wsStream) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		var frame []byte
+		if err := websocket.Message.Receive(s.ws, &frame); err != nil {
+			return 0, err
+		}
+
+		var line bytes.Buffer
+		if err := json.Compact(&line, frame); err != nil {
+			continue
+		}
+		s.buf = append(line.Bytes(), '\n')
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *wsStream) Write(p []byte) (int, error) {
+	if err := websocket.Message.Send(s.ws, string(bytes.TrimSuffix(p, []byte("\n")))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *wsStream) Close() error {
+	return s.ws.Close()
+}
+
+// dialWebSocket connects to a ws:// or wss:// address. The handshake needs an origin, so it sends a
+// loopback one, which the server always accepts; origins only guard against browsers.
+func dialWebSocket(ctx context.Context, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("protocol: dial %s: %w", addr, err)
+	}
+	if u.Path == "" {
+		u.Path = WebSocketPath
+	}
+
+	config, err := websocket.NewConfig(u.String(), "http://localhost")
+	if err != nil {
+		return nil, fmt.Errorf("protocol: dial %s: %w", addr, err)
+	}
+	config.TlsConfig = tlsConfig
+
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("protocol: dial %s: %w", addr, err)
+	}
+	ws.MaxPayloadBytes = maxMessageSize
+	return &wsConn{Conn: ws, stream: &wsStream{ws: ws}}, nil
+}
+
+// wsConn is a client WebSocket connection that reads and writes whole messages through a wsStream.
+type wsConn struct {
+	*websocket.Conn
+	stream *wsStream
+}
+
+func (c *wsConn) Read(p []byte) (int, error)  { return c.stream.Read(p) }
+func (c *wsConn) Write(p []byte) (int, error) { return c.stream.Write(p) }
@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/protocol/types"
+	"golang.org/x/net/websocket"
+)
+
+// serveWebSocket starts an HTTP server serving a handler that requires one of testTokens at /acp.
+func serveWebSocket(t *testing.T, allowedOrigins []string) string {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle(WebSocketPath, NewWebSocketHandler(allowedOrigins, func(stream io.ReadWriteCloser, _ *http.Request) {
+		handler := NewHandler(&mockRunner{}, testRegistry(t), nil, nil)
+		handler.RequireAuth(testTokens)
+		<-handler.Serve(stream, stream).Done()
+	}))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return "ws://" + strings.TrimPrefix(server.URL, "http://") + WebSocketPath
+}
+
+func TestWebSocket_ServesACPWithAuth(t *testing.T) {
+	addr := serveWebSocket(t, nil)
+
+	client, err := Dial(context.Background(), addr, ClientCallbacks{})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.NewSession(context.Background(), types.NewSessionRequest{Cwd: "/tmp", McpServers: []types.McpServer{}}); rpcCode(err) != int(types.ErrAuthRequired) {
+		t.Fatalf("session/new before authenticate error = %v, want auth required", err)
+	}
+
+	client.Token = "admin-secret"
+	if _, err := client.Initialize(context.Background(), types.InitializeRequest{ProtocolVersion: types.ProtocolVersion}); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	resp, err := client.NewSession(context.Background(), types.NewSessionRequest{Cwd: "/tmp", McpServers: []types.McpServer{}})
+	if err != nil {
+		t.Fatalf("session/new over WebSocket failed: %v", err)
+	}
+	if resp.SessionID == "" {
+		t.Error("session/new returned no session ID")
+	}
+}
+
+func TestWebSocket_OneMessagePerFrame(t *testing.T) {
+	addr := serveWebSocket(t, nil)
+
+	ws, err := websocket.Dial(addr, "", "http://"+strings.Split(strings.TrimPrefix(addr, "ws://"), "/")[0])
+	if err != nil {
+		t.Fatalf("websocket dial failed: %v", err)
+	}
+	defer ws.Close()
+
+	pretty := "{\n  \"jsonrpc\": \"2.0\",\n  \"id\": 7,\n  \"method\": \"initialize\",\n  \"params\": {\"protocolVersion\": 1}\n}"
+	if err := websocket.Message.Send(ws, pretty); err != nil {
+		t.Fatal(err)
+	}
+
+	var frame string
+	if err := websocket.Message.Receive(ws, &frame); err != nil {
+		t.Fatalf("no response frame: %v", err)
+	}
+	var msg jsonrpcMessage
+	if err := json.Unmarshal([]byte(frame), &msg); err != nil {
+		t.Fatalf("response frame %q is not one JSON message: %v", frame, err)
+	}
+	if msg.ID == nil || *msg.ID != 7 || msg.Error != nil {
+		t.Errorf("response = %s, want a result for id 7", frame)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		wantErr bool
+	}{
+		{name: "no origin", origin: ""},
+		{name: "localhost origin", origin: "http://localhost:5173"},
+		{name: "loopback ip origin", origin: "http://127.0.0.1:7444"},
+		{name: "loopback ipv6 origin", origin: "http://[::1]:7444"},
+		{name: "same host is not enough", origin: "http://kontekst.local:7444", wantErr: true},
+		{name: "listed origin", origin: "http://kontekst.local:7444", allowed: []string{"http://kontekst.local:7444"}},
+		{name: "any origin", origin: "https://evil.example", allowed: []string{"*"}},
+		{name: "other origin", origin: "https://evil.example", wantErr: true},
+		{name: "other port", origin: "http://kontekst.local:8080", allowed: []string{"http://localhost:5173"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://kontekst.local:7444/acp", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if err := checkOrigin(req, tt.allowed); (err != nil) != tt.wantErr {
+				t.Errorf("checkOrigin(%q) error = %v, want error %v", tt.origin, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebSocket_RejectsForeignOrigin(t *testing.T) {
+	addr := serveWebSocket(t, nil)
+
+	if _, err := websocket.Dial(addr, "", "https://evil.example"); err == nil {
+		t.Fatal("handshake from a foreign origin succeeded")
+	}
+}
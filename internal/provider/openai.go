@@ -2,6 +2,7 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,6 +16,9 @@ import (
 	"github.com/erg0nix/kontekst/internal/core"
 )
 
+// DefaultMaxTokens caps a reply when the sampling configuration sets no max_tokens.
+const DefaultMaxTokens = 4096
+
 // OpenAIConfig holds connection settings for an OpenAI-compatible API endpoint.
 type OpenAIConfig struct {
 	Endpoint    string
@@ -56,7 +60,9 @@ func NewOpenAIProvider(cfg OpenAIConfig, debugCfg config.DebugConfig) *OpenAIPro
 }
 
 // GenerateChat sends a chat completion request to the OpenAI-compatible endpoint and returns the parsed response.
+// Cancelling ctx abandons the request.
 func (p *OpenAIProvider) GenerateChat(
+	ctx context.Context,
 	messages []core.Message,
 	tools []core.ToolDef,
 	sampling *core.SamplingConfig,
@@ -123,7 +129,7 @@ func (p *OpenAIProvider) GenerateChat(
 	}
 	modelName = strings.TrimSuffix(modelName, ".gguf")
 
-	maxTokens := 4096
+	maxTokens := DefaultMaxTokens
 	if sampling != nil && sampling.MaxTokens != nil {
 		maxTokens = *sampling.MaxTokens
 	}
@@ -160,8 +166,14 @@ func (p *OpenAIProvider) GenerateChat(
 		p.requestLogger.LogRequest(requestID, messages, tools, sampling, payload)
 	}
 
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointURL, bytes.NewReader(body))
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
 	startTime := time.Now()
-	httpResp, err := p.client.Post(endpointURL, "application/json", bytes.NewReader(body))
+	httpResp, err := p.client.Do(httpReq)
 	duration := time.Since(startTime)
 
 	if err != nil {
@@ -0,0 +1,511 @@
+// Package search maintains a local inverted index over session messages for full-text search.
+package search
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/erg0nix/kontekst/internal/conversation"
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/session"
+)
+
+// indexVersion is bumped whenever the on-disk index layout or tokenization changes, forcing a rebuild.
+const indexVersion = 1
+
+// BM25 ranking parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// DefaultLimit is the number of results returned when a query sets no limit.
+const DefaultLimit = 20
+
+const snippetWidth = 160
+
+// searchableRoles are the message roles whose content is indexed.
+var searchableRoles = []core.Role{core.RoleUser, core.RoleAssistant, core.RoleTool}
+
+// ErrEmptyQuery is returned when a query contains no searchable terms.
+var ErrEmptyQuery = errors.New("search: query has no searchable terms")
+
+// Query describes a search. Zero-valued filters match everything.
+type Query struct {
+	Text  string
+	Agent string
+	Role  core.Role
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// Result is one matching message, identified by its session and live message index.
+type Result struct {
+	SessionID    core.SessionID
+	MessageIndex int
+	Role         core.Role
+	Agent        string
+	Time         time.Time
+	Score        float64
+	Snippet      string
+}
+
+// Index is a full-text index of the live messages of every session, stored as <data dir>/search/index.json.
+// Before each search it re-indexes the sessions whose files changed since they were last indexed and drops
+// the ones that were deleted.
+type Index struct {
+	sessions *session.FileService
+	path     string
+
+	mu   sync.Mutex
+	data *indexData
+}
+
+// New creates an Index over the sessions of the given service, stored under the service's data directory.
+func New(sessions *session.FileService) *Index {
+	return &Index{
+		sessions: sessions,
+		path:     filepath.Join(sessions.BaseDir, "search", "index.json"),
+	}
+}
+
+type indexData struct {
+	Version  int                                     `json:"version"`
+	Sessions map[core.SessionID]*sessionDoc          `json:"sessions"`
+	Postings map[string]map[core.SessionID][]posting `json:"postings"`
+}
+
+// sessionDoc records the session file state that was indexed and one entry per live message.
+type sessionDoc struct {
+	Size     int64        `json:"size"`
+	ModTime  time.Time    `json:"mod_time"`
+	Messages []messageDoc `json:"messages"`
+}
+
+type messageDoc struct {
+	Role   core.Role `json:"role"`
+	Agent  string    `json:"agent,omitempty"`
+	Time   time.Time `json:"time,omitzero"`
+	Length int       `json:"length"`
+}
+
+func (m messageDoc) searchable() bool {
+	return slices.Contains(searchableRoles, m.Role)
+}
+
+// posting is an occurrence count of a term in one message.
+type posting struct {
+	Message int `json:"m"`
+	Count   int `json:"n"`
+}
+
+func newIndexData() *indexData {
+	return &indexData{
+		Version:  indexVersion,
+		Sessions: make(map[core.SessionID]*sessionDoc),
+		Postings: make(map[string]map[core.SessionID][]posting),
+	}
+}
+
+// Search updates the index and returns the best matching messages, highest score first.
+func (ix *Index) Search(q Query) ([]Result, error) {
+	terms := uniqueTerms(q.Text)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if err := ix.update(); err != nil {
+		return nil, err
+	}
+
+	results := ix.rank(terms, q)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	ix.addSnippets(results, terms)
+	return results, nil
+}
+
+// Update brings the index in step with the session files without searching.
+func (ix *Index) Update() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	return ix.update()
+}
+
+func (ix *Index) update() error {
+	if ix.data == nil {
+		ix.data = ix.load()
+	}
+
+	list, err := ix.sessions.List()
+	if err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+
+	changed := false
+	live := make(map[core.SessionID]bool, len(list))
+	for _, info := range list {
+		live[info.ID] = true
+
+		doc := ix.data.Sessions[info.ID]
+		if doc != nil && doc.Size == info.FileSize && doc.ModTime.Equal(info.ModifiedAt) {
+			continue
+		}
+
+		if err := ix.indexSession(info); err != nil {
+			slog.Warn("failed to index session", "session_id", info.ID, "error", err)
+			continue
+		}
+		changed = true
+	}
+
+	for id := range ix.data.Sessions {
+		if !live[id] {
+			ix.removeSession(id)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := ix.save(); err != nil {
+			slog.Warn("failed to save search index", "path", ix.path, "error", err)
+		}
+	}
+	return nil
+}
+
+// indexSession replaces the session's postings with those of its current live messages.
+func (ix *Index) indexSession(info session.Info) error {
+	records, err := conversation.NewSessionFile(ix.sessions.Path(info.ID)).ReadRecords()
+	if err != nil {
+		return err
+	}
+
+	ix.removeSession(info.ID)
+
+	doc := &sessionDoc{Size: info.FileSize, ModTime: info.ModifiedAt}
+	agent := info.DefaultAgent
+
+	for _, rec := range conversation.LiveRecords(records) {
+		if rec.RunStart != nil && rec.RunStart.AgentName != "" {
+			agent = rec.RunStart.AgentName
+		}
+
+		msg, ok := rec.AsMessage()
+		if !ok {
+			continue
+		}
+
+		messageTime := rec.Time
+		if messageTime.IsZero() {
+			messageTime = info.CreatedAt
+		}
+
+		index := len(doc.Messages)
+		md := messageDoc{Role: msg.Role, Agent: agent, Time: messageTime}
+		if md.searchable() {
+			terms := tokenize(msg.Content)
+			md.Length = len(terms)
+			for term, count := range countTerms(terms) {
+				if ix.data.Postings[term] == nil {
+					ix.data.Postings[term] = make(map[core.SessionID][]posting)
+				}
+				ix.data.Postings[term][info.ID] = append(ix.data.Postings[term][info.ID], posting{Message: index, Count: count})
+			}
+		}
+		doc.Messages = append(doc.Messages, md)
+	}
+
+	ix.data.Sessions[info.ID] = doc
+	return nil
+}
+
+func (ix *Index) removeSession(id core.SessionID) {
+	if _, ok := ix.data.Sessions[id]; !ok {
+		return
+	}
+
+	delete(ix.data.Sessions, id)
+	for term, bySession := range ix.data.Postings {
+		delete(bySession, id)
+		if len(bySession) == 0 {
+			delete(ix.data.Postings, term)
+		}
+	}
+}
+
+type hit struct {
+	session core.SessionID
+	message int
+}
+
+// rank scores every message containing a query term with BM25, applying the query's filters.
+func (ix *Index) rank(terms []string, q Query) []Result {
+	documents, totalLength := 0, 0
+	for _, doc := range ix.data.Sessions {
+		for _, md := range doc.Messages {
+			if md.searchable() {
+				documents++
+				totalLength += md.Length
+			}
+		}
+	}
+	if documents == 0 {
+		return nil
+	}
+	avgLength := max(float64(totalLength)/float64(documents), 1)
+
+	scores := make(map[hit]float64)
+	for _, term := range terms {
+		bySession := ix.data.Postings[term]
+
+		frequency := 0
+		for _, postings := range bySession {
+			frequency += len(postings)
+		}
+		idf := math.Log(1 + (float64(documents)-float64(frequency)+0.5)/(float64(frequency)+0.5))
+
+		for id, postings := range bySession {
+			messages := ix.data.Sessions[id].Messages
+			for _, p := range postings {
+				md := messages[p.Message]
+				if !q.matches(md) {
+					continue
+				}
+				tf := float64(p.Count)
+				norm := bm25K1 * (1 - bm25B + bm25B*float64(md.Length)/avgLength)
+				scores[hit{id, p.Message}] += idf * tf * (bm25K1 + 1) / (tf + norm)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for h, score := range scores {
+		md := ix.data.Sessions[h.session].Messages[h.message]
+		results = append(results, Result{
+			SessionID:    h.session,
+			MessageIndex: h.message,
+			Role:         md.Role,
+			Agent:        md.Agent,
+			Time:         md.Time,
+			Score:        score,
+		})
+	}
+
+	slices.SortFunc(results, func(a, b Result) int {
+		return cmp.Or(
+			cmp.Compare(b.Score, a.Score),
+			b.Time.Compare(a.Time),
+			cmp.Compare(a.SessionID, b.SessionID),
+			cmp.Compare(a.MessageIndex, b.MessageIndex),
+		)
+	})
+	return results
+}
+
+func (q Query) matches(md messageDoc) bool {
+	switch {
+	case q.Agent != "" && md.Agent != q.Agent:
+		return false
+	case q.Role != "" && md.Role != q.Role:
+		return false
+	case !q.Since.IsZero() && md.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !md.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// addSnippets fills in a snippet for each result, reading each session's messages once.
+func (ix *Index) addSnippets(results []Result, terms []string) {
+	messages := make(map[core.SessionID][]core.Message)
+
+	for i := range results {
+		id := results[i].SessionID
+		if _, ok := messages[id]; !ok {
+			loaded, err := conversation.NewSessionFile(ix.sessions.Path(id)).LoadAll()
+			if err != nil {
+				slog.Warn("failed to load session for snippets", "session_id", id, "error", err)
+			}
+			messages[id] = loaded
+		}
+
+		if index := results[i].MessageIndex; index < len(messages[id]) {
+			results[i].Snippet = snippet(messages[id][index].Content, terms)
+		}
+	}
+}
+
+func (ix *Index) load() *indexData {
+	raw, err := os.ReadFile(ix.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read search index, rebuilding", "path", ix.path, "error", err)
+		}
+		return newIndexData()
+	}
+
+	data := newIndexData()
+	if err := json.Unmarshal(raw, data); err != nil || data.Version != indexVersion {
+		slog.Warn("search index is outdated or unreadable, rebuilding", "path", ix.path, "error", err)
+		return newIndexData()
+	}
+	return data
+}
+
+func (ix *Index) save() error {
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0o755); err != nil {
+		return fmt.Errorf("search: create index directory: %w", err)
+	}
+
+	raw, err := json.Marshal(ix.data)
+	if err != nil {
+		return fmt.Errorf("search: marshal index: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ix.path), "index-*.json")
+	if err != nil {
+		return fmt.Errorf("search: write index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("search: write index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("search: write index: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), ix.path); err != nil {
+		return fmt.Errorf("search: write index: %w", err)
+	}
+	return nil
+}
+
+// tokenize lowercases text and splits it into terms of letters and digits, dropping single characters.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return slices.DeleteFunc(fields, func(term string) bool {
+		return len([]rune(term)) < 2
+	})
+}
+
+func uniqueTerms(text string) []string {
+	terms := tokenize(text)
+	slices.Sort(terms)
+	return slices.Compact(terms)
+}
+
+func countTerms(terms []string) map[string]int {
+	counts := make(map[string]int, len(terms))
+	for _, term := range terms {
+		counts[term]++
+	}
+	return counts
+}
+
+// snippet returns a single-line excerpt of content around the first occurrence of any term.
+func snippet(content string, terms []string) string {
+	text := []rune(strings.Join(strings.Fields(content), " "))
+	lower := []rune(strings.ToLower(string(text)))
+
+	first := -1
+	for _, term := range terms {
+		if i := runeIndex(lower, []rune(term)); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+
+	start := max(first-snippetWidth/3, 0)
+	end := min(start+snippetWidth, len(text))
+	start = max(end-snippetWidth, 0)
+
+	excerpt := string(text[start:end])
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if end < len(text) {
+		excerpt += "…"
+	}
+	return excerpt
+}
+
+func runeIndex(haystack, needle []rune) int {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if slices.Equal(haystack[i:i+len(needle)], needle) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseRole validates a role filter. Only the roles whose content is indexed are accepted; empty means any.
+func ParseRole(s string) (core.Role, error) {
+	role := core.Role(s)
+	if role != "" && !slices.Contains(searchableRoles, role) {
+		return "", fmt.Errorf("unknown role %q (want user, assistant or tool)", s)
+	}
+	return role, nil
+}
+
+// ParseRange parses optional since and until bounds given as RFC 3339 times or YYYY-MM-DD dates.
+// A date-only until includes the whole day.
+func ParseRange(since, until string) (time.Time, time.Time, error) {
+	from, _, err := parseBound(since)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("since: %w", err)
+	}
+
+	to, dateOnly, err := parseBound(until)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("until: %w", err)
+	}
+	if dateOnly {
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("until must be after since")
+	}
+
+	return from, to, nil
+}
+
+func parseBound(s string) (time.Time, bool, error) {
+	if s == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("want YYYY-MM-DD or RFC 3339, got %q", s)
+	}
+	return t, false, nil
+}
@@ -0,0 +1,238 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/session"
+)
+
+func writeSession(t *testing.T, svc *session.FileService, id core.SessionID, lines ...string) {
+	t.Helper()
+	path := svc.Path(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestIndex(t *testing.T) (*Index, *session.FileService) {
+	t.Helper()
+	svc := &session.FileService{BaseDir: t.TempDir()}
+
+	writeSession(t, svc, "sess_ws",
+		`{"v":1,"type":"run_start","ts":"2026-03-01T10:00:00Z","run_start":{"run_id":"run_1","agent_name":"coder"}}`,
+		`{"v":1,"type":"message","ts":"2026-03-01T10:00:01Z","message":{"role":"user","content":"the websocket reconnect loop hangs"}}`,
+		`{"v":1,"type":"message","ts":"2026-03-01T10:00:02Z","message":{"role":"assistant","content":"Fixed the websocket reconnect by resetting the backoff timer."}}`,
+		`{"v":1,"type":"message","ts":"2026-03-01T10:00:03Z","message":{"role":"tool","content":"ok: websocket_test.go passed"}}`,
+	)
+	writeSession(t, svc, "sess_db",
+		`{"v":1,"type":"run_start","ts":"2026-04-10T09:00:00Z","run_start":{"run_id":"run_1","agent_name":"reviewer"}}`,
+		`{"v":1,"type":"message","ts":"2026-04-10T09:00:01Z","message":{"role":"system","content":"websocket websocket websocket"}}`,
+		`{"v":1,"type":"message","ts":"2026-04-10T09:00:02Z","message":{"role":"user","content":"why is the database migration slow"}}`,
+		`{"v":1,"type":"message","ts":"2026-04-10T09:00:03Z","message":{"role":"assistant","content":"The migration rebuilds an index; a websocket is not involved."}}`,
+	)
+
+	return New(svc), svc
+}
+
+func resultKeys(results []Result) []string {
+	var keys []string
+	for _, result := range results {
+		keys = append(keys, fmt.Sprintf("%s#%d", result.SessionID, result.MessageIndex))
+	}
+	return keys
+}
+
+func TestSearch(t *testing.T) {
+	ix, _ := newTestIndex(t)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{name: "ranked by relevance", query: Query{Text: "websocket reconnect"}, want: []string{"sess_ws#0", "sess_ws#1", "sess_ws#2", "sess_db#2"}},
+		{name: "system messages are not indexed", query: Query{Text: "websocket", Role: core.RoleUser}, want: []string{"sess_ws#0"}},
+		{name: "agent filter", query: Query{Text: "websocket", Agent: "reviewer"}, want: []string{"sess_db#2"}},
+		{name: "role filter", query: Query{Text: "websocket", Role: core.RoleTool}, want: []string{"sess_ws#2"}},
+		{name: "since filter", query: Query{Text: "websocket", Since: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)}, want: []string{"sess_db#2"}},
+		{name: "until filter", query: Query{Text: "migration", Until: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "limit", query: Query{Text: "websocket reconnect", Limit: 1}, want: []string{"sess_ws#0"}},
+		{name: "case insensitive", query: Query{Text: "MIGRATION"}, want: []string{"sess_db#1", "sess_db#2"}},
+		{name: "no match", query: Query{Text: "kubernetes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := ix.Search(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := resultKeys(results); !slices.Equal(got, tt.want) {
+				t.Fatalf("results = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch_ResultFields(t *testing.T) {
+	ix, _ := newTestIndex(t)
+
+	results, err := ix.Search(Query{Text: "backoff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected one result, got %v", resultKeys(results))
+	}
+
+	got := results[0]
+	if got.Role != core.RoleAssistant || got.Agent != "coder" || got.Score <= 0 {
+		t.Errorf("unexpected result %+v", got)
+	}
+	if !got.Time.Equal(time.Date(2026, 3, 1, 10, 0, 2, 0, time.UTC)) {
+		t.Errorf("time = %v", got.Time)
+	}
+	if !strings.Contains(got.Snippet, "resetting the backoff timer") {
+		t.Errorf("snippet = %q", got.Snippet)
+	}
+}
+
+func TestSearch_EmptyQuery(t *testing.T) {
+	ix, _ := newTestIndex(t)
+
+	for _, text := range []string{"", "  ", "?!"} {
+		if _, err := ix.Search(Query{Text: text}); err != ErrEmptyQuery {
+			t.Errorf("Search(%q) error = %v, want ErrEmptyQuery", text, err)
+		}
+	}
+}
+
+func TestSearch_IncrementalUpdate(t *testing.T) {
+	ix, svc := newTestIndex(t)
+
+	if err := ix.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(svc.BaseDir, "search", "index.json")); err != nil {
+		t.Fatalf("expected the index to be saved: %v", err)
+	}
+
+	file, err := os.OpenFile(svc.Path("sess_db"), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"v":1,"type":"message","ts":"2026-04-10T09:05:00Z","message":{"role":"user","content":"and the reconnect storm?"}}` + "\n")
+	file.Close()
+
+	// A fresh index loads the saved state and picks up only the changed file.
+	reopened := New(svc)
+	results, err := reopened.Search(Query{Text: "reconnect"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultKeys(results); !slices.Contains(got, "sess_db#3") {
+		t.Fatalf("expected the appended message to be found, got %v", got)
+	}
+
+	if err := svc.Delete("sess_ws"); err != nil {
+		t.Fatal(err)
+	}
+	results, err = reopened.Search(Query{Text: "reconnect"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultKeys(results); !slices.Equal(got, []string{"sess_db#3"}) {
+		t.Fatalf("expected deleted session to be dropped, got %v", got)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "Fix the WebSocket reconnect!", want: []string{"fix", "the", "websocket", "reconnect"}},
+		{text: "a b c", want: nil},
+		{text: "read_file(path) → 42", want: []string{"read", "file", "path", "42"}},
+		{text: "Grüße über", want: []string{"grüße", "über"}},
+	}
+
+	for _, tt := range tests {
+		if got := tokenize(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("filler ", 40) + "the needle is here " + strings.Repeat("tail ", 40)
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "short", content: "a  short\nmessage", want: "a short message"},
+		{name: "no term found", content: "nothing relevant", want: "nothing relevant"},
+	}
+	for _, tt := range tests {
+		if got := snippet(tt.content, []string{"needle"}); got != tt.want {
+			t.Errorf("%s: snippet = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	got := snippet(long, []string{"needle"})
+	if !strings.Contains(got, "needle") || !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("snippet = %q", got)
+	}
+	if n := len([]rune(got)); n != snippetWidth+2 {
+		t.Errorf("snippet length = %d, want %d", n, snippetWidth+2)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		since     string
+		until     string
+		wantSince time.Time
+		wantUntil time.Time
+		wantErr   bool
+	}{
+		{name: "empty"},
+		{name: "dates", since: "2026-03-01", until: "2026-03-02",
+			wantSince: time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local), wantUntil: time.Date(2026, 3, 3, 0, 0, 0, 0, time.Local)},
+		{name: "rfc3339", since: "2026-03-01T10:00:00Z",
+			wantSince: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{name: "bad date", since: "yesterday", wantErr: true},
+		{name: "reversed", since: "2026-03-05", until: "2026-03-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			since, until, err := ParseRange(tt.since, tt.until)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !since.Equal(tt.wantSince) || !until.Equal(tt.wantUntil) {
+				t.Errorf("range = %v..%v, want %v..%v", since, until, tt.wantSince, tt.wantUntil)
+			}
+		})
+	}
+}
@@ -1,22 +1,37 @@
 package session
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/erg0nix/kontekst/internal/conversation"
 	"github.com/erg0nix/kontekst/internal/core"
 )
 
 // FileService implements Service using JSONL files on the local filesystem.
+// It caches session info between calls and refreshes an entry when its files change on disk.
 type FileService struct {
 	BaseDir string
+
+	mu      sync.Mutex
+	catalog map[core.SessionID]catalogEntry
+}
+
+// catalogEntry is cached session info with the file state it was computed from.
+type catalogEntry struct {
+	info    Info
+	size    int64
+	modTime time.Time
+	metaMod time.Time
 }
 
 func (service *FileService) sessionDir() string {
@@ -27,6 +42,11 @@ func (service *FileService) sessionPath(id core.SessionID) string {
 	return filepath.Join(service.sessionDir(), string(id)+".jsonl")
 }
 
+// Path returns the JSONL file that backs the session.
+func (service *FileService) Path(id core.SessionID) string {
+	return service.sessionPath(id)
+}
+
 // Create generates a new session ID and creates its backing file, returning the ID and file path.
 func (service *FileService) Create() (core.SessionID, string, error) {
 	sessionID := core.NewSessionID()
@@ -65,50 +85,315 @@ func (service *FileService) metaPath(sessionID core.SessionID) string {
 	return filepath.Join(service.sessionDir(), string(sessionID)+".meta.json")
 }
 
-// GetDefaultAgent returns the default agent name stored in the session's metadata file.
-func (service *FileService) GetDefaultAgent(sessionID core.SessionID) (string, error) {
+func (service *FileService) readMeta(sessionID core.SessionID) (sessionMeta, error) {
+	var meta sessionMeta
+
 	data, err := os.ReadFile(service.metaPath(sessionID))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", nil
+			return meta, nil
 		}
-		return "", fmt.Errorf("read session metadata: %w", err)
+		return meta, fmt.Errorf("read session metadata: %w", err)
 	}
 
-	var meta sessionMeta
 	if err := json.Unmarshal(data, &meta); err != nil {
-		return "", fmt.Errorf("parse session metadata: %w", err)
+		return meta, fmt.Errorf("parse session metadata: %w", err)
 	}
 
-	return meta.DefaultAgent, nil
+	return meta, nil
 }
 
-// SetDefaultAgent persists the given agent name as the default for the session.
-func (service *FileService) SetDefaultAgent(sessionID core.SessionID, agentName string) error {
+// updateMeta applies update to the session's metadata. It holds the session file's lock, so updates from
+// other goroutines or processes are not lost, and replaces the file through a temp file and rename so a
+// reader never sees it half written.
+func (service *FileService) updateMeta(sessionID core.SessionID, update func(meta *sessionMeta)) error {
 	metaPath := service.metaPath(sessionID)
 
-	var meta sessionMeta
-	data, err := os.ReadFile(metaPath)
-	if err == nil {
-		if err := json.Unmarshal(data, &meta); err != nil {
-			slog.Warn("failed to parse session metadata", "path", metaPath, "error", err)
-		}
+	unlock, err := conversation.NewSessionFile(service.sessionPath(sessionID)).Lock()
+	if err != nil {
+		return fmt.Errorf("lock session metadata: %w", err)
 	}
+	defer unlock()
 
-	meta.DefaultAgent = agentName
+	meta, err := service.readMeta(sessionID)
+	if err != nil {
+		slog.Warn("failed to read session metadata", "path", metaPath, "error", err)
+		meta = sessionMeta{}
+	}
 
-	data, err = json.Marshal(meta)
+	update(&meta)
+
+	data, err := json.Marshal(meta)
 	if err != nil {
 		return fmt.Errorf("marshal session metadata: %w", err)
 	}
 
-	if err := os.WriteFile(metaPath, data, 0o644); err != nil {
+	tmp, err := os.CreateTemp(service.sessionDir(), filepath.Base(metaPath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write session metadata: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
 		return fmt.Errorf("write session metadata: %w", err)
 	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write session metadata: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), metaPath); err != nil {
+		return fmt.Errorf("write session metadata: %w", err)
+	}
+
+	return nil
+}
+
+// GetDefaultAgent returns the default agent name stored in the session's metadata file.
+func (service *FileService) GetDefaultAgent(sessionID core.SessionID) (string, error) {
+	meta, err := service.readMeta(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	return meta.DefaultAgent, nil
+}
+
+// SetDefaultAgent persists the given agent name as the default for the session.
+func (service *FileService) SetDefaultAgent(sessionID core.SessionID, agentName string) error {
+	return service.updateMeta(sessionID, func(meta *sessionMeta) {
+		meta.DefaultAgent = agentName
+	})
+}
+
+// GetPlan returns the todo list stored in the session's metadata file.
+func (service *FileService) GetPlan(sessionID core.SessionID) ([]core.PlanEntry, error) {
+	meta, err := service.readMeta(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return meta.Plan, nil
+}
+
+// SetPlan persists the session's todo list, replacing any previous one.
+func (service *FileService) SetPlan(sessionID core.SessionID, entries []core.PlanEntry) error {
+	return service.updateMeta(sessionID, func(meta *sessionMeta) {
+		meta.Plan = entries
+	})
+}
+
+// GetTitle returns the session's title, or an empty string if it has none yet.
+func (service *FileService) GetTitle(sessionID core.SessionID) (string, error) {
+	meta, err := service.readMeta(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	return meta.Title, nil
+}
 
+// SetTitle replaces the session's title.
+func (service *FileService) SetTitle(sessionID core.SessionID, title string) error {
+	if err := service.exists(sessionID); err != nil {
+		return err
+	}
+
+	return service.updateMeta(sessionID, func(meta *sessionMeta) {
+		meta.Title = strings.TrimSpace(title)
+	})
+}
+
+// Tag adds and removes tags on the session and returns the resulting tags, sorted.
+func (service *FileService) Tag(sessionID core.SessionID, add, remove []string) ([]string, error) {
+	if err := service.exists(sessionID); err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	err := service.updateMeta(sessionID, func(meta *sessionMeta) {
+		for _, tag := range add {
+			if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(meta.Tags, tag) {
+				meta.Tags = append(meta.Tags, tag)
+			}
+		}
+		meta.Tags = slices.DeleteFunc(meta.Tags, func(tag string) bool {
+			return slices.Contains(remove, tag)
+		})
+		slices.Sort(meta.Tags)
+		tags = meta.Tags
+	})
+	return tags, err
+}
+
+// SetWorkingDir records the directory the session's runs work in.
+func (service *FileService) SetWorkingDir(sessionID core.SessionID, dir string) error {
+	return service.updateMeta(sessionID, func(meta *sessionMeta) {
+		meta.WorkingDir = dir
+	})
+}
+
+// AddUsage adds the token usage of a run to the session's running totals.
+func (service *FileService) AddUsage(sessionID core.SessionID, promptTokens, completionTokens int) error {
+	return service.updateMeta(sessionID, func(meta *sessionMeta) {
+		meta.Usage.PromptTokens += promptTokens
+		meta.Usage.CompletionTokens += completionTokens
+	})
+}
+
+func (service *FileService) exists(sessionID core.SessionID) error {
+	if _, err := os.Stat(service.sessionPath(sessionID)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+		}
+		return fmt.Errorf("stat session: %w", err)
+	}
 	return nil
 }
 
+// Fork creates a new session whose history is a copy of the parent's up to and including message index at.
+// A negative index copies the whole history. The child inherits the parent's title, tags, working directory,
+// default agent and plan, but not its token usage. When the cut lands on an assistant message with tool calls,
+// the tool results that follow it are kept so the forked conversation stays well-formed.
+// The parent/child link is recorded in both sessions' metadata.
+func (service *FileService) Fork(parentID core.SessionID, at int) (core.SessionID, error) {
+	records, err := liveRecords(service.sessionPath(parentID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, parentID)
+		}
+		return "", fmt.Errorf("read parent session: %w", err)
+	}
+
+	indexes := messageIndexes(records)
+	if at >= len(indexes) {
+		return "", fmt.Errorf("message index %d out of range: session %s has %d messages", at, parentID, len(indexes))
+	}
+
+	keep := len(records)
+	if at >= 0 {
+		keep = forkCutoff(records, indexes[at])
+	}
+	kept := len(messageIndexes(records[:keep]))
+
+	parentMeta, err := service.readMeta(parentID)
+	if err != nil {
+		slog.Warn("failed to read parent session metadata", "session_id", parentID, "error", err)
+	}
+
+	childID, childPath, err := service.Create()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, rec := range records[:keep] {
+		rec.Version = conversation.RecordVersion
+		if err := encoder.Encode(rec); err != nil {
+			os.Remove(childPath)
+			return "", fmt.Errorf("encode forked session: %w", err)
+		}
+	}
+	if err := os.WriteFile(childPath, buf.Bytes(), 0o644); err != nil {
+		os.Remove(childPath)
+		return "", fmt.Errorf("write forked session: %w", err)
+	}
+
+	if err := service.updateMeta(childID, func(meta *sessionMeta) {
+		meta.Title = parentMeta.Title
+		meta.Tags = parentMeta.Tags
+		meta.WorkingDir = parentMeta.WorkingDir
+		meta.DefaultAgent = parentMeta.DefaultAgent
+		meta.Plan = parentMeta.Plan
+		meta.Parent = parentID
+		meta.ForkedAt = kept
+	}); err != nil {
+		return "", err
+	}
+
+	if err := service.updateMeta(parentID, func(meta *sessionMeta) {
+		meta.Children = append(meta.Children, childID)
+	}); err != nil {
+		return "", err
+	}
+
+	return childID, nil
+}
+
+// MigrateResult reports what Migrate did to one session file.
+type MigrateResult struct {
+	ID          core.SessionID
+	Rewritten   bool
+	Quarantined int
+}
+
+// Migrate rewrites every session file that still holds legacy or damaged lines into versioned records,
+// quarantining the damaged ones.
+func (service *FileService) Migrate() ([]MigrateResult, error) {
+	list, err := service.List()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]MigrateResult, 0, len(list))
+	for _, info := range list {
+		rewritten, quarantined, err := conversation.NewSessionFile(service.sessionPath(info.ID)).Migrate()
+		if err != nil {
+			return results, fmt.Errorf("migrate session %s: %w", info.ID, err)
+		}
+		results = append(results, MigrateResult{ID: info.ID, Rewritten: rewritten, Quarantined: quarantined})
+	}
+
+	return results, nil
+}
+
+// RepairResult reports the damaged lines found in one session file.
+type RepairResult struct {
+	ID             core.SessionID
+	Damage         []conversation.Damage
+	QuarantinePath string
+}
+
+// Repair checks the given sessions, or every session when none are given, for torn and corrupt lines.
+// Unless dryRun is set, damaged lines are removed: torn trailing lines are truncated and the rest quarantined.
+func (service *FileService) Repair(ids []core.SessionID, dryRun bool) ([]RepairResult, error) {
+	if len(ids) == 0 {
+		list, err := service.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range list {
+			ids = append(ids, info.ID)
+		}
+	}
+
+	results := make([]RepairResult, 0, len(ids))
+	for _, id := range ids {
+		path := service.sessionPath(id)
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				return results, fmt.Errorf("%w: %s", ErrNotFound, id)
+			}
+			return results, fmt.Errorf("stat session: %w", err)
+		}
+
+		sessionFile := conversation.NewSessionFile(path)
+		check := sessionFile.Repair
+		if dryRun {
+			check = sessionFile.Check
+		}
+
+		damage, err := check()
+		if err != nil {
+			return results, fmt.Errorf("repair session %s: %w", id, err)
+		}
+		results = append(results, RepairResult{ID: id, Damage: damage, QuarantinePath: sessionFile.QuarantinePath()})
+	}
+
+	return results, nil
+}
+
 // List returns all sessions sorted by most recently modified first.
 func (service *FileService) List() ([]Info, error) {
 	dir := service.sessionDir()
@@ -149,21 +434,83 @@ func (service *FileService) Get(sessionID core.SessionID) (Info, error) {
 	stat, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return Info{}, fmt.Errorf("session not found: %s", sessionID)
+			service.forget(sessionID)
+			return Info{}, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
 		}
 		return Info{}, fmt.Errorf("stat session: %w", err)
 	}
 
-	agent, _ := service.GetDefaultAgent(sessionID)
+	var metaMod time.Time
+	if metaStat, err := os.Stat(service.metaPath(sessionID)); err == nil {
+		metaMod = metaStat.ModTime()
+	}
 
-	return Info{
+	service.mu.Lock()
+	cached, ok := service.catalog[sessionID]
+	service.mu.Unlock()
+	if ok && cached.size == stat.Size() && cached.modTime.Equal(stat.ModTime()) && cached.metaMod.Equal(metaMod) {
+		return cached.info, nil
+	}
+
+	meta, err := service.readMeta(sessionID)
+	if err != nil {
+		slog.Warn("failed to read session metadata", "session_id", sessionID, "error", err)
+	}
+
+	info := Info{
 		ID:           sessionID,
-		DefaultAgent: agent,
-		MessageCount: countLines(path),
+		Title:        meta.Title,
+		Tags:         meta.Tags,
+		DefaultAgent: meta.DefaultAgent,
+		WorkingDir:   meta.WorkingDir,
+		Usage:        meta.Usage,
+		ParentID:     meta.Parent,
+		ForkedAt:     meta.ForkedAt,
+		Children:     meta.Children,
+		MessageCount: countMessages(path),
 		FileSize:     stat.Size(),
 		CreatedAt:    parseSessionTimestamp(sessionID),
 		ModifiedAt:   stat.ModTime(),
-	}, nil
+	}
+
+	service.mu.Lock()
+	if service.catalog == nil {
+		service.catalog = make(map[core.SessionID]catalogEntry)
+	}
+	service.catalog[sessionID] = catalogEntry{info: info, size: stat.Size(), modTime: stat.ModTime(), metaMod: metaMod}
+	service.mu.Unlock()
+
+	return info, nil
+}
+
+func (service *FileService) forget(sessionID core.SessionID) {
+	service.mu.Lock()
+	delete(service.catalog, sessionID)
+	service.mu.Unlock()
+}
+
+// Prune deletes the sessions last modified before cutoff, except the excluded ones, and returns them.
+// With dryRun set it only returns the sessions that would be deleted.
+func (service *FileService) Prune(cutoff time.Time, dryRun bool, exclude ...core.SessionID) ([]Info, error) {
+	list, err := service.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []Info
+	for _, info := range list {
+		if !info.ModifiedAt.Before(cutoff) || slices.Contains(exclude, info.ID) {
+			continue
+		}
+		if !dryRun {
+			if err := service.Delete(info.ID); err != nil {
+				return pruned, err
+			}
+		}
+		pruned = append(pruned, info)
+	}
+
+	return pruned, nil
 }
 
 // Delete removes the session's data and metadata files from disk.
@@ -172,7 +519,7 @@ func (service *FileService) Delete(sessionID core.SessionID) error {
 
 	if _, err := os.Stat(path); err != nil {
 		if os.IsNotExist(err) {
-			return fmt.Errorf("session not found: %s", sessionID)
+			return fmt.Errorf("%w: %s", ErrNotFound, sessionID)
 		}
 		return fmt.Errorf("stat session: %w", err)
 	}
@@ -180,41 +527,86 @@ func (service *FileService) Delete(sessionID core.SessionID) error {
 	if err := os.Remove(path); err != nil {
 		return fmt.Errorf("delete session: %w", err)
 	}
+	service.forget(sessionID)
 
 	metaPath := service.metaPath(sessionID)
 	if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("delete session metadata: %w", err)
 	}
 
+	for _, extra := range []string{path + ".idx", path + ".lock", path + ".quarantine"} {
+		if err := os.Remove(extra); err != nil && !os.IsNotExist(err) {
+			slog.Warn("failed to delete session file", "path", extra, "error", err)
+		}
+	}
+
 	return nil
 }
 
 type sessionMeta struct {
-	DefaultAgent string `json:"default_agent,omitempty"`
+	Title        string           `json:"title,omitempty"`
+	Tags         []string         `json:"tags,omitempty"`
+	WorkingDir   string           `json:"working_dir,omitempty"`
+	Usage        Usage            `json:"usage,omitzero"`
+	DefaultAgent string           `json:"default_agent,omitempty"`
+	Plan         []core.PlanEntry `json:"plan,omitempty"`
+	Parent       core.SessionID   `json:"parent,omitempty"`
+	ForkedAt     int              `json:"forked_at,omitempty"`
+	Children     []core.SessionID `json:"children,omitempty"`
 }
 
-func countLines(path string) int {
-	f, err := os.Open(path)
+// liveRecords reads a session file and applies its tombstones and summaries.
+func liveRecords(path string) ([]conversation.Record, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	records, err := conversation.NewSessionFile(path).ReadRecords()
 	if err != nil {
-		return 0
+		return nil, err
 	}
-	defer f.Close()
+	return conversation.LiveRecords(records), nil
+}
 
-	count := 0
-	buf := make([]byte, 32*1024)
-	for {
-		n, err := f.Read(buf)
-		for i := range n {
-			if buf[i] == '\n' {
-				count++
-			}
+// messageIndexes returns the record index of each message-like record.
+func messageIndexes(records []conversation.Record) []int {
+	var indexes []int
+	for i, rec := range records {
+		if _, ok := rec.AsMessage(); ok {
+			indexes = append(indexes, i)
 		}
-		if err == io.EOF {
+	}
+	return indexes
+}
+
+// forkCutoff returns how many records to keep when forking at record index at,
+// extending past at to include the tool results of a trailing assistant tool call.
+func forkCutoff(records []conversation.Record, at int) int {
+	keep := at + 1
+
+	msg, ok := records[at].AsMessage()
+	if !ok || len(msg.ToolCalls) == 0 {
+		return keep
+	}
+
+	for keep < len(records) {
+		next, ok := records[keep].AsMessage()
+		if !ok || next.Role != core.RoleTool {
 			break
 		}
-		if err != nil {
-			return count
-		}
+		keep++
+	}
+
+	return keep
+}
+
+// countMessages counts the live messages of a session file using its index, discounting tombstones
+// and the messages they supersede.
+func countMessages(path string) int {
+	count, err := conversation.NewSessionFile(path).MessageCount()
+	if err != nil {
+		slog.Warn("failed to count session messages", "path", path, "error", err)
+		return 0
 	}
 	return count
 }
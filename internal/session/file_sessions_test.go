@@ -1,9 +1,12 @@
 package session
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,7 +18,7 @@ func newTestService(t *testing.T) *FileService {
 	return &FileService{BaseDir: t.TempDir()}
 }
 
-func createSessionFile(t *testing.T, svc *FileService, id core.SessionID, content string) {
+func createSessionFile(t testing.TB, svc *FileService, id core.SessionID, content string) {
 	t.Helper()
 	dir := svc.sessionDir()
 	if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -114,7 +117,7 @@ func TestGet_ExistingSession(t *testing.T) {
 	svc := newTestService(t)
 	id := core.SessionID("sess_20250212T123045.000000000_a1b2c3d4e5f6")
 
-	createSessionFile(t, svc, id, "msg1\nmsg2\nmsg3\n")
+	createSessionFile(t, svc, id, "{\"role\":\"user\",\"content\":\"1\"}\n{\"role\":\"assistant\",\"content\":\"2\"}\n{\"role\":\"user\",\"content\":\"3\"}\n")
 	if err := svc.SetDefaultAgent(id, "coder"); err != nil {
 		t.Fatal(err)
 	}
@@ -226,6 +229,40 @@ func TestDelete_NotFound(t *testing.T) {
 	}
 }
 
+func TestPlan_RoundTripPreservesDefaultAgent(t *testing.T) {
+	svc := newTestService(t)
+	id := core.SessionID("sess_20250101T000000.000000000_aaaaaaaaaaaa")
+
+	createSessionFile(t, svc, id, "")
+	if err := svc.SetDefaultAgent(id, "coder"); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := []core.PlanEntry{
+		{Content: "Write parser", Priority: core.PlanPriorityHigh, Status: core.PlanStatusInProgress},
+		{Content: "Add tests", Priority: core.PlanPriorityMedium, Status: core.PlanStatusPending},
+	}
+	if err := svc.SetPlan(id, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := svc.GetPlan(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != plan[0] || got[1] != plan[1] {
+		t.Fatalf("plan = %+v, want %+v", got, plan)
+	}
+
+	agent, err := svc.GetDefaultAgent(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent != "coder" {
+		t.Fatalf("default agent = %q, want coder", agent)
+	}
+}
+
 func TestParseSessionTimestamp(t *testing.T) {
 	tests := []struct {
 		id   core.SessionID
@@ -263,8 +300,8 @@ func TestList_IgnoresMetaFiles(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(entries) != 2 {
-		t.Fatalf("expected 2 files (.jsonl + .meta.json), got %d", len(entries))
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 files (.jsonl, .meta.json and .jsonl.lock), got %d", len(entries))
 	}
 
 	list, err := svc.List()
@@ -273,25 +310,375 @@ func TestList_IgnoresMetaFiles(t *testing.T) {
 	}
 
 	if len(list) != 1 {
-		t.Fatalf("expected 1 session (ignoring .meta.json), got %d", len(list))
+		t.Fatalf("expected 1 session (ignoring .meta.json and .lock), got %d", len(list))
 	}
 }
 
-func TestCountLines(t *testing.T) {
+func TestCountMessages(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "test.jsonl")
 
-	if err := os.WriteFile(path, []byte("a\nb\nc\n"), 0o644); err != nil {
+	content := strings.Join([]string{
+		`{"role":"user","content":"a"}`,
+		`{"v":1,"type":"run_start","run_start":{"run_id":"run_1"}}`,
+		`{"v":1,"type":"message","message":{"role":"assistant","content":"b"}}`,
+		`not json`,
+		`{"v":1,"type":"message","message":{"role":"user","content":"c"}}`,
+	}, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	if n := countLines(path); n != 3 {
-		t.Fatalf("expected 3 lines, got %d", n)
+	if n := countMessages(path); n != 3 {
+		t.Fatalf("expected 3 messages, got %d", n)
 	}
 
 	if err := os.WriteFile(path, []byte(""), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	if n := countLines(path); n != 0 {
-		t.Fatalf("expected 0 lines, got %d", n)
+	if n := countMessages(path); n != 0 {
+		t.Fatalf("expected 0 messages, got %d", n)
+	}
+}
+
+func TestFork(t *testing.T) {
+	history := strings.Join([]string{
+		`{"role":"user","content":"list files"}`,
+		`{"role":"assistant","tool_calls":[{"id":"c1","name":"list_files"}]}`,
+		`{"role":"tool","content":"a.go"}`,
+		`{"role":"assistant","content":"a.go"}`,
+		`{"role":"user","content":"now read it"}`,
+	}, "\n") + "\n"
+
+	tests := []struct {
+		name         string
+		at           int
+		wantMessages int
+	}{
+		{"whole history", -1, 5},
+		{"first message", 0, 1},
+		{"tool call keeps its results", 1, 3},
+		{"after tool result", 3, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t)
+			parentID := core.SessionID("sess_20250101T000000.000000000_aaaaaaaaaaaa")
+			createSessionFile(t, svc, parentID, history)
+			if err := svc.SetDefaultAgent(parentID, "coder"); err != nil {
+				t.Fatal(err)
+			}
+			if err := svc.SetTitle(parentID, "List files"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := svc.Tag(parentID, []string{"demo"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			childID, err := svc.Fork(parentID, tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			child, err := svc.Get(childID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if child.MessageCount != tt.wantMessages {
+				t.Errorf("messages = %d, want %d", child.MessageCount, tt.wantMessages)
+			}
+			if child.ParentID != parentID || child.ForkedAt != tt.wantMessages {
+				t.Errorf("parent link = %s@%d, want %s@%d", child.ParentID, child.ForkedAt, parentID, tt.wantMessages)
+			}
+			if child.DefaultAgent != "coder" {
+				t.Errorf("default agent = %q, want inherited coder", child.DefaultAgent)
+			}
+			if child.Title != "List files" || !slices.Equal(child.Tags, []string{"demo"}) {
+				t.Errorf("title and tags = %q %v, want inherited", child.Title, child.Tags)
+			}
+
+			parent, err := svc.Get(parentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parent.Children) != 1 || parent.Children[0] != childID {
+				t.Errorf("parent children = %v, want [%s]", parent.Children, childID)
+			}
+			if parent.MessageCount != 5 {
+				t.Errorf("parent must be left untouched, has %d messages", parent.MessageCount)
+			}
+		})
+	}
+}
+
+func TestTitleAndTags(t *testing.T) {
+	svc := newTestService(t)
+	id := core.SessionID("sess_20250101T000000.000000000_aaaaaaaaaaaa")
+	createSessionFile(t, svc, id, `{"role":"user","content":"hi"}`+"\n")
+
+	if err := svc.SetTitle(id, "  Fix the parser  "); err != nil {
+		t.Fatal(err)
+	}
+	if title, _ := svc.GetTitle(id); title != "Fix the parser" {
+		t.Errorf("title = %q", title)
+	}
+
+	tags, err := svc.Tag(id, []string{"bug", "parser", "bug", " "}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags, []string{"bug", "parser"}) {
+		t.Errorf("tags = %v, want [bug parser]", tags)
+	}
+
+	tags, err = svc.Tag(id, []string{"urgent"}, []string{"bug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags, []string{"parser", "urgent"}) {
+		t.Errorf("tags = %v, want [parser urgent]", tags)
+	}
+
+	missing := core.SessionID("sess_20250101T000000.000000000_bbbbbbbbbbbb")
+	if err := svc.SetTitle(missing, "x"); err == nil {
+		t.Error("expected error titling a missing session")
+	}
+	if _, err := svc.Tag(missing, []string{"x"}, nil); err == nil {
+		t.Error("expected error tagging a missing session")
+	}
+}
+
+func TestUsageAndWorkingDir(t *testing.T) {
+	svc := newTestService(t)
+	id := core.SessionID("sess_20250101T000000.000000000_aaaaaaaaaaaa")
+	createSessionFile(t, svc, id, `{"role":"user","content":"hi"}`+"\n")
+
+	for range 2 {
+		if err := svc.AddUsage(id, 100, 20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.SetWorkingDir(id, "/src/app"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := svc.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Usage != (Usage{PromptTokens: 200, CompletionTokens: 40}) || info.Usage.Total() != 240 {
+		t.Errorf("usage = %+v", info.Usage)
 	}
+	if info.WorkingDir != "/src/app" {
+		t.Errorf("working dir = %q", info.WorkingDir)
+	}
+}
+
+func TestAddUsage_Concurrent(t *testing.T) {
+	svc := newTestService(t)
+	id := core.SessionID("sess_20250101T000000.000000000_aaaaaaaaaaaa")
+	createSessionFile(t, svc, id, "")
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if err := svc.AddUsage(id, 10, 1); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	meta, err := svc.readMeta(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Usage != (Usage{PromptTokens: 200, CompletionTokens: 20}) {
+		t.Errorf("usage = %+v, want every update counted", meta.Usage)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	svc := newTestService(t)
+	old := core.SessionID("sess_20250101T000000.000000000_aaaaaaaaaaaa")
+	active := core.SessionID("sess_20250101T000000.000000000_bbbbbbbbbbbb")
+	recent := core.SessionID("sess_20250101T000000.000000000_cccccccccccc")
+
+	monthAgo := time.Now().Add(-30 * 24 * time.Hour)
+	for _, id := range []core.SessionID{old, active, recent} {
+		createSessionFile(t, svc, id, `{"role":"user","content":"hi"}`+"\n")
+		if id != recent {
+			if err := os.Chtimes(svc.sessionPath(id), monthAgo, monthAgo); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	cutoff := time.Now().Add(-7 * 24 * time.Hour)
+	pruned, err := svc.Prune(cutoff, true, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].ID != old {
+		t.Fatalf("dry run pruned %v, want only %s", pruned, old)
+	}
+	if _, err := os.Stat(svc.sessionPath(old)); err != nil {
+		t.Fatalf("dry run must not delete: %v", err)
+	}
+
+	if _, err := svc.Prune(cutoff, false, active); err != nil {
+		t.Fatal(err)
+	}
+	list, err := svc.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Errorf("sessions left = %d, want 2", len(list))
+	}
+	if _, err := os.Stat(svc.sessionPath(old)); !os.IsNotExist(err) {
+		t.Error("expected old session to be deleted")
+	}
+}
+
+func TestFork_Errors(t *testing.T) {
+	svc := newTestService(t)
+	parentID := core.SessionID("sess_20250101T000000.000000000_aaaaaaaaaaaa")
+	createSessionFile(t, svc, parentID, `{"role":"user","content":"hi"}`+"\n")
+
+	if _, err := svc.Fork(parentID, 1); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("expected out of range error, got %v", err)
+	}
+	if _, err := svc.Fork("missing", -1); err == nil || !strings.Contains(err.Error(), "session not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	svc := newTestService(t)
+	damaged := core.SessionID("sess_20250101T000000.000000000_aaaaaaaaaaaa")
+	clean := core.SessionID("sess_20250102T000000.000000000_bbbbbbbbbbbb")
+	createSessionFile(t, svc, damaged, "{\"role\":\"user\",\"content\":\"q1\"}\ngarbage\n{\"role\":\"assistant\",\"content\":\"a1\"}\n")
+	createSessionFile(t, svc, clean, "{\"role\":\"user\",\"content\":\"q1\"}\n")
+
+	results, err := svc.Repair(nil, true)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected every session to be checked, got %d", len(results))
+	}
+	for _, result := range results {
+		if want := map[core.SessionID]int{damaged: 1, clean: 0}[result.ID]; len(result.Damage) != want {
+			t.Errorf("%s: %d damaged lines, want %d", result.ID, len(result.Damage), want)
+		}
+	}
+	if _, err := os.Stat(results[0].QuarantinePath); !os.IsNotExist(err) {
+		t.Fatal("check must not quarantine anything")
+	}
+
+	results, err = svc.Repair([]core.SessionID{damaged}, false)
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Damage) != 1 {
+		t.Fatalf("unexpected repair results: %+v", results)
+	}
+
+	info, err := svc.Get(damaged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.MessageCount != 2 {
+		t.Fatalf("expected 2 messages after repair, got %d", info.MessageCount)
+	}
+
+	if err := svc.Delete(damaged); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(results[0].QuarantinePath); !os.IsNotExist(err) {
+		t.Fatal("expected delete to remove the quarantine file")
+	}
+
+	if _, err := svc.Repair([]core.SessionID{"sess_missing"}, true); err == nil || !strings.Contains(err.Error(), "session not found") {
+		t.Fatalf("expected session not found, got %v", err)
+	}
+}
+
+func TestGet_CachesUntilFilesChange(t *testing.T) {
+	svc := newTestService(t)
+	id := core.SessionID("sess_20250101T000000.000000000_aaaaaaaaaaaa")
+	createSessionFile(t, svc, id, "{\"role\":\"user\",\"content\":\"q1\"}\n")
+
+	info, err := svc.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.MessageCount != 1 {
+		t.Fatalf("expected 1 message, got %d", info.MessageCount)
+	}
+
+	file, err := os.OpenFile(svc.sessionPath(id), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("{\"role\":\"assistant\",\"content\":\"a1\"}\n")
+	file.Close()
+
+	if info, _ := svc.Get(id); info.MessageCount != 2 {
+		t.Fatalf("expected cache refresh after append, got %d messages", info.MessageCount)
+	}
+
+	if err := svc.SetDefaultAgent(id, "coder"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := svc.Get(id); info.DefaultAgent != "coder" {
+		t.Fatalf("expected cache refresh after metadata change, got %q", info.DefaultAgent)
+	}
+
+	if err := svc.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Get(id); err == nil {
+		t.Fatal("expected deleted session to be gone from the catalog")
+	}
+}
+
+func BenchmarkList(b *testing.B) {
+	baseDir := b.TempDir()
+	svc := &FileService{BaseDir: baseDir}
+
+	line := `{"role":"user","content":"` + strings.Repeat("lorem ipsum ", 40) + `","tokens":100}` + "\n"
+	content := strings.Repeat(line, 2000)
+	for i := range 50 {
+		createSessionFile(b, svc, core.SessionID(fmt.Sprintf("sess_20250101T000000.000000000_%012d", i)), content)
+	}
+
+	b.Run("cold", func(b *testing.B) {
+		for b.Loop() {
+			matches, _ := filepath.Glob(filepath.Join(svc.sessionDir(), "*.idx"))
+			for _, match := range matches {
+				os.Remove(match)
+			}
+			if _, err := (&FileService{BaseDir: baseDir}).List(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("indexed", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := (&FileService{BaseDir: baseDir}).List(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := svc.List(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
 }
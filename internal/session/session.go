@@ -2,17 +2,40 @@
 package session
 
 import (
+	"errors"
 	"time"
 
 	"github.com/erg0nix/kontekst/internal/core"
 )
 
-// Info holds metadata about a session including its size, message count, and timestamps.
+// ErrNotFound is returned when a session does not exist.
+var ErrNotFound = errors.New("session not found")
+
+// Info holds metadata about a session including its title, tags, size, message count, token usage,
+// fork links, and timestamps.
 type Info struct {
 	ID           core.SessionID
+	Title        string
+	Tags         []string
 	DefaultAgent string
+	WorkingDir   string
+	Usage        Usage
+	ParentID     core.SessionID
+	ForkedAt     int
+	Children     []core.SessionID
 	MessageCount int
 	FileSize     int64
 	CreatedAt    time.Time
 	ModifiedAt   time.Time
 }
+
+// Usage is the cumulative token usage reported by the LLM over all of a session's runs.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Total returns the sum of prompt and completion tokens.
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
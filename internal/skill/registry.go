@@ -1,17 +1,23 @@
 package skill
 
 import (
+	"cmp"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 )
 
 // Registry loads and stores skills from a directory, providing thread-safe access by name.
+// files maps each skill file to the skill loaded from it, so a reload can keep a skill whose file has
+// become invalid.
 type Registry struct {
 	skillsDir string
 	skills    map[string]*Skill
+	files     map[string]*Skill
 	mu        sync.RWMutex
 }
 
@@ -20,50 +26,58 @@ func NewRegistry(skillsDir string) *Registry {
 	return &Registry{
 		skillsDir: skillsDir,
 		skills:    make(map[string]*Skill),
+		files:     make(map[string]*Skill),
 	}
 }
 
-// Load discovers and parses all skill files from the registry's directory.
+// Load discovers and parses all skill files from the registry's directory and replaces the loaded skills
+// with them in one step. A file that fails to parse keeps the skill previously loaded from it, if any, and
+// the registry is left unchanged when the directory cannot be read.
 func (r *Registry) Load() error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	r.skills = make(map[string]*Skill)
-
-	if _, err := os.Stat(r.skillsDir); os.IsNotExist(err) {
-		return nil
-	}
-
 	entries, err := os.ReadDir(r.skillsDir)
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
+	r.mu.RLock()
+	previous := r.files
+	r.mu.RUnlock()
+
+	skills := make(map[string]*Skill)
+	files := make(map[string]*Skill)
 	for _, entry := range entries {
 		name := entry.Name()
 
-		if entry.IsDir() {
-			skillPath := filepath.Join(r.skillsDir, name, "SKILL.md")
-			if _, err := os.Stat(skillPath); err == nil {
-				skill, err := loadSkillFile(skillPath)
-				if err != nil {
-					continue
-				}
-				r.skills[skill.Name] = skill
+		var skillPath string
+		switch {
+		case entry.IsDir():
+			skillPath = filepath.Join(r.skillsDir, name, "SKILL.md")
+			if _, err := os.Stat(skillPath); err != nil {
+				continue
 			}
+		case strings.HasSuffix(name, ".md"):
+			skillPath = filepath.Join(r.skillsDir, name)
+		default:
 			continue
 		}
 
-		if strings.HasSuffix(name, ".md") {
-			skillPath := filepath.Join(r.skillsDir, name)
-			skill, err := loadSkillFile(skillPath)
-			if err != nil {
+		skill, err := loadSkillFile(skillPath)
+		if err != nil {
+			skill = previous[skillPath]
+			if skill == nil {
+				slog.Warn("skipping skill", "path", skillPath, "error", err)
 				continue
 			}
-			r.skills[skill.Name] = skill
+			slog.Warn("keeping previous version of skill", "skill", skill.Name, "path", skillPath, "error", err)
 		}
+		skills[skill.Name] = skill
+		files[skillPath] = skill
 	}
 
+	r.mu.Lock()
+	r.skills = skills
+	r.files = files
+	r.mu.Unlock()
 	return nil
 }
 
@@ -76,6 +90,19 @@ func (r *Registry) Get(name string) (*Skill, bool) {
 	return skill, ok
 }
 
+// List returns every loaded skill, sorted by name.
+func (r *Registry) List() []*Skill {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*Skill, 0, len(r.skills))
+	for _, skill := range r.skills {
+		result = append(result, skill)
+	}
+	slices.SortFunc(result, func(a, b *Skill) int { return cmp.Compare(a.Name, b.Name) })
+	return result
+}
+
 // ModelInvocableSkills returns all skills that have not disabled model invocation.
 func (r *Registry) ModelInvocableSkills() []*Skill {
 	r.mu.RLock()
@@ -97,6 +97,73 @@ Test content
 	}
 }
 
+func TestRegistryList(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"zeta", "alpha", "mid"} {
+		content := "+++\nname = \"" + name + "\"\ndescription = \"d\"\n+++\n\nbody\n"
+		if err := os.WriteFile(filepath.Join(tmpDir, name+".md"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry := NewRegistry(tmpDir)
+	if err := registry.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var names []string
+	for _, skill := range registry.List() {
+		names = append(names, skill.Name)
+	}
+	if got := strings.Join(names, ","); got != "alpha,mid,zeta" {
+		t.Errorf("List() names = %s, want alpha,mid,zeta", got)
+	}
+}
+
+func TestRegistryReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("keep.md", "+++\ndescription = \"v1\"\n+++\n\nbody\n")
+	write("gone.md", "body\n")
+
+	registry := NewRegistry(tmpDir)
+	if err := registry.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	write("keep.md", "+++\ndescription = \n+++\n\nbroken\n")
+	write("new.md", "body\n")
+	if err := os.Remove(filepath.Join(tmpDir, "gone.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if skill, ok := registry.Get("keep"); !ok || skill.Description != "v1" {
+		t.Errorf("Get(keep) = %+v, %v, want the previous version", skill, ok)
+	}
+	if _, ok := registry.Get("gone"); ok {
+		t.Error("removed skill is still loaded")
+	}
+	if _, ok := registry.Get("new"); !ok {
+		t.Error("added skill is not loaded")
+	}
+
+	write("keep.md", "+++\ndescription = \"v2\"\n+++\n\nbody\n")
+	if err := registry.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if skill, _ := registry.Get("keep"); skill == nil || skill.Description != "v2" {
+		t.Errorf("Get(keep) = %+v, want the fixed version", skill)
+	}
+}
+
 func TestRegistrySummaries(t *testing.T) {
 	tmpDir := t.TempDir()
 
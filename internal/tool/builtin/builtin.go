@@ -1,4 +1,4 @@
-// Package builtin implements the standard set of agent tools (read, write, edit, list, web_fetch).
+// Package builtin implements the standard set of agent tools (read, write, edit, list, web_fetch, todo, memory).
 package builtin
 
 import (
@@ -186,6 +186,18 @@ func (tool *EditFile) PreviewStructured(args map[string]any, ctx context.Context
 	return &preview, nil
 }
 
+// Diff returns the unified diff of the edits, as recorded in the session after the call runs.
+func (tool *EditFile) Diff(args map[string]any, ctx context.Context) (string, error) {
+	plan, err := tool.prepareEdits(args, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	oldContent := assembleContent(plan.oldLines, plan.trailingNewline)
+	newContent := assembleContent(plan.newLines, plan.trailingNewline)
+	return tooldiff.GenerateUnifiedDiff(plan.path, oldContent, newContent), nil
+}
+
 func (tool *EditFile) Execute(args map[string]any, ctx context.Context) (string, error) {
 	plan, err := tool.prepareEdits(args, ctx)
 	if err != nil {
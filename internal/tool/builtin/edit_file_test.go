@@ -909,3 +909,28 @@ func TestEditFileRoundTrip(t *testing.T) {
 		t.Errorf("content = %q, want %q", string(newContent), expected)
 	}
 }
+
+func TestEditFileDiff(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte("line1\nline2\nline3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tool := &EditFile{BaseDir: tempDir}
+	args := map[string]any{
+		"path": "test.txt",
+		"edits": []any{
+			map[string]any{"operation": "replace", "line": float64(2), "hash": hashline.ComputeLineHash("line2"), "content": "changed"},
+		},
+	}
+
+	got, err := tool.Diff(args, context.Background())
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	for _, want := range []string{"--- test.txt", "-line2", "+changed"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("diff %q does not contain %q", got, want)
+		}
+	}
+}
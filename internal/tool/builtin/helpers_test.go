@@ -106,3 +106,22 @@ func TestResolveBaseDir(t *testing.T) {
 		t.Errorf("resolveBaseDir with working dir = %q, want /working/dir", got)
 	}
 }
+
+func TestBuiltinToolSchemasCompile(t *testing.T) {
+	tools := []toolpkg.Tool{
+		&ReadFile{},
+		&ListFiles{},
+		&WriteFile{},
+		&EditFile{},
+		&WebFetch{},
+		&SkillTool{},
+		&CommandTool{},
+		&TodoTool{},
+	}
+
+	for _, tool := range tools {
+		if _, err := toolpkg.CompileSchema(tool.Parameters()); err != nil {
+			t.Errorf("%s: %v", tool.Name(), err)
+		}
+	}
+}
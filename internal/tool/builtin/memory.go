@@ -0,0 +1,103 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/erg0nix/kontekst/internal/memory"
+	toolpkg "github.com/erg0nix/kontekst/internal/tool"
+)
+
+// MemoryTool is a tool that lets the model remember, recall and forget short facts about the current project.
+// Memories are keyed by the run's working directory and outlive the session.
+type MemoryTool struct {
+	Store *memory.Store
+}
+
+func (tool *MemoryTool) Name() string { return "memory" }
+
+func (tool *MemoryTool) Description() string {
+	return "Stores short facts about the current project that persist across sessions: build and test commands, conventions, where things live, decisions the user made. " +
+		"Use remember for a fact worth knowing next time (one fact per call, a sentence or two), recall to search all memories, and forget to delete one that is wrong or outdated. " +
+		"The newest memories are listed in the system prompt with their IDs."
+}
+
+func (tool *MemoryTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"description": "What to do",
+				"enum":        []string{"remember", "recall", "forget"},
+			},
+			"content": map[string]any{
+				"type":        "string",
+				"description": "The fact to remember (remember only)",
+			},
+			"query": map[string]any{
+				"type":        "string",
+				"description": "Words to search for; empty lists every memory (recall only)",
+			},
+			"id": map[string]any{
+				"type":        "integer",
+				"description": "ID of the memory to delete (forget only)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (tool *MemoryTool) RequiresApproval() bool { return false }
+
+func (tool *MemoryTool) Execute(args map[string]any, ctx context.Context) (string, error) {
+	workingDir := toolpkg.WorkingDir(ctx)
+	if workingDir == "" {
+		return "", errors.New("project memory needs a working directory")
+	}
+
+	action, _ := getStringArg("action", args)
+	switch action {
+	case "remember":
+		content, _ := getStringArg("content", args)
+		entry, err := tool.Store.Remember(workingDir, content)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Remembered as memory %d.", entry.ID), nil
+
+	case "recall":
+		query, _ := getStringArg("query", args)
+		entries, err := tool.Store.Recall(workingDir, query)
+		if err != nil {
+			return "", err
+		}
+		if len(entries) == 0 {
+			return "No memories match.", nil
+		}
+		var b strings.Builder
+		for _, entry := range entries {
+			fmt.Fprintf(&b, "[%d] %s\n", entry.ID, entry.Content)
+		}
+		return strings.TrimRight(b.String(), "\n"), nil
+
+	case "forget":
+		id, ok := getIntArg("id", args)
+		if !ok {
+			return "", errors.New("missing required argument: id")
+		}
+		if err := tool.Store.Forget(workingDir, id); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Forgot memory %d.", id), nil
+	}
+
+	return "", fmt.Errorf("unknown action %q (want remember, recall or forget)", action)
+}
+
+// RegisterMemory adds the memory tool to the registry.
+func RegisterMemory(registry *toolpkg.Registry, store *memory.Store) {
+	registry.Add(&MemoryTool{Store: store})
+}
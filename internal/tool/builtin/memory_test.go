@@ -0,0 +1,55 @@
+package builtin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/memory"
+	toolpkg "github.com/erg0nix/kontekst/internal/tool"
+)
+
+func TestMemoryToolExecute(t *testing.T) {
+	tool := &MemoryTool{Store: memory.New(t.TempDir())}
+	ctx := toolpkg.WithWorkingDir(context.Background(), "/src/app")
+
+	steps := []struct {
+		args    map[string]any
+		want    string
+		wantErr bool
+	}{
+		{args: map[string]any{"action": "remember", "content": "tests run with make test"}, want: "Remembered as memory 1."},
+		{args: map[string]any{"action": "remember", "content": "lint with make lint"}, want: "Remembered as memory 2."},
+		{args: map[string]any{"action": "recall", "query": "lint"}, want: "[2] lint with make lint"},
+		{args: map[string]any{"action": "recall"}, want: "[1] tests run with make test\n[2] lint with make lint"},
+		{args: map[string]any{"action": "forget", "id": float64(1)}, want: "Forgot memory 1."},
+		{args: map[string]any{"action": "recall", "query": "tests"}, want: "No memories match."},
+		{args: map[string]any{"action": "forget", "id": float64(1)}, wantErr: true},
+		{args: map[string]any{"action": "forget"}, wantErr: true},
+		{args: map[string]any{"action": "remember", "content": " "}, wantErr: true},
+		{args: map[string]any{"action": "summarize"}, wantErr: true},
+	}
+
+	for i, step := range steps {
+		got, err := tool.Execute(step.args, ctx)
+		if step.wantErr {
+			if err == nil {
+				t.Errorf("step %d: expected error, got %q", i, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got != step.want {
+			t.Errorf("step %d: got %q, want %q", i, got, step.want)
+		}
+	}
+}
+
+func TestMemoryToolNeedsWorkingDir(t *testing.T) {
+	tool := &MemoryTool{Store: memory.New(t.TempDir())}
+
+	if _, err := tool.Execute(map[string]any{"action": "recall"}, context.Background()); err == nil {
+		t.Error("expected error without a working directory")
+	}
+}
@@ -0,0 +1,164 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/erg0nix/kontekst/internal/core"
+	toolpkg "github.com/erg0nix/kontekst/internal/tool"
+)
+
+type todoContextKey struct{}
+
+// TodoCallbacks holds the function the todo tool uses to publish the session's updated plan.
+type TodoCallbacks struct {
+	SetPlan func(entries []core.PlanEntry) error
+}
+
+// WithTodoCallbacks returns a new context carrying the given todo callbacks.
+func WithTodoCallbacks(ctx context.Context, callbacks *TodoCallbacks) context.Context {
+	return context.WithValue(ctx, todoContextKey{}, callbacks)
+}
+
+// GetTodoCallbacks extracts the todo callbacks from the context, or returns nil if unset.
+func GetTodoCallbacks(ctx context.Context) *TodoCallbacks {
+	val := ctx.Value(todoContextKey{})
+	if val == nil {
+		return nil
+	}
+	return val.(*TodoCallbacks)
+}
+
+// TodoTool is a tool that lets the model maintain a todo list for multi-step tasks.
+type TodoTool struct{}
+
+func (tool *TodoTool) Name() string { return "todo" }
+
+func (tool *TodoTool) Description() string {
+	return "Maintains your todo list for the current session. Send the complete list every time; it replaces the previous one. Use it to plan multi-step tasks, mark exactly one entry in_progress while working on it, and mark entries completed as soon as they are done. The current list is shown in the system prompt."
+}
+
+func (tool *TodoTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"todos": map[string]any{
+				"type":        "array",
+				"description": "The complete todo list",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"content": map[string]any{
+							"type":        "string",
+							"description": "What needs to be done",
+						},
+						"priority": map[string]any{
+							"type":        "string",
+							"description": "Relative importance (default: medium)",
+							"enum":        []string{"high", "medium", "low"},
+						},
+						"status": map[string]any{
+							"type":        "string",
+							"description": "Progress of the entry",
+							"enum":        []string{"pending", "in_progress", "completed"},
+						},
+					},
+					"required": []string{"content", "status"},
+				},
+			},
+		},
+		"required": []string{"todos"},
+	}
+}
+
+func (tool *TodoTool) RequiresApproval() bool { return false }
+
+func (tool *TodoTool) Execute(args map[string]any, ctx context.Context) (string, error) {
+	entries, err := parseTodos(args["todos"])
+	if err != nil {
+		return "", err
+	}
+
+	callbacks := GetTodoCallbacks(ctx)
+	if callbacks == nil || callbacks.SetPlan == nil {
+		return "", fmt.Errorf("todo list not supported in this context")
+	}
+
+	if err := callbacks.SetPlan(entries); err != nil {
+		return "", fmt.Errorf("failed to update todo list: %w", err)
+	}
+
+	if len(entries) == 0 {
+		return "Todo list cleared.", nil
+	}
+
+	return summarizePlan(entries), nil
+}
+
+func summarizePlan(entries []core.PlanEntry) string {
+	counts := make(map[core.PlanEntryStatus]int)
+	for _, entry := range entries {
+		counts[entry.Status]++
+	}
+
+	return fmt.Sprintf("Todo list updated: %d pending, %d in progress, %d completed.",
+		counts[core.PlanStatusPending], counts[core.PlanStatusInProgress], counts[core.PlanStatusCompleted])
+}
+
+func parseTodos(raw any) ([]core.PlanEntry, error) {
+	if raw == nil {
+		return nil, errors.New("missing required argument: todos")
+	}
+
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, errors.New("todos must be an array")
+	}
+
+	entries := make([]core.PlanEntry, 0, len(items))
+	for i, item := range items {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("todo %d must be an object", i)
+		}
+
+		content, _ := getStringArg("content", obj)
+		content = strings.TrimSpace(content)
+		if content == "" {
+			return nil, fmt.Errorf("todo %d: content is required", i)
+		}
+
+		status, _ := getStringArg("status", obj)
+		switch core.PlanEntryStatus(status) {
+		case core.PlanStatusPending, core.PlanStatusInProgress, core.PlanStatusCompleted:
+		case "":
+			status = string(core.PlanStatusPending)
+		default:
+			return nil, fmt.Errorf("todo %d: invalid status %q", i, status)
+		}
+
+		priority, _ := getStringArg("priority", obj)
+		switch core.PlanEntryPriority(priority) {
+		case core.PlanPriorityHigh, core.PlanPriorityMedium, core.PlanPriorityLow:
+		case "":
+			priority = string(core.PlanPriorityMedium)
+		default:
+			return nil, fmt.Errorf("todo %d: invalid priority %q", i, priority)
+		}
+
+		entries = append(entries, core.PlanEntry{
+			Content:  content,
+			Priority: core.PlanEntryPriority(priority),
+			Status:   core.PlanEntryStatus(status),
+		})
+	}
+
+	return entries, nil
+}
+
+// RegisterTodo adds the todo tool to the registry.
+func RegisterTodo(registry *toolpkg.Registry) {
+	registry.Add(&TodoTool{})
+}
@@ -0,0 +1,107 @@
+package builtin
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+func TestTodoToolExecute(t *testing.T) {
+	tool := &TodoTool{}
+
+	var published []core.PlanEntry
+	ctx := WithTodoCallbacks(context.Background(), &TodoCallbacks{
+		SetPlan: func(entries []core.PlanEntry) error {
+			published = entries
+			return nil
+		},
+	})
+
+	result, err := tool.Execute(map[string]any{
+		"todos": []any{
+			map[string]any{"content": "Read the code", "status": "completed"},
+			map[string]any{"content": "Fix the bug", "status": "in_progress", "priority": "high"},
+			map[string]any{"content": "  Write tests  "},
+		},
+	}, ctx)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if result != "Todo list updated: 1 pending, 1 in progress, 1 completed." {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	want := []core.PlanEntry{
+		{Content: "Read the code", Priority: core.PlanPriorityMedium, Status: core.PlanStatusCompleted},
+		{Content: "Fix the bug", Priority: core.PlanPriorityHigh, Status: core.PlanStatusInProgress},
+		{Content: "Write tests", Priority: core.PlanPriorityMedium, Status: core.PlanStatusPending},
+	}
+	if len(published) != len(want) {
+		t.Fatalf("published %d entries, want %d", len(published), len(want))
+	}
+	for i := range want {
+		if published[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, published[i], want[i])
+		}
+	}
+}
+
+func TestTodoToolExecuteClear(t *testing.T) {
+	tool := &TodoTool{}
+
+	published := []core.PlanEntry{{Content: "stale"}}
+	ctx := WithTodoCallbacks(context.Background(), &TodoCallbacks{
+		SetPlan: func(entries []core.PlanEntry) error {
+			published = entries
+			return nil
+		},
+	})
+
+	result, err := tool.Execute(map[string]any{"todos": []any{}}, ctx)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result != "Todo list cleared." {
+		t.Errorf("unexpected result: %s", result)
+	}
+	if len(published) != 0 {
+		t.Errorf("expected empty plan, got %+v", published)
+	}
+}
+
+func TestTodoToolExecuteInvalid(t *testing.T) {
+	ctx := WithTodoCallbacks(context.Background(), &TodoCallbacks{
+		SetPlan: func(entries []core.PlanEntry) error { return nil },
+	})
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{"missing todos", map[string]any{}, "missing required argument"},
+		{"not an array", map[string]any{"todos": "x"}, "must be an array"},
+		{"empty content", map[string]any{"todos": []any{map[string]any{"content": " "}}}, "content is required"},
+		{"bad status", map[string]any{"todos": []any{map[string]any{"content": "a", "status": "done"}}}, "invalid status"},
+		{"bad priority", map[string]any{"todos": []any{map[string]any{"content": "a", "priority": "urgent"}}}, "invalid priority"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&TodoTool{}).Execute(tt.args, ctx)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTodoToolExecuteNoCallbacks(t *testing.T) {
+	_, err := (&TodoTool{}).Execute(map[string]any{"todos": []any{}}, context.Background())
+	if err == nil {
+		t.Fatal("expected error without callbacks")
+	}
+}
@@ -67,6 +67,27 @@ func (tool *WriteFile) Preview(args map[string]any, ctx context.Context) (string
 	return diff.GenerateUnifiedDiff(path, string(existingData), content), nil
 }
 
+// Diff returns the unified diff between the file on disk, if any, and the content to be written.
+func (tool *WriteFile) Diff(args map[string]any, ctx context.Context) (string, error) {
+	path, err := validatePath(args)
+	if err != nil {
+		return "", err
+	}
+
+	content, ok := getStringArg("content", args)
+	if !ok {
+		return "", errors.New("missing content")
+	}
+
+	baseDir := resolveBaseDir(ctx, tool.BaseDir)
+	existingData, err := os.ReadFile(filepath.Join(baseDir, path))
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+
+	return diff.GenerateUnifiedDiff(path, string(existingData), content), nil
+}
+
 func (tool *WriteFile) Execute(args map[string]any, ctx context.Context) (string, error) {
 	path, err := validatePath(args)
 	if err != nil {
@@ -148,3 +148,39 @@ func TestWriteFilePreview(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteFileDiff(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "existing.txt"), []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tool := &WriteFile{BaseDir: tempDir}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want []string
+	}{
+		{name: "new file", args: map[string]any{"path": "new.txt", "content": "hello\n"}, want: []string{"--- /dev/null", "+hello"}},
+		{name: "existing file", args: map[string]any{"path": "existing.txt", "content": "one\nthree\n"}, want: []string{"--- existing.txt", "-two", "+three"}},
+		{name: "unchanged", args: map[string]any{"path": "existing.txt", "content": "one\ntwo\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tool.Diff(tt.args, context.Background())
+			if err != nil {
+				t.Fatalf("Diff failed: %v", err)
+			}
+			if len(tt.want) == 0 && got != "" {
+				t.Errorf("expected empty diff, got %q", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("diff %q does not contain %q", got, want)
+				}
+			}
+		})
+	}
+}
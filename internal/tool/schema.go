@@ -0,0 +1,175 @@
+package tool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Schema is a tool's compiled JSON schema parameters, used to coerce and validate arguments.
+type Schema struct {
+	params   map[string]any
+	compiled *jsonschema.Schema
+}
+
+// CompileSchema compiles a tool's JSON schema parameters; a nil params map yields a schema that accepts anything.
+func CompileSchema(params map[string]any) (*Schema, error) {
+	if params == nil {
+		return &Schema{}, nil
+	}
+
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("marshal schema: %w", err)
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(paramsJSON))
+	if err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("parameters.json", doc); err != nil {
+		return nil, fmt.Errorf("add schema: %w", err)
+	}
+
+	compiled, err := compiler.Compile("parameters.json")
+	if err != nil {
+		return nil, fmt.Errorf("compile schema: %w", err)
+	}
+
+	return &Schema{params: params, compiled: compiled}, nil
+}
+
+// Validate coerces loosely typed arguments to the schema's types and validates the result.
+// It returns the coerced arguments, leaving the input map untouched.
+func (s *Schema) Validate(args map[string]any) (map[string]any, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+
+	if s == nil || s.compiled == nil {
+		return args, nil
+	}
+
+	coerced, _ := coerce(s.params, args).(map[string]any)
+
+	argsJSON, err := json.Marshal(coerced)
+	if err != nil {
+		return nil, fmt.Errorf("marshal arguments: %w", err)
+	}
+
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(argsJSON))
+	if err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+
+	if err := s.compiled.Validate(inst); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %s", describeValidationError(err))
+	}
+
+	return coerced, nil
+}
+
+// coerce converts values the model commonly gets wrong (numeric or boolean strings,
+// JSON-encoded arrays and objects) to the type the schema declares.
+func coerce(schema map[string]any, value any) any {
+	switch schemaType(schema) {
+	case "object":
+		if str, ok := value.(string); ok {
+			var decoded map[string]any
+			if err := json.Unmarshal([]byte(str), &decoded); err == nil {
+				value = decoded
+			}
+		}
+
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return value
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+		out := make(map[string]any, len(obj))
+		for key, v := range obj {
+			if propSchema, ok := properties[key].(map[string]any); ok {
+				out[key] = coerce(propSchema, v)
+			} else {
+				out[key] = v
+			}
+		}
+		return out
+
+	case "array":
+		if str, ok := value.(string); ok {
+			var decoded []any
+			if err := json.Unmarshal([]byte(str), &decoded); err == nil {
+				value = decoded
+			}
+		}
+
+		items, ok := value.([]any)
+		if !ok {
+			return value
+		}
+
+		itemSchema, _ := schema["items"].(map[string]any)
+		out := make([]any, len(items))
+		for i, v := range items {
+			out[i] = coerce(itemSchema, v)
+		}
+		return out
+
+	case "integer":
+		if str, ok := value.(string); ok {
+			if n, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64); err == nil {
+				return float64(n)
+			}
+		}
+
+	case "number":
+		if str, ok := value.(string); ok {
+			if n, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+				return n
+			}
+		}
+
+	case "boolean":
+		if str, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(str)); err == nil {
+				return b
+			}
+		}
+	}
+
+	return value
+}
+
+func schemaType(schema map[string]any) string {
+	if schema == nil {
+		return ""
+	}
+	typ, _ := schema["type"].(string)
+	return typ
+}
+
+// describeValidationError drops the schema URL header from a jsonschema error and keeps the per-field causes.
+func describeValidationError(err error) string {
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) > 1 {
+		lines = lines[1:]
+	}
+
+	causes := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-"))
+		if line != "" {
+			causes = append(causes, line)
+		}
+	}
+
+	return strings.Join(causes, "; ")
+}
@@ -0,0 +1,139 @@
+package tool
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+var testParams = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"path":    map[string]any{"type": "string"},
+		"limit":   map[string]any{"type": "integer"},
+		"ratio":   map[string]any{"type": "number"},
+		"dry_run": map[string]any{"type": "boolean"},
+		"lines": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "integer"},
+		},
+	},
+	"required": []string{"path"},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := CompileSchema(testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    map[string]any
+		wantErr string
+	}{
+		{"valid", map[string]any{"path": "main.go", "limit": float64(10)}, ""},
+		{"missing required", map[string]any{}, "missing property 'path'"},
+		{"wrong type", map[string]any{"path": 3}, "at '/path': got number, want string"},
+		{"nil args", nil, "missing property 'path'"},
+		{"non-numeric string", map[string]any{"path": "a", "limit": "ten"}, "at '/limit': got string, want integer"},
+		{"fractional integer", map[string]any{"path": "a", "limit": "1.5"}, "at '/limit'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := schema.Validate(tt.args)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), "file://") {
+				t.Fatalf("error should not leak schema location: %v", err)
+			}
+		})
+	}
+}
+
+func TestSchemaValidate_Coercion(t *testing.T) {
+	schema, err := CompileSchema(testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := map[string]any{
+		"path":    "main.go",
+		"limit":   " 20 ",
+		"ratio":   "0.5",
+		"dry_run": "true",
+		"lines":   "[1, \"2\"]",
+	}
+
+	got, err := schema.Validate(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got["limit"] != float64(20) {
+		t.Errorf("limit = %#v, want 20", got["limit"])
+	}
+	if got["ratio"] != 0.5 {
+		t.Errorf("ratio = %#v, want 0.5", got["ratio"])
+	}
+	if got["dry_run"] != true {
+		t.Errorf("dry_run = %#v, want true", got["dry_run"])
+	}
+	lines, ok := got["lines"].([]any)
+	if !ok || len(lines) != 2 || lines[0] != float64(1) || lines[1] != float64(2) {
+		t.Errorf("lines = %#v, want [1 2]", got["lines"])
+	}
+
+	if args["limit"] != " 20 " {
+		t.Error("Validate must not modify the input map")
+	}
+}
+
+func TestSchemaValidate_NilSchema(t *testing.T) {
+	schema, err := CompileSchema(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := schema.Validate(map[string]any{"anything": true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+type schemaTool struct{}
+
+func (schemaTool) Name() string               { return "read" }
+func (schemaTool) Description() string        { return "" }
+func (schemaTool) Parameters() map[string]any { return testParams }
+func (schemaTool) RequiresApproval() bool     { return false }
+func (schemaTool) Execute(map[string]any, context.Context) (string, error) {
+	return "", nil
+}
+
+func TestRegistryValidateArguments(t *testing.T) {
+	registry := NewRegistry()
+	registry.Add(schemaTool{})
+
+	got, err := registry.ValidateArguments("read", map[string]any{"path": "a.go", "limit": "5"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["limit"] != float64(5) {
+		t.Errorf("limit = %#v, want coerced 5", got["limit"])
+	}
+
+	if _, err := registry.ValidateArguments("read", map[string]any{}); err == nil {
+		t.Error("expected error for missing path")
+	}
+
+	if _, err := registry.ValidateArguments("missing", nil); err == nil || !strings.Contains(err.Error(), "tool not found") {
+		t.Errorf("expected tool not found error, got %v", err)
+	}
+}
@@ -4,6 +4,8 @@ package tool
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
 
 	"github.com/erg0nix/kontekst/internal/core"
@@ -23,30 +25,57 @@ type Previewer interface {
 	Preview(args map[string]any, ctx context.Context) (string, error)
 }
 
+// Differ is an optional interface for tools that change files, returning a unified diff of the change a call makes.
+type Differ interface {
+	Diff(args map[string]any, ctx context.Context) (string, error)
+}
+
 // ToolExecutor is the interface used by the agent to execute tools and retrieve their definitions.
 type ToolExecutor interface {
 	Execute(name string, args map[string]any, ctx context.Context) (string, error)
 	ToolDefinitions() []core.ToolDef
 	Preview(name string, args map[string]any, ctx context.Context) (string, error)
+	ValidateArguments(name string, args map[string]any) (map[string]any, error)
 }
 
 // Registry is a thread-safe collection of named tool.
 type Registry struct {
-	mu    sync.RWMutex
-	tools map[string]Tool
+	mu      sync.RWMutex
+	tools   map[string]Tool
+	schemas map[string]*Schema
 }
 
 // NewRegistry creates an empty tool registry.
 func NewRegistry() *Registry {
-	return &Registry{tools: make(map[string]Tool)}
+	return &Registry{tools: make(map[string]Tool), schemas: make(map[string]*Schema)}
 }
 
-// Add registers a tool in the registry, keyed by its name.
+// Add registers a tool in the registry, keyed by its name, and compiles its parameter schema.
 func (registry *Registry) Add(tool Tool) {
+	schema, err := CompileSchema(tool.Parameters())
+	if err != nil {
+		slog.Warn("failed to compile tool schema; arguments will not be validated", "tool", tool.Name(), "error", err)
+		schema = &Schema{}
+	}
+
 	registry.mu.Lock()
 	defer registry.mu.Unlock()
 
 	registry.tools[tool.Name()] = tool
+	registry.schemas[tool.Name()] = schema
+}
+
+// ValidateArguments coerces and validates arguments against the named tool's compiled schema.
+func (registry *Registry) ValidateArguments(name string, args map[string]any) (map[string]any, error) {
+	registry.mu.RLock()
+	schema, ok := registry.schemas[name]
+	registry.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("tool not found: %s", name)
+	}
+
+	return schema.Validate(args)
 }
 
 // Execute runs the named tool with the given arguments and returns its output.
@@ -88,6 +117,24 @@ func (registry *Registry) Preview(name string, args map[string]any, ctx context.
 	return "", nil
 }
 
+// Diff returns the unified diff of the change a call to the named tool would make,
+// or an empty string if the tool does not change files.
+func (registry *Registry) Diff(name string, args map[string]any, ctx context.Context) (string, error) {
+	registry.mu.RLock()
+	tool, ok := registry.tools[name]
+	registry.mu.RUnlock()
+
+	if !ok {
+		return "", nil
+	}
+
+	if differ, ok := tool.(Differ); ok {
+		return differ.Diff(args, ctx)
+	}
+
+	return "", nil
+}
+
 // ToolDefinitions returns the LLM-facing definitions of all registered tool.
 func (registry *Registry) ToolDefinitions() []core.ToolDef {
 	registry.mu.RLock()
@@ -0,0 +1,113 @@
+package transcript
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+var htmlTemplate = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"time":      formatTime,
+	"role":      roleTitle,
+	"diffLines": diffLines,
+	"completed": func(status core.PlanEntryStatus) bool { return status == core.PlanStatusCompleted },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Heading}}</title>
+<style>
+body { font: 15px/1.5 system-ui, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+header .meta, .run, .time { color: #656d76; font-size: 13px; }
+.message { border: 1px solid #d0d7de; border-radius: 6px; margin: 1em 0; padding: 0.5em 1em; }
+.message h2 { font-size: 15px; margin: 0.25em 0; }
+.user { background: #f6f8fa; }
+.tool { background: #fbfbfb; }
+.error h2 { color: #cf222e; }
+.text { white-space: pre-wrap; }
+pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; font-size: 13px; }
+details > summary { cursor: pointer; color: #656d76; }
+.reasoning { font-style: italic; color: #656d76; white-space: pre-wrap; }
+.add { color: #116329; background: #dafbe1; }
+.del { color: #82071e; background: #ffebe9; }
+.hunk { color: #0550ae; }
+.run { border-top: 1px dashed #d0d7de; padding-top: 0.5em; margin-top: 1.5em; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Heading}}</h1>
+<p class="meta">{{if .Title}}Session {{.SessionID}} · {{end}}{{range .Tags}}#{{.}} {{end}}{{if .Agent}}Agent {{.Agent}} · {{end}}{{with time .CreatedAt}}Created {{.}} · {{end}}Exported {{time .ExportedAt}}</p>
+{{- if .Plan}}
+<ul class="plan">{{range .Plan}}<li>{{if completed .Status}}☑{{else}}☐{{end}} {{.Content}}</li>{{end}}</ul>
+{{- end}}
+</header>
+{{range .Items}}
+{{- if eq .Kind "run_start" "run_end"}}
+<p class="run">{{.Note}}{{with time .Time}} · {{.}}{{end}}</p>
+{{- else if eq .Kind "summary"}}
+<section class="message summary" id="m{{.Index}}">
+<h2>#{{.Index}} Summary of earlier messages</h2>
+<div class="text">{{.Content}}</div>
+</section>
+{{- else}}
+<section class="message {{.Role}}{{if and .Result .Result.IsError}} error{{end}}" id="m{{.Index}}">
+<h2>#{{.Index}} {{role .Role}}{{if and .Result .Result.Name}}: <code>{{.Result.Name}}</code>{{end}}{{if and .Agent (eq .Role "assistant")}} ({{.Agent}}){{end}} <span class="time">{{time .Time}}</span></h2>
+{{- if .Reasoning}}
+<details><summary>Reasoning</summary><div class="reasoning">{{.Reasoning}}</div></details>
+{{- end}}
+{{- if .Content}}
+<div class="text">{{.Content}}</div>
+{{- end}}
+{{- range .ToolCalls}}
+<details open><summary>Tool call <code>{{.Name}}</code></summary><pre>{{.Arguments}}</pre></details>
+{{- end}}
+{{- with .Result}}
+{{- if .Diff}}
+<pre class="diff">{{range diffLines .Diff}}<span{{with .Class}} class="{{.}}"{{end}}>{{.Text}}</span>
+{{end}}</pre>
+{{- end}}
+<details{{if .IsError}} open{{end}}><summary>Output{{if .Omitted}} ({{.Omitted}} more lines not shown){{end}}</summary><pre>{{.Output}}</pre></details>
+{{- end}}
+</section>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, v view) error {
+	if err := htmlTemplate.Execute(w, v); err != nil {
+		return fmt.Errorf("transcript: write html: %w", err)
+	}
+	return nil
+}
+
+type diffLine struct {
+	Class string
+	Text  string
+}
+
+// diffLines splits a unified diff into lines classed by their marker for highlighting.
+func diffLines(diff string) []diffLine {
+	var lines []diffLine
+	for line := range strings.Lines(strings.TrimRight(diff, "\n")) {
+		line = strings.TrimSuffix(line, "\n")
+
+		class := ""
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			class = "add"
+		case strings.HasPrefix(line, "-"):
+			class = "del"
+		case strings.HasPrefix(line, "@@"):
+			class = "hunk"
+		}
+		lines = append(lines, diffLine{Class: class, Text: line})
+	}
+	return lines
+}
@@ -0,0 +1,123 @@
+package transcript
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+func writeMarkdown(w io.Writer, v view) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", v.Heading())
+	if v.Title != "" {
+		fmt.Fprintf(&b, "- Session: %s\n", v.SessionID)
+	}
+	if len(v.Tags) > 0 {
+		fmt.Fprintf(&b, "- Tags: %s\n", strings.Join(v.Tags, ", "))
+	}
+	if v.Agent != "" {
+		fmt.Fprintf(&b, "- Agent: %s\n", v.Agent)
+	}
+	if created := formatTime(v.CreatedAt); created != "" {
+		fmt.Fprintf(&b, "- Created: %s\n", created)
+	}
+	fmt.Fprintf(&b, "- Exported: %s\n", formatTime(v.ExportedAt))
+
+	if len(v.Plan) > 0 {
+		b.WriteString("\n## Plan\n\n")
+		for _, entry := range v.Plan {
+			mark := " "
+			if entry.Status == core.PlanStatusCompleted {
+				mark = "x"
+			}
+			fmt.Fprintf(&b, "- [%s] %s\n", mark, entry.Content)
+		}
+	}
+
+	for _, it := range v.Items {
+		b.WriteString("\n")
+		switch it.Kind {
+		case itemRunStart, itemRunEnd:
+			if it.Kind == itemRunStart {
+				b.WriteString("---\n\n")
+			}
+			fmt.Fprintf(&b, "*%s*", it.Note)
+			if at := formatTime(it.Time); at != "" {
+				fmt.Fprintf(&b, " *· %s*", at)
+			}
+			b.WriteString("\n")
+
+		case itemSummary:
+			fmt.Fprintf(&b, "## #%d Summary of earlier messages\n\n", it.Index)
+			fmt.Fprintf(&b, "%s\n", strings.TrimSpace(it.Content))
+
+		case itemMessage:
+			writeMarkdownMessage(&b, it)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownMessage(b *strings.Builder, it item) {
+	heading := roleTitle(it.Role)
+	if it.Result != nil && it.Result.Name != "" {
+		heading += ": `" + it.Result.Name + "`"
+	}
+	if it.Agent != "" && it.Role == core.RoleAssistant {
+		heading += " (" + it.Agent + ")"
+	}
+	fmt.Fprintf(b, "## #%d %s\n", it.Index, heading)
+
+	if it.Reasoning != "" {
+		b.WriteString("\n<details>\n<summary>Reasoning</summary>\n\n")
+		fmt.Fprintf(b, "%s\n\n</details>\n", strings.TrimSpace(it.Reasoning))
+	}
+
+	if content := strings.TrimSpace(it.Content); content != "" {
+		fmt.Fprintf(b, "\n%s\n", content)
+	}
+
+	for _, call := range it.ToolCalls {
+		fmt.Fprintf(b, "\n**Tool call** `%s`\n\n", call.Name)
+		writeFence(b, "json", call.Arguments)
+	}
+
+	if it.Result != nil {
+		if it.Result.IsError {
+			b.WriteString("\n**Error**\n")
+		}
+		if it.Result.Diff != "" {
+			b.WriteString("\n")
+			writeFence(b, "diff", strings.TrimRight(it.Result.Diff, "\n"))
+		}
+		b.WriteString("\n")
+		writeFence(b, "", it.Result.Output)
+		if it.Result.Omitted > 0 {
+			fmt.Fprintf(b, "\n*… %d more lines*\n", it.Result.Omitted)
+		}
+	}
+}
+
+// writeFence writes content as a fenced code block whose fence is longer than any backtick run inside it.
+func writeFence(b *strings.Builder, lang, content string) {
+	fence := strings.Repeat("`", max(3, longestRun(content, '`')+1))
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n", fence, lang, content, fence)
+}
+
+func longestRun(s string, c byte) int {
+	longest, run := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
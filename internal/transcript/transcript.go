@@ -0,0 +1,238 @@
+// Package transcript renders sessions as readable Markdown or HTML transcripts and moves them between
+// machines as self-contained JSON documents.
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/conversation"
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/session"
+)
+
+const (
+	formatName    = "kontekst.transcript"
+	formatVersion = 1
+)
+
+// DefaultMaxToolOutputLines is how many lines of each tool output Markdown and HTML transcripts show by default.
+const DefaultMaxToolOutputLines = 40
+
+const redacted = "[redacted]"
+
+// Format is a transcript output format.
+type Format string
+
+const (
+	// FormatMarkdown renders a Markdown document for pasting into pull requests and docs.
+	FormatMarkdown Format = "md"
+	// FormatHTML renders a standalone HTML page.
+	FormatHTML Format = "html"
+	// FormatJSON writes the transcript document that Import reads back.
+	FormatJSON Format = "json"
+)
+
+// ParseFormat validates an export format name.
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(s); format {
+	case FormatMarkdown, FormatHTML, FormatJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %q (want md, html or json)", s)
+}
+
+// Options control how a transcript is written.
+type Options struct {
+	// RedactToolOutput replaces tool outputs and diffs with a placeholder in every format.
+	RedactToolOutput bool
+	// MaxToolOutputLines truncates tool outputs in Markdown and HTML. Zero shows them in full.
+	MaxToolOutputLines int
+}
+
+// Transcript is a self-contained copy of a session's live history: superseded messages are left out and
+// summaries stand on their own, so the records can be written back as a new session.
+type Transcript struct {
+	Format     string                `json:"format"`
+	Version    int                   `json:"version"`
+	SessionID  core.SessionID        `json:"session_id"`
+	Title      string                `json:"title,omitempty"`
+	Tags       []string              `json:"tags,omitempty"`
+	Agent      string                `json:"agent,omitempty"`
+	CreatedAt  time.Time             `json:"created_at,omitzero"`
+	ExportedAt time.Time             `json:"exported_at"`
+	Plan       []core.PlanEntry      `json:"plan,omitempty"`
+	Records    []conversation.Record `json:"records"`
+}
+
+// FromSession builds a transcript of the session's live records.
+func FromSession(sessions *session.FileService, id core.SessionID) (*Transcript, error) {
+	info, err := sessions.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := conversation.NewSessionFile(sessions.Path(id)).ReadRecords()
+	if err != nil {
+		return nil, fmt.Errorf("transcript: %w", err)
+	}
+
+	plan, err := sessions.GetPlan(id)
+	if err != nil {
+		slog.Warn("failed to read session plan", "session_id", id, "error", err)
+	}
+
+	live := conversation.LiveRecords(records)
+	for i := range live {
+		live[i].Version = conversation.RecordVersion
+	}
+
+	return &Transcript{
+		Format:     formatName,
+		Version:    formatVersion,
+		SessionID:  id,
+		Title:      info.Title,
+		Tags:       info.Tags,
+		Agent:      info.DefaultAgent,
+		CreatedAt:  info.CreatedAt,
+		ExportedAt: time.Now().UTC(),
+		Plan:       plan,
+		Records:    live,
+	}, nil
+}
+
+// Write renders the transcript in the given format.
+func (t *Transcript) Write(w io.Writer, format Format, opts Options) error {
+	if opts.RedactToolOutput {
+		t = t.redacted()
+	}
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(t); err != nil {
+			return fmt.Errorf("transcript: write json: %w", err)
+		}
+		return nil
+	case FormatMarkdown:
+		return writeMarkdown(w, newView(t, opts))
+	case FormatHTML:
+		return writeHTML(w, newView(t, opts))
+	}
+	return fmt.Errorf("transcript: unknown format %q", format)
+}
+
+// redacted returns a copy of the transcript with tool outputs and diffs replaced by a placeholder.
+func (t *Transcript) redacted() *Transcript {
+	out := *t
+	out.Records = make([]conversation.Record, len(t.Records))
+
+	for i, rec := range t.Records {
+		if rec.Message != nil && rec.Message.Role == core.RoleTool {
+			msg := *rec.Message
+			msg.Content = redacted
+			if msg.ToolResult != nil {
+				result := *msg.ToolResult
+				result.Output = redacted
+				if result.Diff != "" {
+					result.Diff = redacted
+				}
+				msg.ToolResult = &result
+			}
+			rec.Message = &msg
+		}
+		out.Records[i] = rec
+	}
+
+	return &out
+}
+
+// Read decodes a JSON transcript, checking its format and every record.
+func Read(r io.Reader) (*Transcript, error) {
+	var doc struct {
+		Transcript
+		Records []json.RawMessage `json:"records"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("transcript: parse: %w", err)
+	}
+
+	if doc.Format != formatName {
+		return nil, fmt.Errorf("transcript: not a kontekst transcript (format %q)", doc.Format)
+	}
+	if doc.Version > formatVersion {
+		return nil, fmt.Errorf("transcript: unsupported version %d", doc.Version)
+	}
+
+	t := doc.Transcript
+	t.Records = make([]conversation.Record, 0, len(doc.Records))
+	for i, raw := range doc.Records {
+		rec, err := conversation.ParseRecord(raw)
+		if err != nil {
+			return nil, fmt.Errorf("transcript: record %d: %w", i, err)
+		}
+		if rec.Type == conversation.RecordTombstone {
+			return nil, fmt.Errorf("transcript: record %d: tombstones are not allowed in a transcript", i)
+		}
+		rec.Version = conversation.RecordVersion
+		t.Records = append(t.Records, rec)
+	}
+
+	return &t, nil
+}
+
+// Import writes the transcript as a new session and returns its ID. The session keeps the transcript's
+// title, tags, default agent and plan; its ID is new, so importing never overwrites an existing session.
+func Import(sessions *session.FileService, t *Transcript) (core.SessionID, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, rec := range t.Records {
+		if rec.Summary != nil && rec.Summary.Supersedes != 0 {
+			summary := *rec.Summary
+			summary.Supersedes = 0
+			rec.Summary = &summary
+		}
+		if err := encoder.Encode(rec); err != nil {
+			return "", fmt.Errorf("transcript: encode record: %w", err)
+		}
+	}
+
+	id, path, err := sessions.Create()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("transcript: write session: %w", err)
+	}
+
+	if t.Title != "" {
+		if err := sessions.SetTitle(id, t.Title); err != nil {
+			return id, err
+		}
+	}
+	if len(t.Tags) > 0 {
+		if _, err := sessions.Tag(id, t.Tags, nil); err != nil {
+			return id, err
+		}
+	}
+	if t.Agent != "" {
+		if err := sessions.SetDefaultAgent(id, t.Agent); err != nil {
+			return id, err
+		}
+	}
+	if len(t.Plan) > 0 {
+		if err := sessions.SetPlan(id, t.Plan); err != nil {
+			return id, err
+		}
+	}
+
+	return id, nil
+}
@@ -0,0 +1,260 @@
+package transcript
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erg0nix/kontekst/internal/conversation"
+	"github.com/erg0nix/kontekst/internal/core"
+	"github.com/erg0nix/kontekst/internal/session"
+)
+
+func newTestSession(t *testing.T) (*session.FileService, core.SessionID) {
+	t.Helper()
+	svc := &session.FileService{BaseDir: t.TempDir()}
+	id := core.SessionID("sess_20260301T100000.000000000_abc123")
+
+	lines := []string{
+		`{"v":1,"type":"run_start","ts":"2026-03-01T10:00:00Z","run_start":{"run_id":"run_1","agent_name":"coder","model":"qwen"}}`,
+		`{"v":1,"type":"message","ts":"2026-03-01T10:00:01Z","message":{"role":"user","content":"first try"}}`,
+		`{"v":1,"type":"tombstone","tombstone":{"supersedes":1,"reason":"retry"}}`,
+		`{"v":1,"type":"message","ts":"2026-03-01T10:00:02Z","message":{"role":"user","content":"fix the <b>reconnect</b> loop"}}`,
+		`{"v":1,"type":"message","ts":"2026-03-01T10:00:03Z","message":{"role":"assistant","content":"Editing.","reasoning":"The backoff never resets.","agent_name":"coder","tool_calls":[{"id":"c1","name":"edit_file","arguments":{"path":"ws.go"}}]}}`,
+		`{"v":1,"type":"message","ts":"2026-03-01T10:00:04Z","message":{"role":"tool","content":"Applied 1 edit(s) to ws.go","tool_result":{"call_id":"c1","name":"edit_file","output":"Applied 1 edit(s) to ws.go","diff":"--- ws.go\n+++ ws.go\n@@ -1,1 +1,1 @@\n-old\n+new\n"}}}`,
+		`{"v":1,"type":"message","ts":"2026-03-01T10:00:05Z","message":{"role":"tool","content":"l1\nl2\nl3\nl4\nl5","tool_result":{"call_id":"c2","name":"run_command","output":"l1\nl2\nl3\nl4\nl5","is_error":true}}}`,
+		`{"v":1,"type":"message","ts":"2026-03-01T10:00:06Z","message":{"role":"assistant","content":"Done: ` + "```go\\nx := 1\\n```" + `","agent_name":"coder"}}`,
+		`{"v":1,"type":"run_end","ts":"2026-03-01T10:00:07Z","run_end":{"run_id":"run_1","outcome":"completed","turns":2,"duration_ms":7000}}`,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(svc.Path(id)), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(svc.Path(id), []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetDefaultAgent(id, "coder"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetPlan(id, []core.PlanEntry{{Content: "fix reconnect", Status: core.PlanStatusCompleted}}); err != nil {
+		t.Fatal(err)
+	}
+
+	return svc, id
+}
+
+func render(t *testing.T, tr *Transcript, format Format, opts Options) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tr.Write(&buf, format, opts); err != nil {
+		t.Fatalf("write %s: %v", format, err)
+	}
+	return buf.String()
+}
+
+func TestWrite(t *testing.T) {
+	svc, id := newTestSession(t)
+	tr, err := FromSession(svc, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		format  Format
+		opts    Options
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "markdown",
+			format: FormatMarkdown,
+			opts:   Options{MaxToolOutputLines: 3},
+			want: []string{
+				"# Session " + string(id),
+				"- [x] fix reconnect",
+				"*Run started with agent coder (qwen)*",
+				"## #0 User\n\nfix the <b>reconnect</b> loop",
+				"## #1 Assistant (coder)",
+				"<summary>Reasoning</summary>\n\nThe backoff never resets.",
+				"**Tool call** `edit_file`\n\n```json\n{\n  \"path\": \"ws.go\"\n}\n```",
+				"```diff\n--- ws.go",
+				"## #3 Tool result: `run_command`\n\n**Error**",
+				"```\nl1\nl2\nl3\n```\n\n*… 2 more lines*",
+				"*Run completed after 2 turns in 7s*",
+			},
+			notWant: []string{"first try", "l4"},
+		},
+		{
+			name:   "html",
+			format: FormatHTML,
+			opts:   Options{MaxToolOutputLines: 3},
+			want: []string{
+				"<title>Session " + string(id) + "</title>",
+				"fix the &lt;b&gt;reconnect&lt;/b&gt; loop",
+				`<div class="reasoning">The backoff never resets.</div>`,
+				`<span class="del">-old</span>`,
+				`<span class="add">&#43;new</span>`,
+				`class="message tool error"`,
+				"Output (2 more lines not shown)",
+			},
+			notWant: []string{"<b>reconnect", "first try"},
+		},
+		{
+			name:    "redacted",
+			format:  FormatMarkdown,
+			opts:    Options{RedactToolOutput: true},
+			want:    []string{"[redacted]", "**Tool call** `edit_file`"},
+			notWant: []string{"Applied 1 edit", "+new", "l1"},
+		},
+		{
+			name:    "json is not truncated",
+			format:  FormatJSON,
+			opts:    Options{MaxToolOutputLines: 1},
+			want:    []string{`"format": "kontekst.transcript"`, `l1\nl2\nl3\nl4\nl5`},
+			notWant: []string{"first try", "tombstone"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := render(t, tr, tt.format, tt.opts)
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("output contains %q:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+
+	if !strings.Contains(render(t, tr, FormatJSON, Options{}), "Applied 1 edit") {
+		t.Error("redaction modified the transcript")
+	}
+}
+
+func TestImport_RoundTrip(t *testing.T) {
+	svc, id := newTestSession(t)
+
+	summary := `{"v":1,"type":"summary","ts":"2026-03-01T11:00:00Z","summary":{"content":"fixed reconnect","supersedes":2}}`
+	file, err := os.OpenFile(svc.Path(id), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(summary + "\n")
+	file.Close()
+
+	if err := svc.SetTitle(id, "Fix reconnect"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Tag(id, []string{"ws"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := FromSession(svc, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := render(t, tr, FormatJSON, Options{})
+
+	// Import on another machine.
+	target := &session.FileService{BaseDir: t.TempDir()}
+	read, err := Read(strings.NewReader(exported))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	importedID, err := Import(target, read)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if importedID == id {
+		t.Fatal("expected a new session ID")
+	}
+
+	want, err := conversation.NewSessionFile(svc.Path(id)).LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := conversation.NewSessionFile(target.Path(importedID)).LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("imported %d messages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Content != want[i].Content || got[i].Reasoning != want[i].Reasoning {
+			t.Errorf("message %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	info, err := target.Get(importedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, _ := target.GetPlan(importedID)
+	if info.DefaultAgent != "coder" || len(plan) != 1 {
+		t.Errorf("imported agent %q and plan %v", info.DefaultAgent, plan)
+	}
+	if info.Title != "Fix reconnect" || len(info.Tags) != 1 || info.Tags[0] != "ws" {
+		t.Errorf("imported title %q and tags %v", info.Title, info.Tags)
+	}
+}
+
+func TestRead_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{name: "not json", doc: "# Session", wantErr: "parse"},
+		{name: "other format", doc: `{"format":"something","version":1}`, wantErr: "not a kontekst transcript"},
+		{name: "future version", doc: `{"format":"kontekst.transcript","version":9}`, wantErr: "unsupported version 9"},
+		{name: "bad record", doc: `{"format":"kontekst.transcript","version":1,"records":[{"v":1,"type":"bogus"}]}`, wantErr: "record 0"},
+		{name: "tombstone", doc: `{"format":"kontekst.transcript","version":1,"records":[{"v":1,"type":"tombstone","tombstone":{"supersedes":1}}]}`, wantErr: "tombstones"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWriteFence(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{content: "plain", want: "```\nplain\n```\n"},
+		{content: "a ```go block```", want: "````\na ```go block```\n````\n"},
+	}
+
+	for _, tt := range tests {
+		var b strings.Builder
+		writeFence(&b, "", tt.content)
+		if b.String() != tt.want {
+			t.Errorf("writeFence(%q) = %q, want %q", tt.content, b.String(), tt.want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"md", "html", "json"} {
+		if _, err := ParseFormat(name); err != nil {
+			t.Errorf("ParseFormat(%q): %v", name, err)
+		}
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("expected error for pdf")
+	}
+}
@@ -0,0 +1,180 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/erg0nix/kontekst/internal/conversation"
+	"github.com/erg0nix/kontekst/internal/core"
+)
+
+// view is the format-independent shape of a rendered transcript.
+type view struct {
+	Title      string
+	Tags       []string
+	SessionID  core.SessionID
+	Agent      string
+	CreatedAt  time.Time
+	ExportedAt time.Time
+	Plan       []core.PlanEntry
+	Items      []item
+}
+
+type itemKind string
+
+const (
+	itemRunStart itemKind = "run_start"
+	itemRunEnd   itemKind = "run_end"
+	itemMessage  itemKind = "message"
+	itemSummary  itemKind = "summary"
+)
+
+// item is one block of the transcript: a run boundary, a message or a summary.
+type item struct {
+	Kind      itemKind
+	Index     int
+	Time      time.Time
+	Role      core.Role
+	Agent     string
+	Content   string
+	Reasoning string
+	ToolCalls []toolCallView
+	Result    *toolResultView
+	Note      string
+}
+
+type toolCallView struct {
+	Name      string
+	Arguments string
+}
+
+// toolResultView is a tool output cut to the configured number of lines.
+type toolResultView struct {
+	Name    string
+	Output  string
+	Omitted int
+	IsError bool
+	Diff    string
+}
+
+func newView(t *Transcript, opts Options) view {
+	v := view{
+		Title:      t.Title,
+		Tags:       t.Tags,
+		SessionID:  t.SessionID,
+		Agent:      t.Agent,
+		CreatedAt:  t.CreatedAt,
+		ExportedAt: t.ExportedAt,
+		Plan:       t.Plan,
+	}
+
+	index := 0
+	for _, rec := range t.Records {
+		switch rec.Type {
+		case conversation.RecordRunStart:
+			note := "Run started"
+			if rec.RunStart.AgentName != "" {
+				note += " with agent " + rec.RunStart.AgentName
+			}
+			if rec.RunStart.Model != "" {
+				note += " (" + rec.RunStart.Model + ")"
+			}
+			v.Items = append(v.Items, item{Kind: itemRunStart, Time: rec.Time, Agent: rec.RunStart.AgentName, Note: note})
+
+		case conversation.RecordRunEnd:
+			note := fmt.Sprintf("Run %s after %d turns in %s", rec.RunEnd.Outcome, rec.RunEnd.Turns,
+				(time.Duration(rec.RunEnd.DurationMS) * time.Millisecond).Round(100*time.Millisecond))
+			if rec.RunEnd.Error != "" {
+				note += ": " + rec.RunEnd.Error
+			}
+			v.Items = append(v.Items, item{Kind: itemRunEnd, Time: rec.Time, Note: note})
+
+		case conversation.RecordSummary:
+			v.Items = append(v.Items, item{Kind: itemSummary, Index: index, Time: rec.Time, Content: rec.Summary.Content})
+			index++
+
+		case conversation.RecordMessage:
+			v.Items = append(v.Items, newMessageItem(*rec.Message, index, rec.Time, opts))
+			index++
+		}
+	}
+
+	return v
+}
+
+func newMessageItem(msg core.Message, index int, at time.Time, opts Options) item {
+	it := item{
+		Kind:      itemMessage,
+		Index:     index,
+		Time:      at,
+		Role:      msg.Role,
+		Agent:     msg.AgentName,
+		Content:   msg.Content,
+		Reasoning: msg.Reasoning,
+	}
+
+	for _, call := range msg.ToolCalls {
+		args, err := json.MarshalIndent(call.Arguments, "", "  ")
+		if err != nil || len(call.Arguments) == 0 {
+			args = []byte("{}")
+		}
+		it.ToolCalls = append(it.ToolCalls, toolCallView{Name: call.Name, Arguments: string(args)})
+	}
+
+	if msg.Role == core.RoleTool {
+		result := core.ToolResult{Output: msg.Content}
+		if msg.ToolResult != nil {
+			result = *msg.ToolResult
+		}
+		output, omitted := truncateLines(result.Output, opts.MaxToolOutputLines)
+		it.Result = &toolResultView{Name: result.Name, Output: output, Omitted: omitted, IsError: result.IsError, Diff: result.Diff}
+		it.Content = ""
+	}
+
+	return it
+}
+
+// truncateLines keeps the first max lines of s and reports how many were dropped. Zero keeps everything.
+func truncateLines(s string, max int) (string, int) {
+	s = strings.TrimRight(s, "\n")
+	if max <= 0 {
+		return s, 0
+	}
+
+	lines := strings.Split(s, "\n")
+	if len(lines) <= max {
+		return s, 0
+	}
+	return strings.Join(lines[:max], "\n"), len(lines) - max
+}
+
+// Heading is the transcript's title, falling back to the session ID.
+func (v view) Heading() string {
+	if v.Title != "" {
+		return v.Title
+	}
+	return "Session " + string(v.SessionID)
+}
+
+func roleTitle(role core.Role) string {
+	switch role {
+	case core.RoleUser:
+		return "User"
+	case core.RoleAssistant:
+		return "Assistant"
+	case core.RoleTool:
+		return "Tool result"
+	case core.RoleSystem:
+		return "System"
+	}
+	return string(role)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}